@@ -0,0 +1,300 @@
+package vss
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression method of an archive.
+type Compression int
+
+// Supported compression methods.
+const (
+	NoCompression Compression = iota
+	Gzip                      // gzip stream for tar, Deflate entries for zip
+	Zstd                      // zstd stream for tar, zstd entries (method 93) for zip
+)
+
+// ArchiveOptions configures WriteTar and WriteZip.
+type ArchiveOptions struct {
+	// Include and Exclude select the files and directories to archive, as
+	// described in CopyOptions. Patterns are matched against names in fsys,
+	// not archive entry names.
+	Include []string
+	Exclude []string
+
+	// Compression is the compression method. The default is no compression.
+	Compression Compression
+
+	// Manifest is the name of an entry added at the end of the archive,
+	// which lists the SHA-256 hash and name of every archived file in the
+	// format of the sha256sum tool. No manifest is added if it is empty.
+	Manifest string
+}
+
+// WriteTar writes the file or directory tree at root in fsys to w as a tar
+// archive. Entry names are relative to root, or the base name of root if it is
+// a file. Entries use the PAX format when necessary to preserve long or
+// Unicode names and sub-second modification times. Symlinks and other
+// irregular files are skipped. Files are streamed directly from fsys, so fsys
+// should be a shadow copy file system, such as that returned by
+// ShadowCopy.FS, for a consistent archive. The compressed stream is flushed,
+// but w is not closed.
+func WriteTar(ctx context.Context, w io.Writer, fsys fs.FS, root string, opts *ArchiveOptions) error {
+	var o ArchiveOptions
+	if opts != nil {
+		o = *opts
+	}
+	a := &tarArchive{}
+	switch o.Compression {
+	case NoCompression:
+	case Gzip:
+		a.z = gzip.NewWriter(w)
+	case Zstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return fmt.Errorf("vss: failed to create zstd writer (%w)", err)
+		}
+		a.z = zw
+	default:
+		return fmt.Errorf("vss: invalid compression: %d", o.Compression)
+	}
+	if a.z != nil {
+		w = a.z
+	}
+	a.tw = tar.NewWriter(w)
+	return writeArchive(ctx, a, fsys, root, &o, time.Now)
+}
+
+// WriteZip writes the file or directory tree at root in fsys to w as a zip
+// archive. It is otherwise the same as WriteTar. Modification times are stored
+// with one second precision.
+func WriteZip(ctx context.Context, w io.Writer, fsys fs.FS, root string, opts *ArchiveOptions) error {
+	var o ArchiveOptions
+	if opts != nil {
+		o = *opts
+	}
+	a := &zipArchive{zw: zip.NewWriter(w)}
+	switch o.Compression {
+	case NoCompression:
+		a.method = zip.Store
+	case Gzip:
+		a.method = zip.Deflate
+	case Zstd:
+		a.method = zstd.ZipMethodWinZip
+		a.zw.RegisterCompressor(a.method, zstd.ZipCompressor())
+	default:
+		return fmt.Errorf("vss: invalid compression: %d", o.Compression)
+	}
+	return writeArchive(ctx, a, fsys, root, &o, time.Now)
+}
+
+// archiver writes archive entries.
+type archiver interface {
+	// create adds an entry and returns the writer of its contents. Directory
+	// names end with '/'.
+	create(name string, info fs.FileInfo) (io.Writer, error)
+
+	// close flushes the archive.
+	close() error
+}
+
+// writeArchive implements WriteTar and WriteZip using the specified clock for
+// the manifest modification time.
+func writeArchive(ctx context.Context, a archiver, fsys fs.FS, root string, opts *ArchiveOptions, now func() time.Time) error {
+	include, exclude := cleanPatterns(opts.Include), cleanPatterns(opts.Exclude)
+	var manifest bytes.Buffer
+	buf := make([]byte, 1<<20)
+	var parents []archiveDir // Directories containing the current name
+	mkdirs := func() error {
+		for i := range parents {
+			if d := &parents[i]; !d.written {
+				if _, err := a.create(d.rel+"/", d.info); err != nil {
+					return err
+				}
+				d.written = true
+			}
+		}
+		return nil
+	}
+	err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		if matchPatterns(exclude, name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		for n := len(parents); n > 0 && !strings.HasPrefix(name, parents[n-1].name+"/"); n-- {
+			parents = parents[:n-1]
+		}
+		rel := archiveName(root, name, d.IsDir())
+		if d.IsDir() {
+			if rel == "" {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			parents = append(parents, archiveDir{name: name, rel: rel, info: info})
+			if len(include) == 0 {
+				return mkdirs()
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (len(include) > 0 && !matchPatterns(include, name)) {
+			return nil
+		}
+		if err := mkdirs(); err != nil {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		w, err := a.create(rel, info)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		if _, err = io.CopyBuffer(io.MultiWriter(w, h), ctxReader{ctx, f}, buf); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), rel)
+		return nil
+	})
+	if err == nil && opts.Manifest != "" {
+		info := archiveInfo{path.Base(opts.Manifest), int64(manifest.Len()), now()}
+		var w io.Writer
+		if w, err = a.create(opts.Manifest, info); err == nil {
+			_, err = w.Write(manifest.Bytes())
+		}
+	}
+	if err = errors.Join(err, a.close()); err != nil {
+		return fmt.Errorf("vss: failed to write archive (%w)", err)
+	}
+	return nil
+}
+
+// archiveDir is a directory entry that is written before the first entry under
+// it.
+type archiveDir struct {
+	name    string
+	rel     string
+	info    fs.FileInfo
+	written bool
+}
+
+// archiveName returns the entry name of name in the tree at root, which is
+// empty for a root directory.
+func archiveName(root, name string, isDir bool) string {
+	switch {
+	case name == root && isDir:
+		return ""
+	case name == root:
+		return path.Base(name)
+	case root == ".":
+		return name
+	}
+	return name[len(root)+1:]
+}
+
+// tarArchive writes a tar archive.
+type tarArchive struct {
+	tw *tar.Writer
+	z  io.WriteCloser // Compressor or nil
+}
+
+func (a *tarArchive) create(name string, info fs.FileInfo) (io.Writer, error) {
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name, hdr.Format = name, tar.FormatPAX
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	if err = a.tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	return a.tw, nil
+}
+
+func (a *tarArchive) close() error {
+	err := a.tw.Close()
+	if a.z != nil {
+		err = errors.Join(err, a.z.Close())
+	}
+	return err
+}
+
+// zipArchive writes a zip archive.
+type zipArchive struct {
+	zw     *zip.Writer
+	method uint16
+}
+
+func (a *zipArchive) create(name string, info fs.FileInfo) (io.Writer, error) {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = name
+	if !info.IsDir() {
+		hdr.Method = a.method
+	}
+	return a.zw.CreateHeader(hdr)
+}
+
+func (a *zipArchive) close() error { return a.zw.Close() }
+
+// archiveInfo is the fs.FileInfo of a generated archive entry.
+type archiveInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+}
+
+func (fi archiveInfo) Name() string       { return fi.name }
+func (fi archiveInfo) Size() int64        { return fi.size }
+func (archiveInfo) Mode() fs.FileMode     { return 0o644 }
+func (fi archiveInfo) ModTime() time.Time { return fi.mtime }
+func (archiveInfo) IsDir() bool           { return false }
+func (archiveInfo) Sys() any              { return nil }
+
+// ctxReader is a reader that stops when its context is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
@@ -0,0 +1,208 @@
+package vss
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archiveLongName is a file name that requires a PAX header.
+var archiveLongName = strings.Repeat("ü", 60) + ".txt"
+
+// archiveFS returns copyFS with a long Unicode file name that has a sub-second
+// modification time.
+func archiveFS() fstest.MapFS {
+	fsys := copyFS()
+	fsys["C:/Users/x/"+archiveLongName] = &fstest.MapFile{
+		Data:    []byte("long"),
+		Mode:    0o644,
+		ModTime: copyTime.Add(123456789),
+	}
+	return fsys
+}
+
+// archiveEntries are the expected entries of archiveFS at "C:/Users/x"
+// excluding "*.tmp".
+var archiveEntries = []string{
+	"Cache/",
+	"Cache/c.txt",
+	"Mail/",
+	"Mail/outlook.PST",
+	"NTUSER.DAT",
+	"a.txt",
+	archiveLongName,
+	"SHA256SUMS",
+}
+
+// testManifest returns the expected manifest of archiveEntries.
+func testManifest() string {
+	var b strings.Builder
+	for _, e := range []struct{ name, data string }{
+		{"Cache/c.txt", "c"},
+		{"Mail/outlook.PST", "pst"},
+		{"NTUSER.DAT", "hive"},
+		{"a.txt", "a"},
+		{archiveLongName, "long"},
+	} {
+		h := sha256.Sum256([]byte(e.data))
+		b.WriteString(hex.EncodeToString(h[:]) + "  " + e.name + "\n")
+	}
+	return b.String()
+}
+
+func TestWriteTar(t *testing.T) {
+	opts := &ArchiveOptions{Exclude: []string{"*.tmp"}, Manifest: "SHA256SUMS"}
+	for _, c := range []Compression{NoCompression, Gzip, Zstd} {
+		opts.Compression = c
+		var buf bytes.Buffer
+		require.NoError(t, WriteTar(context.Background(), &buf, archiveFS(), "C:/Users/x", opts))
+		var r io.Reader = &buf
+		switch c {
+		case Gzip:
+			zr, err := gzip.NewReader(r)
+			require.NoError(t, err)
+			r = zr
+		case Zstd:
+			zr, err := zstd.NewReader(r)
+			require.NoError(t, err)
+			defer zr.Close()
+			r = zr
+		}
+		tr := tar.NewReader(r)
+		var names []string
+		data := make(map[string]string)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			names = append(names, hdr.Name)
+			b, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			data[hdr.Name] = string(b)
+			switch hdr.Name {
+			case archiveLongName:
+				assert.Equal(t, copyTime.Add(123456789), hdr.ModTime.UTC())
+				assert.Equal(t, archiveLongName, hdr.PAXRecords["path"])
+			case "a.txt":
+				assert.Equal(t, copyTime, hdr.ModTime.UTC())
+				assert.Equal(t, int64(0o644), hdr.Mode)
+			case "Mail/":
+				assert.Equal(t, byte(tar.TypeDir), hdr.Typeflag)
+			}
+		}
+		assert.Equal(t, archiveEntries, names, "%d", c)
+		assert.Equal(t, "a", data["a.txt"])
+		assert.Equal(t, testManifest(), data["SHA256SUMS"])
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	opts := &ArchiveOptions{Exclude: []string{"*.tmp"}, Manifest: "SHA256SUMS"}
+	for _, c := range []Compression{NoCompression, Gzip, Zstd} {
+		opts.Compression = c
+		var buf bytes.Buffer
+		require.NoError(t, WriteZip(context.Background(), &buf, archiveFS(), "C:/Users/x", opts))
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		require.NoError(t, err)
+		zr.RegisterDecompressor(zstd.ZipMethodWinZip, zstd.ZipDecompressor())
+		var names []string
+		data := make(map[string]string)
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			rc, err := f.Open()
+			require.NoError(t, err)
+			b, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			data[f.Name] = string(b)
+			if f.Name == "a.txt" {
+				assert.Equal(t, copyTime, f.Modified.UTC())
+				assert.Equal(t, map[Compression]uint16{
+					NoCompression: zip.Store,
+					Gzip:          zip.Deflate,
+					Zstd:          zstd.ZipMethodWinZip,
+				}[c], f.Method)
+			}
+		}
+		assert.Equal(t, archiveEntries, names, "%d", c)
+		assert.Equal(t, "long", data[archiveLongName])
+		assert.Equal(t, testManifest(), data["SHA256SUMS"])
+	}
+}
+
+func TestWriteArchiveFilter(t *testing.T) {
+	var buf bytes.Buffer
+	opts := &ArchiveOptions{Include: []string{"*.pst", "*.mdf"}}
+	require.NoError(t, WriteZip(context.Background(), &buf, archiveFS(), ".", opts))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{
+		"C:/",
+		"C:/Data/",
+		"C:/Data/db.mdf",
+		"C:/Users/",
+		"C:/Users/x/",
+		"C:/Users/x/Mail/",
+		"C:/Users/x/Mail/outlook.PST",
+	}, names)
+
+	// No directories without included files
+	buf.Reset()
+	opts = &ArchiveOptions{Include: []string{"*.none"}}
+	require.NoError(t, WriteZip(context.Background(), &buf, archiveFS(), ".", opts))
+	zr, err = zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Empty(t, zr.File)
+
+	// File root
+	buf.Reset()
+	require.NoError(t, WriteTar(context.Background(), &buf, archiveFS(), "C:/Data/db.mdf", nil))
+	hdr, err := tar.NewReader(&buf).Next()
+	require.NoError(t, err)
+	assert.Equal(t, "db.mdf", hdr.Name)
+}
+
+func TestWriteArchiveErrors(t *testing.T) {
+	ctx := context.Background()
+	assert.Error(t, WriteTar(ctx, io.Discard, archiveFS(), "C:/Missing", nil))
+	assert.Error(t, WriteTar(ctx, io.Discard, archiveFS(), ".", &ArchiveOptions{Compression: 3}))
+	assert.Error(t, WriteZip(ctx, io.Discard, archiveFS(), ".", &ArchiveOptions{Compression: -1}))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, WriteZip(canceled, io.Discard, archiveFS(), ".", nil), context.Canceled)
+}
+
+func TestArchiveManifestTime(t *testing.T) {
+	var buf bytes.Buffer
+	a := &tarArchive{tw: tar.NewWriter(&buf)}
+	mtime := time.Date(2024, 3, 5, 9, 7, 8, 0, time.UTC)
+	opts := &ArchiveOptions{Include: []string{"db.mdf"}, Manifest: "m/SHA256SUMS"}
+	require.NoError(t, writeArchive(context.Background(), a, archiveFS(), "C:/Data", opts, func() time.Time { return mtime }))
+	tr := tar.NewReader(&buf)
+	_, err := tr.Next()
+	require.NoError(t, err)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "m/SHA256SUMS", hdr.Name)
+	assert.Equal(t, mtime, hdr.ModTime.UTC())
+}
@@ -0,0 +1,76 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-ole/go-ole"
+)
+
+// errNotAdmin is returned when the current user lacks admin privileges.
+var errNotAdmin = fmt.Errorf("vss: do not have Administrators group privileges (%w)",
+	os.ErrPermission)
+
+// backend provides access to the shadow copy service. It allows operations
+// involving many shadow copies to share connections and tests to replace the
+// system implementation with a fake.
+type backend interface {
+	// exec calls fn with a new connection, which is closed when fn returns.
+	// The connection must not be used concurrently or after fn returns.
+	exec(ctx context.Context, fn func(c conn) error) error
+}
+
+// conn is a connection to the shadow copy service.
+type conn interface {
+	// list returns existing shadow copies. If vol is non-empty, only shadow
+	// copies for the specified volume are returned.
+	list(vol string) ([]*ShadowCopy, error)
+
+	// remove removes a shadow copy by ID.
+	remove(id ShadowID) error
+
+	// create creates a new client-accessible shadow copy of volume vol.
+	create(vol string) (*ShadowCopy, error)
+}
+
+// getNew returns the newly created shadow copy id using get. If get fails, the
+// shadow copy is removed, because the caller would not otherwise know about it.
+func getNew(id ShadowID, get func(id ShadowID) (*ShadowCopy, error), remove func(id ShadowID) error) (*ShadowCopy, error) {
+	sc, err := get(id)
+	if err != nil {
+		return nil, errors.Join(err, remove(id))
+	}
+	return sc, nil
+}
+
+// removeError returns the error for a failed removal of shadow copy id. COM
+// errors indicating that the shadow copy does not exist are converted to
+// os.ErrNotExist, which allows IDs of shadow copies that were never created to
+// be ignored.
+func removeError(id ShadowID, err error) error {
+	if isNotFound(err) {
+		err = fmt.Errorf("%w (%w)", err, os.ErrNotExist)
+	}
+	return fmt.Errorf("vss: failed to remove shadow copy ID %s (%w)", id, err)
+}
+
+// isNotFound returns whether err is a COM error with WBEM_E_NOT_FOUND or
+// VSS_E_OBJECT_NOT_FOUND status. For DISP_E_EXCEPTION, the status is taken
+// from the exception info.
+func isNotFound(err error) bool {
+	var e *ole.OleError
+	if !errors.As(err, &e) {
+		return false
+	}
+	code := uint32(e.Code())
+	if sub, ok := e.SubError().(interface{ SCODE() uint32 }); ok && code == 0x80020009 { // DISP_E_EXCEPTION
+		code = sub.SCODE()
+	}
+	switch code {
+	case 0x80041002, 0x80042308: // WBEM_E_NOT_FOUND, VSS_E_OBJECT_NOT_FOUND
+		return true
+	}
+	return false
+}
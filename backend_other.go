@@ -0,0 +1,76 @@
+//go:build !windows
+
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// errUnsupported is returned by all operations that require the shadow copy
+// service on platforms other than Windows.
+var errUnsupported = fmt.Errorf("vss: shadow copies are not supported on this platform (%w)",
+	errors.ErrUnsupported)
+
+// isAdmin returns true because privileges are only checked on Windows.
+func isAdmin() bool { return true }
+
+// setMetadata sets the permission bits of dst to those of the source file
+// described by info.
+func setMetadata(dst string, info fs.FileInfo) error {
+	return os.Chmod(dst, info.Mode().Perm())
+}
+
+// oemText returns b unchanged, because console tools only use OEM code pages
+// on Windows.
+func oemText(b []byte) ([]byte, error) { return b, nil }
+
+// unsupportedBackend is the backend for platforms other than Windows.
+type unsupportedBackend struct{}
+
+// sys is the backend used by package functions.
+var sys backend = unsupportedBackend{}
+
+// exec implements backend.
+func (unsupportedBackend) exec(context.Context, func(c conn) error) error {
+	return errUnsupported
+}
+
+// newBackupComponents returns errUnsupported.
+func newBackupComponents() (backupComponents, error) {
+	return nil, errUnsupported
+}
+
+// linkShadow returns errUnsupported.
+func linkShadow(*ShadowCopy, string) error {
+	return errUnsupported
+}
+
+// unlinkShadow returns errUnsupported.
+func unlinkShadow(string) error {
+	return errUnsupported
+}
+
+// unsupportedTopology is the topology for platforms other than Windows.
+type unsupportedTopology struct{}
+
+// sysTopology is the topology used by path translation.
+var sysTopology topology = unsupportedTopology{}
+
+// volumeOf implements topology.
+func (unsupportedTopology) volumeOf(string) (string, VolumeGUIDName, error) {
+	return "", VolumeGUIDName{}, errUnsupported
+}
+
+// paths implements topology.
+func (unsupportedTopology) paths(VolumeGUIDName) ([]string, error) {
+	return nil, errUnsupported
+}
+
+// volumes implements topology.
+func (unsupportedTopology) volumes() ([]VolumeGUIDName, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,170 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-ole/go-ole"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend is an in-memory backend for testing.
+type fakeBackend struct {
+	mu     sync.Mutex
+	all    []*ShadowCopy
+	fail   map[string]error   // Errors returned by remove (by ID) and create (by volume)
+	seq    int                // Number of created shadow copies
+	err    error              // Error returned by exec
+	errAt  func(n int32) bool // If non-nil, selects the exec calls that return err
+	execs  atomic.Int32       // Number of exec calls
+	active atomic.Int32       // Number of open connections
+	peak   atomic.Int32       // Maximum number of open connections
+}
+
+func (b *fakeBackend) exec(ctx context.Context, fn func(c conn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n := b.execs.Add(1); b.err != nil && (b.errAt == nil || b.errAt(n)) {
+		return b.err
+	}
+	n := b.active.Add(1)
+	defer b.active.Add(-1)
+	for p := b.peak.Load(); n > p && !b.peak.CompareAndSwap(p, n); p = b.peak.Load() {
+	}
+	return fn(fakeConn{b})
+}
+
+// ids returns the IDs of all remaining shadow copies.
+func (b *fakeBackend) ids() []ShadowID {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]ShadowID, 0, len(b.all))
+	for _, sc := range b.all {
+		ids = append(ids, sc.ID)
+	}
+	return ids
+}
+
+type fakeConn struct{ *fakeBackend }
+
+func (c fakeConn) list(vol string) ([]*ShadowCopy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var all []*ShadowCopy
+	for _, sc := range c.all {
+		if vol == "" || strings.EqualFold(vol, sc.VolumeName.String()) {
+			cp := *sc
+			all = append(all, &cp)
+		}
+	}
+	return all, nil
+}
+
+func (c fakeConn) remove(id ShadowID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.fail[id.String()]; err != nil {
+		return removeError(id, err)
+	}
+	for i, sc := range c.all {
+		if sc.ID == id {
+			c.all = append(c.all[:i], c.all[i+1:]...)
+			return nil
+		}
+	}
+	// SWbemServices.Delete reports a missing object as an exception
+	return removeError(id, wmiException(0x80041002))
+}
+
+// wmiException returns the error produced by IDispatch.Invoke when a WMI method
+// fails with the specified status code.
+func wmiException(code uint32) error {
+	return ole.NewErrorWithSubError(0x80020009, "", excepInfo(code))
+}
+
+// excepInfo mimics ole.EXCEPINFO, whose fields cannot be set outside of go-ole.
+type excepInfo uint32
+
+func (e excepInfo) Error() string { return fmt.Sprintf("scode: %#x", uint32(e)) }
+func (e excepInfo) SCODE() uint32 { return uint32(e) }
+
+func (c fakeConn) create(vol string) (*ShadowCopy, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.fail[vol]; err != nil {
+		return nil, fmt.Errorf("vss: failed to create shadow copy of %#q (%w)", vol, err)
+	}
+	v, err := ParseVolumeGUIDName(vol)
+	if err != nil {
+		return nil, err
+	}
+	c.seq++
+	sc := &ShadowCopy{
+		ID:           testShadowID(100 + c.seq),
+		DeviceObject: fmt.Sprintf(`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy%d`, 100+c.seq),
+		VolumeName:   v,
+	}
+	c.all = append(c.all, sc)
+	cp := *sc
+	return &cp, nil
+}
+
+func TestRemoveError(t *testing.T) {
+	id := testShadowID(1)
+	for _, err := range []error{
+		wmiException(0x80041002),
+		wmiException(0x80042308),
+		ole.NewError(0x80041002),
+	} {
+		err = removeError(id, err)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		assert.ErrorContains(t, err, id.String())
+	}
+	for _, err := range []error{
+		wmiException(0x80041001), // WBEM_E_FAILED
+		ole.NewError(0x80020009),
+		errors.New("remove"),
+	} {
+		assert.NotErrorIs(t, removeError(id, err), os.ErrNotExist)
+	}
+}
+
+func TestGetNew(t *testing.T) {
+	b := new(fakeBackend)
+	c := fakeConn{b}
+	sc, err := c.create(volC.String())
+	require.NoError(t, err)
+	get := func(id ShadowID) (*ShadowCopy, error) {
+		for _, sc := range b.all {
+			if sc.ID == id {
+				return sc, nil
+			}
+		}
+		return nil, errors.New("query failed")
+	}
+	got, err := getNew(sc.ID, get, c.remove)
+	require.NoError(t, err)
+	assert.Equal(t, sc, got)
+
+	// Query failure removes the new shadow copy
+	errQuery := errors.New("query failed")
+	_, err = getNew(sc.ID, func(ShadowID) (*ShadowCopy, error) { return nil, errQuery }, c.remove)
+	assert.ErrorIs(t, err, errQuery)
+	assert.Empty(t, b.ids())
+
+	// Removal failure is reported along with the query failure
+	sc, err = c.create(volC.String())
+	require.NoError(t, err)
+	b.fail = map[string]error{sc.ID.String(): errors.New("remove failed")}
+	_, err = getNew(sc.ID, func(ShadowID) (*ShadowCopy, error) { return nil, errQuery }, c.remove)
+	assert.ErrorIs(t, err, errQuery)
+	assert.ErrorIs(t, err, b.fail[sc.ID.String()])
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/mxk/go-vss"
+)
+
+// backend is the shadow copy service used by commands.
+type backend interface {
+	Create(vol string) (*vss.ShadowCopy, error)
+	Get(name string) (*vss.ShadowCopy, error)
+	List(vol string) ([]*vss.ShadowCopy, error)
+	Remove(name string) error
+	Link(sc *vss.ShadowCopy, name string) error
+	IsShadowCopy(name string) (bool, error)
+	SplitVolume(name string) (vol, rel string, err error)
+	Storage(ctx context.Context) ([]*vss.Storage, error)
+	Providers(ctx context.Context) ([]*vss.Provider, error)
+}
+
+// env is the environment of a command, including its parsed flags.
+type env struct {
+	ctx    context.Context
+	b      backend
+	format string
+	dryRun bool
+}
+
+// validate checks the common flags.
+func (e *env) validate() error {
+	switch e.format {
+	case formatTable, formatJSON, formatCSV:
+		return nil
+	}
+	return fmt.Errorf("vss: invalid output format %q", e.format)
+}
+
+// command is a vss subcommand.
+type command struct {
+	name     string
+	args     string // Argument synopsis
+	summary  string
+	minArgs  int
+	maxArgs  int  // Negative for unlimited
+	mutating bool // Supports -dry-run
+	run      func(e *env, args []string) (*result, error)
+}
+
+// commands are all subcommands in usage order.
+var commands = []*command{
+	{"create", "<volume>...", "Create shadow copies of volumes", 1, -1, true, runCreate},
+	{"list", "[volume]", "List shadow copies", 0, 1, false, runList},
+	{"get", "<name>...", "Show shadow copies by ID, DeviceObject, or link", 1, -1, false, runGet},
+	{"rm", "<name>...", "Remove shadow copies and their links", 1, -1, true, runRemove},
+	{"link", "<path> <volume|ID>", "Link a new or existing shadow copy at path", 2, 2, true, runLink},
+	{"is-shadow", "<path>...", "Report whether paths refer to shadow copies", 1, -1, false, runIsShadow},
+	{"split-volume", "<path>...", "Split paths into volume mount point and rest", 1, -1, false, runSplitVolume},
+	{"storage", "", "List shadow copy storage associations", 0, 0, false, runStorage},
+	{"providers", "", "List shadow copy providers", 0, 0, false, runProviders},
+}
+
+// findCommand returns the named command or nil if there is no such command.
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flags returns the command flag set, which stores flag values in e.
+func (c *command) flags(e *env) *flag.FlagSet {
+	fs := flag.NewFlagSet("vss "+c.name, flag.ContinueOnError)
+	fs.StringVar(&e.format, "format", formatTable, "output `format`: table, json, or csv")
+	fs.StringVar(&e.format, "o", formatTable, "shorthand for -format")
+	if c.mutating {
+		fs.BoolVar(&e.dryRun, "dry-run", false, "print actions without performing them")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: vss %s [flags] %s\n\n%s.\n\nFlags:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runCreate(e *env, args []string) (*result, error) {
+	if e.dryRun {
+		var plan []action
+		for _, vol := range args {
+			plan = append(plan, action{"create", vol, true})
+		}
+		return actionResult(plan), nil
+	}
+	var all []*vss.ShadowCopy
+	for _, vol := range args {
+		sc, err := e.b.Create(vol)
+		if err != nil {
+			return shadowResult(all), err
+		}
+		all = append(all, sc)
+	}
+	return shadowResult(all), nil
+}
+
+func runList(e *env, args []string) (*result, error) {
+	var vol string
+	if len(args) > 0 {
+		vol = args[0]
+	}
+	all, err := e.b.List(vol)
+	if err != nil {
+		return nil, err
+	}
+	return shadowResult(all), nil
+}
+
+func runGet(e *env, args []string) (*result, error) {
+	var all []*vss.ShadowCopy
+	var errs []error
+	for _, name := range args {
+		sc, err := e.b.Get(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		all = append(all, sc)
+	}
+	return shadowResult(all), errors.Join(errs...)
+}
+
+func runRemove(e *env, args []string) (*result, error) {
+	var done []action
+	var errs []error
+	for _, name := range args {
+		var err error
+		if e.dryRun {
+			_, err = e.b.Get(name)
+		} else {
+			err = e.b.Remove(name)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		done = append(done, action{"remove", name, e.dryRun})
+	}
+	return actionResult(done), errors.Join(errs...)
+}
+
+func runLink(e *env, args []string) (*result, error) {
+	link, target := args[0], args[1]
+	if id, err := vss.ParseShadowID(target); err == nil {
+		sc, err := e.b.Get(id.String())
+		if err != nil {
+			return nil, err
+		}
+		if e.dryRun {
+			return actionResult([]action{{"link", link + " -> " + sc.DeviceObject, true}}), nil
+		}
+		if err = e.b.Link(sc, link); err != nil {
+			return nil, err
+		}
+		return shadowResult([]*vss.ShadowCopy{sc}), nil
+	}
+	if e.dryRun {
+		return actionResult([]action{
+			{"create", target, true},
+			{"link", link, true},
+		}), nil
+	}
+	sc, err := e.b.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.b.Link(sc, link); err != nil {
+		return nil, errors.Join(err, e.b.Remove(sc.ID.String()))
+	}
+	return shadowResult([]*vss.ShadowCopy{sc}), nil
+}
+
+func runIsShadow(e *env, args []string) (*result, error) {
+	all := make([]shadowCheck, 0, len(args))
+	for _, p := range args {
+		ok, err := e.b.IsShadowCopy(p)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, shadowCheck{p, ok})
+	}
+	return checkResult(all), nil
+}
+
+func runSplitVolume(e *env, args []string) (*result, error) {
+	all := make([]volumeSplit, 0, len(args))
+	for _, p := range args {
+		vol, rel, err := e.b.SplitVolume(p)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, volumeSplit{p, vol, rel})
+	}
+	return splitResult(all), nil
+}
+
+func runStorage(e *env, _ []string) (*result, error) {
+	all, err := e.b.Storage(e.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storageResult(all), nil
+}
+
+func runProviders(e *env, _ []string) (*result, error) {
+	all, err := e.b.Providers(e.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return providerResult(all), nil
+}
@@ -0,0 +1,139 @@
+// Command vss manages Windows Volume Shadow Copies.
+//
+// Usage:
+//
+//	vss <command> [flags] [args]
+//
+// Commands:
+//
+//	create <volume>...          Create shadow copies of volumes
+//	list [volume]               List shadow copies
+//	get <name>...               Show shadow copies by ID, DeviceObject, or link
+//	rm <name>...                Remove shadow copies and their links
+//	link <path> <volume|ID>     Link a new or existing shadow copy at path
+//	is-shadow <path>...         Report whether paths refer to shadow copies
+//	split-volume <path>...      Split paths into volume mount point and rest
+//	storage                     List shadow copy storage associations
+//	providers                   List shadow copy providers
+//
+// All commands accept -o (or -format) to select table, json, or csv output.
+// Mutating commands (create, rm, link) accept -dry-run to print what would be
+// done without doing it.
+//
+// Exit codes:
+//
+//	0      Success
+//	1      is-shadow found a path that is not a shadow copy
+//	2      Invalid command line
+//	3      Other error
+//	4      Permission denied; run as administrator
+//	5      Shadow copy, volume, or path not found
+//	16+N   Win32_ShadowCopy.Create failed with error code N (see vss.CreateError)
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/mxk/go-vss"
+)
+
+// Exit codes.
+const (
+	exitOK         = 0
+	exitFalse      = 1
+	exitUsage      = 2
+	exitError      = 3
+	exitPermission = 4
+	exitNotExist   = 5
+	exitCreate     = 16
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, sys, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run executes the command line args and returns the exit code.
+func run(ctx context.Context, b backend, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		printUsage(stdout)
+		return exitOK
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "vss: unknown command %q\n", name)
+		printUsage(stderr)
+		return exitUsage
+	}
+	e := &env{ctx: ctx, b: b}
+	fs := cmd.flags(e)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := e.validate(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if n := fs.NArg(); n < cmd.minArgs || (cmd.maxArgs >= 0 && n > cmd.maxArgs) {
+		fmt.Fprintf(stderr, "vss: invalid number of arguments for %s\n", cmd.name)
+		fs.Usage()
+		return exitUsage
+	}
+	r, err := cmd.run(e, fs.Args())
+	if r != nil {
+		if werr := r.write(stdout, e.format); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitCode(err)
+	}
+	if r != nil && r.negative {
+		return exitFalse
+	}
+	return exitOK
+}
+
+// exitCode returns the exit code for a command error.
+func exitCode(err error) int {
+	var ce vss.CreateError
+	switch {
+	case errors.As(err, &ce) && ce != 0:
+		return exitCreate + int(ce)
+	case errors.Is(err, os.ErrPermission):
+		return exitPermission
+	case errors.Is(err, os.ErrNotExist):
+		return exitNotExist
+	}
+	return exitError
+}
+
+// printUsage writes the command summary to w.
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: vss <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-26s %s\n", c.name+" "+c.args, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "vss <command> -h" for command flags.`)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-vss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend is an in-memory backend for testing.
+type fakeBackend struct {
+	all       []*vss.ShadowCopy
+	links     map[string]vss.ShadowID
+	createErr error
+	linkErr   error
+	calls     []string
+}
+
+func newFakeBackend() *fakeBackend {
+	b := &fakeBackend{links: make(map[string]vss.ShadowID)}
+	for i := 1; i <= 2; i++ {
+		b.add(fmt.Sprintf(`\\?\Volume{%08d-0000-0000-0000-000000000000}\`, i))
+	}
+	return b
+}
+
+func (b *fakeBackend) add(vol string) (*vss.ShadowCopy, error) {
+	v, err := vss.ParseVolumeGUIDName(vol)
+	if err != nil {
+		return nil, fmt.Errorf("vss: invalid volume (%w)", os.ErrNotExist)
+	}
+	n := len(b.all) + 1
+	sc := &vss.ShadowCopy{
+		ID:           mustParse(vss.ParseShadowID(fmt.Sprintf("{00000000-0000-0000-0000-%012d}", n))),
+		SetID:        mustParse(vss.ParseSetID(fmt.Sprintf("{10000000-0000-0000-0000-%012d}", n))),
+		InstallDate:  time.Date(2024, 1, 31, 13, 45, n, 0, time.UTC),
+		DeviceObject: fmt.Sprintf(`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy%d`, n),
+		VolumeName:   v,
+	}
+	b.all = append(b.all, sc)
+	return sc, nil
+}
+
+func (b *fakeBackend) find(name string) int {
+	for i, sc := range b.all {
+		if sc.ID.String() == name || sc.DeviceObject == name || b.links[name] == sc.ID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *fakeBackend) Create(vol string) (*vss.ShadowCopy, error) {
+	b.calls = append(b.calls, "create "+vol)
+	if b.createErr != nil {
+		return nil, b.createErr
+	}
+	return b.add(vol)
+}
+
+func (b *fakeBackend) Get(name string) (*vss.ShadowCopy, error) {
+	if i := b.find(name); i >= 0 {
+		return b.all[i], nil
+	}
+	return nil, fmt.Errorf("vss: shadow copy not found: %s (%w)", name, os.ErrNotExist)
+}
+
+func (b *fakeBackend) List(vol string) ([]*vss.ShadowCopy, error) {
+	var all []*vss.ShadowCopy
+	for _, sc := range b.all {
+		if vol == "" || vol == sc.VolumeName.String() {
+			all = append(all, sc)
+		}
+	}
+	return all, nil
+}
+
+func (b *fakeBackend) Remove(name string) error {
+	b.calls = append(b.calls, "remove "+name)
+	i := b.find(name)
+	if i < 0 {
+		return fmt.Errorf("vss: shadow copy not found: %s (%w)", name, os.ErrNotExist)
+	}
+	b.all = append(b.all[:i], b.all[i+1:]...)
+	delete(b.links, name)
+	return nil
+}
+
+func (b *fakeBackend) Link(sc *vss.ShadowCopy, name string) error {
+	b.calls = append(b.calls, "link "+name)
+	if b.linkErr != nil {
+		return b.linkErr
+	}
+	b.links[name] = sc.ID
+	return nil
+}
+
+func (b *fakeBackend) IsShadowCopy(name string) (bool, error) {
+	return b.find(name) >= 0, nil
+}
+
+func (b *fakeBackend) SplitVolume(name string) (string, string, error) {
+	if len(name) < 3 || name[1:3] != `:\` {
+		return "", "", fmt.Errorf("vss: non-absolute path: %s", name)
+	}
+	return name[:3], name[3:], nil
+}
+
+func (b *fakeBackend) Storage(context.Context) ([]*vss.Storage, error) {
+	return []*vss.Storage{{
+		Volume:         b.all[0].VolumeName,
+		DiffVolume:     b.all[0].VolumeName,
+		AllocatedSpace: 2048,
+		UsedSpace:      1024,
+		MaxSpace:       vss.UnboundedSpace,
+	}}, nil
+}
+
+func (b *fakeBackend) Providers(context.Context) ([]*vss.Provider, error) {
+	return []*vss.Provider{{
+		ID:      "{B5946137-7B9F-4925-AF80-51ABD60B20D5}",
+		Name:    "Microsoft Software Shadow Copy provider 1.0",
+		Type:    vss.ProviderSystem,
+		Version: "1.0.0.7",
+	}}, nil
+}
+
+func mustParse[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// vssRun runs the command line and returns the exit code and outputs.
+func vssRun(b backend, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), b, args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestList(t *testing.T) {
+	b := newFakeBackend()
+	code, out, _ := vssRun(b, "list")
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, strings.Join([]string{
+		`ID                                      SetID                                   InstallDate           VolumeName                                         DeviceObject                                     ExposedName`,
+		`{00000000-0000-0000-0000-000000000001}  {10000000-0000-0000-0000-000000000001}  2024-01-31T13:45:01Z  \\?\Volume{00000001-0000-0000-0000-000000000000}\  \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1  `,
+		`{00000000-0000-0000-0000-000000000002}  {10000000-0000-0000-0000-000000000002}  2024-01-31T13:45:02Z  \\?\Volume{00000002-0000-0000-0000-000000000000}\  \\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy2  `,
+		``,
+	}, "\n"), out)
+
+	code, out, _ = vssRun(b, "list", "-o", "json", `\\?\Volume{00000002-0000-0000-0000-000000000000}\`)
+	require.Equal(t, exitOK, code)
+	var all []*vss.ShadowCopy
+	require.NoError(t, json.Unmarshal([]byte(out), &all))
+	assert.Equal(t, b.all[1:], all)
+
+	code, out, _ = vssRun(b, "list", "-format=csv", `\\?\Volume{00000003-0000-0000-0000-000000000000}\`)
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, "ID,SetID,InstallDate,VolumeName,DeviceObject,ExposedName\n", out)
+
+	code, out, _ = vssRun(b, "list", "-o", "json", "X:")
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, "[]\n", out)
+}
+
+func TestCreate(t *testing.T) {
+	b := newFakeBackend()
+	vol := `\\?\Volume{00000003-0000-0000-0000-000000000000}\`
+	code, out, _ := vssRun(b, "create", "-dry-run", "-o", "csv", vol)
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, "Action,Target,DryRun\ncreate,"+vol+",true\n", out)
+	assert.Empty(t, b.calls)
+
+	code, out, _ = vssRun(b, "create", "-o", "csv", vol)
+	require.Equal(t, exitOK, code)
+	assert.Contains(t, out, `{00000000-0000-0000-0000-000000000003}`)
+	assert.Len(t, b.all, 3)
+
+	b.createErr = fmt.Errorf("vss: Win32_ShadowCopy.Create returned 8 (%w)", vss.CreateError(8))
+	code, _, errOut := vssRun(b, "create", vol)
+	assert.Equal(t, exitCreate+8, code)
+	assert.Contains(t, errOut, "Maximum number of shadow copies reached")
+}
+
+func TestRemove(t *testing.T) {
+	b := newFakeBackend()
+	id := b.all[0].ID.String()
+	code, out, _ := vssRun(b, "rm", "-dry-run", "-o", "json", id)
+	require.Equal(t, exitOK, code)
+	assert.JSONEq(t, `[{"action": "remove", "target": "`+id+`", "dryRun": true}]`, out)
+	assert.Empty(t, b.calls)
+
+	code, _, errOut := vssRun(b, "rm", "-dry-run", "{00000000-0000-0000-0000-000000000009}")
+	assert.Equal(t, exitNotExist, code)
+	assert.Contains(t, errOut, "not found")
+
+	code, _, _ = vssRun(b, "rm", id, b.all[1].DeviceObject)
+	require.Equal(t, exitOK, code)
+	assert.Empty(t, b.all)
+}
+
+func TestLink(t *testing.T) {
+	b := newFakeBackend()
+	vol := `\\?\Volume{00000003-0000-0000-0000-000000000000}\`
+	code, out, _ := vssRun(b, "link", "-dry-run", "-o", "csv", `C:\snap`, vol)
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, "Action,Target,DryRun\ncreate,"+vol+",true\nlink,C:\\snap,true\n", out)
+	assert.Empty(t, b.calls)
+
+	code, _, _ = vssRun(b, "link", `C:\snap`, vol)
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, b.all[2].ID, b.links[`C:\snap`])
+
+	id := b.all[0].ID.String()
+	code, _, _ = vssRun(b, "link", `C:\old`, id)
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, b.all[0].ID, b.links[`C:\old`])
+
+	// Link failure removes the new shadow copy
+	b.linkErr = fmt.Errorf("vss: link failed (%w)", os.ErrPermission)
+	b.calls = nil
+	code, _, _ = vssRun(b, "link", `C:\new`, vol)
+	assert.Equal(t, exitPermission, code)
+	assert.Equal(t, []string{"create " + vol, `link C:\new`, "remove {00000000-0000-0000-0000-000000000004}"}, b.calls)
+	assert.Len(t, b.all, 3)
+}
+
+func TestIsShadow(t *testing.T) {
+	b := newFakeBackend()
+	code, out, _ := vssRun(b, "is-shadow", "-o", "csv", b.all[0].DeviceObject)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "Path,IsShadowCopy\n"+b.all[0].DeviceObject+",true\n", out)
+	code, _, _ = vssRun(b, "is-shadow", b.all[0].DeviceObject, `C:\`)
+	assert.Equal(t, exitFalse, code)
+}
+
+func TestSplitVolume(t *testing.T) {
+	code, out, _ := vssRun(newFakeBackend(), "split-volume", "-o", "json", `C:\Windows\System32`)
+	require.Equal(t, exitOK, code)
+	assert.JSONEq(t, `[{"path": "C:\\Windows\\System32", "volume": "C:\\", "relative": "Windows\\System32"}]`, out)
+	code, _, _ = vssRun(newFakeBackend(), "split-volume", `Windows`)
+	assert.Equal(t, exitError, code)
+}
+
+func TestStorageProviders(t *testing.T) {
+	code, out, _ := vssRun(newFakeBackend(), "storage", "-o", "csv")
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, "Volume,DiffVolume,UsedSpace,AllocatedSpace,MaxSpace\n"+
+		`\\?\Volume{00000001-0000-0000-0000-000000000000}\,\\?\Volume{00000001-0000-0000-0000-000000000000}\,1024,2048,UNBOUNDED`+"\n", out)
+
+	code, out, _ = vssRun(newFakeBackend(), "providers")
+	require.Equal(t, exitOK, code)
+	assert.Equal(t, strings.Join([]string{
+		"Name                                         Type    Version  ID",
+		"Microsoft Software Shadow Copy provider 1.0  System  1.0.0.7  {B5946137-7B9F-4925-AF80-51ABD60B20D5}",
+		"",
+	}, "\n"), out)
+}
+
+func TestUsage(t *testing.T) {
+	b := newFakeBackend()
+	for _, args := range [][]string{
+		nil,
+		{"frobnicate"},
+		{"list", "-o", "xml"},
+		{"list", "a", "b"},
+		{"get"},
+		{"list", "-dry-run"},
+		{"storage", "x"},
+	} {
+		code, out, errOut := vssRun(b, args...)
+		assert.Equal(t, exitUsage, code, "%q", args)
+		assert.Empty(t, out)
+		assert.NotEmpty(t, errOut)
+	}
+	code, out, _ := vssRun(b, "help")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "split-volume <path>...")
+	code, _, errOut := vssRun(b, "rm", "-h")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, errOut, "-dry-run")
+	assert.Empty(t, b.calls)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitError, exitCode(errors.New("x")))
+	assert.Equal(t, exitPermission, exitCode(fmt.Errorf("x (%w)", os.ErrPermission)))
+	assert.Equal(t, exitNotExist, exitCode(fmt.Errorf("x (%w)", os.ErrNotExist)))
+	assert.Equal(t, exitCreate+1, exitCode(fmt.Errorf("x (%w)", vss.CreateError(1))))
+	assert.Equal(t, exitCreate+13, exitCode(errors.Join(errors.New("x"), vss.CreateError(13))))
+}
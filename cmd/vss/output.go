@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mxk/go-vss"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// result is the output of a command. Table and CSV formats use cols and rows,
+// while JSON encodes v.
+type result struct {
+	cols     []string
+	rows     [][]string
+	v        any
+	negative bool // Command evaluated to false
+}
+
+// write writes the result to w in the specified format.
+func (r *result) write(w io.Writer, format string) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r.v)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		_ = cw.Write(r.cols)
+		_ = cw.WriteAll(r.rows)
+		return cw.Error()
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, row := range append([][]string{r.cols}, r.rows...) {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("vss: invalid output format %q", format)
+}
+
+// shadowResult returns the result listing shadow copies. The JSON output
+// includes the volume path, which is resolved once per volume.
+func shadowResult(all []*vss.ShadowCopy) *result {
+	v := make([]vss.ShadowCopyJSON, 0, len(all))
+	paths := make(map[vss.VolumeGUIDName]string)
+	r := &result{
+		cols: []string{"ID", "SetID", "InstallDate", "VolumeName", "DeviceObject", "ExposedName"},
+	}
+	for _, sc := range all {
+		p, ok := paths[sc.VolumeName]
+		if !ok && !sc.VolumeName.IsZero() {
+			p, _ = sc.VolumePath()
+			paths[sc.VolumeName] = p
+		}
+		v = append(v, vss.ShadowCopyJSON{ShadowCopy: sc, VolumePath: p})
+		r.rows = append(r.rows, []string{
+			sc.ID.String(),
+			sc.SetID.String(),
+			sc.InstallDate.Format(time.RFC3339),
+			sc.VolumeName.String(),
+			sc.DeviceObject,
+			sc.ExposedName,
+		})
+	}
+	r.v = v
+	return r
+}
+
+// action is an operation performed or, in dry-run mode, planned by a command.
+type action struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// actionResult returns the result listing actions.
+func actionResult(all []action) *result {
+	if all == nil {
+		all = []action{}
+	}
+	r := &result{cols: []string{"Action", "Target", "DryRun"}, v: all}
+	for _, a := range all {
+		r.rows = append(r.rows, []string{a.Action, a.Target, strconv.FormatBool(a.DryRun)})
+	}
+	return r
+}
+
+// shadowCheck is the is-shadow result for one path.
+type shadowCheck struct {
+	Path         string `json:"path"`
+	IsShadowCopy bool   `json:"isShadowCopy"`
+}
+
+// checkResult returns the is-shadow result.
+func checkResult(all []shadowCheck) *result {
+	r := &result{cols: []string{"Path", "IsShadowCopy"}, v: all}
+	for _, c := range all {
+		r.rows = append(r.rows, []string{c.Path, strconv.FormatBool(c.IsShadowCopy)})
+		r.negative = r.negative || !c.IsShadowCopy
+	}
+	return r
+}
+
+// volumeSplit is the split-volume result for one path.
+type volumeSplit struct {
+	Path     string `json:"path"`
+	Volume   string `json:"volume"`
+	Relative string `json:"relative"`
+}
+
+// splitResult returns the split-volume result.
+func splitResult(all []volumeSplit) *result {
+	r := &result{cols: []string{"Path", "Volume", "Relative"}, v: all}
+	for _, s := range all {
+		r.rows = append(r.rows, []string{s.Path, s.Volume, s.Relative})
+	}
+	return r
+}
+
+// storageResult returns the result listing storage associations.
+func storageResult(all []*vss.Storage) *result {
+	if all == nil {
+		all = []*vss.Storage{}
+	}
+	r := &result{
+		cols: []string{"Volume", "DiffVolume", "UsedSpace", "AllocatedSpace", "MaxSpace"},
+		v:    all,
+	}
+	for _, s := range all {
+		limit := "UNBOUNDED"
+		if s.MaxSpace != vss.UnboundedSpace {
+			limit = strconv.FormatUint(s.MaxSpace, 10)
+		}
+		r.rows = append(r.rows, []string{
+			s.Volume.String(),
+			s.DiffVolume.String(),
+			strconv.FormatUint(s.UsedSpace, 10),
+			strconv.FormatUint(s.AllocatedSpace, 10),
+			limit,
+		})
+	}
+	return r
+}
+
+// providerResult returns the result listing providers.
+func providerResult(all []*vss.Provider) *result {
+	if all == nil {
+		all = []*vss.Provider{}
+	}
+	r := &result{cols: []string{"Name", "Type", "Version", "ID"}, v: all}
+	for _, p := range all {
+		r.rows = append(r.rows, []string{p.Name, p.Type.String(), p.Version, p.ID})
+	}
+	return r
+}
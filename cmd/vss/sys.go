@@ -0,0 +1,45 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mxk/go-vss"
+)
+
+// sysBackend is the backend implemented by package vss.
+type sysBackend struct{}
+
+// sys is the backend used by main.
+var sys backend = sysBackend{}
+
+// Create creates a shadow copy of vol and returns its properties. The shadow
+// copy is removed if its properties cannot be read.
+func (sysBackend) Create(vol string) (*vss.ShadowCopy, error) {
+	id, err := vss.Create(vol)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := vss.Get(id.String())
+	if err != nil {
+		return nil, errors.Join(err, vss.Remove(id.String()))
+	}
+	return sc, nil
+}
+
+func (sysBackend) Get(name string) (*vss.ShadowCopy, error)        { return vss.Get(name) }
+func (sysBackend) List(vol string) ([]*vss.ShadowCopy, error)      { return vss.List(vol) }
+func (sysBackend) Remove(name string) error                        { return vss.Remove(name) }
+func (sysBackend) Link(sc *vss.ShadowCopy, name string) error      { return sc.Link(name) }
+func (sysBackend) IsShadowCopy(name string) (bool, error)          { return vss.IsShadowCopy(name) }
+func (sysBackend) SplitVolume(name string) (string, string, error) { return vss.SplitVolume(name) }
+
+func (sysBackend) Storage(ctx context.Context) ([]*vss.Storage, error) {
+	return vss.ListStorage(ctx)
+}
+
+func (sysBackend) Providers(ctx context.Context) ([]*vss.Provider, error) {
+	return vss.ListProviders(ctx)
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mxk/go-vss"
+)
+
+// errUnsupported is returned by all backend operations on platforms other than
+// Windows.
+var errUnsupported = fmt.Errorf("vss: shadow copies are not supported on this platform (%w)",
+	errors.ErrUnsupported)
+
+// unsupportedBackend is the backend for platforms other than Windows.
+type unsupportedBackend struct{}
+
+// sys is the backend used by main.
+var sys backend = unsupportedBackend{}
+
+func (unsupportedBackend) Create(string) (*vss.ShadowCopy, error)     { return nil, errUnsupported }
+func (unsupportedBackend) Get(string) (*vss.ShadowCopy, error)        { return nil, errUnsupported }
+func (unsupportedBackend) List(string) ([]*vss.ShadowCopy, error)     { return nil, errUnsupported }
+func (unsupportedBackend) Remove(string) error                        { return errUnsupported }
+func (unsupportedBackend) Link(*vss.ShadowCopy, string) error         { return errUnsupported }
+func (unsupportedBackend) IsShadowCopy(string) (bool, error)          { return false, errUnsupported }
+func (unsupportedBackend) SplitVolume(string) (string, string, error) { return "", "", errUnsupported }
+
+func (unsupportedBackend) Storage(context.Context) ([]*vss.Storage, error) {
+	return nil, errUnsupported
+}
+
+func (unsupportedBackend) Providers(context.Context) ([]*vss.Provider, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,421 @@
+package vss
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// BackupComponents is a parsed VSS Backup Components Document, which records
+// the state of a backup operation and is required to restore writer data.
+// See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/vss/backup-components-document
+type BackupComponents struct {
+	SetID               SetID
+	BackupType          BackupType
+	SelectComponents    bool
+	BootableSystemState bool
+	PartialFileSupport  bool
+	Writers             []*WriterComponents
+	Snapshots           []SnapshotDescription
+
+	doc string // Original XML document, if any
+}
+
+// WriterComponents lists the components of a writer included in a backup.
+type WriterComponents struct {
+	WriterID   string
+	InstanceID string
+	Components []ComponentBackup
+}
+
+// ComponentBackup is the backup state of a writer component.
+type ComponentBackup struct {
+	Type                ComponentType
+	LogicalPath         string
+	Name                string
+	BackupSucceeded     bool
+	BackupOptions       string
+	BackupStamp         string
+	PreviousBackupStamp string
+}
+
+// FullPath returns the component's logical path joined with its name.
+func (c *ComponentBackup) FullPath() string {
+	return fullPath(c.LogicalPath, c.Name)
+}
+
+// SnapshotDescription describes a shadow copy in the backup's shadow copy set.
+type SnapshotDescription struct {
+	ID           ShadowID
+	ProviderID   string
+	Attributes   uint32
+	VolumeName   VolumeGUIDName
+	DeviceObject string
+}
+
+// ParseBackupComponents parses a Backup Components Document in XML format, as
+// returned by IVssBackupComponents::SaveAsXML. The original document is
+// retained and written by WriteTo.
+func ParseBackupComponents(r io.Reader) (*BackupComponents, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("vss: failed to read backup components document (%w)", err)
+	}
+	return parseBackupComponents(string(b))
+}
+
+// parseBackupComponents parses a Backup Components Document and retains it.
+func parseBackupComponents(doc string) (*BackupComponents, error) {
+	var x xmlBackupComponents
+	if err := decodeXML(strings.NewReader(doc), &x); err != nil {
+		return nil, fmt.Errorf("vss: failed to parse backup components document (%w)", err)
+	}
+	if x.XMLName.Local != "BACKUP_COMPONENTS" {
+		return nil, fmt.Errorf("vss: invalid backup components root element: %s", x.XMLName.Local)
+	}
+	bt, err := parseBackupType(x.BackupType)
+	if err != nil {
+		return nil, err
+	}
+	bc := &BackupComponents{
+		BackupType:          bt,
+		SelectComponents:    bool(x.SelectComponents),
+		BootableSystemState: bool(x.BootableSystemState),
+		PartialFileSupport:  bool(x.PartialFileSupport),
+		doc:                 doc,
+	}
+	for _, xw := range x.Writers {
+		w := &WriterComponents{WriterID: xw.WriterID, InstanceID: xw.InstanceID}
+		for _, xc := range xw.Components {
+			c := ComponentBackup{
+				LogicalPath:         xc.LogicalPath,
+				Name:                xc.ComponentName,
+				BackupSucceeded:     bool(xc.BackupSucceeded),
+				BackupOptions:       xc.BackupOptions,
+				BackupStamp:         xc.BackupStamp,
+				PreviousBackupStamp: xc.PreviousBackupStamp,
+			}
+			if c.Type, err = parseComponentType(xc.ComponentType); err != nil {
+				return nil, fmt.Errorf("vss: invalid type of component %s (%w)", c.FullPath(), err)
+			}
+			w.Components = append(w.Components, c)
+		}
+		bc.Writers = append(bc.Writers, w)
+	}
+	setID := x.SnapshotSetID
+	var snaps []xmlSnapshotDescription
+	if x.SnapshotSet != nil {
+		if setID == "" {
+			setID = x.SnapshotSet.SnapshotSetID
+		}
+		snaps = x.SnapshotSet.Snapshots
+	}
+	if err = bc.SetID.UnmarshalText([]byte(setID)); err != nil {
+		return nil, err
+	}
+	for _, xs := range snaps {
+		s := SnapshotDescription{
+			ProviderID:   xs.ProviderID,
+			DeviceObject: xs.DeviceName,
+		}
+		if err = s.ID.UnmarshalText([]byte(xs.SnapshotID)); err != nil {
+			return nil, err
+		}
+		if err = s.VolumeName.UnmarshalText([]byte(xs.OriginalVolumeName)); err != nil {
+			return nil, err
+		}
+		if xs.SnapshotAttributes != "" {
+			a, err := strconv.ParseUint(xs.SnapshotAttributes, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("vss: invalid snapshotAttributes of %s: %s", xs.SnapshotID, xs.SnapshotAttributes)
+			}
+			s.Attributes = uint32(a)
+		}
+		bc.Snapshots = append(bc.Snapshots, s)
+	}
+	return bc, nil
+}
+
+// WriteTo writes the document in XML format. Documents created by VSS or
+// parsed by ParseBackupComponents are written verbatim to preserve writer
+// private data, so any changes to their fields are not reflected. Other
+// documents are encoded from their fields.
+func (b *BackupComponents) WriteTo(w io.Writer) (int64, error) {
+	doc, err := b.xml()
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.WriteString(w, doc)
+	return int64(n), err
+}
+
+// xml returns the document in XML format.
+func (b *BackupComponents) xml() (string, error) {
+	if b.doc != "" {
+		return b.doc, nil
+	}
+	bt, ok := backupTypeNames[b.BackupType]
+	if !ok {
+		return "", fmt.Errorf("vss: invalid backup type: %d", b.BackupType)
+	}
+	x := xmlBackupComponents{
+		XMLName:             xml.Name{Space: "x-schema:#VssComponentMetadata", Local: "BACKUP_COMPONENTS"},
+		Version:             "1.2",
+		BootableSystemState: xmlBool(b.BootableSystemState),
+		SelectComponents:    xmlBool(b.SelectComponents),
+		BackupType:          bt,
+		PartialFileSupport:  xmlBool(b.PartialFileSupport),
+		SnapshotSetID:       idText(b.SetID),
+	}
+	for _, w := range b.Writers {
+		xw := xmlWriterComponents{WriterID: w.WriterID, InstanceID: w.InstanceID}
+		for _, c := range w.Components {
+			typ, ok := componentTypeNames[c.Type]
+			if !ok {
+				return "", fmt.Errorf("vss: invalid type of component %s: %s", c.FullPath(), c.Type)
+			}
+			xw.Components = append(xw.Components, xmlComponentBackup{
+				LogicalPath:         c.LogicalPath,
+				ComponentName:       c.Name,
+				ComponentType:       typ,
+				BackupSucceeded:     xmlBool(c.BackupSucceeded),
+				BackupOptions:       c.BackupOptions,
+				BackupStamp:         c.BackupStamp,
+				PreviousBackupStamp: c.PreviousBackupStamp,
+			})
+		}
+		x.Writers = append(x.Writers, xw)
+	}
+	if len(b.Snapshots) > 0 {
+		x.SnapshotSet = &xmlSnapshotSet{SnapshotSetID: idText(b.SetID)}
+		for _, s := range b.Snapshots {
+			x.SnapshotSet.Snapshots = append(x.SnapshotSet.Snapshots, xmlSnapshotDescription{
+				SnapshotID:         idText(s.ID),
+				ProviderID:         s.ProviderID,
+				SnapshotAttributes: fmt.Sprintf("0x%X", s.Attributes),
+				OriginalVolumeName: idText(s.VolumeName),
+				DeviceName:         s.DeviceObject,
+			})
+		}
+	}
+	out, err := xml.MarshalIndent(&x, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("vss: failed to encode backup components document (%w)", err)
+	}
+	return xml.Header + string(out), nil
+}
+
+// Validate verifies that every component in the document is described by the
+// writer metadata and that each of its file specifications matches at least one
+// captured file. Files are specified by their full path on the original volume.
+// Environment variables in file specification paths, such as %SystemRoot%, are
+// expanded using env, as in NewFileMatcher. All problems are reported as a
+// joined error.
+func (b *BackupComponents) Validate(writers []*WriterMetadata, files, env []string) error {
+	var errs []error
+	for _, w := range b.Writers {
+		wm := findWriter(writers, w)
+		if wm == nil {
+			errs = append(errs, fmt.Errorf("vss: no metadata for writer %s", w.WriterID))
+			continue
+		}
+		for i := range w.Components {
+			c := &w.Components[i]
+			comp := findComponent(wm, c)
+			if comp == nil {
+				errs = append(errs, fmt.Errorf("vss: component %s not found in metadata of writer %s",
+					c.FullPath(), wm.Name))
+				continue
+			}
+			for _, specs := range [][]FileSpec{comp.Files, comp.LogFiles} {
+				for _, fs := range specs {
+					m, err := NewFileMatcher([]FileSpec{fs}, env)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("vss: invalid file specification of component %s of writer %s (%w)",
+							c.FullPath(), wm.Name, err))
+					} else if !matchAny(m, files) {
+						errs = append(errs, fmt.Errorf("vss: no files captured for %s\\%s of component %s of writer %s",
+							strings.TrimRight(fs.Path, `\`), fs.FileSpec, c.FullPath(), wm.Name))
+					}
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findWriter returns the metadata of writer w. A matching instance ID is
+// preferred over a matching writer ID.
+func findWriter(all []*WriterMetadata, w *WriterComponents) (match *WriterMetadata) {
+	for _, wm := range all {
+		if guidEqual(wm.WriterID, w.WriterID) {
+			if w.InstanceID == "" || guidEqual(wm.InstanceID, w.InstanceID) {
+				return wm
+			}
+			if match == nil {
+				match = wm
+			}
+		}
+	}
+	return
+}
+
+// findComponent returns the component of wm identified by c.
+func findComponent(wm *WriterMetadata, c *ComponentBackup) *Component {
+	for _, comp := range wm.Components {
+		if strings.EqualFold(comp.FullPath(), c.FullPath()) {
+			return comp
+		}
+	}
+	return nil
+}
+
+// matchAny returns whether m matches any of the files.
+func matchAny(m *FileMatcher, files []string) bool {
+	for _, f := range files {
+		if m.Match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore restores writer data backed up with the Backup Components Document
+// read from r. It initializes a restore operation with the document, selects
+// all components for restore, notifies the writers, calls fn to restore the
+// files, and notifies the writers that the restore is complete. The writers
+// are notified even if fn fails.
+func Restore(ctx context.Context, r io.Reader, fn func(*BackupComponents) error) error {
+	doc, err := ParseBackupComponents(r)
+	if err != nil {
+		return err
+	}
+	bc, err := newBackupComponents()
+	if err != nil {
+		return err
+	}
+	defer bc.Release()
+	return restore(ctx, bc, doc, fn)
+}
+
+// restore implements Restore.
+func restore(ctx context.Context, bc backupComponents, doc *BackupComponents, fn func(*BackupComponents) error) (err error) {
+	x, err := doc.xml()
+	if err != nil {
+		return err
+	}
+	if err = bc.InitializeForRestore(x); err != nil {
+		return err
+	}
+	if err = bc.GatherWriterMetadata(ctx); err != nil {
+		return err
+	}
+	if doc.SelectComponents {
+		for _, w := range doc.Writers {
+			for i := range w.Components {
+				c := &w.Components[i]
+				if err = bc.SetSelectedForRestore(w.WriterID, c.Type, c.LogicalPath, c.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err = bc.PreRestore(ctx); err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, bc.PostRestore(ctx)) }()
+	return fn(doc)
+}
+
+// backupTypeNames maps backup types to their document representation.
+var backupTypeNames = map[BackupType]string{
+	BackupCopy:         "copy",
+	BackupFull:         "full",
+	BackupIncremental:  "incremental",
+	BackupDifferential: "differential",
+	BackupLog:          "log",
+	BackupOther:        "other",
+}
+
+// parseBackupType parses the backupType document attribute.
+func parseBackupType(s string) (BackupType, error) {
+	for t, name := range backupTypeNames {
+		if strings.EqualFold(s, name) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("vss: invalid backup type: %q", s)
+}
+
+// componentTypeNames maps component types to their document representation.
+var componentTypeNames = map[ComponentType]string{
+	ComponentDatabase:  "database",
+	ComponentFileGroup: "filegroup",
+}
+
+// parseComponentType parses the componentType document attribute.
+func parseComponentType(s string) (ComponentType, error) {
+	switch strings.ToLower(s) {
+	case "database":
+		return ComponentDatabase, nil
+	case "filegroup", "file_group":
+		return ComponentFileGroup, nil
+	}
+	return "", fmt.Errorf("unknown component type: %q", s)
+}
+
+// xmlBackupComponents is the XML representation of a Backup Components
+// Document.
+type xmlBackupComponents struct {
+	XMLName             xml.Name
+	Version             string                `xml:"version,attr,omitempty"`
+	BootableSystemState xmlBool               `xml:"bootableSystemStateBackup,attr"`
+	SelectComponents    xmlBool               `xml:"selectComponents,attr"`
+	BackupType          string                `xml:"backupType,attr"`
+	PartialFileSupport  xmlBool               `xml:"partialFileSupport,attr"`
+	SnapshotSetID       string                `xml:"snapshotSetId,attr,omitempty"`
+	Writers             []xmlWriterComponents `xml:"WRITER_COMPONENTS"`
+	SnapshotSet         *xmlSnapshotSet       `xml:"SNAPSHOT_SET_DESCRIPTION"`
+}
+
+// xmlWriterComponents is the XML representation of a WRITER_COMPONENTS
+// element.
+type xmlWriterComponents struct {
+	InstanceID string               `xml:"instanceId,attr"`
+	WriterID   string               `xml:"writerId,attr"`
+	Components []xmlComponentBackup `xml:"COMPONENT"`
+}
+
+// xmlComponentBackup is the XML representation of a COMPONENT element.
+type xmlComponentBackup struct {
+	LogicalPath         string  `xml:"logicalPath,attr,omitempty"`
+	ComponentName       string  `xml:"componentName,attr"`
+	ComponentType       string  `xml:"componentType,attr"`
+	BackupSucceeded     xmlBool `xml:"backupSucceeded,attr"`
+	BackupOptions       string  `xml:"backupOptions,attr,omitempty"`
+	BackupStamp         string  `xml:"backupStamp,attr,omitempty"`
+	PreviousBackupStamp string  `xml:"previousBackupStamp,attr,omitempty"`
+}
+
+// xmlSnapshotSet is the XML representation of a SNAPSHOT_SET_DESCRIPTION
+// element.
+type xmlSnapshotSet struct {
+	SnapshotSetID string                   `xml:"snapshotSetId,attr"`
+	Snapshots     []xmlSnapshotDescription `xml:"SNAPSHOT_DESCRIPTION"`
+}
+
+// xmlSnapshotDescription is the XML representation of a SNAPSHOT_DESCRIPTION
+// element.
+type xmlSnapshotDescription struct {
+	SnapshotID         string `xml:"snapshotId,attr"`
+	ProviderID         string `xml:"providerId,attr"`
+	SnapshotAttributes string `xml:"snapshotAttributes,attr"`
+	OriginalVolumeName string `xml:"originalVolumeName,attr"`
+	DeviceName         string `xml:"deviceName,attr,omitempty"`
+}
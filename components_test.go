@@ -0,0 +1,278 @@
+package vss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackupComponents(t *testing.T) {
+	bc := loadBackupComponents(t, "sql.xml")
+	assert.Equal(t, "{3E5F7C8A-1B2D-4E6F-9A0B-C1D2E3F40506}", bc.SetID.String())
+	assert.Equal(t, BackupFull, bc.BackupType)
+	assert.True(t, bc.SelectComponents)
+	assert.False(t, bc.BootableSystemState)
+	require.Len(t, bc.Writers, 2)
+	assert.Equal(t, &WriterComponents{
+		WriterID:   "a65faa63-5ea8-4ebc-9dbd-a0c4db26912a",
+		InstanceID: "aa8ad2d0-2c2b-4cc0-ab0e-fb0f0d1e8b0d",
+		Components: []ComponentBackup{{
+			Type:            ComponentDatabase,
+			LogicalPath:     `HOST\SQLEXPRESS`,
+			Name:            "master",
+			BackupSucceeded: true,
+			BackupStamp:     "0x0000002a00000190",
+		}, {
+			Type:            ComponentDatabase,
+			LogicalPath:     `HOST\SQLEXPRESS`,
+			Name:            "Sales",
+			BackupSucceeded: true,
+		}},
+	}, bc.Writers[0])
+	assert.Equal(t, ComponentFileGroup, bc.Writers[1].Components[0].Type)
+	assert.Equal(t, "System Files", bc.Writers[1].Components[0].FullPath())
+	require.Len(t, bc.Snapshots, 2)
+	assert.Equal(t, SnapshotDescription{
+		ID:           mustParse(ParseShadowID("{8e2a1d5f-6b7c-4d4e-9f0a-1b2c3d4e5f60}")),
+		ProviderID:   "{b5946137-7b9f-4925-af80-51abd60b20d5}",
+		Attributes:   0x20009,
+		VolumeName:   mustParse(ParseVolumeGUIDName(`\\?\Volume{66666666-7777-8888-9999-000000000000}\`)),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy8`,
+	}, bc.Snapshots[1])
+
+	// Parsed documents are written verbatim
+	want, err := os.ReadFile(filepath.Join("testdata", "components", "sql.xml"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	n, err := bc.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want)), n)
+	assert.Equal(t, string(want), buf.String())
+}
+
+func TestParseBackupComponentsErrors(t *testing.T) {
+	for _, doc := range []string{
+		``,
+		`<BACKUP_COMPONENTS>`,
+		`<WRITER_METADATA/>`,
+		`<BACKUP_COMPONENTS backupType="weekly"/>`,
+		`<BACKUP_COMPONENTS backupType="full" selectComponents="maybe"/>`,
+		`<BACKUP_COMPONENTS backupType="full"><WRITER_COMPONENTS><COMPONENT componentType="table"/></WRITER_COMPONENTS></BACKUP_COMPONENTS>`,
+		`<BACKUP_COMPONENTS backupType="full"><SNAPSHOT_SET_DESCRIPTION><SNAPSHOT_DESCRIPTION snapshotAttributes="x"/></SNAPSHOT_SET_DESCRIPTION></BACKUP_COMPONENTS>`,
+	} {
+		_, err := ParseBackupComponents(strings.NewReader(doc))
+		assert.Error(t, err, doc)
+	}
+}
+
+func TestBackupComponentsEncode(t *testing.T) {
+	orig := loadBackupComponents(t, "sql.xml")
+	bc := *orig
+	bc.doc = ""
+	var buf bytes.Buffer
+	_, err := bc.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "<?xml"))
+	assert.Contains(t, buf.String(), `componentType="filegroup"`)
+
+	rt, err := ParseBackupComponents(&buf)
+	require.NoError(t, err)
+	rt.doc = ""
+	assert.Equal(t, &bc, rt)
+
+	// All backup types round-trip
+	for typ := BackupCopy; typ <= BackupOther; typ++ {
+		bc.BackupType = typ
+		buf.Reset()
+		_, err = bc.WriteTo(&buf)
+		require.NoError(t, err, typ)
+		rt, err = ParseBackupComponents(&buf)
+		require.NoError(t, err, typ)
+		assert.Equal(t, typ, rt.BackupType)
+	}
+
+	bc.BackupType = 100
+	_, err = bc.WriteTo(&buf)
+	assert.Error(t, err)
+}
+
+func TestBackupComponentsValidate(t *testing.T) {
+	bc := loadBackupComponents(t, "sql.xml")
+	meta := []*WriterMetadata{
+		loadWriterMetadata(t, "sql.xml"),
+		loadWriterMetadata(t, "system.xml"),
+	}
+	files := []string{
+		`C:\Program Files\Microsoft SQL Server\MSSQL16.SQLEXPRESS\MSSQL\DATA\MASTER.MDF`,
+		`C:\Program Files\Microsoft SQL Server\MSSQL16.SQLEXPRESS\MSSQL\DATA\mastlog.ldf`,
+		`D:\SQL\Data\Sales.mdf`,
+		`D:\SQL\Data\Sales_2.ndf`,
+		`E:\SQL\Logs\Sales_log.ldf`,
+		`C:\Windows\System32\ntoskrnl.exe`,
+		`C:\Windows\System32\drivers\disk.sys`,
+		`C:\Windows\WinSxS\amd64_x\comctl32.dll`,
+	}
+	require.NoError(t, bc.Validate(meta, files, nil))
+
+	// Missing files
+	err := bc.Validate(meta, files[1:len(files)-1], nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `master.mdf of component HOST\SQLEXPRESS\master`)
+	assert.Contains(t, err.Error(), `c:\windows\winsxs\* of component System Files`)
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+
+	// Environment variables are expanded
+	sys := meta[1].Components[0]
+	sys.Files[0].Path = `%SystemRoot%\System32`
+	require.NoError(t, bc.Validate(meta, files, []string{`SYSTEMROOT=C:\Windows`}))
+	err = bc.Validate(meta, files, []string{`SYSTEMROOT=D:\Windows`})
+	assert.ErrorContains(t, err, `ntoskrnl.exe of component System Files`)
+	err = bc.Validate(meta, files, nil)
+	assert.ErrorContains(t, err, "undefined environment variable: %SystemRoot%")
+
+	// Missing metadata
+	err = bc.Validate(meta[:1], files, nil)
+	assert.ErrorContains(t, err, "no metadata for writer e8132975")
+	meta[0].Components = meta[0].Components[:1]
+	err = bc.Validate(meta, files, []string{`SYSTEMROOT=C:\Windows`})
+	assert.ErrorContains(t, err, `component HOST\SQLEXPRESS\Sales not found`)
+}
+
+func TestSnapshotSetBackupComponents(t *testing.T) {
+	f := &fakeComponents{doc: "<BACKUP_COMPONENTS/>"}
+	var buf bytes.Buffer
+	_, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"},
+		&SetOptions{BackupComponents: &buf})
+	require.NoError(t, err)
+	assert.Equal(t, f.doc, buf.String())
+	assert.Equal(t, []string{"SaveAsXML", "BackupComplete"}, f.calls[len(f.calls)-2:])
+
+	f = &fakeComponents{fail: []string{"SaveAsXML"}}
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"},
+		&SetOptions{BackupComponents: &buf})
+	require.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Equal(t, "DeleteSnapshotSet", f.calls[len(f.calls)-1])
+}
+
+func TestSnapshotSetComponents(t *testing.T) {
+	var docs []string
+	for _, name := range []string{"system.xml", "sql.xml"} {
+		b, err := os.ReadFile(filepath.Join("testdata", "writers", name))
+		require.NoError(t, err)
+		docs = append(docs, string(b))
+	}
+	f := &fakeComponents{docs: docs}
+	opts := &SetOptions{Components: []ComponentSelector{
+		{Writer: "SqlServerWriter", Path: `host\sqlexpress\SALES`},
+		{Writer: "e8132975-6f93-4464-a53e-1050253ae220", Path: "System Files"},
+	}}
+	_, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.NoError(t, err)
+	assert.True(t, f.selectComponents)
+	assert.Equal(t, []string{
+		"InitializeForBackup",
+		"SetContext",
+		"SetBackupState",
+		"GatherWriterMetadata",
+		"GetWriterMetadata",
+		"AddComponent",
+		"AddComponent",
+		"StartSnapshotSet",
+	}, f.calls[:8])
+	assert.Equal(t, []string{
+		`aa8ad2d0-2c2b-4cc0-ab0e-fb0f0d1e8b0d:a65faa63-5ea8-4ebc-9dbd-a0c4db26912a:DATABASE:HOST\SQLEXPRESS\Sales`,
+		`78b3e38b-1bba-4c8a-a9ce-5dd3bd9d5d0e:e8132975-6f93-4464-a53e-1050253ae220:FILE_GROUP:System Files`,
+	}, f.add)
+
+	// Unmatched selectors are reported before any component is added
+	f = &fakeComponents{docs: docs}
+	opts.Components = append(opts.Components, ComponentSelector{Writer: "SqlServerWriter", Path: "Other"})
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "`SqlServerWriter:Other`")
+	assert.Empty(t, f.add)
+	assert.NotContains(t, f.calls, "StartSnapshotSet")
+
+	// AddComponent failure
+	opts.Components = opts.Components[:2]
+	f = &fakeComponents{docs: docs, fail: []string{"AddComponent"}}
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.ErrorContains(t, err, `HOST\SQLEXPRESS\Sales`)
+
+	// Components require writers
+	f = &fakeComponents{docs: docs}
+	opts.Context = ContextClientAccessible
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.ErrorIs(t, err, errNoWriters)
+	assert.Empty(t, f.calls)
+
+	// Document-mode backups do not select components
+	f = new(fakeComponents)
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, nil)
+	require.NoError(t, err)
+	assert.False(t, f.selectComponents)
+	assert.NotContains(t, f.calls, "GetWriterMetadata")
+}
+
+func TestRestore(t *testing.T) {
+	doc := loadBackupComponents(t, "sql.xml")
+	f := new(fakeComponents)
+	var got *BackupComponents
+	err := restore(context.Background(), f, doc, func(bc *BackupComponents) error {
+		got = bc
+		f.calls = append(f.calls, "fn")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, doc, got)
+	assert.Equal(t, doc.doc, f.doc)
+	assert.Equal(t, []string{
+		"InitializeForRestore",
+		"GatherWriterMetadata",
+		"SetSelectedForRestore",
+		"SetSelectedForRestore",
+		"SetSelectedForRestore",
+		"PreRestore",
+		"fn",
+		"PostRestore",
+	}, f.calls)
+	assert.Equal(t, []string{
+		`a65faa63-5ea8-4ebc-9dbd-a0c4db26912a:DATABASE:HOST\SQLEXPRESS\master`,
+		`a65faa63-5ea8-4ebc-9dbd-a0c4db26912a:DATABASE:HOST\SQLEXPRESS\Sales`,
+		`e8132975-6f93-4464-a53e-1050253ae220:FILE_GROUP:System Files`,
+	}, f.sel)
+
+	// PostRestore is called even if fn fails
+	f = &fakeComponents{fail: []string{"PostRestore"}}
+	errFn := errors.New("fn")
+	err = restore(context.Background(), f, doc, func(*BackupComponents) error { return errFn })
+	assert.ErrorIs(t, err, errFn)
+	assert.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Equal(t, "PostRestore", f.calls[len(f.calls)-1])
+
+	// Writers are not notified if PreRestore fails
+	f = &fakeComponents{fail: []string{"PreRestore"}}
+	err = restore(context.Background(), f, doc, func(*BackupComponents) error {
+		panic("fn called")
+	})
+	assert.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.NotContains(t, f.calls, "PostRestore")
+}
+
+func loadBackupComponents(t *testing.T, name string) *BackupComponents {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "components", name))
+	require.NoError(t, err)
+	defer f.Close()
+	bc, err := ParseBackupComponents(f)
+	require.NoError(t, err)
+	return bc
+}
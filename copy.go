@@ -0,0 +1,373 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultProgressInterval is the default CopyOptions.ProgressInterval.
+const defaultProgressInterval = time.Second
+
+// CopyOptions configures CopyConsistent and CopyFS.
+type CopyOptions struct {
+	// Include and Exclude are file patterns containing '*' and '?' wildcards,
+	// which are matched without regard to case. Patterns without a separator
+	// match file names, such as "*.pst". Other patterns match whole names with
+	// either separator, such as `C:\Users\*\NTUSER.DAT`, and "**" matches any
+	// number of directories. If Include is not empty, only matching files and
+	// their parent directories are copied. Otherwise, empty directories are
+	// also copied. Excluded files are not copied and excluded directories are
+	// not traversed.
+	Include []string
+	Exclude []string
+
+	// Progress is called after each file is copied and at least every
+	// ProgressInterval while copying large files.
+	Progress func(CopyProgress)
+
+	// ProgressInterval is the interval of Progress calls while copying a
+	// file. The default is one second.
+	ProgressInterval time.Duration
+}
+
+// CopyProgress reports the progress of a copy operation.
+type CopyProgress struct {
+	Path    string        // Name of the file being copied
+	Files   int           // Number of files copied
+	Bytes   int64         // Number of bytes copied
+	Elapsed time.Duration // Time since the copy started
+}
+
+// Rate returns the average throughput in bytes per second.
+func (p CopyProgress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / p.Elapsed.Seconds()
+}
+
+// CopyConsistent creates shadow copies of all volumes containing the specified
+// absolute paths, copies the files and directory trees at those paths from the
+// shadow copies to directory dst, and removes the shadow copies, even if the
+// copy fails. Volumes mounted in folders under the paths are also copied. Each
+// path is copied to the same location under dst as its FSName, such as
+// `dst\C\Users\x\a.pst` for `C:\Users\x\a.pst` (see CopyFS). It returns the
+// final progress.
+func CopyConsistent(ctx context.Context, paths []string, dst string, opts *CopyOptions) (CopyProgress, error) {
+	return copyConsistent(ctx, sysTopology, sys, newBackupComponents,
+		func(sc *ShadowCopy) fs.FS { return sc.FS() }, paths, dst, opts)
+}
+
+// copyConsistent implements CopyConsistent using the specified topology,
+// backend, IVssBackupComponents constructor, and shadow copy file systems.
+func copyConsistent(ctx context.Context, t topology, b backend, newBC func() (backupComponents, error), open func(sc *ShadowCopy) fs.FS, paths []string, dst string, opts *CopyOptions) (_ CopyProgress, err error) {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		if names[i], err = FSName(p); err != nil {
+			return CopyProgress{}, err
+		}
+	}
+	s, err := snapshotPaths(ctx, t, b, newBC, paths)
+	if err != nil {
+		return CopyProgress{}, err
+	}
+	defer func() { err = errors.Join(err, s.Close()) }()
+	v, err := newVolumeFS(t, s.ShadowCopies(), open)
+	if err != nil {
+		return CopyProgress{}, err
+	}
+	c := newCopier(dst, opts, time.Now)
+	err = c.copyAll(ctx, v, names)
+	return c.p, err
+}
+
+// CopyFS copies the files and directory trees at the specified names in fsys
+// to directory dst, preserving modification times and, where supported, other
+// timestamps and file attributes. A trailing colon is removed from the first
+// element of each name, so "C:/Users/x" is copied to `dst\C\Users\x`. Existing
+// files are overwritten. Symlinks and other irregular files are skipped. It
+// returns the final progress.
+func CopyFS(ctx context.Context, fsys fs.FS, names []string, dst string, opts *CopyOptions) (CopyProgress, error) {
+	c := newCopier(dst, opts, time.Now)
+	err := c.copyAll(ctx, fsys, names)
+	return c.p, err
+}
+
+// copier implements CopyFS.
+type copier struct {
+	dst     string
+	opts    CopyOptions
+	now     func() time.Time
+	start   time.Time
+	last    time.Time // Time of the last Progress call
+	p       CopyProgress
+	dirs    []copiedDir // Created directories
+	parents []copiedDir // Directories containing the current name
+	buf     []byte
+	include []string
+	exclude []string
+}
+
+// copiedDir is a copied directory whose metadata is set after its contents are
+// copied.
+type copiedDir struct {
+	name    string
+	dst     string
+	info    fs.FileInfo
+	created bool
+}
+
+// newCopier returns a copier using the specified clock.
+func newCopier(dst string, opts *CopyOptions, now func() time.Time) *copier {
+	c := &copier{dst: dst, now: now}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.ProgressInterval <= 0 {
+		c.opts.ProgressInterval = defaultProgressInterval
+	}
+	c.include = cleanPatterns(c.opts.Include)
+	c.exclude = cleanPatterns(c.opts.Exclude)
+	return c
+}
+
+// copyAll copies the specified names. Names under other names are ignored.
+func (c *copier) copyAll(ctx context.Context, fsys fs.FS, names []string) error {
+	c.start = c.now()
+	c.last = c.start
+	var roots []string
+	var errs []error
+	for _, name := range names {
+		under := func(r string) bool {
+			return len(name) > len(r) && name[len(r)] == '/' && strings.EqualFold(name[:len(r)], r)
+		}
+		if slices.ContainsFunc(names, under) ||
+			slices.ContainsFunc(roots, func(r string) bool { return strings.EqualFold(name, r) }) {
+			continue
+		}
+		roots = append(roots, name)
+		c.parents = c.parents[:0]
+		if err := fs.WalkDir(fsys, name, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return c.visit(ctx, fsys, name, d)
+		}); err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		if err := setTimes(c.dirs[i].dst, c.dirs[i].info); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.p.Path, c.p.Elapsed = "", c.now().Sub(c.start)
+	return errors.Join(errs...)
+}
+
+// visit copies one file or directory.
+func (c *copier) visit(ctx context.Context, fsys fs.FS, name string, d fs.DirEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if matchPatterns(c.exclude, name) {
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	}
+	for n := len(c.parents); n > 0 && !strings.HasPrefix(name, c.parents[n-1].name+"/"); n-- {
+		c.parents = c.parents[:n-1]
+	}
+	dst := copyDest(c.dst, name)
+	if d.IsDir() {
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		c.parents = append(c.parents, copiedDir{name: name, dst: dst, info: info})
+		if len(c.include) == 0 {
+			return c.mkdirs()
+		}
+		return nil
+	}
+	if !d.Type().IsRegular() || (len(c.include) > 0 && !matchPatterns(c.include, name)) {
+		return nil
+	}
+	if err := c.mkdirs(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("vss: failed to create directory (%w)", err)
+	}
+	return c.copyFile(ctx, fsys, name, dst)
+}
+
+// mkdirs creates the directories in c.parents that have not been created.
+func (c *copier) mkdirs() error {
+	for i := range c.parents {
+		if d := &c.parents[i]; !d.created {
+			if err := os.MkdirAll(d.dst, 0o755); err != nil {
+				return fmt.Errorf("vss: failed to create directory (%w)", err)
+			}
+			d.created = true
+			c.dirs = append(c.dirs, *d)
+		}
+	}
+	return nil
+}
+
+// copyFile copies file name to dst.
+func (c *copier) copyFile(ctx context.Context, fsys fs.FS, name, dst string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if err = makeWritable(dst); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return fmt.Errorf("vss: failed to create file (%w)", err)
+	}
+	c.p.Path = name
+	if c.buf == nil {
+		c.buf = make([]byte, 1<<20)
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var n int
+		n, err = src.Read(c.buf)
+		if n > 0 {
+			if _, werr := f.Write(c.buf[:n]); werr != nil {
+				err = fmt.Errorf("vss: failed to write file (%w)", werr)
+				break
+			}
+			c.p.Bytes += int64(n)
+			if now := c.now(); now.Sub(c.last) >= c.opts.ProgressInterval {
+				c.report(now)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	if err = setTimes(dst, info); err != nil {
+		return err
+	}
+	c.p.Files++
+	c.report(c.now())
+	return nil
+}
+
+// report calls the progress function, if any.
+func (c *copier) report(now time.Time) {
+	c.last = now
+	if c.opts.Progress != nil {
+		c.p.Elapsed = now.Sub(c.start)
+		c.opts.Progress(c.p)
+	}
+}
+
+// setTimes sets the timestamps and attributes of dst to those of the source
+// file described by info.
+func setTimes(dst string, info fs.FileInfo) error {
+	t := info.ModTime()
+	if err := os.Chtimes(dst, t, t); err != nil {
+		return fmt.Errorf("vss: failed to set file times (%w)", err)
+	}
+	if err := setMetadata(dst, info); err != nil {
+		return fmt.Errorf("vss: failed to set file attributes of %#q (%w)", dst, err)
+	}
+	return nil
+}
+
+// makeWritable makes an existing file writable, so that a read-only file copied
+// previously can be overwritten. On Windows, this clears the read-only
+// attribute.
+func makeWritable(name string) error {
+	fi, err := os.Lstat(name)
+	if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0o200 != 0 {
+		return nil
+	}
+	if err = os.Chmod(name, fi.Mode().Perm()|0o200); err != nil {
+		return fmt.Errorf("vss: failed to make file writable (%w)", err)
+	}
+	return nil
+}
+
+// copyDest returns the destination of name under dst.
+func copyDest(dst, name string) string {
+	vol, rest, _ := strings.Cut(name, "/")
+	return filepath.Join(dst, strings.TrimSuffix(vol, ":"), filepath.FromSlash(rest))
+}
+
+// cleanPatterns converts file patterns to use '/' separators.
+func cleanPatterns(patterns []string) []string {
+	all := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if p = strings.Trim(strings.ReplaceAll(p, `\`, "/"), "/"); p != "" {
+			all = append(all, p)
+		}
+	}
+	return all
+}
+
+// matchPatterns returns whether name matches any of the patterns.
+func matchPatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if strings.IndexByte(p, '/') < 0 {
+			if wildcardMatch(p, path.Base(name)) {
+				return true
+			}
+		} else if matchParts(strings.Split(p, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchParts returns whether the name elements match the pattern elements,
+// where "**" matches zero or more elements.
+func matchParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 || !wildcardMatch(pattern[0], name[0]) {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
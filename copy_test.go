@@ -0,0 +1,241 @@
+package vss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyTime is the modification time of files in copyFS.
+var copyTime = time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC)
+
+// copyFS returns a test file system for copy operations.
+func copyFS() fstest.MapFS {
+	dir := &fstest.MapFile{Mode: fs.ModeDir | 0o755, ModTime: copyTime.Add(-time.Hour)}
+	file := func(s string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(s), Mode: 0o644, ModTime: copyTime}
+	}
+	return fstest.MapFS{
+		"C:":                          dir,
+		"C:/Users":                    dir,
+		"C:/Users/x":                  dir,
+		"C:/Users/x/NTUSER.DAT":       file("hive"),
+		"C:/Users/x/a.txt":            file("a"),
+		"C:/Users/x/b.tmp":            file("b"),
+		"C:/Users/x/Cache":            dir,
+		"C:/Users/x/Cache/c.txt":      file("c"),
+		"C:/Users/x/Mail":             dir,
+		"C:/Users/x/Mail/outlook.PST": file("pst"),
+		"C:/Users/x/Mail/link":        {Mode: fs.ModeSymlink | 0o777, Data: []byte("a.txt")},
+		"C:/Data":                     dir,
+		"C:/Data/db.mdf":              file("db"),
+		"Volume{22222222-2222-2222-2222-222222222222}":       dir,
+		"Volume{22222222-2222-2222-2222-222222222222}/d.txt": file("d"),
+	}
+}
+
+// readTree returns the contents of all files under dir by slash-separated
+// relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	all := make(map[string]string)
+	require.NoError(t, filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		all[filepath.ToSlash(rel)] = string(b)
+		return err
+	}))
+	return all
+}
+
+// readDirs returns the slash-separated relative paths of all directories under
+// dir.
+func readDirs(t *testing.T, dir string) []string {
+	t.Helper()
+	var all []string
+	require.NoError(t, filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && p != dir {
+			rel, _ := filepath.Rel(dir, p)
+			all = append(all, filepath.ToSlash(rel))
+		}
+		return err
+	}))
+	return all
+}
+
+func TestCopyFS(t *testing.T) {
+	dst := t.TempDir()
+	var calls []CopyProgress
+	p, err := CopyFS(context.Background(), copyFS(), []string{
+		"C:/Users/x",
+		"c:/users/x/a.txt",
+		"C:/Data/db.mdf",
+		"Volume{22222222-2222-2222-2222-222222222222}",
+	}, dst, &CopyOptions{
+		Exclude:  []string{"*.tmp", `C:\Users\*\Cache`},
+		Progress: func(p CopyProgress) { calls = append(calls, p) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"C/Users/x/NTUSER.DAT":       "hive",
+		"C/Users/x/a.txt":            "a",
+		"C/Users/x/Mail/outlook.PST": "pst",
+		"C/Data/db.mdf":              "db",
+		"Volume{22222222-2222-2222-2222-222222222222}/d.txt": "d",
+	}, readTree(t, dst))
+	assert.Equal(t, 5, p.Files)
+	assert.Equal(t, int64(11), p.Bytes)
+	assert.Empty(t, p.Path)
+	require.Len(t, calls, 5)
+	for i, c := range calls {
+		assert.Equal(t, i+1, c.Files)
+		assert.NotEmpty(t, c.Path)
+	}
+	assert.Equal(t, "C:/Users/x/Mail/outlook.PST", calls[0].Path)
+	assert.Equal(t, []string{
+		"C", "C/Data", "C/Users", "C/Users/x", "C/Users/x/Mail",
+		"Volume{22222222-2222-2222-2222-222222222222}",
+	}, readDirs(t, dst))
+
+	fi, err := os.Stat(filepath.Join(dst, "C", "Users", "x", "a.txt"))
+	require.NoError(t, err)
+	assert.True(t, copyTime.Equal(fi.ModTime()))
+	fi, err = os.Stat(filepath.Join(dst, "C", "Users", "x"))
+	require.NoError(t, err)
+	assert.True(t, copyTime.Add(-time.Hour).Equal(fi.ModTime()))
+
+	// Existing files are overwritten, even if they are read-only
+	fsys := copyFS()
+	fsys["C:/Data/db.mdf"] = &fstest.MapFile{Data: []byte("db1"), Mode: 0o444, ModTime: copyTime}
+	_, err = CopyFS(context.Background(), fsys, []string{"C:/Data"}, dst, nil)
+	require.NoError(t, err)
+	fsys["C:/Data/db.mdf"].Data = []byte("db2")
+	_, err = CopyFS(context.Background(), fsys, []string{"C:/Data"}, dst, nil)
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(dst, "C", "Data", "db.mdf"))
+	require.NoError(t, err)
+	assert.Equal(t, "db2", string(b))
+	fi, err = os.Stat(filepath.Join(dst, "C", "Data", "db.mdf"))
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o444), fi.Mode().Perm())
+
+	_, err = CopyFS(context.Background(), copyFS(), []string{"C:/Missing"}, t.TempDir(), nil)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCopyFSInclude(t *testing.T) {
+	dst := t.TempDir()
+	_, err := CopyFS(context.Background(), copyFS(), []string{"C:"}, dst, &CopyOptions{
+		Include: []string{"**/*.pst", `C:\Users\*\ntuser.dat`},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"C/Users/x/NTUSER.DAT":       "hive",
+		"C/Users/x/Mail/outlook.PST": "pst",
+	}, readTree(t, dst))
+	assert.Equal(t, []string{"C", "C/Users", "C/Users/x", "C/Users/x/Mail"}, readDirs(t, dst))
+	fi, err := os.Stat(filepath.Join(dst, "C", "Users", "x", "Mail"))
+	require.NoError(t, err)
+	assert.True(t, copyTime.Add(-time.Hour).Equal(fi.ModTime()))
+
+	// Nothing is created if no files match
+	dst = t.TempDir()
+	_, err = CopyFS(context.Background(), copyFS(), []string{"C:"}, dst, &CopyOptions{Include: []string{"*.none"}})
+	require.NoError(t, err)
+	assert.Empty(t, readDirs(t, dst))
+}
+
+func TestCopyFSProgress(t *testing.T) {
+	const size = 3<<20 + 1
+	fsys := fstest.MapFS{"big": {Data: bytes.Repeat([]byte{1}, size), Mode: 0o644}}
+	var now time.Time
+	var calls []CopyProgress
+	c := newCopier(t.TempDir(), &CopyOptions{
+		Progress:         func(p CopyProgress) { calls = append(calls, p) },
+		ProgressInterval: 2 * time.Second,
+	}, func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+	require.NoError(t, c.copyAll(context.Background(), fsys, []string{"big"}))
+	assert.Equal(t, []CopyProgress{
+		{Path: "big", Bytes: 2 << 20, Elapsed: 2 * time.Second},
+		{Path: "big", Bytes: 4<<20 - (1<<20 - 1), Elapsed: 4 * time.Second},
+		{Path: "big", Files: 1, Bytes: size, Elapsed: 5 * time.Second},
+	}, calls)
+	assert.Equal(t, CopyProgress{Files: 1, Bytes: size, Elapsed: 6 * time.Second}, c.p)
+	assert.InDelta(t, float64(size)/6, c.p.Rate(), 1)
+	assert.Zero(t, CopyProgress{}.Rate())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := CopyFS(ctx, fsys, []string{"big"}, t.TempDir(), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.pst", "C:/Users/x/a.PST", true},
+		{"*.pst", "C:/Users/x/a.pst.bak", false},
+		{`C:\Users\*\NTUSER.DAT`, "c:/users/x/ntuser.dat", true},
+		{`C:\Users\*\NTUSER.DAT`, "C:/Users/x/y/NTUSER.DAT", false},
+		{"C:/Users/**/NTUSER.DAT", "C:/Users/NTUSER.DAT", true},
+		{"C:/Users/**/NTUSER.DAT", "C:/Users/x/y/NTUSER.DAT", true},
+		{"C:/Users/**", "C:/Users/x/y", true},
+		{"**/Cache", "C:/Users/x/Cache", true},
+		{"**/Cache", "C:/Users/x/Cache/c.txt", false},
+		{`C:\Users\`, "C:/Users", true},
+	}
+	for _, tc := range tests {
+		got := matchPatterns(cleanPatterns([]string{tc.pattern}), tc.name)
+		assert.Equal(t, tc.want, got, "%s %s", tc.pattern, tc.name)
+	}
+	assert.False(t, matchPatterns(cleanPatterns([]string{"", `\`}), "C:/x"))
+}
+
+func TestCopyConsistent(t *testing.T) {
+	noNative := func() (backupComponents, error) { return nil, errors.New("native API unavailable") }
+	dir := &fstest.MapFile{Mode: fs.ModeDir | 0o755}
+	files := map[VolumeGUIDName]fstest.MapFS{
+		volC: {"Users/x/a.txt": {Data: []byte("C:a"), Mode: 0o644}, "Mnt/Data": dir},
+		volD: {"data/x.db": {Data: []byte("D:x"), Mode: 0o644}, "data/logs": dir},
+		volE: {"1.log": {Data: []byte("E:1"), Mode: 0o644}},
+	}
+	open := func(sc *ShadowCopy) fs.FS { return files[sc.VolumeName] }
+	b := new(fakeBackend)
+	dst := t.TempDir()
+	paths := []string{`C:\Mnt\Data\data`, `C:\Users\x\a.txt`}
+	p, err := copyConsistent(context.Background(), testTopology, b, noNative, open, paths, dst, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, p.Files)
+	assert.Equal(t, map[string]string{
+		"C/Mnt/Data/data/x.db":       "D:x",
+		"C/Mnt/Data/data/logs/1.log": "E:1",
+		"C/Users/x/a.txt":            "C:a",
+	}, readTree(t, dst))
+	assert.Empty(t, b.ids())
+
+	// Shadow copies are removed after a failed copy
+	_, err = copyConsistent(context.Background(), testTopology, b, noNative, open, []string{`C:\Missing`}, t.TempDir(), nil)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Empty(t, b.ids())
+
+	_, err = copyConsistent(context.Background(), testTopology, b, noNative, open, []string{`Users\x`}, t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(4), b.execs.Load()) // No snapshots for invalid paths
+}
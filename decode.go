@@ -0,0 +1,309 @@
+package vss
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decode converts WMI object properties into T, which must be a struct, a
+// pointer to a struct, or map[string]any. Struct fields are matched to
+// properties by the `wmi` tag or, if the tag is absent, by the field name.
+// Fields tagged with `wmi:"-"` and unexported fields are ignored. Properties
+// that are missing or NULL leave the corresponding field unmodified.
+//
+// Supported field types are string, bool, all integer and floating-point
+// types, time.Time (CIM datetime), time.Duration (CIM interval), types
+// implementing encoding.TextUnmarshaler (decoded from strings), and slices and
+// pointers of those types.
+func decode[T any](props map[string]any) (T, error) {
+	var out T
+	rv := reflect.ValueOf(&out).Elem()
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type() == reflect.TypeOf(props):
+		rv.Set(reflect.ValueOf(props))
+		return out, nil
+	case rv.Kind() == reflect.Pointer && rv.Type().Elem().Kind() == reflect.Struct:
+		rv.Set(reflect.New(rv.Type().Elem()))
+		rv = rv.Elem()
+	case rv.Kind() != reflect.Struct:
+		return out, fmt.Errorf("vss: unsupported query result type: %T", out)
+	}
+	return out, decodeStruct(props, rv)
+}
+
+// decodeStruct stores props into the fields of struct v.
+func decodeStruct(props map[string]any, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := propName(f)
+		if name == "" {
+			continue
+		}
+		p, ok := props[name]
+		if !ok || p == nil {
+			continue
+		}
+		if err := decodeValue(p, v.Field(i)); err != nil {
+			return fmt.Errorf("vss: failed to decode property %s into %s.%s (%w)",
+				name, t.Name(), f.Name, err)
+		}
+	}
+	return nil
+}
+
+// propName returns the WMI property name for struct field f or an empty string
+// if the field should be ignored.
+func propName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("wmi"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// decodeValue stores property value p into v.
+func decodeValue(p any, v reflect.Value) error {
+	switch v.Type() {
+	case timeType:
+		s, ok := p.(string)
+		if !ok {
+			return typeError(p, v)
+		}
+		t, err := parseDateTime(s)
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return err
+	case durationType:
+		s, ok := p.(string)
+		if !ok {
+			return typeError(p, v)
+		}
+		d, err := parseInterval(s)
+		if err == nil {
+			v.SetInt(int64(d))
+		}
+		return err
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			s, ok := p.(string)
+			if !ok {
+				return typeError(p, v)
+			}
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		e := reflect.New(v.Type().Elem())
+		if err := decodeValue(p, e.Elem()); err != nil {
+			return err
+		}
+		v.Set(e)
+	case reflect.Slice:
+		pv := reflect.ValueOf(p)
+		if pv.Kind() != reflect.Slice {
+			return typeError(p, v)
+		}
+		s := reflect.MakeSlice(v.Type(), pv.Len(), pv.Len())
+		for i := 0; i < pv.Len(); i++ {
+			if err := decodeValue(pv.Index(i).Interface(), s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.String:
+		s, ok := p.(string)
+		if !ok {
+			return typeError(p, v)
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := p.(bool)
+		if !ok {
+			return typeError(p, v)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt(p)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("value %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := toUint(p)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("value %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(p)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Interface:
+		if p == nil {
+			v.SetZero()
+			break
+		}
+		if !reflect.TypeOf(p).AssignableTo(v.Type()) {
+			return typeError(p, v)
+		}
+		v.Set(reflect.ValueOf(p))
+	default:
+		return typeError(p, v)
+	}
+	return nil
+}
+
+// toInt converts an integer property value to int64. WMI returns 64-bit
+// integers as strings.
+func toInt(p any) (int64, error) {
+	switch p := p.(type) {
+	case string:
+		return strconv.ParseInt(p, 10, 64)
+	case uint64:
+		if p > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int64", p)
+		}
+		return int64(p), nil
+	}
+	if v := reflect.ValueOf(p); v.CanInt() {
+		return v.Int(), nil
+	} else if v.CanUint() {
+		return int64(v.Uint()), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to an integer", p)
+}
+
+// toUint converts an unsigned integer property value to uint64. Signed values
+// are reinterpreted because WMI returns uint32 properties as VT_I4.
+func toUint(p any) (uint64, error) {
+	switch p := p.(type) {
+	case string:
+		return strconv.ParseUint(p, 10, 64)
+	case int8:
+		return uint64(uint8(p)), nil
+	case int16:
+		return uint64(uint16(p)), nil
+	case int32:
+		return uint64(uint32(p)), nil
+	}
+	if v := reflect.ValueOf(p); v.CanUint() {
+		return v.Uint(), nil
+	} else if v.CanInt() {
+		if i := v.Int(); i >= 0 {
+			return uint64(i), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot convert %T(%v) to an unsigned integer", p, p)
+}
+
+// toFloat converts a numeric property value to float64.
+func toFloat(p any) (float64, error) {
+	if s, ok := p.(string); ok {
+		return strconv.ParseFloat(s, 64)
+	}
+	switch v := reflect.ValueOf(p); {
+	case v.CanFloat():
+		return v.Float(), nil
+	case v.CanInt():
+		return float64(v.Int()), nil
+	case v.CanUint():
+		return float64(v.Uint()), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to a float", p)
+}
+
+// storeProp stores string property value p into v, which must be a *string,
+// a *time.Time (CIM datetime), or an encoding.TextUnmarshaler.
+func storeProp(p string, v any) (err error) {
+	switch v := v.(type) {
+	case *string:
+		*v = p
+	case *time.Time:
+		// time.Time implements encoding.TextUnmarshaler using RFC 3339, so
+		// this case must come first.
+		*v, err = parseDateTime(p)
+	case encoding.TextUnmarshaler:
+		err = v.UnmarshalText([]byte(p))
+	default:
+		err = fmt.Errorf("vss: unsupported property type: %T", v)
+	}
+	return err
+}
+
+// typeError returns an error for a property value that cannot be stored in v.
+func typeError(p any, v reflect.Value) error {
+	return fmt.Errorf("cannot store %T in %s", p, v.Type())
+}
+
+// parseDateTime converts a WMI datetime string (yyyymmddHHMMSS.mmmmmmsUUU) to
+// time.Time.
+func parseDateTime(dt string) (time.Time, error) {
+	// This logic is the same as creating an SWbemDateTime object, setting its
+	// Value property, and calling GetFileTime method, but much faster.
+	const sign = 21
+	if len(dt) != sign+4 || (dt[sign] != '-' && dt[sign] != '+') {
+		return time.Time{}, fmt.Errorf("vss: invalid datetime: %s", dt)
+	}
+	// https://learn.microsoft.com/en-us/windows/win32/wmisdk/swbemdatetime-utc
+	off, err := strconv.Atoi(dt[sign:])
+	if err != nil || off < -720 || 720 < off {
+		return time.Time{}, fmt.Errorf("vss: invalid datetime UTC offset: %s", dt)
+	}
+	// https://learn.microsoft.com/en-us/windows/win32/wmisdk/cim-datetime
+	tz := time.FixedZone("", off*60)
+	t, err := time.ParseInLocation("20060102150405.000000", dt[:sign], tz)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("vss: failed to parse datetime: %s (%w)", dt, err)
+	}
+	return t.Local(), nil
+}
+
+// parseInterval converts a WMI interval string (ddddddddHHMMSS.mmmmmm:000) to
+// time.Duration.
+func parseInterval(iv string) (time.Duration, error) {
+	// https://learn.microsoft.com/en-us/windows/win32/wmisdk/cim-datetime#interval-format
+	const n = len("ddddddddHHMMSS.mmmmmm:000")
+	if len(iv) != n || iv[14] != '.' || iv[21:] != ":000" {
+		return 0, fmt.Errorf("vss: invalid interval: %s", iv)
+	}
+	var f [5]int64
+	for i, s := range []string{iv[:8], iv[8:10], iv[10:12], iv[12:14], iv[15:21]} {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("vss: invalid interval: %s", iv)
+		}
+		f[i] = int64(v)
+	}
+	d := time.Duration(f[0])*24*time.Hour + time.Duration(f[1])*time.Hour +
+		time.Duration(f[2])*time.Minute + time.Duration(f[3])*time.Second +
+		time.Duration(f[4])*time.Microsecond
+	return d, nil
+}
@@ -0,0 +1,161 @@
+package vss
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	type volume struct {
+		DeviceID    string
+		Label       *string
+		Capacity    uint64
+		BlockSize   uint32 `wmi:"BlockSize"`
+		Automount   bool
+		DriveType   int
+		Freq        float64   `wmi:"Frequency"`
+		Created     time.Time `wmi:"InstallDate"`
+		Age         time.Duration
+		Paths       []string
+		Ignored     string `wmi:"-"`
+		unexported  string
+		Unspecified any
+		Values      []any
+	}
+	zone := time.FixedZone("", -300*60)
+	props := map[string]any{
+		"DeviceID":    `\\?\Volume{f4bd5e9c-0000-0000-0000-100000000000}\`,
+		"Label":       "Data",
+		"Capacity":    "1099511627776",
+		"BlockSize":   int32(-1),
+		"Automount":   true,
+		"DriveType":   int32(3),
+		"Frequency":   float32(0.5),
+		"InstallDate": "20231213012250.108124-300",
+		"Age":         "00000001020304.000005:000",
+		"Paths":       []any{`C:\`, `D:\mnt`},
+		"Ignored":     "x",
+		"unexported":  "x",
+		"Unspecified": uint8(7),
+		"Values":      []any{nil, int32(1)},
+	}
+	v, err := decode[volume](props)
+	require.NoError(t, err)
+	label := "Data"
+	want := volume{
+		DeviceID:    props["DeviceID"].(string),
+		Label:       &label,
+		Capacity:    1 << 40,
+		BlockSize:   1<<32 - 1,
+		Automount:   true,
+		DriveType:   3,
+		Freq:        0.5,
+		Age:         26*time.Hour + 3*time.Minute + 4*time.Second + 5*time.Microsecond,
+		Paths:       []string{`C:\`, `D:\mnt`},
+		Unspecified: uint8(7),
+		Values:      []any{nil, int32(1)},
+	}
+	assert.Equal(t, time.Date(2023, 12, 13, 01, 22, 50, 108_124_000, zone), v.Created.In(zone))
+	v.Created = time.Time{}
+	assert.Equal(t, want, v)
+
+	p, err := decode[*volume](map[string]any{"DeviceID": "x", "Label": nil})
+	require.NoError(t, err)
+	assert.Equal(t, &volume{DeviceID: "x"}, p)
+
+	m, err := decode[map[string]any](props)
+	require.NoError(t, err)
+	assert.Equal(t, props, m)
+
+	_, err = decode[string](props)
+	assert.Error(t, err)
+
+	sc, err := decode[ShadowCopy](map[string]any{
+		"ID":         "{6b3c1f0e-0a2d-4e9b-8f51-3c7d2a9b4e10}",
+		"SetID":      nil,
+		"VolumeName": `\\?\Volume{F4BD5E9C-0000-0000-0000-100000000000}\`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "{6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10}", sc.ID.String())
+	assert.True(t, sc.SetID.IsZero())
+	assert.Equal(t, `\\?\Volume{f4bd5e9c-0000-0000-0000-100000000000}\`, sc.VolumeName.String())
+}
+
+func TestDecodeErrors(t *testing.T) {
+	type small struct {
+		I8  int8
+		U8  uint8
+		S   string
+		B   bool
+		T   time.Time
+		Arr []int
+		ID  ShadowID
+	}
+	for _, props := range []map[string]any{
+		{"I8": int32(128)},
+		{"I8": "x"},
+		{"U8": int32(-1)},
+		{"U8": uint16(256)},
+		{"S": int32(1)},
+		{"B": "true"},
+		{"T": "2023"},
+		{"T": int32(1)},
+		{"Arr": "1"},
+		{"Arr": []any{"x"}},
+		{"ID": "x"},
+		{"ID": int32(1)},
+	} {
+		_, err := decode[small](props)
+		assert.Error(t, err, "%v", props)
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	zone := time.FixedZone("", -300*60)
+	want := time.Date(2023, 12, 13, 01, 22, 50, 108_124_000, zone)
+	v, err := parseDateTime("20231213012250.108124-300")
+	require.NoError(t, err)
+	require.Equal(t, want, v.In(zone))
+	require.Equal(t, want.Local(), v)
+
+	for _, dt := range []string{"", "20231213012250.108124", "20231213012250.108124*300",
+		"20231213012250.108124+999", "2023121301225x.108124-300"} {
+		_, err = parseDateTime(dt)
+		assert.Error(t, err, dt)
+	}
+}
+
+func TestStoreProp(t *testing.T) {
+	var s string
+	require.NoError(t, storeProp("x", &s))
+	assert.Equal(t, "x", s)
+
+	var tm time.Time
+	require.NoError(t, storeProp("20231213012250.108124-300", &tm))
+	zone := time.FixedZone("", -300*60)
+	assert.Equal(t, time.Date(2023, 12, 13, 01, 22, 50, 108_124_000, zone), tm.In(zone))
+	assert.Error(t, storeProp("2023-12-13T01:22:50Z", &tm))
+
+	var id ShadowID
+	require.NoError(t, storeProp("{5A4C1C1E-1B5A-4C4D-9C1D-0F9E8D7C6B5A}", &id))
+	assert.Equal(t, "{5A4C1C1E-1B5A-4C4D-9C1D-0F9E8D7C6B5A}", id.String())
+
+	assert.Error(t, storeProp("1", new(int)))
+}
+
+func TestParseInterval(t *testing.T) {
+	d, err := parseInterval("00000000000000.000000:000")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+	d, err = parseInterval("00000010235959.999999:000")
+	require.NoError(t, err)
+	assert.Equal(t, 11*24*time.Hour-time.Microsecond, d)
+	for _, iv := range []string{"", "00000010235959.999999", "00000010235959x999999:000",
+		"0000001023595x.999999:000", "00000010235959.999999:001"} {
+		_, err = parseInterval(iv)
+		assert.Error(t, err, iv)
+	}
+}
@@ -0,0 +1,216 @@
+package vss
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExposeOptions configures how a shadow copy is exposed.
+type ExposeOptions struct {
+	// Remote exposes the shadow copy as a file share instead of a drive
+	// letter or mount point.
+	Remote bool
+
+	// Path is the directory of the shadow copy, relative to its root, that
+	// is exposed as a share. It is only valid for remote exposure. The root
+	// directory is exposed if Path is empty.
+	Path string
+}
+
+// Shadow copy exposure attributes.
+const (
+	attrExposedLocally  = 0x00010000
+	attrExposedRemotely = 0x00020000
+
+	vssCtxAll = -1 // VSS_CTX_ALL
+)
+
+// Expose makes the shadow copy accessible at target using the native VSS API.
+// This is required for shadow copies that are not client-accessible, which
+// cannot be accessed through DeviceObject. Locally, target is an unused drive
+// letter (e.g. "P:") or an empty directory on an NTFS volume. Remotely, target
+// is the share name, which defaults to the shadow copy ID if empty. On success,
+// ExposedName and ExposedPath are updated.
+//
+// Expose only works for persistent shadow copies. Non-persistent shadow copies
+// can only be exposed by the requester that created them, which is done by
+// HeldSet.Expose.
+func (sc *ShadowCopy) Expose(target string, opts *ExposeOptions) error {
+	expose, path, attr, err := checkExposeTarget(target, opts)
+	if err != nil {
+		return err
+	}
+	bc, err := newBackupComponents()
+	if err != nil {
+		return err
+	}
+	defer bc.Release()
+	return sc.expose(bc, expose, path, attr)
+}
+
+// Unexpose removes the drive letter, mount point, or share created by Expose
+// and clears ExposedName and ExposedPath.
+func (sc *ShadowCopy) Unexpose() error {
+	bc, err := newBackupComponents()
+	if err != nil {
+		return err
+	}
+	defer bc.Release()
+	return sc.unexpose(bc)
+}
+
+// expose implements Expose after target validation.
+func (sc *ShadowCopy) expose(bc backupComponents, expose, path string, attr int32) error {
+	if err := initContextAll(bc); err != nil {
+		return err
+	}
+	return sc.exposeWith(bc, expose, path, attr)
+}
+
+// unexpose implements Unexpose.
+func (sc *ShadowCopy) unexpose(bc backupComponents) error {
+	if err := initContextAll(bc); err != nil {
+		return err
+	}
+	return sc.unexposeWith(bc)
+}
+
+// exposeWith exposes the shadow copy using an initialized bc.
+func (sc *ShadowCopy) exposeWith(bc backupComponents, expose, path string, attr int32) error {
+	name, err := bc.ExposeSnapshot(sc.ID, path, attr, expose)
+	if err != nil {
+		return fmt.Errorf("vss: failed to expose shadow copy %s at %#q (%w)", sc.ID, expose, err)
+	}
+	sc.ExposedName, sc.ExposedPath = name, path
+	return nil
+}
+
+// unexposeWith unexposes the shadow copy using an initialized bc.
+func (sc *ShadowCopy) unexposeWith(bc backupComponents) error {
+	if err := bc.UnexposeSnapshot(sc.ID); err != nil {
+		return fmt.Errorf("vss: failed to unexpose shadow copy %s (%w)", sc.ID, err)
+	}
+	sc.ExposedName, sc.ExposedPath = "", ""
+	return nil
+}
+
+// initContextAll initializes bc for operations on existing shadow copies of
+// any context.
+func initContextAll(bc backupComponents) error {
+	if err := bc.InitializeForBackup(); err != nil {
+		return err
+	}
+	return bc.SetContext(vssCtxAll)
+}
+
+// checkExposeTarget validates the exposure target and options, including that
+// a mount point is an existing empty directory, and returns the values from
+// exposeTarget. A nil opts is the same as the default options.
+func checkExposeTarget(target string, opts *ExposeOptions) (expose, path string, attr int32, err error) {
+	if opts == nil {
+		opts = new(ExposeOptions)
+	}
+	if expose, path, attr, err = exposeTarget(target, opts); err != nil {
+		return "", "", 0, err
+	}
+	if !opts.Remote && !isDriveLetter(expose) {
+		if err = checkMountDir(expose); err != nil {
+			return "", "", 0, err
+		}
+	}
+	return expose, path, attr, nil
+}
+
+// exposeTarget validates the exposure target and options and returns the
+// normalized target, path from root, and exposure attribute.
+func exposeTarget(target string, opts *ExposeOptions) (expose, path string, attr int32, err error) {
+	if !opts.Remote {
+		if opts.Path != "" {
+			return "", "", 0, errors.New("vss: path can only be specified for remote exposure")
+		}
+		if expose, err = localTarget(target); err != nil {
+			return "", "", 0, err
+		}
+		return expose, "", attrExposedLocally, nil
+	}
+	if err = checkShareName(target); err != nil {
+		return "", "", 0, err
+	}
+	if path, err = sharePath(opts.Path); err != nil {
+		return "", "", 0, err
+	}
+	return target, path, attrExposedRemotely, nil
+}
+
+// localTarget validates a local exposure target and returns it as "X:" for
+// drive letters or with a trailing separator for mount points.
+func localTarget(target string) (string, error) {
+	t := strings.ReplaceAll(target, "/", `\`)
+	if isDriveLetter(strings.TrimSuffix(t, `\`)) {
+		return strings.ToUpper(t[:2]), nil
+	}
+	if len(t) < 4 || !isDriveLetter(t[:2]) || t[2] != '\\' {
+		return "", fmt.Errorf("vss: invalid expose target %#q (must be a drive letter or an absolute directory path)", target)
+	}
+	for _, c := range strings.Split(strings.TrimSuffix(t[3:], `\`), `\`) {
+		if !validName(c) {
+			return "", fmt.Errorf("vss: invalid expose target %#q", target)
+		}
+	}
+	if !strings.HasSuffix(t, `\`) {
+		t += `\`
+	}
+	return t, nil
+}
+
+// checkShareName validates a share name. An empty name is allowed.
+func checkShareName(name string) error {
+	if len(name) > 80 || strings.ContainsAny(name, `"/\[]:|<>+=;,?*`) ||
+		strings.IndexFunc(name, isCtl) >= 0 || strings.Trim(name, ". ") == "" && name != "" {
+		return fmt.Errorf("vss: invalid share name %#q", name)
+	}
+	return nil
+}
+
+// sharePath validates the exposed path of a shadow copy relative to its root.
+func sharePath(p string) (string, error) {
+	p = strings.Trim(strings.ReplaceAll(p, "/", `\`), `\`)
+	if p == "" {
+		return "", nil
+	}
+	for _, c := range strings.Split(p, `\`) {
+		if !validName(c) {
+			return "", fmt.Errorf("vss: invalid expose path %#q", p)
+		}
+	}
+	return p, nil
+}
+
+// checkMountDir verifies that dir is an existing empty directory.
+func checkMountDir(dir string) error {
+	all, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("vss: invalid mount point %#q (%w)", dir, err)
+	}
+	if len(all) > 0 {
+		return fmt.Errorf("vss: mount point %#q is not empty", dir)
+	}
+	return nil
+}
+
+// isDriveLetter returns whether s is a drive letter followed by a colon.
+func isDriveLetter(s string) bool {
+	return len(s) == 2 && s[1] == ':' && ('A' <= s[0] && s[0] <= 'Z' || 'a' <= s[0] && s[0] <= 'z')
+}
+
+// validName returns whether s is a valid Windows file name component that does
+// not refer to the current or parent directory.
+func validName(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `<>:"|?*`) &&
+		strings.IndexFunc(s, isCtl) < 0 && !strings.HasSuffix(s, " ")
+}
+
+// isCtl returns whether r is an ASCII control character.
+func isCtl(r rune) bool { return r < 0x20 || r == 0x7f }
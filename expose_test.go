@@ -0,0 +1,113 @@
+package vss
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExposeTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		opts   ExposeOptions
+		expose string
+		path   string
+		attr   int32
+	}{
+		{"p:", ExposeOptions{}, "P:", "", attrExposedLocally},
+		{`P:\`, ExposeOptions{}, "P:", "", attrExposedLocally},
+		{`C:\mnt\snap`, ExposeOptions{}, `C:\mnt\snap\`, "", attrExposedLocally},
+		{`C:/mnt/snap/`, ExposeOptions{}, `C:\mnt\snap\`, "", attrExposedLocally},
+		{"", ExposeOptions{Remote: true}, "", "", attrExposedRemotely},
+		{"Snap$", ExposeOptions{Remote: true}, "Snap$", "", attrExposedRemotely},
+		{"Snap", ExposeOptions{Remote: true, Path: `/Users/Public/`}, "Snap", `Users\Public`, attrExposedRemotely},
+	}
+	for _, tc := range tests {
+		expose, path, attr, err := exposeTarget(tc.target, &tc.opts)
+		require.NoError(t, err, tc.target)
+		assert.Equal(t, tc.expose, expose, tc.target)
+		assert.Equal(t, tc.path, path, tc.target)
+		assert.Equal(t, tc.attr, attr, tc.target)
+	}
+
+	for _, tc := range []struct {
+		target string
+		opts   ExposeOptions
+	}{
+		{"", ExposeOptions{}},
+		{"P", ExposeOptions{}},
+		{"1:", ExposeOptions{}},
+		{`P:\\`, ExposeOptions{}},
+		{`C:mnt`, ExposeOptions{}},
+		{`mnt\snap`, ExposeOptions{}},
+		{`\\server\share`, ExposeOptions{}},
+		{`\\?\C:\mnt`, ExposeOptions{}},
+		{`C:\mnt\..\Windows`, ExposeOptions{}},
+		{`C:\mnt\a*b`, ExposeOptions{}},
+		{`C:\mnt\a:b`, ExposeOptions{}},
+		{`C:\mnt\a \b`, ExposeOptions{}},
+		{"P:", ExposeOptions{Path: "x"}},
+		{"a/b", ExposeOptions{Remote: true}},
+		{"a,b", ExposeOptions{Remote: true}},
+		{"..", ExposeOptions{Remote: true}},
+		{"a\x01", ExposeOptions{Remote: true}},
+		{string(make([]byte, 81)), ExposeOptions{Remote: true}},
+		{"Snap", ExposeOptions{Remote: true, Path: `a\..\..`}},
+		{"Snap", ExposeOptions{Remote: true, Path: `a\\b`}},
+		{"Snap", ExposeOptions{Remote: true, Path: `a|b`}},
+	} {
+		_, _, _, err := exposeTarget(tc.target, &tc.opts)
+		assert.Error(t, err, "%q %+v", tc.target, tc.opts)
+	}
+}
+
+func TestCheckMountDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, checkMountDir(dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "x"), nil, 0o666))
+	assert.ErrorContains(t, checkMountDir(dir), "not empty")
+	assert.Error(t, checkMountDir(filepath.Join(dir, "x")))
+	assert.Error(t, checkMountDir(filepath.Join(dir, "y")))
+}
+
+func TestExposeMissingMountDir(t *testing.T) {
+	// Mount points are checked before IVssBackupComponents is created
+	dir := filepath.Join(t.TempDir(), "missing")
+	target := `Z:\go-vss\missing`
+	if filepath.VolumeName(dir) != "" {
+		target = dir
+	}
+	err := new(ShadowCopy).Expose(target, nil)
+	assert.ErrorContains(t, err, "invalid mount point")
+}
+
+func TestExposeUnexpose(t *testing.T) {
+	sc := &ShadowCopy{ID: testShadowID(1)}
+	f := new(fakeComponents)
+	require.NoError(t, sc.expose(f, "", `Users`, attrExposedRemotely))
+	assert.Equal(t, sc.ID.String(), sc.ExposedName)
+	assert.Equal(t, "Users", sc.ExposedPath)
+	assert.Equal(t, []string{sc.ID.String() + "|Users|0x20000|"}, f.exposed)
+	assert.Equal(t, int32(vssCtxAll), f.attr)
+	assert.Equal(t, []string{"InitializeForBackup", "SetContext", "ExposeSnapshot"}, f.calls)
+
+	f = new(fakeComponents)
+	require.NoError(t, sc.unexpose(f))
+	assert.Empty(t, sc.ExposedName)
+	assert.Empty(t, sc.ExposedPath)
+	assert.Equal(t, []string{"InitializeForBackup", "SetContext", "UnexposeSnapshot"}, f.calls)
+
+	f = &fakeComponents{fail: []string{"ExposeSnapshot"}}
+	err := sc.expose(f, "P:", "", attrExposedLocally)
+	assert.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Empty(t, sc.ExposedName)
+
+	sc.ExposedName = "P:"
+	f = &fakeComponents{fail: []string{"SetContext"}}
+	assert.Error(t, sc.unexpose(f))
+	assert.Equal(t, "P:", sc.ExposedName)
+	assert.NotContains(t, f.calls, "UnexposeSnapshot")
+}
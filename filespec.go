@@ -0,0 +1,240 @@
+package vss
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FileMatcher reports whether files are included in a set of file
+// specifications, such as writer include and exclude lists or the
+// FilesNotToSnapshot and FilesNotToBackup registry lists. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/backup/registry-keys-for-backup-and-restore
+//
+// The zero value matches nothing.
+type FileMatcher struct {
+	rules []fileRule
+}
+
+// fileRule is a compiled file specification. All fields are upper-case with
+// '\' separators.
+type fileRule struct {
+	vol       string // Volume, such as "C:", or "" for any volume
+	dir       string // Directory without the volume or trailing separator
+	pattern   string // File name pattern
+	recursive bool
+}
+
+// NewFileMatcher compiles specs into a FileMatcher. Environment variable
+// references of the form %NAME% in spec paths are expanded using env, which
+// contains "NAME=value" entries as returned by os.Environ. Variable names are
+// case-insensitive and an error is returned if a variable is not defined.
+// Other tokens, such as $UserProfile$, are not expanded.
+func NewFileMatcher(specs []FileSpec, env []string) (*FileMatcher, error) {
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		// Windows environment blocks contain entries like "=C:=C:\"
+		if k, v, ok := strings.Cut(kv, "="); ok && k != "" {
+			vars[strings.ToUpper(k)] = v
+		}
+	}
+	m := &FileMatcher{rules: make([]fileRule, 0, len(specs))}
+	var errs []error
+	for _, fs := range specs {
+		p, err := expandEnv(fs.Path, vars)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("vss: failed to expand %s (%w)", fs.Path, err))
+			continue
+		}
+		fs.Path = p
+		m.rules = append(m.rules, newFileRule(fs))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseFileList parses entries of the FilesNotToSnapshot and FilesNotToBackup
+// registry values. Each entry is a path ending with a file name pattern,
+// optionally followed by "/s" to include subdirectories. Entries without a
+// volume, such as `\Pagefile.sys`, apply to all volumes. Empty entries are
+// ignored.
+func ParseFileList(entries []string) ([]FileSpec, error) {
+	var all []FileSpec
+	for _, e := range entries {
+		s := strings.TrimSpace(e)
+		var recursive bool
+		if n := len(s) - len("/s"); n >= 0 && strings.EqualFold(s[n:], "/s") &&
+			(n == 0 || s[n-1] == ' ' || s[n-1] == '\t') {
+			s, recursive = strings.TrimSpace(s[:n]), true
+		}
+		if s == "" {
+			if recursive {
+				return nil, fmt.Errorf("vss: invalid file list entry: %q", e)
+			}
+			continue
+		}
+		i := strings.LastIndexAny(s, `\/`)
+		if i < 0 || i == len(s)-1 {
+			return nil, fmt.Errorf("vss: invalid file list entry: %q", e)
+		}
+		dir := s[:i]
+		if dir == "" {
+			dir = `\`
+		}
+		all = append(all, FileSpec{Path: dir, FileSpec: s[i+1:], Recursive: recursive})
+	}
+	return all, nil
+}
+
+// Match returns whether path is included in any of the file specifications.
+// Path must be an absolute path, preferably starting with a drive letter. Paths
+// without a volume only match specifications that apply to all volumes.
+// Matching is case-insensitive.
+func (m *FileMatcher) Match(path string) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	vol, dir, name, ok := splitFilePath(path)
+	if !ok {
+		return false
+	}
+	for i := range m.rules {
+		if m.rules[i].match(vol, dir, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newFileRule compiles fs without expanding environment variables.
+func newFileRule(fs FileSpec) fileRule {
+	vol, dir := cutVolume(strings.ToUpper(strings.ReplaceAll(fs.Path, "/", `\`)))
+	return fileRule{
+		vol:       vol,
+		dir:       strings.TrimRight(dir, `\`),
+		pattern:   strings.ToUpper(fs.FileSpec),
+		recursive: fs.Recursive,
+	}
+}
+
+// match returns whether the file specified by upper-case vol, dir, and name
+// matches r.
+func (r *fileRule) match(vol, dir, name string) bool {
+	if r.vol != "" && r.vol != vol {
+		return false
+	}
+	if dir != r.dir && !(r.recursive && len(dir) > len(r.dir) &&
+		dir[len(r.dir)] == '\\' && dir[:len(r.dir)] == r.dir) {
+		return false
+	}
+	return wildcardMatch(r.pattern, name)
+}
+
+// splitFilePath splits an absolute path into its upper-case volume, directory,
+// and file name components.
+func splitFilePath(path string) (vol, dir, name string, ok bool) {
+	vol, rest := cutVolume(strings.ToUpper(strings.ReplaceAll(path, "/", `\`)))
+	i := strings.LastIndexByte(rest, '\\')
+	if i < 0 || i == len(rest)-1 {
+		return "", "", "", false
+	}
+	return vol, rest[:i], rest[i+1:], true
+}
+
+// cutVolume splits an upper-case path into its volume and the rest of the path.
+// Drive letters are returned without any `\\?\` prefix. Volume GUID paths,
+// device paths, and UNC shares are also recognized. The volume is empty if the
+// path does not specify one.
+func cutVolume(p string) (vol, rest string) {
+	t, prefixed := strings.CutPrefix(p, `\\?\`)
+	if !prefixed {
+		t, prefixed = strings.CutPrefix(p, `\\.\`)
+	}
+	if len(t) >= 2 && t[1] == ':' && 'A' <= t[0] && t[0] <= 'Z' {
+		return t[:2], t[2:]
+	}
+	var n int // Number of components in the volume name
+	switch {
+	case prefixed && strings.HasPrefix(t, "VOLUME{"):
+		n = 1
+	case prefixed && (strings.HasPrefix(t, `GLOBALROOT\DEVICE\`) || strings.HasPrefix(t, `UNC\`)):
+		n = 3
+	case !prefixed && strings.HasPrefix(p, `\\`):
+		t, n = p[2:], 2
+	default:
+		return "", p
+	}
+	var i, k int
+	for ; n > 0; n-- {
+		j := strings.IndexByte(t[i:], '\\')
+		if j < 0 {
+			return p, ""
+		}
+		k = i + j
+		i = k + 1
+	}
+	return p[:len(p)-len(t)+k], t[k:]
+}
+
+// expandEnv expands %NAME% references in s using upper-case vars. A '%' that
+// is not followed by a closing '%' is copied verbatim.
+func expandEnv(s string, vars map[string]string) (string, error) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i+1:], '%')
+		if j < 0 {
+			break
+		}
+		name := s[i+1 : i+1+j]
+		v, ok := vars[strings.ToUpper(name)]
+		if !ok {
+			return "", fmt.Errorf("undefined environment variable: %%%s%%", name)
+		}
+		b.WriteString(s[:i])
+		b.WriteString(v)
+		s = s[i+j+2:]
+	}
+	b.WriteString(s)
+	return b.String(), nil
+}
+
+// wildcardMatch returns whether name matches a Windows file name pattern
+// containing '*' and '?' wildcards. Matching is case-insensitive and "*.*"
+// matches all names, including those without an extension.
+func wildcardMatch(pattern, name string) bool {
+	if pattern == "*.*" {
+		pattern = "*"
+	}
+	p, s := []rune(strings.ToUpper(pattern)), []rune(strings.ToUpper(name))
+	var pi, si int
+	star, next := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == s[si]):
+			pi++
+			si++
+		case pi < len(p) && p[pi] == '*':
+			star, next = pi, si
+			pi++
+		case star >= 0:
+			next++
+			pi, si = star+1, next
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
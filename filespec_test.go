@@ -0,0 +1,165 @@
+package vss
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMatcher(t *testing.T) {
+	specs, err := ParseFileList([]string{
+		`%SystemRoot%\Temp\* /s`,
+		`\Pagefile.sys`,
+		`\System Volume Information\* /S`,
+		`%ProgramData%\App\*.tmp`,
+		`D:/Cache/*.*  /s`,
+		`\\?\Volume{11111111-2222-3333-4444-555555555555}\Dump\*.dmp`,
+		``,
+		`  `,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []FileSpec{
+		{Path: `%SystemRoot%\Temp`, FileSpec: "*", Recursive: true},
+		{Path: `\`, FileSpec: "Pagefile.sys"},
+		{Path: `\System Volume Information`, FileSpec: "*", Recursive: true},
+		{Path: `%ProgramData%\App`, FileSpec: "*.tmp"},
+		{Path: `D:/Cache`, FileSpec: "*.*", Recursive: true},
+		{Path: `\\?\Volume{11111111-2222-3333-4444-555555555555}\Dump`, FileSpec: "*.dmp"},
+	}, specs)
+
+	env := []string{"=C:=C:\\", "SYSTEMROOT=C:\\Windows", "programdata=C:\\ProgramData"}
+	m, err := NewFileMatcher(specs, env)
+	require.NoError(t, err)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{`C:\Windows\Temp\a.log`, true},
+		{`c:\windows\temp\x\y\z`, true},
+		{`\\?\C:\WINDOWS\TEMP\a`, true},
+		{`C:\Windows\Temp`, false},
+		{`C:\Windows\TempX\a`, false},
+		{`D:\Windows\Temp\a`, false},
+		{`C:\pagefile.sys`, true},
+		{`E:\PAGEFILE.SYS`, true},
+		{`\pagefile.sys`, true},
+		{`C:\x\pagefile.sys`, false},
+		{`E:\System Volume Information\{guid}\x`, true},
+		{`C:\ProgramData\App\a.TMP`, true},
+		{`C:\ProgramData\App\sub\a.tmp`, false},
+		{`D:\Cache\README`, true},
+		{`D:\Cache\a\b.c`, true},
+		{`\\?\Volume{11111111-2222-3333-4444-555555555555}\Dump\mem.dmp`, true},
+		{`\\?\volume{11111111-2222-3333-4444-555555555555}\dump\MEM.DMP`, true},
+		{`C:\Dump\mem.dmp`, false},
+		{`C:`, false},
+		{`C:\`, false},
+		{`pagefile.sys`, false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, m.Match(tc.path), tc.path)
+	}
+
+	_, err = NewFileMatcher(specs, env[:2])
+	assert.ErrorContains(t, err, "%ProgramData%")
+	assert.False(t, new(FileMatcher).Match(`C:\pagefile.sys`))
+	assert.False(t, (*FileMatcher)(nil).Match(`C:\pagefile.sys`))
+}
+
+func TestParseFileListErrors(t *testing.T) {
+	for _, e := range []string{`/s`, `C:\Temp\`, `pagefile.sys`, `\ /s`} {
+		_, err := ParseFileList([]string{e})
+		assert.Error(t, err, e)
+	}
+	specs, err := ParseFileList([]string{`C:\Temp\files/s`})
+	require.NoError(t, err)
+	assert.Equal(t, []FileSpec{{Path: `C:\Temp\files`, FileSpec: "s"}}, specs)
+}
+
+func TestCutVolume(t *testing.T) {
+	tests := []struct{ path, vol, rest string }{
+		{``, ``, ``},
+		{`\X`, ``, `\X`},
+		{`C:`, `C:`, ``},
+		{`C:\X`, `C:`, `\X`},
+		{`\\?\C:\X`, `C:`, `\X`},
+		{`\\.\C:\X`, `C:`, `\X`},
+		{`\\?\VOLUME{1}\X`, `\\?\VOLUME{1}`, `\X`},
+		{`\\?\VOLUME{1}`, `\\?\VOLUME{1}`, ``},
+		{`\\?\GLOBALROOT\DEVICE\HARDDISKVOLUMESHADOWCOPY1\X`, `\\?\GLOBALROOT\DEVICE\HARDDISKVOLUMESHADOWCOPY1`, `\X`},
+		{`\\SERVER\SHARE\X`, `\\SERVER\SHARE`, `\X`},
+		{`\\?\UNC\SERVER\SHARE\X`, `\\?\UNC\SERVER\SHARE`, `\X`},
+		{`\\SERVER`, `\\SERVER`, ``},
+	}
+	for _, tc := range tests {
+		vol, rest := cutVolume(tc.path)
+		assert.Equal(t, tc.vol, vol, tc.path)
+		assert.Equal(t, tc.rest, rest, tc.path)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	vars := map[string]string{"A": "1", "B": ""}
+	for in, want := range map[string]string{
+		"":          "",
+		"x":         "x",
+		"%a%":       "1",
+		"x%A%y%b%z": "x1yz",
+		"%a%%a%":    "11",
+		"100%":      "100%",
+		"%a%%":      "1%",
+	} {
+		got, err := expandEnv(in, vars)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := expandEnv("%C%", vars)
+	assert.Error(t, err)
+	_, err = expandEnv("%%", vars)
+	assert.Error(t, err)
+}
+
+func TestFileSpecMatch(t *testing.T) {
+	tests := []struct {
+		spec FileSpec
+		file string
+		want bool
+	}{
+		{FileSpec{Path: `C:\Data`, FileSpec: "*.mdf"}, `C:\Data\a.mdf`, true},
+		{FileSpec{Path: `C:\Data\`, FileSpec: "*.mdf"}, `c:\data\A.MDF`, true},
+		{FileSpec{Path: `C:\Data`, FileSpec: "*.mdf"}, `C:\Data\a.ldf`, false},
+		{FileSpec{Path: `C:\Data`, FileSpec: "*.mdf"}, `C:\Data\x\a.mdf`, false},
+		{FileSpec{Path: `C:\Data`, FileSpec: "*.mdf", Recursive: true}, `C:\Data\x\a.mdf`, true},
+		{FileSpec{Path: `C:\Data`, FileSpec: "*", Recursive: true}, `C:\DataX\a.mdf`, false},
+		{FileSpec{Path: `C:\Data`, FileSpec: "a?.*"}, `C:\Data\ab`, false},
+		{FileSpec{Path: `C:\Data`, FileSpec: "a?.*"}, `C:\Data\ab.c`, true},
+		{FileSpec{Path: `C:\Data`, FileSpec: "*.*"}, `C:\Data\README`, true},
+		{FileSpec{Path: `C:\Data`, FileSpec: "*"}, `a.mdf`, false},
+	}
+	for _, tc := range tests {
+		m, err := NewFileMatcher([]FileSpec{tc.spec}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, m.Match(tc.file), "%+v %s", tc.spec, tc.file)
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbY", false},
+		{"*log", "mastlog", true},
+		{"ma?t*", "MASTLOG.LDF", true},
+		{"Ä*", "äb", true},
+		{"**", "x", true},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, wildcardMatch(tc.pattern, tc.name), "%q %q", tc.pattern, tc.name)
+	}
+}
@@ -0,0 +1,362 @@
+package vss
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-vss/vsspath"
+)
+
+// FS is a read-only file system that supports reading directories and files
+// and getting file information without opening files.
+type FS interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+}
+
+// FS returns the contents of the shadow copy as a file system. Names are
+// relative to the root of the original volume, such as "Users/x/a.txt".
+func (sc *ShadowCopy) FS() FS {
+	return os.DirFS(sc.DeviceObject + string(filepath.Separator)).(FS)
+}
+
+// FSName converts an absolute path on a local volume, such as `C:\Users\x`,
+// into the corresponding VolumeFS name, such as "C:/Users/x". The path may use
+// any mount point, a `\\?\` prefix, or a volume GUID name, in which case the
+// name starts with "Volume{guid}".
+func FSName(p string) (string, error) {
+	s, err := cleanLivePath(p)
+	if err != nil {
+		return "", err
+	}
+	if vol := volumeGUIDPrefix(s); vol != "" {
+		v, err := ParseVolumeGUIDName(vol)
+		if err != nil {
+			return "", err
+		}
+		s = v.String()[len(`\\?\`):] + s[len(vol):]
+	}
+	return strings.TrimSuffix(vsspath.ToSlash(s), "/"), nil
+}
+
+// VolumeFS is a read-only file system that presents the shadow copies of
+// multiple volumes at the original locations of their files. Names are
+// original absolute paths with '/' separators, such as "C:/Users/x", which
+// can be obtained with FSName. Each shadow copy is available at all mount
+// points of its volume and at its volume GUID name. Drive letters and mounted
+// folders are matched without regard to case.
+//
+// The root directory and the parents of mounted folders that are not on a
+// volume with a shadow copy contain only the mount points below them.
+type VolumeFS struct {
+	mounts []fsMount           // Sorted by decreasing name length
+	dirs   map[string][]string // Child names of mount point ancestors by lower-case name
+	names  map[string]string   // Names of mount point ancestors by lower-case name
+}
+
+// fsMount is a shadow copy file system mounted at name.
+type fsMount struct {
+	name string
+	fsys fs.FS
+}
+
+// NewVolumeFS returns a file system that presents the specified shadow copies
+// at their original locations. It returns an error if there are multiple
+// shadow copies of the same volume.
+func NewVolumeFS(all []*ShadowCopy) (*VolumeFS, error) {
+	return newVolumeFS(sysTopology, all, func(sc *ShadowCopy) fs.FS { return sc.FS() })
+}
+
+// newVolumeFS implements NewVolumeFS using topology t and opening the file
+// system of each shadow copy with open.
+func newVolumeFS(t topology, all []*ShadowCopy, open func(sc *ShadowCopy) fs.FS) (*VolumeFS, error) {
+	v := &VolumeFS{
+		dirs:  map[string][]string{".": nil},
+		names: map[string]string{".": "."},
+	}
+	seen := make(map[VolumeGUIDName]ShadowID, len(all))
+	for _, sc := range all {
+		if id, ok := seen[sc.VolumeName]; ok {
+			return nil, fmt.Errorf("vss: multiple shadow copies of volume %s (%s and %s)", sc.VolumeName, id, sc.ID)
+		}
+		seen[sc.VolumeName] = sc.ID
+		mounts, err := t.paths(sc.VolumeName)
+		if err != nil {
+			return nil, err
+		}
+		fsys := open(sc)
+		for _, m := range append([]string{sc.VolumeName.String()}, mounts...) {
+			name, err := FSName(m)
+			if err != nil {
+				return nil, err
+			}
+			v.mounts = append(v.mounts, fsMount{name, fsys})
+			v.addParents(name)
+		}
+	}
+	slices.SortStableFunc(v.mounts, func(a, b fsMount) int { return len(b.name) - len(a.name) })
+	return v, nil
+}
+
+// addParents adds name to the children of its parent directories.
+func (v *VolumeFS) addParents(name string) {
+	for {
+		dir, base := path.Dir(name), path.Base(name)
+		key := strings.ToLower(dir)
+		if !slices.ContainsFunc(v.dirs[key], func(c string) bool { return strings.EqualFold(c, base) }) {
+			v.dirs[key] = append(v.dirs[key], base)
+		}
+		if _, ok := v.names[key]; ok {
+			return
+		}
+		v.names[key] = dir
+		name = dir
+	}
+}
+
+// Open implements fs.FS.
+func (v *VolumeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	key := strings.ToLower(name)
+	_, anc := v.names[key]
+	if m, rel, ok := v.route(name); ok {
+		f, err := m.fsys.Open(rel)
+		if err == nil {
+			return v.wrap(f, name, rel)
+		}
+		if !anc || !errors.Is(err, fs.ErrNotExist) {
+			return nil, renamePathError(err, name)
+		}
+	}
+	if !anc {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := v.children(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsDir{info: fsDirInfo(path.Base(name)), entries: entries, loaded: true, name: name}, nil
+}
+
+// wrap returns file f opened as name, which is rel in its shadow copy. Mount
+// roots are renamed to the base of name, and directories containing mount
+// points are wrapped to replace their entries.
+func (v *VolumeFS) wrap(f fs.File, name, rel string) (fs.File, error) {
+	if rel != "." && v.dirs[strings.ToLower(name)] == nil {
+		return f, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, renamePathError(err, name)
+	}
+	if rel == "." {
+		info = fsNamedInfo{info, path.Base(name)}
+	}
+	return &fsDir{File: f, info: info, name: name, v: v}, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (v *VolumeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not implemented")}
+	}
+	list, err := d.ReadDir(-1)
+	slices.SortFunc(list, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return list, err
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (v *VolumeFS) ReadFile(name string) ([]byte, error) {
+	if m, rel, ok := v.route(name); ok && rel != "." && v.direct(name) {
+		b, err := fs.ReadFile(m.fsys, rel)
+		return b, renamePathError(err, name)
+	}
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(f)
+}
+
+// Stat implements fs.StatFS.
+func (v *VolumeFS) Stat(name string) (fs.FileInfo, error) {
+	if m, rel, ok := v.route(name); ok && rel != "." && v.direct(name) {
+		info, err := fs.Stat(m.fsys, rel)
+		return info, renamePathError(err, name)
+	}
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return f.Stat()
+}
+
+// direct returns whether name can be accessed directly in its shadow copy
+// without Open.
+func (v *VolumeFS) direct(name string) bool {
+	_, anc := v.names[strings.ToLower(name)]
+	return fs.ValidPath(name) && !anc
+}
+
+// route returns the file system containing name and the name relative to its
+// root.
+func (v *VolumeFS) route(name string) (m *fsMount, rel string, ok bool) {
+	for i := range v.mounts {
+		m = &v.mounts[i]
+		if len(name) < len(m.name) || !strings.EqualFold(name[:len(m.name)], m.name) {
+			continue
+		}
+		if rest := name[len(m.name):]; rest == "" {
+			return m, ".", true
+		} else if rest[0] == '/' {
+			return m, rest[1:], true
+		}
+	}
+	return nil, "", false
+}
+
+// children returns the entries for the mount points and their ancestors in
+// directory dir.
+func (v *VolumeFS) children(dir string) ([]fs.DirEntry, error) {
+	names := v.dirs[strings.ToLower(dir)]
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, c := range names {
+		info, err := v.Stat(path.Join(dir, c))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// fsDir is a directory of VolumeFS. It is either a directory containing only
+// mount points and their ancestors or an open directory of a shadow copy,
+// whose entries for mount points are replaced with the mounted roots.
+type fsDir struct {
+	fs.File // Directory of a shadow copy or nil
+	info    fs.FileInfo
+	name    string
+	v       *VolumeFS // Set to load entries from File
+	entries []fs.DirEntry
+	loaded  bool
+	off     int
+}
+
+// Stat implements fs.File.
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+// Read implements fs.File.
+func (d *fsDir) Read(b []byte) (int, error) {
+	if d.File != nil {
+		return d.File.Read(b)
+	}
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+// Close implements fs.File.
+func (d *fsDir) Close() error {
+	if d.File != nil {
+		return d.File.Close()
+	}
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		if err := d.load(); err != nil {
+			return nil, err
+		}
+	}
+	rem := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return slices.Clone(rem), nil
+	}
+	if len(rem) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rem))
+	d.off += n
+	return slices.Clone(rem[:n]), nil
+}
+
+// load reads all entries of the shadow copy directory and replaces the entries
+// of mount points and their ancestors.
+func (d *fsDir) load() error {
+	rd, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return &fs.PathError{Op: "readdir", Path: d.name, Err: errors.New("not a directory")}
+	}
+	all, err := rd.ReadDir(-1)
+	if err != nil {
+		return renamePathError(err, d.name)
+	}
+	over, err := d.v.children(d.name)
+	if err != nil {
+		return err
+	}
+	for _, e := range over {
+		i := slices.IndexFunc(all, func(a fs.DirEntry) bool { return strings.EqualFold(a.Name(), e.Name()) })
+		if i < 0 {
+			all = append(all, e)
+		} else {
+			info, _ := e.Info()
+			all[i] = fs.FileInfoToDirEntry(fsNamedInfo{info, all[i].Name()})
+		}
+	}
+	slices.SortFunc(all, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	d.entries, d.loaded = all, true
+	return nil
+}
+
+// fsNamedInfo is a fs.FileInfo with a different name.
+type fsNamedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+// Name implements fs.FileInfo.
+func (fi fsNamedInfo) Name() string { return fi.name }
+
+// fsDirInfo is the fs.FileInfo of a directory containing only mount points.
+type fsDirInfo string
+
+func (fi fsDirInfo) Name() string    { return string(fi) }
+func (fsDirInfo) Size() int64        { return 0 }
+func (fsDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (fsDirInfo) ModTime() time.Time { return time.Time{} }
+func (fsDirInfo) IsDir() bool        { return true }
+func (fsDirInfo) Sys() any           { return nil }
+
+// renamePathError replaces the path in a *fs.PathError with name, so that
+// errors refer to VolumeFS names.
+func renamePathError(err error, name string) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: pe.Op, Path: name, Err: pe.Err}
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package vss
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testVolumeFS returns a VolumeFS of in-memory shadow copies of the specified
+// volumes in testTopology.
+func testVolumeFS(t *testing.T, vols ...VolumeGUIDName) *VolumeFS {
+	t.Helper()
+	dir := &fstest.MapFile{Mode: fs.ModeDir | 0o755}
+	files := map[VolumeGUIDName]fstest.MapFS{
+		volC: {
+			"Users/x/a.txt": {Data: []byte("C:a")},
+			"Mnt/Data":      dir,
+		},
+		volD: {
+			"a.txt":     {Data: []byte("D:a")},
+			"data/logs": dir,
+		},
+		volE: {
+			"1.log": {Data: []byte("E:1")},
+		},
+	}
+	all := make([]*ShadowCopy, len(vols))
+	for i, vol := range vols {
+		all[i] = &ShadowCopy{ID: testShadowID(i + 1), VolumeName: vol}
+	}
+	v, err := newVolumeFS(testTopology, all, func(sc *ShadowCopy) fs.FS { return files[sc.VolumeName] })
+	require.NoError(t, err)
+	return v
+}
+
+func TestVolumeFS(t *testing.T) {
+	v := testVolumeFS(t, volC, volD, volE)
+	require.NoError(t, fstest.TestFS(v,
+		"C:/Users/x/a.txt",
+		"C:/Mnt/Data/a.txt",
+		"C:/Mnt/Data/data/logs/1.log",
+		"D:/a.txt",
+		"D:/data/logs/1.log",
+		"Volume{22222222-2222-2222-2222-222222222222}/a.txt",
+		"Volume{33333333-3333-3333-3333-333333333333}/1.log",
+	))
+
+	for name, want := range map[string]string{
+		"C:/Users/x/a.txt":            "C:a",
+		"c:/users/x/a.txt":            "",
+		"c:/mnt/data/a.txt":           "D:a",
+		"C:/MNT/DATA/DATA/LOGS/1.log": "E:1",
+		"d:/data/logs/1.log":          "E:1",
+	} {
+		b, err := v.ReadFile(name)
+		if want == "" {
+			assert.ErrorIs(t, err, fs.ErrNotExist, "%s", name)
+			continue
+		}
+		require.NoError(t, err, "%s", name)
+		assert.Equal(t, want, string(b), "%s", name)
+	}
+
+	fi, err := v.Stat("c:/mnt/data")
+	require.NoError(t, err)
+	assert.Equal(t, "data", fi.Name())
+	assert.True(t, fi.IsDir())
+
+	_, err = v.Open("D:/b.txt")
+	var pe *fs.PathError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "D:/b.txt", pe.Path)
+	_, err = v.ReadFile("C:/Users")
+	assert.Error(t, err)
+	_, err = v.Stat("C:/../x")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+}
+
+func TestVolumeFSPartial(t *testing.T) {
+	v := testVolumeFS(t, volE)
+	require.NoError(t, fstest.TestFS(v,
+		"C:/Mnt/Data/data/logs/1.log",
+		"D:/data/logs/1.log",
+		"Volume{33333333-3333-3333-3333-333333333333}/1.log",
+	))
+	names := func(name string) (all []string) {
+		list, err := v.ReadDir(name)
+		require.NoError(t, err)
+		for _, e := range list {
+			all = append(all, e.Name())
+		}
+		return
+	}
+	assert.Equal(t, []string{"C:", "D:", "Volume{33333333-3333-3333-3333-333333333333}"}, names("."))
+	assert.Equal(t, []string{"Mnt"}, names("C:"))
+	assert.Equal(t, []string{"logs"}, names("D:/data"))
+	_, err := v.Open("D:/a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = v.ReadFile("D:/data")
+	assert.Error(t, err)
+}
+
+func TestNewVolumeFSDuplicate(t *testing.T) {
+	all := []*ShadowCopy{
+		{ID: testShadowID(1), VolumeName: volD},
+		{ID: testShadowID(2), VolumeName: volD},
+	}
+	_, err := newVolumeFS(testTopology, all, func(*ShadowCopy) fs.FS { return fstest.MapFS{} })
+	assert.ErrorContains(t, err, "multiple shadow copies")
+}
+
+func TestFSName(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`C:\`, "C:"},
+		{`c:\`, "C:"},
+		{`C:\Users\x`, "C:/Users/x"},
+		{`C:/Users/x/`, "C:/Users/x"},
+		{`\\?\C:\Users`, "C:/Users"},
+		{volD.String(), "Volume{22222222-2222-2222-2222-222222222222}"},
+		{volD.String() + `data\logs`, "Volume{22222222-2222-2222-2222-222222222222}/data/logs"},
+	}
+	for _, tc := range tests {
+		got, err := FSName(tc.in)
+		if assert.NoError(t, err, "%s", tc.in) {
+			assert.Equal(t, tc.want, got, "%s", tc.in)
+		}
+	}
+	for _, p := range []string{"", `Users\x`, `\\server\share\x`} {
+		_, err := FSName(p)
+		assert.Error(t, err, "%s", p)
+	}
+}
+
+func TestShadowCopyFS(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "Users", "x"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Users", "x", "a.txt"), []byte("a"), 0o644))
+	sc := &ShadowCopy{DeviceObject: dir}
+	require.NoError(t, fstest.TestFS(sc.FS(), "Users/x/a.txt"))
+}
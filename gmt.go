@@ -0,0 +1,77 @@
+package vss
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-vss/vsspath"
+)
+
+// GMTToken returns the @GMT token that SMB clients use to access the shadow
+// copy as a previous version, such as "@GMT-2024.01.31-13.45.06".
+func (sc *ShadowCopy) GMTToken() string {
+	return vsspath.FormatGMT(sc.InstallDate)
+}
+
+// FindGMT returns the shadow copy of volume vol whose InstallDate matches the
+// @GMT token tok to the second. The volume is required, because the shadow
+// copies of a multi-volume set share the same InstallDate. The returned error
+// contains os.ErrNotExist if there is no match.
+func FindGMT(all []*ShadowCopy, vol VolumeGUIDName, tok string) (*ShadowCopy, error) {
+	t, err := vsspath.ParseGMT(tok)
+	if err != nil {
+		return nil, fmt.Errorf("vss: invalid @GMT token %#q", tok)
+	}
+	return findGMT(all, vol, t)
+}
+
+// RewriteGMT converts path p, which contains an @GMT token and is relative to
+// the root of volume vol, into the corresponding path under the DeviceObject of
+// the matching shadow copy. For example, `Data\@GMT-2024.01.31-13.45.06\a.txt`
+// becomes `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Data\a.txt`. Both '\'
+// and '/' are accepted as separators in p. Shadow copies are selected as in
+// FindGMT.
+func RewriteGMT(all []*ShadowCopy, vol VolumeGUIDName, p string) (string, error) {
+	before, t, after, ok := vsspath.CutGMT(p)
+	if !ok {
+		return "", fmt.Errorf("vss: path does not contain an @GMT token: %#q", p)
+	}
+	if strings.ContainsRune(before, ':') || strings.HasPrefix(before, `\\`) ||
+		strings.HasPrefix(before, "//") {
+		return "", fmt.Errorf("vss: @GMT path must be relative to the volume root: %#q", p)
+	}
+	sc, err := findGMT(all, vol, t)
+	if err != nil {
+		return "", err
+	}
+	dev, err := vsspath.Parse(sc.DeviceObject)
+	if err != nil {
+		return "", fmt.Errorf("vss: invalid DeviceObject of shadow copy %s: %#q", sc.ID, sc.DeviceObject)
+	}
+	return dev.Join(before, after).String(), nil
+}
+
+// findGMT returns the shadow copy of vol created at time t with second
+// precision.
+func findGMT(all []*ShadowCopy, vol VolumeGUIDName, t time.Time) (*ShadowCopy, error) {
+	if vol.IsZero() {
+		return nil, fmt.Errorf("vss: volume required to match %s (%w)", vsspath.FormatGMT(t), os.ErrInvalid)
+	}
+	var match *ShadowCopy
+	for _, sc := range all {
+		if !sc.InstallDate.Truncate(time.Second).Equal(t) || sc.VolumeName != vol {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("vss: multiple shadow copies match %s (%s and %s)",
+				vsspath.FormatGMT(t), match.ID, sc.ID)
+		}
+		match = sc
+	}
+	if match == nil {
+		return nil, fmt.Errorf("vss: no shadow copy matches %s (%w)", vsspath.FormatGMT(t), os.ErrNotExist)
+	}
+	return match, nil
+}
@@ -0,0 +1,113 @@
+package vss
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gmtShadowCopies() []*ShadowCopy {
+	est := time.FixedZone("EST", -5*3600)
+	return []*ShadowCopy{{
+		ID:           testShadowID(1),
+		InstallDate:  time.Date(2024, 1, 31, 8, 45, 6, 123456000, est),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`,
+		VolumeName:   volC,
+	}, {
+		ID:           testShadowID(2),
+		InstallDate:  time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy2`,
+		VolumeName:   volD,
+	}, {
+		ID:           testShadowID(3),
+		InstallDate:  time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy3`,
+		VolumeName:   volC,
+	}, {
+		ID:           testShadowID(4),
+		InstallDate:  time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		DeviceObject: `C:\invalid`,
+		VolumeName:   volC,
+	}}
+}
+
+func TestGMTToken(t *testing.T) {
+	all := gmtShadowCopies()
+	assert.Equal(t, "@GMT-2024.01.31-13.45.06", all[0].GMTToken())
+	assert.Equal(t, "@GMT-2024.01.31-13.45.06", all[1].GMTToken())
+	assert.Equal(t, "@GMT-2024.02.01-00.00.00", all[2].GMTToken())
+}
+
+func TestFindGMT(t *testing.T) {
+	all := gmtShadowCopies()
+	sc, err := FindGMT(all, volC, "@GMT-2024.01.31-13.45.06")
+	require.NoError(t, err)
+	assert.Equal(t, testShadowID(1), sc.ID)
+	sc, err = FindGMT(all, volD, "@GMT-2024.01.31-13.45.06")
+	require.NoError(t, err)
+	assert.Equal(t, testShadowID(2), sc.ID)
+	sc, err = FindGMT(all, volC, "@GMT-2024.02.01-00.00.00")
+	require.NoError(t, err)
+	assert.Equal(t, testShadowID(3), sc.ID)
+
+	_, err = FindGMT(all, VolumeGUIDName{}, "@GMT-2024.02.01-00.00.00")
+	assert.ErrorIs(t, err, os.ErrInvalid)
+	_, err = FindGMT(append(all, &ShadowCopy{ID: testShadowID(5), InstallDate: all[0].InstallDate, VolumeName: volC}),
+		volC, "@GMT-2024.01.31-13.45.06")
+	assert.ErrorContains(t, err, "multiple")
+	_, err = FindGMT(all, volD, "@GMT-2024.02.01-00.00.00")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = FindGMT(all, volC, "@GMT-2024.01.31-13.45.07")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = FindGMT(all, volC, "@GMT-2024.01.31")
+	assert.Error(t, err)
+}
+
+func TestFindGMTSet(t *testing.T) {
+	// Shadow copies created by one CreateSet call share the set InstallDate
+	date := time.Date(2024, 4, 2, 10, 0, 0, 0, time.UTC)
+	all := []*ShadowCopy{
+		{ID: testShadowID(1), SetID: testSetID(1), InstallDate: date, VolumeName: volC},
+		{ID: testShadowID(2), SetID: testSetID(1), InstallDate: date, VolumeName: volD},
+	}
+	for i, vol := range []VolumeGUIDName{volC, volD} {
+		sc, err := FindGMT(all, vol, "@GMT-2024.04.02-10.00.00")
+		require.NoError(t, err)
+		assert.Equal(t, all[i], sc)
+	}
+	_, err := FindGMT(all, VolumeGUIDName{}, "@GMT-2024.04.02-10.00.00")
+	assert.ErrorIs(t, err, os.ErrInvalid)
+}
+
+func TestRewriteGMT(t *testing.T) {
+	all := gmtShadowCopies()
+	vol := volC
+	tests := []struct{ in, want string }{
+		{`@GMT-2024.02.01-00.00.00`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy3\`},
+		{`\@GMT-2024.02.01-00.00.00\`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy3\`},
+		{`Data\@GMT-2024.01.31-13.45.06\a.txt`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Data\a.txt`},
+		{`/Data/Sub/@GMT-2024.01.31-13.45.06/x/y`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Data\Sub\x\y`},
+		{`..\@GMT-2024.01.31-13.45.06\..\..\x`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\x`},
+	}
+	for _, tc := range tests {
+		got, err := RewriteGMT(all, vol, tc.in)
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.want, got, tc.in)
+	}
+	for _, in := range []string{
+		`Data\a.txt`,
+		`C:\Data\@GMT-2024.01.31-13.45.06\a.txt`,
+		`\\server\share\@GMT-2024.01.31-13.45.06\a.txt`,
+		`//server/share/@GMT-2024.01.31-13.45.06/a.txt`,
+		`@GMT-2024.01.31-13.45.07\a.txt`,
+		`@GMT-2024.03.01-00.00.00\a.txt`,
+	} {
+		_, err := RewriteGMT(all, vol, in)
+		assert.Error(t, err, in)
+	}
+	_, err := RewriteGMT(all, VolumeGUIDName{}, `@GMT-2024.02.01-00.00.00`)
+	assert.ErrorIs(t, err, os.ErrInvalid)
+}
@@ -1,11 +1,13 @@
 module github.com/mxk/go-vss
 
-go 1.21
+go 1.22
 
 require (
 	github.com/go-ole/go-ole v1.3.0
+	github.com/klauspost/compress v1.18.0
 	github.com/stretchr/testify v1.8.4
 	golang.org/x/sys v0.15.0
+	golang.org/x/text v0.14.0
 )
 
 require (
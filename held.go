@@ -0,0 +1,175 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// HeldSet is a set of non-persistent, auto-release shadow copies that exist
+// only while the set is held open. The shadow copies are deleted when the set is
+// closed or when the process exits for any reason, so they never outlive the
+// backup that created them. They can be accessed through their DeviceObject
+// paths like any other shadow copy, or exposed by HeldSet.Expose.
+type HeldSet struct {
+	copies  []*ShadowCopy
+	ops     chan<- func(bc backupComponents) // Runs functions on the owner goroutine
+	stopped <-chan struct{}                  // Closed when ops are no longer accepted
+	req     chan<- struct{}                  // Closed to request release
+	done    <-chan error                     // Receives the release result
+
+	once sync.Once
+	err  error
+}
+
+// CreateHeldSet atomically creates non-persistent shadow copies of multiple
+// volumes using the native VSS API. The returned set must be closed to release
+// the shadow copies. If opts is nil or opts.Context is zero, ContextBackup is
+// used. Otherwise, opts.Context must be ContextFileShareBackup. When writers
+// are involved, they are notified that the backup is complete when the set is
+// closed.
+func CreateHeldSet(ctx context.Context, vols []string, opts *SetOptions) (*HeldSet, error) {
+	return createHeldSet(ctx, newBackupComponents, vols, opts)
+}
+
+// createHeldSet implements CreateHeldSet using the specified
+// IVssBackupComponents constructor.
+func createHeldSet(ctx context.Context, newBC func() (backupComponents, error), vols []string, opts *SetOptions) (*HeldSet, error) {
+	if opts == nil {
+		opts = &SetOptions{Context: ContextBackup}
+	} else if opts.Context == 0 {
+		o := *opts
+		o.Context = ContextBackup
+		opts = &o
+	}
+	if _, err := opts.Context.attr(); err != nil {
+		return nil, err
+	}
+	if opts.Context.persistent() {
+		return nil, errors.New("vss: held shadow copy sets require a non-persistent context")
+	}
+	req, done := make(chan struct{}), make(chan error, 1)
+	ops, stopped := make(chan func(bc backupComponents)), make(chan struct{})
+	type result struct {
+		all []*ShadowCopy
+		err error
+	}
+	res := make(chan result, 1)
+
+	// IVssBackupComponents is bound to the thread that created it, so it is
+	// owned by a dedicated goroutine for the lifetime of the set.
+	go func() {
+		bc, err := newBC()
+		if err != nil {
+			res <- result{err: err}
+			return
+		}
+		s := &snapshotSet{bc: bc, hold: true}
+		all, err := s.create(ctx, vols, opts)
+		if err != nil {
+			bc.Release()
+			res <- result{err: err}
+			return
+		}
+		res <- result{all: all}
+		for held := true; held; {
+			select {
+			case fn := <-ops:
+				fn(bc)
+			case <-req:
+				held = false
+			}
+		}
+		close(stopped)
+		if s.writers {
+			err = s.bc.BackupComplete(context.Background())
+		}
+		bc.Release()
+		done <- err
+	}()
+
+	r := <-res
+	if r.err != nil {
+		return nil, r.err
+	}
+	h := &HeldSet{copies: r.all, ops: ops, stopped: stopped, req: req, done: done}
+	runtime.SetFinalizer(h, (*HeldSet).release)
+	return h, nil
+}
+
+// ShadowCopies returns the shadow copies in the set in the order of the volumes
+// passed to CreateHeldSet. The returned shadow copies must not be used after
+// the set is closed.
+func (h *HeldSet) ShadowCopies() []*ShadowCopy {
+	return append([]*ShadowCopy(nil), h.copies...)
+}
+
+// Expose makes shadow copy sc, which must be in the set, accessible at target
+// using the IVssBackupComponents instance that created it. Non-persistent
+// shadow copies can only be exposed locally by their requester, so target is an
+// unused drive letter or an empty directory, and opts.Remote must be false. The
+// exposure is removed when the set is closed.
+func (h *HeldSet) Expose(sc *ShadowCopy, target string, opts *ExposeOptions) error {
+	if opts != nil && opts.Remote {
+		return fmt.Errorf("vss: non-persistent shadow copy %s cannot be exposed remotely (%w)", sc.ID, os.ErrInvalid)
+	}
+	if err := h.check(sc); err != nil {
+		return err
+	}
+	expose, path, attr, err := checkExposeTarget(target, opts)
+	if err != nil {
+		return err
+	}
+	return h.do(func(bc backupComponents) error { return sc.exposeWith(bc, expose, path, attr) })
+}
+
+// Unexpose removes the drive letter or mount point created by Expose and clears
+// ExposedName and ExposedPath of sc.
+func (h *HeldSet) Unexpose(sc *ShadowCopy) error {
+	if err := h.check(sc); err != nil {
+		return err
+	}
+	return h.do(sc.unexposeWith)
+}
+
+// Close releases the shadow copies, which causes VSS to delete them. If writers
+// are involved, they are notified that the backup is complete first. Calling
+// Close more than once returns the result of the first call.
+func (h *HeldSet) Close() error {
+	h.once.Do(func() {
+		runtime.SetFinalizer(h, nil)
+		close(h.req)
+		h.err = <-h.done
+	})
+	return h.err
+}
+
+// release is the finalizer of a set that was not closed. It requests the
+// release without waiting for it, because that would block the finalizer
+// goroutine while writers are notified.
+func (h *HeldSet) release() { close(h.req) }
+
+// check returns an error if sc is not in the set.
+func (h *HeldSet) check(sc *ShadowCopy) error {
+	for _, c := range h.copies {
+		if c.ID == sc.ID {
+			return nil
+		}
+	}
+	return fmt.Errorf("vss: shadow copy %s is not in the held set (%w)", sc.ID, os.ErrInvalid)
+}
+
+// do calls fn on the goroutine that owns the IVssBackupComponents instance and
+// returns its result. It fails if the set is closed.
+func (h *HeldSet) do(fn func(bc backupComponents) error) error {
+	err := make(chan error, 1)
+	select {
+	case h.ops <- func(bc backupComponents) { err <- fn(bc) }:
+		return <-err
+	case <-h.stopped:
+		return errors.New("vss: held shadow copy set is closed")
+	}
+}
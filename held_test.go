@@ -0,0 +1,176 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeldSet(t *testing.T) {
+	f := new(fakeComponents)
+	h, err := createHeldSet(context.Background(), fakeNew(f), []string{"C:", "D:"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(vssCtxBackup), f.attr)
+	assert.Equal(t, []string{
+		"InitializeForBackup",
+		"SetContext",
+		"SetBackupState",
+		"GatherWriterMetadata",
+		"StartSnapshotSet",
+		"AddToSnapshotSet",
+		"AddToSnapshotSet",
+		"PrepareForBackup",
+		"DoSnapshotSet",
+		"GetSnapshotProperties",
+		"GetSnapshotProperties",
+	}, f.calls)
+	all := h.ShadowCopies()
+	require.Len(t, all, 2)
+	assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy2`, all[1].DeviceObject)
+	all[0] = nil
+	assert.NotNil(t, h.ShadowCopies()[0])
+
+	n := len(f.calls)
+	require.NoError(t, h.Close())
+	assert.Equal(t, []string{"BackupComplete", "Release"}, f.calls[n:])
+	require.NoError(t, h.Close())
+	assert.Len(t, f.calls, n+2)
+
+	// No writers
+	f = new(fakeComponents)
+	h, err = createHeldSet(context.Background(), fakeNew(f), []string{"C:"},
+		&SetOptions{Context: ContextFileShareBackup})
+	require.NoError(t, err)
+	assert.Equal(t, int32(attrNoWriters), f.attr)
+	require.NoError(t, h.Close())
+	assert.Equal(t, []string{"DoSnapshotSet", "GetSnapshotProperties", "Release"}, f.calls[len(f.calls)-3:])
+
+	// Zero context
+	f = new(fakeComponents)
+	h, err = createHeldSet(context.Background(), fakeNew(f), []string{"C:"},
+		&SetOptions{FailOnWriterError: true})
+	require.NoError(t, err)
+	assert.Equal(t, int32(vssCtxBackup), f.attr)
+	require.NoError(t, h.Close())
+}
+
+func TestHeldSetExpose(t *testing.T) {
+	f := new(fakeComponents)
+	h, err := createHeldSet(context.Background(), fakeNew(f), []string{"C:", "D:"}, nil)
+	require.NoError(t, err)
+	sc := h.ShadowCopies()[1]
+	n := len(f.calls)
+
+	// The set's IVssBackupComponents is used without reinitialization
+	require.NoError(t, h.Expose(sc, "p:", nil))
+	assert.Equal(t, "P:", sc.ExposedName)
+	assert.Equal(t, []string{sc.ID.String() + "||0x10000|P:"}, f.exposed)
+	require.NoError(t, h.Unexpose(sc))
+	assert.Empty(t, sc.ExposedName)
+	assert.Equal(t, []string{"ExposeSnapshot", "UnexposeSnapshot"}, f.calls[n:])
+
+	// Remote exposure, invalid targets, and foreign shadow copies
+	n = len(f.calls)
+	assert.ErrorIs(t, h.Expose(sc, "Snap", &ExposeOptions{Remote: true}), os.ErrInvalid)
+	assert.Error(t, h.Expose(sc, "P", nil))
+	assert.ErrorIs(t, h.Expose(&ShadowCopy{ID: testShadowID(9)}, "P:", nil), os.ErrInvalid)
+	assert.ErrorIs(t, h.Unexpose(&ShadowCopy{ID: testShadowID(9)}), os.ErrInvalid)
+	assert.Len(t, f.calls, n)
+
+	f.fail = []string{"ExposeSnapshot"}
+	assert.ErrorIs(t, h.Expose(sc, "P:", nil), HRESULT(0x80042302))
+	assert.Empty(t, sc.ExposedName)
+
+	require.NoError(t, h.Close())
+	n = len(f.calls)
+	assert.ErrorContains(t, h.Expose(sc, "P:", nil), "closed")
+	assert.ErrorContains(t, h.Unexpose(sc), "closed")
+	assert.Len(t, f.calls, n)
+}
+
+func TestHeldSetErrors(t *testing.T) {
+	// BackupComplete failure is reported by every Close call
+	f := &fakeComponents{fail: []string{"BackupComplete"}}
+	h, err := createHeldSet(context.Background(), fakeNew(f), []string{"C:"}, nil)
+	require.NoError(t, err)
+	err = h.Close()
+	require.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Equal(t, err, h.Close())
+	assert.Equal(t, "Release", f.calls[len(f.calls)-1])
+
+	// Creation failure
+	f = &fakeComponents{fail: []string{"GetSnapshotProperties"}}
+	_, err = createHeldSet(context.Background(), fakeNew(f), []string{"C:"}, nil)
+	require.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Equal(t, []string{"DeleteSnapshotSet", "Release"}, f.calls[len(f.calls)-2:])
+
+	errNew := errors.New("new")
+	_, err = createHeldSet(context.Background(), func() (backupComponents, error) {
+		return nil, errNew
+	}, []string{"C:"}, nil)
+	require.ErrorIs(t, err, errNew)
+
+	// Invalid contexts
+	for _, c := range []SnapshotContext{ContextClientAccessible, ContextNASRollback, -1} {
+		f = new(fakeComponents)
+		_, err = createHeldSet(context.Background(), fakeNew(f), []string{"C:"}, &SetOptions{Context: c})
+		require.Error(t, err, c)
+		assert.Empty(t, f.calls, c)
+	}
+	for _, c := range []SnapshotContext{ContextBackup, ContextFileShareBackup, -1} {
+		_, err = CreateSet(context.Background(), []string{"C:"}, &SetOptions{Context: c})
+		require.Error(t, err, c)
+		assert.NotErrorIs(t, err, errors.ErrUnsupported, c)
+	}
+}
+
+func TestSnapshotContextPersistent(t *testing.T) {
+	for c, want := range map[SnapshotContext]bool{
+		ContextClientAccessibleWriters: true,
+		ContextClientAccessible:        true,
+		ContextAppRollback:             true,
+		ContextNASRollback:             true,
+		ContextBackup:                  false,
+		ContextFileShareBackup:         false,
+		-1:                             false,
+	} {
+		assert.Equal(t, want, c.persistent(), c)
+	}
+}
+
+func TestHeldSetFinalizer(t *testing.T) {
+	f := &blockingComponents{fakeComponents: new(fakeComponents), unblock: make(chan struct{})}
+	h, err := createHeldSet(context.Background(),
+		func() (backupComponents, error) { return f, nil }, []string{"C:"}, nil)
+	require.NoError(t, err)
+
+	// The finalizer does not wait for BackupComplete. It is cleared, so that
+	// it does not run again when h is collected.
+	runtime.SetFinalizer(h, nil)
+	h.release()
+	close(f.unblock)
+	require.NoError(t, <-h.done)
+	assert.Equal(t, []string{"BackupComplete", "Release"}, f.calls[len(f.calls)-2:])
+}
+
+// blockingComponents is a fakeComponents whose BackupComplete blocks until
+// unblock is closed.
+type blockingComponents struct {
+	*fakeComponents
+	unblock chan struct{}
+}
+
+func (b *blockingComponents) BackupComplete(ctx context.Context) error {
+	<-b.unblock
+	return b.fakeComponents.BackupComplete(ctx)
+}
+
+// fakeNew returns an IVssBackupComponents constructor that returns f.
+func fakeNew(f *fakeComponents) func() (backupComponents, error) {
+	return func() (backupComponents, error) { return f, nil }
+}
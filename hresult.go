@@ -0,0 +1,141 @@
+package vss
+
+import (
+	"fmt"
+	"os"
+)
+
+// HRESULT is a COM status code returned by the native VSS API. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/vss/volume-shadow-copy-api-return-codes
+type HRESULT uint32
+
+// IVssAsync status codes.
+const (
+	vssAsyncPending   HRESULT = 0x00042309 // VSS_S_ASYNC_PENDING
+	vssAsyncFinished  HRESULT = 0x0004230A // VSS_S_ASYNC_FINISHED
+	vssAsyncCancelled HRESULT = 0x0004230B // VSS_S_ASYNC_CANCELLED
+)
+
+// Failed returns whether hr represents a failure.
+func (hr HRESULT) Failed() bool {
+	return hr&0x80000000 != 0
+}
+
+// Error implements the error interface.
+func (hr HRESULT) Error() string {
+	if s := hr.text(); s != "" {
+		return fmt.Sprintf("%s (HRESULT 0x%08X)", s, uint32(hr))
+	}
+	return fmt.Sprintf("HRESULT 0x%08X", uint32(hr))
+}
+
+// Unwrap implements errors.Unwrap interface.
+func (hr HRESULT) Unwrap() error {
+	switch hr {
+	case 0x80070005: // E_ACCESSDENIED
+		return os.ErrPermission
+	case 0x80070057: // E_INVALIDARG
+		return os.ErrInvalid
+	case 0x80042308: // VSS_E_OBJECT_NOT_FOUND
+		return os.ErrNotExist
+	case 0x8004230D: // VSS_E_OBJECT_ALREADY_EXISTS
+		return os.ErrExist
+	}
+	return nil
+}
+
+// text returns the description of known status codes.
+func (hr HRESULT) text() string {
+	switch hr {
+	case 0:
+		return "Success"
+	case 0x80004001:
+		return "Not implemented"
+	case 0x80070005:
+		return "Access denied"
+	case 0x8007000E:
+		return "Out of memory"
+	case 0x80070057:
+		return "Invalid argument"
+	case 0x8000FFFF:
+		return "Unexpected failure"
+	case 0x80042301:
+		return "Operation called in incorrect sequence"
+	case 0x80042302:
+		return "Unexpected VSS error"
+	case 0x80042304:
+		return "Shadow copy provider not registered"
+	case 0x80042306:
+		return "Shadow copy provider vetoed the operation"
+	case 0x80042307:
+		return "Shadow copy provider is in use"
+	case 0x80042308:
+		return "Object not found"
+	case vssAsyncPending:
+		return "Asynchronous operation pending"
+	case vssAsyncFinished:
+		return "Asynchronous operation finished"
+	case vssAsyncCancelled:
+		return "Asynchronous operation cancelled"
+	case 0x8004230C:
+		return "Volume not supported"
+	case 0x8004230D:
+		return "Object already exists"
+	case 0x8004230E:
+		return "Volume not supported by the specified provider"
+	case 0x8004230F:
+		return "Unexpected shadow copy provider error"
+	case 0x80042310:
+		return "Corrupt XML document"
+	case 0x80042311:
+		return "Invalid XML document"
+	case 0x80042312:
+		return "Maximum number of volumes reached"
+	case 0x80042313:
+		return "Timeout while flushing writes"
+	case 0x80042314:
+		return "Timeout while holding writes"
+	case 0x80042315:
+		return "Unexpected writer error"
+	case 0x80042316:
+		return "Another shadow copy operation is already in progress"
+	case 0x80042317:
+		return "Maximum number of shadow copies reached"
+	case 0x80042318:
+		return "Writer infrastructure failure"
+	case 0x80042319:
+		return "Writer not responding"
+	case 0x8004231A:
+		return "Writer already subscribed"
+	case 0x8004231B:
+		return "Unsupported shadow copy context"
+	case 0x8004231D:
+		return "Volume is in use"
+	case 0x8004231E:
+		return "Maximum number of diff area associations reached"
+	case 0x8004231F:
+		return "Insufficient storage"
+	case 0x80042328:
+		return "Timeout while freezing transactions"
+	case 0x80042329:
+		return "Timeout while thawing transactions"
+	case 0x8004232D:
+		return "Volume is not local"
+	case 0x800423F0:
+		return "Writer reported an inconsistent shadow copy"
+	case 0x800423F1:
+		return "Writer ran out of resources"
+	case 0x800423F2:
+		return "Writer timed out"
+	case 0x800423F3:
+		return "Writer reported a retryable error"
+	case 0x800423F4:
+		return "Writer reported a non-retryable error"
+	case 0x800423F5:
+		return "Writer recovery failed"
+	case 0x80042409:
+		return "Writer status not available"
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+package vss
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHRESULT(t *testing.T) {
+	assert.False(t, HRESULT(0).Failed())
+	assert.False(t, vssAsyncFinished.Failed())
+	assert.True(t, HRESULT(0x80042317).Failed())
+	assert.Equal(t, "Maximum number of shadow copies reached (HRESULT 0x80042317)",
+		HRESULT(0x80042317).Error())
+	assert.Equal(t, "HRESULT 0x8004FFFF", HRESULT(0x8004FFFF).Error())
+	assert.True(t, errors.Is(HRESULT(0x80070005), os.ErrPermission))
+	assert.True(t, errors.Is(HRESULT(0x80042308), os.ErrNotExist))
+	assert.Nil(t, HRESULT(0x80042317).Unwrap())
+}
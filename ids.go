@@ -0,0 +1,183 @@
+package vss
+
+import (
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mxk/go-vss/vsspath"
+)
+
+// ShadowID is the ID of a shadow copy. The zero value is an unset ID. IDs are
+// stored in binary form, so they can be compared with == regardless of how they
+// were formatted when parsed.
+//
+// Provider and writer IDs identify software rather than shadow copies, so they
+// remain GUID strings in the format reported by VSS. APIs that select by them
+// compare them regardless of case and braces. Functions that accept a name,
+// such as Get and Remove, also take strings, because the name can be an ID,
+// DeviceObject, or symlink path.
+type ShadowID struct{ g guid }
+
+// SetID is the ID of a shadow copy set. It has the same properties as ShadowID.
+type SetID struct{ g guid }
+
+// VolumeGUIDName is the unique name of a volume in the `\\?\Volume{GUID}\`
+// format. The zero value is an unset name. Names can be compared with ==
+// regardless of case or the presence of a trailing separator when parsed.
+type VolumeGUIDName struct{ g guid }
+
+// ParseShadowID parses a shadow copy ID in the "{XXXXXXXX-XXXX-XXXX-XXXX-
+// XXXXXXXXXXXX}" format. Braces are optional and case is ignored.
+func ParseShadowID(s string) (ShadowID, error) {
+	g, err := parseGUIDText(s, "shadow copy ID")
+	return ShadowID{g}, err
+}
+
+// ParseSetID parses a shadow copy set ID in the same format as ParseShadowID.
+func ParseSetID(s string) (SetID, error) {
+	g, err := parseGUIDText(s, "shadow copy set ID")
+	return SetID{g}, err
+}
+
+// ParseVolumeGUIDName parses a volume name in the `\\?\Volume{GUID}\` format.
+// The trailing separator is optional and case is ignored.
+func ParseVolumeGUIDName(s string) (VolumeGUIDName, error) {
+	t := strings.TrimSuffix(s, `\`)
+	if vsspath.HasPrefixFold(t, `\\?\Volume{`) && strings.HasSuffix(t, "}") {
+		if g, ok := parseGUID(t[len(`\\?\Volume`):]); ok {
+			return VolumeGUIDName{g}, nil
+		}
+	}
+	return VolumeGUIDName{}, fmt.Errorf("vss: invalid volume GUID name: %#q (%w)", s, os.ErrInvalid)
+}
+
+// String returns the ID in the canonical upper-case format with braces, as
+// used by WMI. The zero ID is formatted as the NULL GUID, which parses back to
+// the zero ID.
+func (id ShadowID) String() string { return id.g.format() }
+
+// String returns the ID in the same format as ShadowID.String.
+func (id SetID) String() string { return id.g.format() }
+
+// String returns the name in the canonical `\\?\Volume{guid}\` format with a
+// lower-case GUID and a trailing separator, as used by Windows volume
+// management functions. The zero name is formatted with the NULL GUID.
+func (v VolumeGUIDName) String() string {
+	return `\\?\Volume` + strings.ToLower(v.g.format()) + `\`
+}
+
+// IsZero returns whether the ID is unset.
+func (id ShadowID) IsZero() bool { return id.g == guid{} }
+
+// IsZero returns whether the ID is unset.
+func (id SetID) IsZero() bool { return id.g == guid{} }
+
+// IsZero returns whether the name is unset.
+func (v VolumeGUIDName) IsZero() bool { return v.g == guid{} }
+
+// MarshalText implements encoding.TextMarshaler. The zero ID is encoded as
+// empty text.
+func (id ShadowID) MarshalText() ([]byte, error) { return marshalID(id.IsZero(), id.String()) }
+
+// MarshalText implements encoding.TextMarshaler. The zero ID is encoded as
+// empty text.
+func (id SetID) MarshalText() ([]byte, error) { return marshalID(id.IsZero(), id.String()) }
+
+// MarshalText implements encoding.TextMarshaler. The zero name is encoded as
+// empty text.
+func (v VolumeGUIDName) MarshalText() ([]byte, error) { return marshalID(v.IsZero(), v.String()) }
+
+// idText returns the text encoding of an identifier, which is empty if it is
+// zero.
+func idText(id encoding.TextMarshaler) string {
+	b, _ := id.MarshalText()
+	return string(b)
+}
+
+// marshalID returns the text encoding of an identifier.
+func marshalID(zero bool, s string) ([]byte, error) {
+	if zero {
+		return []byte{}, nil
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Empty text is decoded as
+// the zero ID.
+func (id *ShadowID) UnmarshalText(b []byte) (err error) {
+	if len(b) == 0 {
+		*id = ShadowID{}
+		return nil
+	}
+	*id, err = ParseShadowID(string(b))
+	return
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Empty text is decoded as
+// the zero ID.
+func (id *SetID) UnmarshalText(b []byte) (err error) {
+	if len(b) == 0 {
+		*id = SetID{}
+		return nil
+	}
+	*id, err = ParseSetID(string(b))
+	return
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Empty text is decoded as
+// the zero name.
+func (v *VolumeGUIDName) UnmarshalText(b []byte) (err error) {
+	if len(b) == 0 {
+		*v = VolumeGUIDName{}
+		return nil
+	}
+	*v, err = ParseVolumeGUIDName(string(b))
+	return
+}
+
+// guid is a GUID in the byte order of its text representation.
+type guid [16]byte
+
+// parseGUIDText parses a GUID with optional braces, returning an error that
+// describes the value as what.
+func parseGUIDText(s, what string) (guid, error) {
+	if g, ok := parseGUID(s); ok {
+		return g, nil
+	}
+	return guid{}, fmt.Errorf("vss: invalid %s: %#q (%w)", what, s, os.ErrInvalid)
+}
+
+// parseGUID parses a GUID with optional braces.
+func parseGUID(s string) (g guid, ok bool) {
+	if len(s) == 38 && s[0] == '{' && s[37] == '}' {
+		s = s[1:37]
+	}
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return guid{}, false
+	}
+	h := s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(g[:], []byte(h)); err != nil {
+		return guid{}, false
+	}
+	return g, true
+}
+
+// guidEqual returns whether a and b are valid GUIDs with the same value, with
+// optional braces.
+func guidEqual(a, b string) bool {
+	ga, ok := parseGUID(a)
+	if !ok {
+		return false
+	}
+	gb, ok := parseGUID(b)
+	return ok && ga == gb
+}
+
+// format returns g in upper-case with braces.
+func (g guid) format() string {
+	h := strings.ToUpper(hex.EncodeToString(g[:]))
+	return "{" + h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:] + "}"
+}
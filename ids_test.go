@@ -0,0 +1,160 @@
+package vss
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowID(t *testing.T) {
+	const want = "{6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10}"
+	for _, s := range []string{
+		want,
+		"{6b3c1f0e-0a2d-4e9b-8f51-3c7d2a9b4e10}",
+		"6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10",
+		"6b3c1f0e-0a2d-4e9B-8F51-3c7d2a9b4e10",
+	} {
+		id, err := ParseShadowID(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, id.String())
+		assert.Equal(t, mustParse(ParseShadowID(want)), id)
+		assert.False(t, id.IsZero())
+	}
+	for _, s := range []string{
+		"",
+		"{}",
+		"{6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10",
+		"6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10}",
+		"(6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10)",
+		"{6B3C1F0E0A2D-4E9B-8F51-3C7D2A9B4E10-}",
+		"{6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E1G}",
+		"{6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10} ",
+		"{+B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10}",
+	} {
+		_, err := ParseShadowID(s)
+		assert.ErrorIs(t, err, os.ErrInvalid, s)
+	}
+	var zero ShadowID
+	assert.True(t, zero.IsZero())
+	assert.Equal(t, "{00000000-0000-0000-0000-000000000000}", zero.String())
+	assert.Equal(t, zero, mustParse(ParseShadowID(zero.String())))
+	assert.Equal(t, "", idText(zero))
+	assert.Equal(t, "{00000000-0000-0000-0000-000000000001}", testShadowID(1).String())
+}
+
+func TestSetID(t *testing.T) {
+	id, err := ParseSetID("{a4c8c0ad-f7d2-4e0f-a3b2-0b8b3b3c0d81}")
+	require.NoError(t, err)
+	assert.Equal(t, "{A4C8C0AD-F7D2-4E0F-A3B2-0B8B3B3C0D81}", id.String())
+	_, err = ParseSetID("{A4C8C0AD}")
+	assert.ErrorContains(t, err, "set ID")
+}
+
+func TestVolumeGUIDName(t *testing.T) {
+	const want = `\\?\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}\`
+	for _, s := range []string{
+		want,
+		`\\?\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}`,
+		`\\?\VOLUME{F4BD5E9C-1A2B-4C3D-8E4F-5A6B7C8D9E0F}\`,
+		`\\?\volume{F4BD5E9C-1a2b-4c3d-8e4f-5a6b7c8d9e0f}`,
+	} {
+		v, err := ParseVolumeGUIDName(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, v.String())
+		assert.Equal(t, mustParse(ParseVolumeGUIDName(want)), v)
+	}
+	for _, s := range []string{
+		"",
+		`C:\`,
+		`\\?\Volume{}\`,
+		`\\?\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}\\`,
+		`\\?\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}\Windows`,
+		`\\.\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}\`,
+		`\??\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}\`,
+		`Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}`,
+		`\\?\Volume f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f\`,
+		`\\?\Volume{\\?\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}}\`,
+	} {
+		_, err := ParseVolumeGUIDName(s)
+		assert.ErrorIs(t, err, os.ErrInvalid, s)
+	}
+	var zero VolumeGUIDName
+	assert.True(t, zero.IsZero())
+	assert.Equal(t, `\\?\Volume{00000000-0000-0000-0000-000000000000}\`, zero.String())
+	assert.Equal(t, zero, mustParse(ParseVolumeGUIDName(zero.String())))
+}
+
+func TestIDText(t *testing.T) {
+	type doc struct {
+		ID  ShadowID       `json:"id" xml:"id,attr"`
+		Set SetID          `json:"set" xml:"set"`
+		Vol VolumeGUIDName `json:"vol" xml:"vol"`
+	}
+	in := doc{
+		ID:  mustParse(ParseShadowID("{6b3c1f0e-0a2d-4e9b-8f51-3c7d2a9b4e10}")),
+		Set: mustParse(ParseSetID("{a4c8c0ad-f7d2-4e0f-a3b2-0b8b3b3c0d81}")),
+		Vol: mustParse(ParseVolumeGUIDName(`\\?\Volume{F4BD5E9C-1A2B-4C3D-8E4F-5A6B7C8D9E0F}`)),
+	}
+	b, err := json.Marshal(in)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"{6B3C1F0E-0A2D-4E9B-8F51-3C7D2A9B4E10}",`+
+		`"set":"{A4C8C0AD-F7D2-4E0F-A3B2-0B8B3B3C0D81}",`+
+		`"vol":"\\\\?\\Volume{f4bd5e9c-1a2b-4c3d-8e4f-5a6b7c8d9e0f}\\"}`, string(b))
+	var out doc
+	require.NoError(t, json.Unmarshal(b, &out))
+	assert.Equal(t, in, out)
+
+	b, err = xml.Marshal(in)
+	require.NoError(t, err)
+	out = doc{}
+	require.NoError(t, xml.Unmarshal(b, &out))
+	assert.Equal(t, in, out)
+
+	// Zero values round-trip as empty strings
+	b, err = json.Marshal(doc{})
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"","set":"","vol":""}`, string(b))
+	out = in
+	require.NoError(t, json.Unmarshal(b, &out))
+	assert.Equal(t, doc{}, out)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"id":"x"}`), &out))
+	assert.Error(t, json.Unmarshal([]byte(`{"vol":"C:\\"}`), &out))
+}
+
+func TestGUIDEqual(t *testing.T) {
+	const g = "{A65FAA63-5EA8-4EBC-9DBD-A0C4DB26912A}"
+	assert.True(t, guidEqual(g, "a65faa63-5ea8-4ebc-9dbd-a0c4db26912a"))
+	assert.False(t, guidEqual(g, "{A65FAA63-5EA8-4EBC-9DBD-A0C4DB26912B}"))
+	assert.False(t, guidEqual(g, "A65FAA63-5EA8-4EBC-9DBD-A0C4DB26912A}"))
+	assert.False(t, guidEqual("", ""))
+	assert.False(t, guidEqual("{}", "{}"))
+}
+
+// mustParse returns v or panics if err is non-nil.
+func mustParse[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// testShadowID returns a shadow copy ID ending with n.
+func testShadowID(n int) ShadowID {
+	return mustParse(ParseShadowID(fmt.Sprintf("{00000000-0000-0000-0000-%012d}", n)))
+}
+
+// testSetID returns a shadow copy set ID ending with n.
+func testSetID(n int) SetID {
+	return mustParse(ParseSetID(fmt.Sprintf("{10000000-0000-0000-0000-%012d}", n)))
+}
+
+// testVolume returns a volume name ending with n.
+func testVolume(n int) VolumeGUIDName {
+	return mustParse(ParseVolumeGUIDName(fmt.Sprintf(`\\?\Volume{20000000-0000-0000-0000-%012d}\`, n)))
+}
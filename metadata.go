@@ -0,0 +1,380 @@
+package vss
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// WriterMetadata is a parsed VSS Writer Metadata Document, which describes the
+// data managed by a writer and how it should be backed up and restored. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/vss/writer-metadata-document
+type WriterMetadata struct {
+	WriterID     string
+	InstanceID   string
+	InstanceName string
+	Name         string
+	Usage        WriterUsage
+	DataSource   string
+	Restore      RestoreMethod
+	Include      []FileSpec
+	Exclude      []FileSpec
+	Components   []*Component
+}
+
+// WriterUsage indicates how the data managed by a writer is used on the system.
+type WriterUsage string
+
+const (
+	UsageUndefined           WriterUsage = "UNDEFINED"
+	UsageBootableSystemState WriterUsage = "BOOTABLE_SYSTEM_STATE"
+	UsageSystemService       WriterUsage = "SYSTEM_SERVICE"
+	UsageUserData            WriterUsage = "USER_DATA"
+	UsageOther               WriterUsage = "OTHER"
+)
+
+// matches returns whether the writer is selected by name or writer/instance ID.
+func (wm *WriterMetadata) matches(sel string) bool {
+	return strings.EqualFold(wm.Name, sel) || guidEqual(wm.WriterID, sel) ||
+		guidEqual(wm.InstanceID, sel)
+}
+
+// RestoreMethod describes how a writer's data should be restored.
+type RestoreMethod struct {
+	Method         string // e.g. "RESTORE_IF_NOT_THERE" or "REPLACE_AT_REBOOT"
+	WriterRestore  string // "never", "always", or "ifReplaceFails"
+	Service        string
+	UserProcedure  string
+	RebootRequired bool
+}
+
+// FileSpec is a set of files specified by a directory path, a file name
+// pattern, and a flag indicating whether subdirectories are included.
+type FileSpec struct {
+	Path          string
+	FileSpec      string
+	Recursive     bool
+	AlternatePath string
+}
+
+// ComponentType is the type of a writer component.
+type ComponentType string
+
+const (
+	ComponentDatabase  ComponentType = "DATABASE"
+	ComponentFileGroup ComponentType = "FILE_GROUP"
+)
+
+// Component is a group of files that a writer backs up and restores as a unit.
+type Component struct {
+	Type                   ComponentType
+	Name                   string
+	LogicalPath            string
+	Caption                string
+	Selectable             bool
+	SelectableForRestore   bool
+	RestoreMetadata        bool
+	NotifyOnBackupComplete bool
+	Flags                  uint32
+	Files                  []FileSpec // FILE_LIST or DATABASE_FILES
+	LogFiles               []FileSpec // DATABASE_LOGFILES
+	Dependencies           []Dependency
+}
+
+// FullPath returns the component's logical path joined with its name, which
+// uniquely identifies the component within the writer.
+func (c *Component) FullPath() string {
+	return fullPath(c.LogicalPath, c.Name)
+}
+
+// fullPath joins a component's logical path and name.
+func fullPath(logicalPath, name string) string {
+	if logicalPath == "" {
+		return name
+	}
+	return logicalPath + `\` + name
+}
+
+// Dependency is a component of another writer that must be backed up and
+// restored together with the component that declares it.
+type Dependency struct {
+	WriterID      string
+	LogicalPath   string
+	ComponentName string
+}
+
+// GatherWriterMetadata returns the metadata of all writers on the system using
+// the native VSS API.
+func GatherWriterMetadata(ctx context.Context) ([]*WriterMetadata, error) {
+	bc, err := newBackupComponents()
+	if err != nil {
+		return nil, err
+	}
+	defer bc.Release()
+	return gatherWriterMetadata(ctx, bc)
+}
+
+// gatherWriterMetadata implements GatherWriterMetadata.
+func gatherWriterMetadata(ctx context.Context, bc backupComponents) ([]*WriterMetadata, error) {
+	bt, _ := BackupCopy.vss()
+	if _, err := initBackup(ctx, bc, vssCtxBackup, bt, false); err != nil {
+		return nil, err
+	}
+	return getWriterMetadata(bc)
+}
+
+// getWriterMetadata returns the parsed metadata gathered by bc.
+func getWriterMetadata(bc backupComponents) ([]*WriterMetadata, error) {
+	docs, err := bc.GetWriterMetadata()
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*WriterMetadata, 0, len(docs))
+	for _, doc := range docs {
+		wm, err := ParseWriterMetadata(strings.NewReader(doc))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, wm)
+	}
+	return all, nil
+}
+
+// ParseWriterMetadata parses a Writer Metadata Document in XML format, as
+// returned by IVssExamineWriterMetadata::SaveAsXML.
+func ParseWriterMetadata(r io.Reader) (*WriterMetadata, error) {
+	var doc xmlWriterMetadata
+	if err := decodeXML(r, &doc); err != nil {
+		return nil, fmt.Errorf("vss: failed to parse writer metadata (%w)", err)
+	}
+	if doc.XMLName.Local != "WRITER_METADATA" {
+		return nil, fmt.Errorf("vss: invalid writer metadata root element: %s", doc.XMLName.Local)
+	}
+	id := doc.Identification
+	wm := &WriterMetadata{
+		WriterID:     id.WriterID,
+		InstanceID:   id.InstanceID,
+		InstanceName: id.InstanceName,
+		Name:         id.FriendlyName,
+		Usage:        WriterUsage(id.Usage),
+		DataSource:   id.DataSource,
+		Restore: RestoreMethod{
+			Method:         doc.RestoreMethod.Method,
+			WriterRestore:  doc.RestoreMethod.WriterRestore,
+			Service:        doc.RestoreMethod.Service,
+			UserProcedure:  doc.RestoreMethod.UserProcedure,
+			RebootRequired: bool(doc.RestoreMethod.RebootRequired),
+		},
+		Include: fileSpecs(doc.Include),
+		Exclude: fileSpecs(doc.Exclude),
+	}
+	for _, c := range doc.BackupLocations.Components {
+		comp := &Component{
+			Type:                   ComponentType(c.XMLName.Local),
+			Name:                   c.ComponentName,
+			LogicalPath:            c.LogicalPath,
+			Caption:                c.Caption,
+			Selectable:             bool(c.Selectable),
+			SelectableForRestore:   bool(c.SelectableForRestore),
+			RestoreMetadata:        bool(c.RestoreMetadata),
+			NotifyOnBackupComplete: bool(c.NotifyOnBackupComplete),
+			LogFiles:               fileSpecs(c.LogFiles),
+		}
+		if c.ComponentFlags != "" {
+			f, err := strconv.ParseUint(c.ComponentFlags, 0, 32)
+			if err != nil {
+				return nil, fmt.Errorf("vss: invalid componentFlags of %s: %s", comp.FullPath(), c.ComponentFlags)
+			}
+			comp.Flags = uint32(f)
+		}
+		if comp.Type == ComponentDatabase {
+			comp.Files = fileSpecs(c.DatabaseFiles)
+		} else {
+			comp.Files = fileSpecs(c.FileList)
+		}
+		for _, d := range c.Dependencies {
+			comp.Dependencies = append(comp.Dependencies, Dependency(d))
+		}
+		wm.Components = append(wm.Components, comp)
+	}
+	return wm, nil
+}
+
+// xmlWriterMetadata is the XML representation of a Writer Metadata Document.
+type xmlWriterMetadata struct {
+	XMLName        xml.Name
+	Identification struct {
+		WriterID     string `xml:"writerId,attr"`
+		InstanceID   string `xml:"instanceId,attr"`
+		InstanceName string `xml:"instanceName,attr"`
+		FriendlyName string `xml:"friendlyName,attr"`
+		Usage        string `xml:"usage,attr"`
+		DataSource   string `xml:"dataSource,attr"`
+	} `xml:"IDENTIFICATION"`
+	RestoreMethod struct {
+		Method         string  `xml:"method,attr"`
+		WriterRestore  string  `xml:"writerRestore,attr"`
+		Service        string  `xml:"service,attr"`
+		UserProcedure  string  `xml:"userProcedure,attr"`
+		RebootRequired xmlBool `xml:"rebootRequired,attr"`
+	} `xml:"RESTORE_METHOD"`
+	Include         []xmlFileSpec      `xml:"INCLUDE"`
+	Exclude         []xmlFileSpec      `xml:"EXCLUDE"`
+	BackupLocations xmlBackupLocations `xml:"BACKUP_LOCATIONS"`
+}
+
+// xmlBackupLocations is the XML representation of a BACKUP_LOCATIONS element.
+// Components are kept in document order. Other elements are ignored.
+type xmlBackupLocations struct {
+	Components []xmlComponent
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (l *xmlBackupLocations) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch ComponentType(t.Name.Local) {
+			case ComponentDatabase, ComponentFileGroup:
+				var c xmlComponent
+				if err = d.DecodeElement(&c, &t); err != nil {
+					return err
+				}
+				l.Components = append(l.Components, c)
+			default:
+				if err = d.Skip(); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// xmlComponent is the XML representation of a DATABASE or FILE_GROUP element.
+type xmlComponent struct {
+	XMLName                xml.Name
+	ComponentName          string          `xml:"componentName,attr"`
+	LogicalPath            string          `xml:"logicalPath,attr"`
+	Caption                string          `xml:"caption,attr"`
+	Selectable             xmlBool         `xml:"selectable,attr"`
+	SelectableForRestore   xmlBool         `xml:"selectableForRestore,attr"`
+	RestoreMetadata        xmlBool         `xml:"restoreMetadata,attr"`
+	NotifyOnBackupComplete xmlBool         `xml:"notifyOnBackupComplete,attr"`
+	ComponentFlags         string          `xml:"componentFlags,attr"`
+	FileList               []xmlFileSpec   `xml:"FILE_LIST"`
+	DatabaseFiles          []xmlFileSpec   `xml:"DATABASE_FILES"`
+	LogFiles               []xmlFileSpec   `xml:"DATABASE_LOGFILES"`
+	Dependencies           []xmlDependency `xml:"DEPENDENCY"`
+}
+
+// xmlFileSpec is the XML representation of a file specification element.
+type xmlFileSpec struct {
+	Path          string  `xml:"path,attr"`
+	FileSpec      string  `xml:"filespec,attr"`
+	Recursive     xmlBool `xml:"recursive,attr"`
+	AlternatePath string  `xml:"alternatePath,attr"`
+}
+
+// xmlDependency is the XML representation of a DEPENDENCY element.
+type xmlDependency struct {
+	WriterID      string `xml:"writerId,attr"`
+	LogicalPath   string `xml:"logicalPath,attr"`
+	ComponentName string `xml:"componentName,attr"`
+}
+
+// fileSpecs converts XML file specifications.
+func fileSpecs(x []xmlFileSpec) []FileSpec {
+	if len(x) == 0 {
+		return nil
+	}
+	all := make([]FileSpec, len(x))
+	for i, f := range x {
+		all[i] = FileSpec{
+			Path:          f.Path,
+			FileSpec:      f.FileSpec,
+			Recursive:     bool(f.Recursive),
+			AlternatePath: f.AlternatePath,
+		}
+	}
+	return all
+}
+
+// xmlBool is a boolean XML attribute encoded as "yes" or "no".
+type xmlBool bool
+
+// UnmarshalXMLAttr implements xml.UnmarshalerAttr.
+func (b *xmlBool) UnmarshalXMLAttr(attr xml.Attr) error {
+	switch strings.ToLower(attr.Value) {
+	case "yes", "true", "1":
+		*b = true
+	case "no", "false", "0", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean attribute %s=%q", attr.Name.Local, attr.Value)
+	}
+	return nil
+}
+
+// MarshalXMLAttr implements xml.MarshalerAttr.
+func (b xmlBool) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if b {
+		return xml.Attr{Name: name, Value: "yes"}, nil
+	}
+	return xml.Attr{Name: name, Value: "no"}, nil
+}
+
+// decodeXML decodes an XML document produced by VSS. Documents returned by VSS
+// as BSTRs are converted to UTF-8 before parsing, but documents saved to files
+// may still be UTF-16, so they are transcoded to UTF-8 (see xmlText). Either
+// way, the UTF-16 encoding declaration is ignored.
+func decodeXML(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d := xml.NewDecoder(bytes.NewReader(xmlText(b)))
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-16", "utf-8", "us-ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	return d.Decode(v)
+}
+
+// xmlText returns document b as UTF-8. UTF-16 documents are recognized by a
+// byte order mark or, without one, by the encoding of the leading '<'.
+func xmlText(b []byte) []byte {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		order, b = binary.LittleEndian, b[2:]
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		order, b = binary.BigEndian, b[2:]
+	case bytes.HasPrefix(b, []byte{'<', 0}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(b, []byte{0, '<'}):
+		order = binary.BigEndian
+	default:
+		return b
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	return []byte(string(utf16.Decode(u)))
+}
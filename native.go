@@ -0,0 +1,423 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SnapshotContext determines the attributes of shadow copies created with the
+// native VSS API. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/vss/ne-vss-_vss_snapshot_context
+type SnapshotContext int
+
+const (
+	// ContextClientAccessibleWriters creates persistent, client-accessible
+	// shadow copies with writer participation (VSS_CTX_CLIENT_ACCESSIBLE_WRITERS).
+	ContextClientAccessibleWriters SnapshotContext = iota
+
+	// ContextClientAccessible creates persistent, client-accessible shadow
+	// copies without writers (VSS_CTX_CLIENT_ACCESSIBLE). This is the context
+	// used by Create.
+	ContextClientAccessible
+
+	// ContextAppRollback creates persistent shadow copies with writer
+	// participation for application rollback (VSS_CTX_APP_ROLLBACK).
+	ContextAppRollback
+
+	// ContextNASRollback creates persistent shadow copies without writers for
+	// NAS rollback (VSS_CTX_NAS_ROLLBACK).
+	ContextNASRollback
+
+	// ContextBackup creates non-persistent, auto-release shadow copies with
+	// writer participation (VSS_CTX_BACKUP). It requires CreateHeldSet.
+	ContextBackup
+
+	// ContextFileShareBackup creates non-persistent, auto-release shadow
+	// copies without writers (VSS_CTX_FILE_SHARE_BACKUP). It requires
+	// CreateHeldSet.
+	ContextFileShareBackup
+)
+
+// Shadow copy attributes. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/vss/ne-vss-vss_volume_snapshot_attributes
+const (
+	attrPersistent       = 0x00000001
+	attrNoAutoRecovery   = 0x00000002
+	attrClientAccessible = 0x00000004
+	attrNoAutoRelease    = 0x00000008
+	attrNoWriters        = 0x00000010
+
+	vssCtxBackup = 0 // Non-persistent, auto-release shadow copies with writers
+)
+
+// attr returns the VSS_SNAPSHOT_CONTEXT value of c.
+func (c SnapshotContext) attr() (int32, error) {
+	switch c {
+	case ContextClientAccessibleWriters:
+		return attrPersistent | attrClientAccessible | attrNoAutoRelease, nil
+	case ContextClientAccessible:
+		return attrPersistent | attrClientAccessible | attrNoAutoRelease | attrNoWriters, nil
+	case ContextAppRollback:
+		return attrPersistent | attrNoAutoRelease, nil
+	case ContextNASRollback:
+		return attrPersistent | attrNoAutoRelease | attrNoWriters, nil
+	case ContextBackup:
+		return vssCtxBackup, nil
+	case ContextFileShareBackup:
+		return attrNoWriters, nil
+	}
+	return 0, fmt.Errorf("vss: invalid snapshot context: %d", c)
+}
+
+// persistent returns whether c creates persistent shadow copies.
+func (c SnapshotContext) persistent() bool {
+	attr, err := c.attr()
+	return err == nil && attr&attrPersistent != 0
+}
+
+// BackupType is the type of backup reported to writers. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/vss/ne-vss-vss_backup_type
+type BackupType int
+
+const (
+	// BackupCopy does not update the writers' backup history (VSS_BT_COPY).
+	BackupCopy BackupType = iota
+
+	// BackupFull backs up all files and updates the writers' backup history
+	// (VSS_BT_FULL).
+	BackupFull
+
+	// BackupIncremental backs up files changed since the last full or
+	// incremental backup (VSS_BT_INCREMENTAL).
+	BackupIncremental
+
+	// BackupDifferential backs up files changed since the last full backup
+	// (VSS_BT_DIFFERENTIAL).
+	BackupDifferential
+
+	// BackupLog backs up only the log files of the writers (VSS_BT_LOG).
+	BackupLog
+
+	// BackupOther is a backup type that is not one of the above, which
+	// writers interpret as they see fit (VSS_BT_OTHER).
+	BackupOther
+)
+
+// vss returns the VSS_BACKUP_TYPE value of t.
+func (t BackupType) vss() (int32, error) {
+	switch t {
+	case BackupCopy:
+		return 5, nil
+	case BackupFull:
+		return 1, nil
+	case BackupIncremental:
+		return 2, nil
+	case BackupDifferential:
+		return 3, nil
+	case BackupLog:
+		return 4, nil
+	case BackupOther:
+		return 6, nil
+	}
+	return 0, fmt.Errorf("vss: invalid backup type: %d", t)
+}
+
+// SetOptions configures the creation of a shadow copy set.
+type SetOptions struct {
+	Context    SnapshotContext
+	BackupType BackupType
+
+	// FailOnWriterError causes shadow copy creation to fail with a
+	// WriterError if any writer selected by Writers is in a failed state
+	// after the shadow copies are created. The shadow copies are removed in
+	// that case. It requires a context with writer participation.
+	FailOnWriterError bool
+
+	// Writers selects the writers checked by FailOnWriterError by name or
+	// writer/instance ID. If empty, all writers are checked. Creation fails
+	// if any selector does not match a writer.
+	Writers []string
+
+	// Components selects the writer components included in the backup. If
+	// not empty, the backup is performed in component mode and the selected
+	// components are listed in the Backup Components Document. Creation
+	// fails if any selector does not match a component. It requires a
+	// context with writer participation.
+	Components []ComponentSelector
+
+	// BackupComponents, if not nil, receives the Backup Components Document
+	// in XML format after the shadow copies are created. The document must
+	// be saved with the backed up data in order to restore it using Restore.
+	BackupComponents io.Writer
+}
+
+// ComponentSelector selects a writer component for backup.
+type ComponentSelector struct {
+	Writer string // Writer name or writer/instance ID
+	Path   string // Component path, as returned by Component.FullPath
+}
+
+// String returns the selector in "Writer:Path" format.
+func (s ComponentSelector) String() string {
+	return s.Writer + ":" + s.Path
+}
+
+// backupComponents is the subset of the IVssBackupComponents interface used to
+// create shadow copy sets and restore writer data. Methods that wait for
+// asynchronous operations cancel them if ctx is done. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/vsbackup/nl-vsbackup-ivssbackupcomponents
+type backupComponents interface {
+	InitializeForBackup() error
+	SetContext(attr int32) error
+	SetBackupState(selectComponents bool, backupType int32) error
+	GatherWriterMetadata(ctx context.Context) error
+
+	// GetWriterMetadata returns the Writer Metadata Documents of all writers
+	// in XML format and frees the metadata held by the interface. It must be
+	// called after GatherWriterMetadata.
+	GetWriterMetadata() ([]string, error)
+
+	// GatherWriterStatus waits for the writers to report their status and
+	// returns it.
+	GatherWriterStatus(ctx context.Context) ([]WriterStatus, error)
+
+	// AddComponent adds a writer component to a component-mode backup.
+	AddComponent(instanceID, writerID string, typ ComponentType, logicalPath, name string) error
+
+	StartSnapshotSet() (SetID, error)
+	AddToSnapshotSet(vol string) (ShadowID, error)
+	PrepareForBackup(ctx context.Context) error
+	DoSnapshotSet(ctx context.Context) error
+	GetSnapshotProperties(id ShadowID) (*ShadowCopy, error)
+	BackupComplete(ctx context.Context) error
+	AbortBackup() error
+	DeleteSnapshotSet(id SetID) error
+
+	// ExposeSnapshot exposes a shadow copy and returns the exposed name.
+	ExposeSnapshot(id ShadowID, path string, attr int32, expose string) (string, error)
+
+	// UnexposeSnapshot removes the exposure of a shadow copy. It requires
+	// IVssBackupComponentsEx2.
+	UnexposeSnapshot(id ShadowID) error
+
+	// SaveAsXML returns the Backup Components Document in XML format.
+	SaveAsXML() (string, error)
+
+	InitializeForRestore(doc string) error
+	SetSelectedForRestore(writerID string, typ ComponentType, logicalPath, name string) error
+	PreRestore(ctx context.Context) error
+	PostRestore(ctx context.Context) error
+
+	// Release releases the interface and any COM resources held by the
+	// caller.
+	Release()
+}
+
+// CreateSet atomically creates shadow copies of multiple volumes using the
+// native VSS API and returns them in the same order as vols. All returned
+// shadow copies share the same SetID. Volumes can be specified in any format
+// accepted by Create. If opts is nil, the default options are used, which
+// create persistent, client-accessible shadow copies with writer
+// participation. If any step fails, all shadow copies in the set are removed.
+// Non-persistent contexts are not supported; use CreateHeldSet instead.
+func CreateSet(ctx context.Context, vols []string, opts *SetOptions) ([]*ShadowCopy, error) {
+	if opts != nil && !opts.Context.persistent() {
+		if _, err := opts.Context.attr(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("vss: non-persistent shadow copies require CreateHeldSet")
+	}
+	bc, err := newBackupComponents()
+	if err != nil {
+		return nil, err
+	}
+	defer bc.Release()
+	return (&snapshotSet{bc: bc}).create(ctx, vols, opts)
+}
+
+// snapshotSet creates a shadow copy set using IVssBackupComponents.
+type snapshotSet struct {
+	bc      backupComponents
+	writers bool       // Writers are involved
+	id      SetID      // Shadow copy set ID
+	ids     []ShadowID // Shadow copy IDs
+	created bool       // DoSnapshotSet succeeded
+	hold    bool       // Defer BackupComplete until the set is released
+
+	// start, if not nil, is called with the ID of each shadow copy before
+	// the set is created. Creation is aborted if it returns an error.
+	start func(id ShadowID) error
+}
+
+// create creates shadow copies of vols. Any partial results are cleaned up on
+// failure.
+func (s *snapshotSet) create(ctx context.Context, vols []string, opts *SetOptions) (_ []*ShadowCopy, err error) {
+	if len(vols) == 0 {
+		return nil, errors.New("vss: no volumes specified")
+	}
+	if opts == nil {
+		opts = new(SetOptions)
+	}
+	attr, err := opts.Context.attr()
+	if err != nil {
+		return nil, err
+	}
+	bt, err := opts.BackupType.vss()
+	if err != nil {
+		return nil, err
+	}
+	if (opts.FailOnWriterError || len(opts.Components) > 0) && attr&attrNoWriters != 0 {
+		return nil, errNoWriters
+	}
+	if s.writers, err = initBackup(ctx, s.bc, attr, bt, len(opts.Components) > 0); err != nil {
+		return nil, err
+	}
+	if len(opts.Components) > 0 {
+		if err = addComponents(s.bc, opts.Components); err != nil {
+			return nil, err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.id, err = s.bc.StartSnapshotSet(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, s.abort())
+		}
+	}()
+	for _, vol := range vols {
+		id, err := s.bc.AddToSnapshotSet(vol)
+		if err != nil {
+			return nil, fmt.Errorf("vss: failed to add %#q to shadow copy set (%w)", vol, err)
+		}
+		s.ids = append(s.ids, id)
+		if s.start != nil {
+			if err = s.start(id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.writers {
+		if err = s.bc.PrepareForBackup(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.bc.DoSnapshotSet(ctx); err != nil {
+		return nil, err
+	}
+	s.created = true
+	if opts.FailOnWriterError {
+		ws, err := s.bc.GatherWriterStatus(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkWriters(ws, opts.Writers); err != nil {
+			return nil, err
+		}
+	}
+	all := make([]*ShadowCopy, 0, len(s.ids))
+	for _, id := range s.ids {
+		sc, err := s.bc.GetSnapshotProperties(id)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, sc)
+	}
+	if opts.BackupComponents != nil {
+		doc, err := s.bc.SaveAsXML()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(opts.BackupComponents, doc); err != nil {
+			return nil, fmt.Errorf("vss: failed to save backup components document (%w)", err)
+		}
+	}
+	if s.writers && !s.hold {
+		if err = s.bc.BackupComplete(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// initBackup initializes bc for a backup operation in the specified context.
+// If the context involves writers, it also sets the backup type and mode and
+// gathers writer metadata. It returns whether writers are involved.
+func initBackup(ctx context.Context, bc backupComponents, attr, bt int32, selectComponents bool) (writers bool, err error) {
+	if err = bc.InitializeForBackup(); err != nil {
+		return false, err
+	}
+	if err = bc.SetContext(attr); err != nil {
+		return false, err
+	}
+	if attr&attrNoWriters != 0 {
+		return false, nil
+	}
+	if err = bc.SetBackupState(selectComponents, bt); err != nil {
+		return false, err
+	}
+	return true, bc.GatherWriterMetadata(ctx)
+}
+
+// addComponents adds the components selected by sel to the backup. It must be
+// called after the writer metadata is gathered. It returns an error containing
+// os.ErrNotExist if any selector does not match a component.
+func addComponents(bc backupComponents, sel []ComponentSelector) error {
+	all, err := getWriterMetadata(bc)
+	if err != nil {
+		return err
+	}
+	type match struct {
+		wm   *WriterMetadata
+		comp *Component
+	}
+	var matches []match
+	var unmatched []string
+	for _, s := range sel {
+		n := len(matches)
+		for _, wm := range all {
+			if !wm.matches(s.Writer) {
+				continue
+			}
+			for _, comp := range wm.Components {
+				if strings.EqualFold(comp.FullPath(), s.Path) {
+					matches = append(matches, match{wm, comp})
+				}
+			}
+		}
+		if len(matches) == n {
+			unmatched = append(unmatched, fmt.Sprintf("%#q", s))
+		}
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("vss: components not found: %s (%w)", strings.Join(unmatched, ", "), os.ErrNotExist)
+	}
+	for _, m := range matches {
+		err = bc.AddComponent(m.wm.InstanceID, m.wm.WriterID, m.comp.Type, m.comp.LogicalPath, m.comp.Name)
+		if err != nil {
+			return fmt.Errorf("vss: failed to add component %s of writer %s (%w)",
+				m.comp.FullPath(), m.wm.Name, err)
+		}
+	}
+	return nil
+}
+
+// abort cancels the creation of the shadow copy set. If the shadow copies were
+// already created, they are deleted.
+func (s *snapshotSet) abort() error {
+	if s.created {
+		return s.bc.DeleteSnapshotSet(s.id)
+	}
+	return s.bc.AbortBackup()
+}
@@ -0,0 +1,261 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeComponents is an IVssBackupComponents stand-in that records method calls
+// and fails the methods named by fail.
+type fakeComponents struct {
+	calls []string
+	fail  []string
+	vols  []string
+	docs  []string
+	ws    []WriterStatus
+	doc   string
+	sel   []string
+	add   []string
+
+	exposed []string
+	attr    int32
+	bt      int32
+
+	selectComponents bool
+}
+
+func (f *fakeComponents) call(name string) error {
+	f.calls = append(f.calls, name)
+	if slices.Contains(f.fail, name) {
+		return fmt.Errorf("vss: IVssBackupComponents.%s failed (%w)", name, HRESULT(0x80042302))
+	}
+	return nil
+}
+
+func (f *fakeComponents) InitializeForBackup() error { return f.call("InitializeForBackup") }
+func (f *fakeComponents) SetContext(attr int32) error {
+	f.attr = attr
+	return f.call("SetContext")
+}
+func (f *fakeComponents) SetBackupState(sel bool, bt int32) error {
+	f.bt, f.selectComponents = bt, sel
+	return f.call("SetBackupState")
+}
+func (f *fakeComponents) GatherWriterMetadata(ctx context.Context) error {
+	return f.call("GatherWriterMetadata")
+}
+func (f *fakeComponents) GetWriterMetadata() ([]string, error) {
+	return f.docs, f.call("GetWriterMetadata")
+}
+func (f *fakeComponents) GatherWriterStatus(ctx context.Context) ([]WriterStatus, error) {
+	return f.ws, f.call("GatherWriterStatus")
+}
+func (f *fakeComponents) AddComponent(instanceID, writerID string, typ ComponentType, logicalPath, name string) error {
+	if err := f.call("AddComponent"); err != nil {
+		return err
+	}
+	f.add = append(f.add, fmt.Sprintf("%s:%s:%s:%s", instanceID, writerID, typ, fullPath(logicalPath, name)))
+	return nil
+}
+func (f *fakeComponents) StartSnapshotSet() (SetID, error) {
+	return testSetID(1), f.call("StartSnapshotSet")
+}
+func (f *fakeComponents) AddToSnapshotSet(vol string) (ShadowID, error) {
+	if err := f.call("AddToSnapshotSet"); err != nil {
+		return ShadowID{}, err
+	}
+	f.vols = append(f.vols, vol)
+	return testShadowID(len(f.vols)), nil
+}
+func (f *fakeComponents) PrepareForBackup(ctx context.Context) error {
+	return f.call("PrepareForBackup")
+}
+func (f *fakeComponents) DoSnapshotSet(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		f.calls = append(f.calls, "DoSnapshotSet")
+		return err
+	}
+	return f.call("DoSnapshotSet")
+}
+func (f *fakeComponents) GetSnapshotProperties(id ShadowID) (*ShadowCopy, error) {
+	if err := f.call("GetSnapshotProperties"); err != nil {
+		return nil, err
+	}
+	i := 1
+	for testShadowID(i) != id {
+		i++
+	}
+	return &ShadowCopy{
+		ID:           id,
+		SetID:        testSetID(1),
+		DeviceObject: fmt.Sprintf(`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy%d`, i),
+		VolumeName:   fakeVolume(f.vols[i-1]),
+	}, nil
+}
+func (f *fakeComponents) BackupComplete(ctx context.Context) error {
+	return f.call("BackupComplete")
+}
+func (f *fakeComponents) AbortBackup() error { return f.call("AbortBackup") }
+func (f *fakeComponents) DeleteSnapshotSet(id SetID) error {
+	return f.call("DeleteSnapshotSet")
+}
+func (f *fakeComponents) ExposeSnapshot(id ShadowID, path string, attr int32, expose string) (string, error) {
+	f.exposed = append(f.exposed, fmt.Sprintf("%s|%s|%#x|%s", id, path, attr, expose))
+	if expose == "" {
+		expose = id.String()
+	}
+	return expose, f.call("ExposeSnapshot")
+}
+func (f *fakeComponents) UnexposeSnapshot(id ShadowID) error {
+	return f.call("UnexposeSnapshot")
+}
+func (f *fakeComponents) SaveAsXML() (string, error) {
+	return f.doc, f.call("SaveAsXML")
+}
+func (f *fakeComponents) InitializeForRestore(doc string) error {
+	f.doc = doc
+	return f.call("InitializeForRestore")
+}
+func (f *fakeComponents) SetSelectedForRestore(writerID string, typ ComponentType, logicalPath, name string) error {
+	f.sel = append(f.sel, writerID+":"+string(typ)+":"+fullPath(logicalPath, name))
+	return f.call("SetSelectedForRestore")
+}
+func (f *fakeComponents) PreRestore(ctx context.Context) error  { return f.call("PreRestore") }
+func (f *fakeComponents) PostRestore(ctx context.Context) error { return f.call("PostRestore") }
+func (f *fakeComponents) Release()                              { f.calls = append(f.calls, "Release") }
+
+// fakeVolume returns the volume name of vol, which is either a volume GUID name
+// or a drive letter.
+func fakeVolume(vol string) VolumeGUIDName {
+	if v, err := ParseVolumeGUIDName(vol); err == nil {
+		return v
+	}
+	return testVolume(int(vol[0]))
+}
+
+func TestSnapshotSet(t *testing.T) {
+	f := new(fakeComponents)
+	all, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:", "D:"}, new(SetOptions))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"InitializeForBackup",
+		"SetContext",
+		"SetBackupState",
+		"GatherWriterMetadata",
+		"StartSnapshotSet",
+		"AddToSnapshotSet",
+		"AddToSnapshotSet",
+		"PrepareForBackup",
+		"DoSnapshotSet",
+		"GetSnapshotProperties",
+		"GetSnapshotProperties",
+		"BackupComplete",
+	}, f.calls)
+	assert.Equal(t, int32(0xd), f.attr)
+	assert.Equal(t, int32(5), f.bt)
+	require.Len(t, all, 2)
+	assert.Equal(t, &ShadowCopy{
+		ID:           testShadowID(2),
+		SetID:        testSetID(1),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy2`,
+		VolumeName:   testVolume('D'),
+	}, all[1])
+
+	f = new(fakeComponents)
+	opts := &SetOptions{Context: ContextNASRollback, BackupType: BackupFull}
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"InitializeForBackup",
+		"SetContext",
+		"StartSnapshotSet",
+		"AddToSnapshotSet",
+		"DoSnapshotSet",
+		"GetSnapshotProperties",
+	}, f.calls)
+	assert.Equal(t, int32(0x19), f.attr)
+}
+
+func TestSnapshotSetStart(t *testing.T) {
+	// start is called with each ID before the set is created
+	f := new(fakeComponents)
+	var ids []ShadowID
+	start := func(id ShadowID) error {
+		assert.NotContains(t, f.calls, "DoSnapshotSet")
+		ids = append(ids, id)
+		return nil
+	}
+	all, err := (&snapshotSet{bc: f, start: start}).create(context.Background(), []string{"C:", "D:"},
+		&SetOptions{Context: ContextClientAccessible})
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, []ShadowID{all[0].ID, all[1].ID}, ids)
+
+	// start failure aborts the set
+	errStart := errors.New("start")
+	f = new(fakeComponents)
+	_, err = (&snapshotSet{bc: f, start: func(ShadowID) error { return errStart }}).create(
+		context.Background(), []string{"C:"}, &SetOptions{Context: ContextClientAccessible})
+	require.ErrorIs(t, err, errStart)
+	assert.NotContains(t, f.calls, "DoSnapshotSet")
+	assert.Equal(t, "AbortBackup", f.calls[len(f.calls)-1])
+}
+
+func TestSnapshotSetErrors(t *testing.T) {
+	tests := []struct {
+		fail    string
+		cleanup string
+	}{
+		{"InitializeForBackup", ""},
+		{"SetContext", ""},
+		{"SetBackupState", ""},
+		{"GatherWriterMetadata", ""},
+		{"StartSnapshotSet", ""},
+		{"AddToSnapshotSet", "AbortBackup"},
+		{"PrepareForBackup", "AbortBackup"},
+		{"DoSnapshotSet", "AbortBackup"},
+		{"GetSnapshotProperties", "DeleteSnapshotSet"},
+		{"BackupComplete", "DeleteSnapshotSet"},
+	}
+	for _, tc := range tests {
+		f := &fakeComponents{fail: []string{tc.fail}}
+		all, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, nil)
+		require.Error(t, err, tc.fail)
+		assert.Nil(t, all)
+		assert.ErrorIs(t, err, HRESULT(0x80042302))
+		last := f.calls[len(f.calls)-1]
+		if tc.cleanup == "" {
+			assert.Equal(t, tc.fail, last)
+		} else {
+			assert.Equal(t, tc.cleanup, last, tc.fail)
+		}
+	}
+
+	// Cleanup failure is reported with the original error
+	f := &fakeComponents{fail: []string{"DoSnapshotSet", "AbortBackup"}}
+	_, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, nil)
+	require.ErrorContains(t, err, "DoSnapshotSet")
+	require.ErrorContains(t, err, "AbortBackup")
+
+	_, err = (&snapshotSet{bc: &fakeComponents{}}).create(context.Background(), nil, nil)
+	require.Error(t, err)
+	_, err = (&snapshotSet{bc: &fakeComponents{}}).create(context.Background(), []string{"C:"},
+		&SetOptions{Context: -1})
+	require.Error(t, err)
+	_, err = (&snapshotSet{bc: &fakeComponents{}}).create(context.Background(), []string{"C:"},
+		&SetOptions{BackupType: 100})
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f = new(fakeComponents)
+	_, err = (&snapshotSet{bc: f}).create(ctx, []string{"C:"}, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NotContains(t, f.calls, "StartSnapshotSet")
+}
@@ -0,0 +1,37 @@
+package vss
+
+import "github.com/mxk/go-vss/vsspath"
+
+// isShadowPath returns whether s is a shadow copy path.
+func isShadowPath(s string) bool {
+	return vsspath.Is(s)
+}
+
+// isShadowCopy implements IsShadowCopy using the specified functions to read a
+// symlink and to resolve the final NT path of a file.
+func isShadowCopy(name string, readlink, resolve func(string) (string, error)) (bool, error) {
+	// https://github.com/golang/go/issues/63703#issuecomment-1872960199
+	if isShadowPath(name) {
+		return true, nil
+	}
+	if target, err := readlink(name); err == nil {
+		if name = target; isShadowPath(target) {
+			return true, nil
+		}
+	}
+	name, err := resolve(name)
+	return isShadowPath(name), err
+}
+
+// normShadowPath converts s to the canonical DeviceObject form. It returns an
+// empty string if s does not refer to a shadow copy. Paths that already start
+// with the GLOBALROOT prefix are canonicalized too: the prefix is rewritten in
+// canonical case and paths without a valid index, such as the bare prefix, are
+// rejected (see vsspath.Parse). The rest of the path is kept verbatim.
+func normShadowPath(s string) string {
+	p, err := vsspath.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return p.String()
+}
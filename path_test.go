@@ -0,0 +1,142 @@
+package vss
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowPath(t *testing.T) {
+	const want = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy42`
+	assert.False(t, isShadowPath(``))
+	assert.False(t, isShadowPath(`C:\Windows`))
+	assert.False(t, isShadowPath(`\Device\HarddiskVolumeShadowCopyX`))
+	assert.True(t, isShadowPath(`\Device\HarddiskVolumeShadowCopy42`))
+	assert.Equal(t, want, normShadowPath(`\device\harddiskvolumeshadowcopy42`))
+	assert.Equal(t, want, normShadowPath(`globalroot\device\harddiskvolumeshadowcopy42`))
+	assert.Equal(t, want, normShadowPath(`\\.\HarddiskVolumeShadowCopy42`))
+	assert.Equal(t, want+`\x`, normShadowPath(`\\?\globalroot\device\harddiskvolumeshadowcopy42\x`))
+	assert.Equal(t, want, normShadowPath(want))
+	assert.Equal(t, "", normShadowPath(want[:len(want)-2]))
+}
+
+func TestIsShadowCopyFake(t *testing.T) {
+	const dev = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`
+	for name, want := range map[string]bool{
+		dev + `\x`:       true,
+		`C:\link`:        true,
+		`C:\link\x`:      true,
+		`C:\Windows`:     false,
+		`C:\Mnt\Missing`: false,
+	} {
+		ok, err := isShadowCopy(name, testReadlink, testResolve)
+		if name == `C:\Mnt\Missing` {
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		} else {
+			assert.NoError(t, err, name)
+		}
+		assert.Equal(t, want, ok, name)
+	}
+}
+
+// testReadlink is a readlink function with a single symlink at C:\link.
+func testReadlink(name string) (string, error) {
+	if name == `C:\link` {
+		return `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`, nil
+	}
+	return "", os.ErrInvalid
+}
+
+// testResolve is a path resolution function for files under C:\link and
+// existing files in testTopology.
+func testResolve(name string) (string, error) {
+	if rest, ok := cutMount(name, `C:\link\`); ok {
+		return `\Device\HarddiskVolumeShadowCopy1` + rest, nil
+	}
+	if _, _, err := splitVolume(testTopology, name); err != nil || strings.Contains(name, "Missing") {
+		return "", os.ErrNotExist
+	}
+	return name, nil
+}
+
+func FuzzShadowPath(f *testing.F) {
+	for _, s := range []string{
+		``,
+		`C:\Windows`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Windows`,
+		`\\?\globalroot\device\harddiskvolumeshadowcopy42`,
+		`GLOBALROOT\Device\HarddiskVolumeShadowCopy7`,
+		`\Device\HarddiskVolumeShadowCopy3\`,
+		"\\Device\\HarddiskVolumeShadowCopy3\x00",
+		"\\?\\GLOBALROOT\xff",
+		`C:`,
+		`c:/mnt/data`,
+		`C:\Mnt\Data\data\logs\1.log`,
+		`\\?\D:\data\..\x.db`,
+		`\\?\Volume{20000000-0000-0000-0000-000000000070}\x`,
+		`C:\link\x`,
+		`\\server\share\dir`,
+		`\\?\UNC\server\share\..\x`,
+		`//server/share`,
+		`\\server\\x`,
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		const prefix = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`
+		norm := normShadowPath(s)
+		assert.Equal(t, norm != "", isShadowPath(s))
+		if norm != "" {
+			assert.True(t, strings.HasPrefix(norm, prefix))
+			assert.Equal(t, norm, normShadowPath(norm))
+		}
+
+		// IsShadowCopy agrees with the path and symlink target
+		ok, err := isShadowCopy(s, testReadlink, testResolve)
+		if err == nil {
+			link, _ := testReadlink(s)
+			res, _ := testResolve(s)
+			assert.Equal(t, isShadowPath(s) || isShadowPath(link) || isShadowPath(res), ok)
+		} else {
+			assert.False(t, ok)
+		}
+
+		// SplitVolume returns a mount point and the rest of the clean path
+		vol, rel, err := splitVolume(testTopology, s)
+		if share, rest, ok := cutShare(s); ok {
+			require.NoError(t, err)
+			assert.Equal(t, share, vol)
+			assert.True(t, strings.HasSuffix(vol, `\`), vol)
+			if rest == "" {
+				rest = "."
+			}
+			assert.Equal(t, rest, rel)
+		} else if err == nil {
+			p, err := cleanLivePath(s)
+			require.NoError(t, err)
+			mount, _, _ := mountOf(testTopology, vol)
+			assert.Equal(t, vol, mount)
+			assert.True(t, strings.HasSuffix(vol, `\`), vol)
+			assert.NotEmpty(t, rel)
+			if rel == "." {
+				assert.True(t, strings.EqualFold(vol, p+`\`) || strings.EqualFold(vol, p), p)
+			} else {
+				assert.True(t, strings.EqualFold(vol+rel, p), p)
+			}
+		}
+
+		// volumeName accepts mount points and returns canonical names
+		if name, err := volumeName(testTopology, s); err == nil {
+			v, err := ParseVolumeGUIDName(name)
+			require.NoError(t, err)
+			assert.Equal(t, v.String(), name)
+			_, rel, err := splitVolume(testTopology, strings.TrimRight(s, `\/`)+`\`)
+			require.NoError(t, err)
+			assert.Equal(t, ".", rel, s)
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PathSet is a set of shadow copies of all volumes containing a list of paths.
+type PathSet struct {
+	// Paths maps each path passed to SnapshotPaths to the corresponding path
+	// inside a shadow copy.
+	Paths map[string]string
+
+	// Nested maps the mount points of volumes mounted in folders under the
+	// snapshotted paths to the root directories of their shadow copies.
+	// Shadow copies do not contain the contents of such volumes, so callers
+	// walking a snapshotted tree must continue into these roots.
+	Nested map[string]string
+
+	copies  []*ShadowCopy
+	topo    topology
+	release func() error
+
+	once sync.Once
+	err  error
+}
+
+// SnapshotPaths creates a shadow copy of every volume containing one of the
+// specified absolute paths, including volumes mounted in folders under those
+// paths. Each volume is copied once. When the native VSS API is available, all
+// shadow copies are created atomically as a held set with writer participation.
+// Otherwise, they are created one at a time using WMI. The returned set must be
+// closed to remove the shadow copies.
+func SnapshotPaths(ctx context.Context, paths []string) (*PathSet, error) {
+	return snapshotPaths(ctx, sysTopology, sys, newBackupComponents, paths)
+}
+
+// snapshotPaths implements SnapshotPaths using the specified topology, backend,
+// and IVssBackupComponents constructor.
+func snapshotPaths(ctx context.Context, t topology, b backend, newBC func() (backupComponents, error), paths []string) (_ *PathSet, err error) {
+	g, err := groupPaths(t, paths)
+	if err != nil {
+		return nil, err
+	}
+	all, release, err := snapshotVolumes(ctx, b, newBC, g.vols)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, release())
+		}
+	}()
+	s := &PathSet{
+		Paths:   make(map[string]string, len(paths)),
+		Nested:  make(map[string]string, len(g.nested)),
+		copies:  all,
+		topo:    t,
+		release: release,
+	}
+	for _, p := range paths {
+		if s.Paths[p], err = s.Translate(p); err != nil {
+			return nil, err
+		}
+	}
+	for m, vol := range g.nested {
+		sc := s.find(vol)
+		dev, err := sc.device()
+		if err != nil {
+			return nil, err
+		}
+		s.Nested[m] = dev.Root().String()
+	}
+	return s, nil
+}
+
+// ShadowCopies returns the shadow copies in the set, one per volume.
+func (s *PathSet) ShadowCopies() []*ShadowCopy {
+	return append([]*ShadowCopy(nil), s.copies...)
+}
+
+// Translate converts an absolute path on any of the snapshotted volumes into
+// the path of the same file inside the corresponding shadow copy.
+func (s *PathSet) Translate(livePath string) (string, error) {
+	p, err := cleanLivePath(livePath)
+	if err != nil {
+		return "", err
+	}
+	_, vol, err := mountOf(s.topo, p)
+	if err != nil {
+		return "", err
+	}
+	sc := s.find(vol)
+	if sc == nil {
+		return "", fmt.Errorf("vss: volume of %#q is not in the shadow copy set", livePath)
+	}
+	return sc.translate(s.topo, p)
+}
+
+// Close removes the shadow copies. Calling Close more than once returns the
+// result of the first call.
+func (s *PathSet) Close() error {
+	s.once.Do(func() { s.err = s.release() })
+	return s.err
+}
+
+// find returns the shadow copy of volume vol or nil if there isn't one.
+func (s *PathSet) find(vol VolumeGUIDName) *ShadowCopy {
+	for _, sc := range s.copies {
+		if sc.VolumeName == vol {
+			return sc
+		}
+	}
+	return nil
+}
+
+// pathGroup contains the volumes of a list of paths.
+type pathGroup struct {
+	vols   []VolumeGUIDName          // Distinct volumes in order of discovery
+	nested map[string]VolumeGUIDName // Nested mount point to volume name
+}
+
+// pathTree is a directory tree on a volume.
+type pathTree struct {
+	vol VolumeGUIDName // Volume name
+	rel string         // Root of the tree relative to the volume root
+}
+
+// mountPoint is a folder where a volume is mounted on another volume.
+type mountPoint struct {
+	path   string         // Mount point, such as `D:\data\logs\`
+	vol    VolumeGUIDName // Mounted volume
+	parent VolumeGUIDName // Volume containing the mount point
+	rel    string         // Mount point relative to the root of parent
+}
+
+// groupPaths returns the volumes containing paths and any volumes mounted in
+// folders under them.
+func groupPaths(t topology, paths []string) (*pathGroup, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("vss: no paths specified")
+	}
+	g := &pathGroup{nested: make(map[string]VolumeGUIDName)}
+	queue := make([]pathTree, 0, len(paths))
+	for _, p := range paths {
+		clean, err := cleanLivePath(p)
+		if err != nil {
+			return nil, err
+		}
+		mount, vol, err := mountOf(t, clean)
+		if err != nil {
+			return nil, err
+		}
+		rel, ok := cutMount(clean, mount)
+		if !ok {
+			return nil, fmt.Errorf("vss: %#q is not under mount point %#q", p, mount)
+		}
+		g.add(vol)
+		queue = append(queue, pathTree{vol, rel})
+	}
+	mounts, err := folderMounts(t)
+	if err != nil {
+		return nil, err
+	}
+	for len(queue) > 0 {
+		tree := queue[0]
+		queue = queue[1:]
+		for _, m := range mounts {
+			if _, done := g.nested[m.path]; done || m.parent != tree.vol {
+				continue
+			}
+			if _, ok := cutMount(m.rel, tree.rel); ok {
+				g.nested[m.path] = m.vol
+				g.add(m.vol)
+				queue = append(queue, pathTree{m.vol, ""})
+			}
+		}
+	}
+	return g, nil
+}
+
+// add adds vol to the group if it is not already present.
+func (g *pathGroup) add(vol VolumeGUIDName) {
+	if !slices.Contains(g.vols, vol) {
+		g.vols = append(g.vols, vol)
+	}
+}
+
+// folderMounts returns all volume mount points other than drive roots.
+func folderMounts(t topology) ([]mountPoint, error) {
+	vols, err := t.volumes()
+	if err != nil {
+		return nil, err
+	}
+	var all []mountPoint
+	for _, vol := range vols {
+		paths, err := t.paths(vol)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			q := strings.TrimSuffix(p, `\`)
+			i := strings.LastIndexByte(q, '\\')
+			if i < 0 {
+				continue
+			}
+			mount, parent, err := t.volumeOf(q[:i+1])
+			if err != nil {
+				return nil, err
+			}
+			if rel, ok := cutMount(q, mount); ok {
+				all = append(all, mountPoint{p, vol, parent, rel})
+			}
+		}
+	}
+	return all, nil
+}
+
+// mountOf returns the mount point and volume name of the clean path p.
+func mountOf(t topology, p string) (mount string, vol VolumeGUIDName, err error) {
+	if mount = volumeGUIDPrefix(p); mount != "" {
+		vol, err = ParseVolumeGUIDName(mount)
+		return
+	}
+	return t.volumeOf(p)
+}
+
+// snapshotVolumes creates shadow copies of vols and returns them in the same
+// order along with the function that removes them. The native API is used if
+// IVssBackupComponents can be created. Otherwise, the shadow copies are created
+// using b.
+func snapshotVolumes(ctx context.Context, b backend, newBC func() (backupComponents, error), vols []VolumeGUIDName) ([]*ShadowCopy, func() error, error) {
+	names := make([]string, len(vols))
+	for i, vol := range vols {
+		names[i] = vol.String()
+	}
+	var unavailable bool
+	h, err := createHeldSet(ctx, func() (backupComponents, error) {
+		bc, err := newBC()
+		unavailable = err != nil
+		return bc, err
+	}, names, nil)
+	if err == nil {
+		return h.ShadowCopies(), h.Close, nil
+	}
+	if !unavailable {
+		return nil, nil, err
+	}
+	var all []*ShadowCopy
+	remove := func() error {
+		if len(all) == 0 {
+			return nil
+		}
+		return b.exec(context.Background(), func(c conn) error {
+			var errs []error
+			for _, sc := range all {
+				errs = append(errs, c.remove(sc.ID))
+			}
+			return errors.Join(errs...)
+		})
+	}
+	err = b.exec(ctx, func(c conn) error {
+		for _, vol := range names {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sc, err := c.create(vol)
+			if err != nil {
+				return err
+			}
+			all = append(all, sc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Join(err, remove())
+	}
+	return all, remove, nil
+}
@@ -0,0 +1,136 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nestedTopology extends testTopology with F: mounted inside E:.
+var nestedTopology = mapTopology{
+	`C:\`:                            volC,
+	`D:\`:                            volD,
+	`C:\Mnt\Data\`:                   volD,
+	`D:\data\logs\`:                  volE,
+	`C:\Mnt\Data\data\logs\`:         volE,
+	`D:\data\logs\archive\`:          volF,
+	`C:\Mnt\Data\data\logs\archive\`: volF,
+}
+
+func TestGroupPaths(t *testing.T) {
+	g, err := groupPaths(nestedTopology, []string{`C:\Windows`, `d:\data\x.db`, `C:\Mnt\Data\data`})
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeGUIDName{volC, volD, volE, volF}, g.vols)
+	assert.Equal(t, map[string]VolumeGUIDName{
+		`D:\data\logs\`:                  volE,
+		`C:\Mnt\Data\data\logs\`:         volE,
+		`D:\data\logs\archive\`:          volF,
+		`C:\Mnt\Data\data\logs\archive\`: volF,
+	}, g.nested)
+
+	// Volumes are only included if they are under one of the paths
+	g, err = groupPaths(nestedTopology, []string{`D:\data\logs\archive\2023`, `D:\other`})
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeGUIDName{volF, volD}, g.vols)
+	assert.Empty(t, g.nested)
+
+	g, err = groupPaths(nestedTopology, []string{volE.String() + `x`})
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeGUIDName{volE}, g.vols)
+	assert.Empty(t, g.nested)
+	g, err = groupPaths(nestedTopology, []string{volE.String()})
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeGUIDName{volE, volF}, g.vols)
+	assert.Len(t, g.nested, 2)
+
+	// The whole tree of C: includes all volumes
+	g, err = groupPaths(nestedTopology, []string{`C:/`})
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeGUIDName{volC, volD, volE, volF}, g.vols)
+	assert.Len(t, g.nested, 5)
+
+	for _, paths := range [][]string{nil, {`data`}, {`S:\data`}, {`Z:\data`}, {`\\server\share`}} {
+		_, err = groupPaths(nestedTopology, paths)
+		assert.Error(t, err, paths)
+	}
+}
+
+func TestSnapshotPaths(t *testing.T) {
+	f := new(fakeComponents)
+	paths := []string{`D:\data\x.db`, `C:\Mnt\Data\data\logs\1.log`, `d:\data`, `C:\Windows`}
+	s, err := snapshotPaths(context.Background(), nestedTopology, new(fakeBackend), fakeNew(f), paths)
+	require.NoError(t, err)
+	assert.Equal(t, []string{volD.String(), volE.String(), volC.String(), volF.String()}, f.vols)
+	const dev = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`
+	assert.Equal(t, map[string]string{
+		`D:\data\x.db`:                dev + `1\data\x.db`,
+		`C:\Mnt\Data\data\logs\1.log`: dev + `2\1.log`,
+		`d:\data`:                     dev + `1\data`,
+		`C:\Windows`:                  dev + `3\Windows`,
+	}, s.Paths)
+	assert.Equal(t, map[string]string{
+		`D:\data\logs\`:                  dev + `2\`,
+		`C:\Mnt\Data\data\logs\`:         dev + `2\`,
+		`D:\data\logs\archive\`:          dev + `4\`,
+		`C:\Mnt\Data\data\logs\archive\`: dev + `4\`,
+	}, s.Nested)
+	assert.Len(t, s.ShadowCopies(), 4)
+	p, err := s.Translate(`C:\Mnt\Data\data\logs\archive\2023\1.log`)
+	require.NoError(t, err)
+	assert.Equal(t, dev+`4\2023\1.log`, p)
+
+	n := len(f.calls)
+	require.NoError(t, s.Close())
+	require.NoError(t, s.Close())
+	assert.Equal(t, []string{"BackupComplete", "Release"}, f.calls[n:])
+
+	// Volumes outside of the set
+	f = new(fakeComponents)
+	s, err = snapshotPaths(context.Background(), nestedTopology, new(fakeBackend), fakeNew(f), []string{`D:\other`})
+	require.NoError(t, err)
+	_, err = s.Translate(`D:\data\logs\1.log`)
+	assert.Error(t, err)
+	require.NoError(t, s.Close())
+
+	// Native failure is not retried
+	f = &fakeComponents{fail: []string{"DoSnapshotSet"}}
+	b := new(fakeBackend)
+	_, err = snapshotPaths(context.Background(), nestedTopology, b, fakeNew(f), paths)
+	require.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Zero(t, b.execs.Load())
+}
+
+func TestSnapshotPathsFallback(t *testing.T) {
+	errNative := errors.New("native API unavailable")
+	noNative := func() (backupComponents, error) { return nil, errNative }
+	b := new(fakeBackend)
+	s, err := snapshotPaths(context.Background(), nestedTopology, b, noNative, []string{`D:\data\logs`, `C:\Windows`})
+	require.NoError(t, err)
+	const dev = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`
+	assert.Equal(t, map[string]string{
+		`D:\data\logs`: dev + `101\`,
+		`C:\Windows`:   dev + `102\Windows`,
+	}, s.Paths)
+	assert.Equal(t, map[string]string{
+		`D:\data\logs\archive\`:          dev + `103\`,
+		`C:\Mnt\Data\data\logs\archive\`: dev + `103\`,
+	}, s.Nested)
+	assert.Len(t, b.ids(), 3)
+	require.NoError(t, s.Close())
+	assert.Empty(t, b.ids())
+
+	// Partial results are removed
+	b = &fakeBackend{fail: map[string]error{volC.String(): errors.New("fail")}}
+	_, err = snapshotPaths(context.Background(), nestedTopology, b, noNative, []string{`D:\data\logs`, `C:\Windows`})
+	require.Error(t, err)
+	assert.Empty(t, b.ids())
+
+	// Backend failure
+	errBackend := errors.New("backend")
+	b = &fakeBackend{err: errBackend}
+	_, err = snapshotPaths(context.Background(), nestedTopology, b, noNative, []string{`C:\`})
+	assert.ErrorIs(t, err, errBackend)
+}
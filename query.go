@@ -0,0 +1,113 @@
+//go:build windows
+
+package vss
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-ole/go-ole"
+)
+
+// Query executes a WQL query in the root\CIMV2 namespace and returns all
+// resulting objects decoded into T, which must be a struct, a pointer to a
+// struct, or map[string]any. Struct fields are matched to WMI properties by
+// their `wmi` tag or, if the tag is absent, by the field name. For example:
+//
+//	type Volume struct {
+//		DeviceID  string
+//		Label     string
+//		Capacity  uint64
+//		FreeSpace uint64 `wmi:"FreeSpace"`
+//	}
+//	vols, err := vss.Query[Volume](ctx, "SELECT * FROM Win32_Volume")
+//
+// Supported field types are string, bool, integers, floats, time.Time (CIM
+// datetime), time.Duration (CIM interval), and slices and pointers of those
+// types. Properties that are NULL leave the corresponding field unmodified.
+// The context is checked before the connection is established and between
+// returned objects.
+func Query[T any](ctx context.Context, wql string) ([]T, error) {
+	var all []T
+	err := wmiExecContext(ctx, func(s *sWbemServices) error {
+		return s.execQuery(wql, func(v *ole.IDispatch) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			out, err := decodeObject[T](v)
+			if err == nil {
+				all = append(all, out)
+			}
+			return err
+		})
+	})
+	return all, err
+}
+
+// QueryOne executes a WQL query that is expected to return exactly one object
+// and returns that object decoded into T. See Query for the decoding rules.
+func QueryOne[T any](ctx context.Context, wql string) (T, error) {
+	var out T
+	err := wmiExecContext(ctx, func(s *sWbemServices) (err error) {
+		out, err = queryOne(s, wql, decodeObject[T])
+		return
+	})
+	return out, err
+}
+
+// CallMethod calls a WMI method on the class or instance identified by the
+// object path (e.g. "Win32_ShadowCopy" or `Win32_ShadowCopy.ID="{...}"`) and
+// returns the method's return value, which is typically a uint32 status code
+// represented as int32. Out parameters are passed as pointers to variables of
+// the appropriate type (e.g. *string). Only scalar return values, such as
+// integers, strings, and booleans, are supported. Methods that return objects
+// or arrays fail with an error, because COM resources are released before
+// CallMethod returns.
+func CallMethod(ctx context.Context, path, method string, args ...any) (any, error) {
+	var out any
+	err := wmiExecContext(ctx, func(s *sWbemServices) (err error) {
+		rv, err := s.callMethod(path, method, args...)
+		if err != nil {
+			return err
+		}
+		defer clearVariant(rv, &err)
+		if vt := rv.VT; vt == ole.VT_DISPATCH || vt == ole.VT_UNKNOWN || vt&ole.VT_ARRAY != 0 {
+			return fmt.Errorf("vss: %s.%s returned unsupported type %v", path, method, vt)
+		}
+		out = rv.Value()
+		return nil
+	})
+	return out, err
+}
+
+// wmiExecContext calls wmiExec if ctx is not done.
+func wmiExecContext(ctx context.Context, fn func(s *sWbemServices) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return wmiExec(fn)
+}
+
+// callMethod gets the object identified by path and calls the specified method
+// on it. The caller must clear the returned VARIANT.
+func (s *sWbemServices) callMethod(path, method string, args ...any) (rv *ole.VARIANT, err error) {
+	obj, err := s.CallMethod("Get", path)
+	if err != nil {
+		return nil, fmt.Errorf("vss: failed to get %s (%w)", path, err)
+	}
+	defer clearVariant(obj, &err)
+	if rv, err = obj.ToIDispatch().CallMethod(method, args...); err != nil {
+		return nil, fmt.Errorf("vss: %s.%s failed (%w)", path, method, err)
+	}
+	return rv, nil
+}
+
+// decodeObject decodes all properties of v into T.
+func decodeObject[T any](v *ole.IDispatch) (T, error) {
+	props, err := getProps(v)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return decode[T](props)
+}
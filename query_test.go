@@ -0,0 +1,48 @@
+//go:build windows
+
+package vss
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	type computerSystem struct {
+		Host        string `wmi:"DNSHostName"`
+		LogicalCPUs uint32 `wmi:"NumberOfLogicalProcessors"`
+		Memory      uint64 `wmi:"TotalPhysicalMemory"`
+	}
+	want, err := os.Hostname()
+	require.NoError(t, err)
+	const wql = "SELECT DNSHostName,NumberOfLogicalProcessors,TotalPhysicalMemory FROM Win32_ComputerSystem"
+	all, err := Query[computerSystem](context.Background(), wql)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, want, all[0].Host)
+	require.NotZero(t, all[0].LogicalCPUs)
+	require.NotZero(t, all[0].Memory)
+
+	cs, err := QueryOne[*computerSystem](context.Background(), wql)
+	require.NoError(t, err)
+	require.Equal(t, all[0], *cs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Query[computerSystem](ctx, wql)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCallMethod(t *testing.T) {
+	ctx := context.Background()
+	text, err := CallMethod(ctx, "Win32_ShadowCopy", "GetObjectText_")
+	require.NoError(t, err)
+	require.Contains(t, text, "Win32_ShadowCopy")
+
+	// SWbemObject.SpawnInstance_ returns an object
+	_, err = CallMethod(ctx, "Win32_ShadowCopy", "SpawnInstance_")
+	require.ErrorContains(t, err, "unsupported type")
+}
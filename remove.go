@@ -0,0 +1,138 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// removeWorkers is the maximum number of concurrent RemoveMatching
+// connections.
+const removeWorkers = 4
+
+// Filter selects shadow copies. Zero-value fields match all shadow copies.
+type Filter struct {
+	// Volume restricts the selection to shadow copies of the specified volume,
+	// which can be a drive letter, mount point, or volume GUID name.
+	Volume string
+
+	// SetID and ProviderID restrict the selection to shadow copies with the
+	// matching shadow copy set and provider IDs. ProviderID is a GUID string,
+	// like ShadowCopy.ProviderID, which is compared regardless of case and
+	// braces.
+	SetID      SetID
+	ProviderID string
+
+	// OlderThan restricts the selection to shadow copies that were created
+	// more than the specified duration ago.
+	OlderThan time.Duration
+
+	// Func, if non-nil, is called for each shadow copy that matches all other
+	// criteria and returns whether it should be selected.
+	Func func(sc *ShadowCopy) bool
+}
+
+// match returns whether sc is selected by f at the specified time.
+func (f *Filter) match(sc *ShadowCopy, now time.Time) bool {
+	switch {
+	case !f.SetID.IsZero() && f.SetID != sc.SetID:
+		return false
+	case f.ProviderID != "" && !guidEqual(f.ProviderID, sc.ProviderID):
+		return false
+	case f.OlderThan > 0 && now.Sub(sc.InstallDate) <= f.OlderThan:
+		return false
+	}
+	return f.Func == nil || f.Func(sc)
+}
+
+// RemoveResult is the outcome of removing one shadow copy.
+type RemoveResult struct {
+	ShadowCopy *ShadowCopy
+	Err        error
+}
+
+// RemoveMatching removes all shadow copies selected by f. The shadow copies are
+// listed using one connection and removed by up to 4 concurrent connections,
+// because a connection cannot be shared. Removal continues past individual
+// failures. It returns the result for each selected shadow copy and an error
+// joining all individual failures, or just an error if the shadow copies could
+// not be listed.
+func RemoveMatching(ctx context.Context, f Filter) ([]RemoveResult, error) {
+	return removeMatching(ctx, sys, f, time.Now())
+}
+
+// removeMatching implements RemoveMatching using the specified backend and the
+// current time.
+func removeMatching(ctx context.Context, b backend, f Filter, now time.Time) ([]RemoveResult, error) {
+	var all []*ShadowCopy
+	err := b.exec(ctx, func(c conn) (err error) {
+		all, err = c.list(f.Volume)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rs []RemoveResult
+	for _, sc := range all {
+		if f.match(sc, now) {
+			rs = append(rs, RemoveResult{ShadowCopy: sc})
+		}
+	}
+	return rs, removeAll(ctx, b, rs)
+}
+
+// removeAll removes the shadow copies in rs, setting the Err field of each
+// result, and returns an error joining all failures. Each worker removes shadow
+// copies using its own connection. If a worker cannot connect, the others
+// continue without it, and the remaining shadow copies fail with its error
+// only if no worker could connect.
+func removeAll(ctx context.Context, b backend, rs []RemoveResult) error {
+	next := make(chan *RemoveResult)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var connErr error
+	var wg sync.WaitGroup
+	for n := min(removeWorkers, len(rs)); n > 0; n-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.exec(ctx, func(c conn) error {
+				for r := range next {
+					if r.Err = ctx.Err(); r.Err == nil {
+						r.Err = c.remove(r.ShadowCopy.ID)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				mu.Lock()
+				connErr = err
+				mu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	i := 0
+send:
+	for ; i < len(rs); i++ {
+		select {
+		case next <- &rs[i]:
+		case <-done: // All workers failed to connect
+			break send
+		}
+	}
+	close(next)
+	<-done
+	for ; i < len(rs); i++ {
+		rs[i].Err = connErr
+	}
+	errs := make([]error, 0, len(rs))
+	for i := range rs {
+		errs = append(errs, rs[i].Err)
+	}
+	return errors.Join(errs...)
+}
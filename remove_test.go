@@ -0,0 +1,133 @@
+package vss
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveMatching(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	newBackend := func() *fakeBackend {
+		b := new(fakeBackend)
+		for i := 0; i < 10; i++ {
+			b.all = append(b.all, &ShadowCopy{
+				ID:          testShadowID(i),
+				SetID:       testSetID(i / 2),
+				ProviderID:  "{B5946137-7B9F-4925-AF80-51ABD60B20D5}",
+				InstallDate: now.Add(-time.Duration(i) * time.Hour),
+				VolumeName:  testVolume(i % 2),
+			})
+		}
+		return b
+	}
+	ids := func(rs []RemoveResult) []ShadowID {
+		var ids []ShadowID
+		for _, r := range rs {
+			ids = append(ids, r.ShadowCopy.ID)
+		}
+		return ids
+	}
+
+	b := newBackend()
+	rs, err := removeMatching(context.Background(), b, Filter{}, now)
+	require.NoError(t, err)
+	var all []ShadowID
+	for i := 0; i < 10; i++ {
+		all = append(all, testShadowID(i))
+	}
+	assert.Equal(t, all, ids(rs))
+	for _, r := range rs {
+		assert.NoError(t, r.Err)
+	}
+	assert.Empty(t, b.ids())
+	assert.LessOrEqual(t, b.peak.Load(), int32(removeWorkers))
+	assert.Equal(t, int32(1+removeWorkers), b.execs.Load())
+
+	b = newBackend()
+	rs, err = removeMatching(context.Background(), b, Filter{
+		Volume:     testVolume(1).String(),
+		ProviderID: "b5946137-7b9f-4925-af80-51abd60b20d5",
+		OlderThan:  4 * time.Hour,
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{testShadowID(5), testShadowID(7), testShadowID(9)}, ids(rs))
+	assert.Len(t, b.ids(), 7)
+
+	b = newBackend()
+	rs, err = removeMatching(context.Background(), b, Filter{
+		SetID: testSetID(1),
+		Func:  func(sc *ShadowCopy) bool { return sc.VolumeName == testVolume(0) },
+	}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{testShadowID(2)}, ids(rs))
+
+	b = newBackend()
+	rs, err = removeMatching(context.Background(), b, Filter{ProviderID: "{other}"}, now)
+	require.NoError(t, err)
+	assert.Empty(t, rs)
+	assert.Len(t, b.ids(), 10)
+}
+
+func TestRemoveMatchingErrors(t *testing.T) {
+	b := new(fakeBackend)
+	for i := 0; i < 5; i++ {
+		b.all = append(b.all, &ShadowCopy{ID: testShadowID(i)})
+	}
+	b.fail = map[string]error{
+		testShadowID(1).String(): os.ErrPermission,
+		testShadowID(3).String(): os.ErrInvalid,
+	}
+	rs, err := removeMatching(context.Background(), b, Filter{}, time.Now())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.ErrorIs(t, err, os.ErrInvalid)
+	assert.Len(t, rs, 5)
+	for _, r := range rs {
+		if err := b.fail[r.ShadowCopy.ID.String()]; err != nil {
+			assert.ErrorIs(t, r.Err, err)
+		} else {
+			assert.NoError(t, r.Err)
+		}
+	}
+	assert.Equal(t, []ShadowID{testShadowID(1), testShadowID(3)}, b.ids())
+
+	// Workers that cannot connect leave the removals to the others
+	b = new(fakeBackend)
+	for i := 0; i < 10; i++ {
+		b.all = append(b.all, &ShadowCopy{ID: testShadowID(i)})
+	}
+	b.err, b.errAt = os.ErrPermission, func(n int32) bool { return n == 2 || n == 3 }
+	rs, err = removeMatching(context.Background(), b, Filter{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, rs, 10)
+	assert.Empty(t, b.ids())
+
+	// All removals fail if no worker can connect
+	for i := 0; i < 10; i++ {
+		b.all = append(b.all, &ShadowCopy{ID: testShadowID(i)})
+	}
+	b.execs.Store(0)
+	b.errAt = func(n int32) bool { return n > 1 }
+	rs, err = removeMatching(context.Background(), b, Filter{}, time.Now())
+	require.ErrorIs(t, err, os.ErrPermission)
+	require.Len(t, rs, 10)
+	for _, r := range rs {
+		assert.ErrorIs(t, r.Err, os.ErrPermission)
+	}
+	assert.Len(t, b.ids(), 10)
+
+	b.err, b.errAt = os.ErrPermission, nil
+	rs, err = removeMatching(context.Background(), b, Filter{}, time.Now())
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.Nil(t, rs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = removeMatching(ctx, new(fakeBackend), Filter{}, time.Now())
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,225 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxShadowCopies is the maximum number of shadow copies that Windows keeps
+// for each volume. Creating another one removes the oldest.
+const MaxShadowCopies = 64
+
+// Policy is a retention policy that decides which shadow copies to keep. It is
+// evaluated independently for each volume. A shadow copy is kept if any rule
+// selects it, subject to MaxCount. The periodic rules keep the newest shadow
+// copy in each of the most recent N calendar periods that contain at least one
+// shadow copy.
+type Policy struct {
+	Last    int // Keep the N newest shadow copies
+	Hourly  int // Keep the newest shadow copy of the N most recent hours
+	Daily   int // Keep the newest shadow copy of the N most recent days
+	Weekly  int // Keep the newest shadow copy of the N most recent ISO weeks
+	Monthly int // Keep the newest shadow copy of the N most recent months
+	Yearly  int // Keep the newest shadow copy of the N most recent years
+
+	// Within keeps all shadow copies created within the specified duration
+	// before the evaluation time.
+	Within time.Duration
+
+	// MaxCount limits the number of shadow copies kept per volume. The oldest
+	// ones selected by other rules are removed to stay within the limit. Zero
+	// means MaxShadowCopies, which is also the largest allowed value. Use a
+	// smaller value to leave room for new shadow copies, since Windows
+	// removes the oldest one when the limit is reached.
+	MaxCount int
+
+	// Location is the time zone that defines period boundaries for the
+	// periodic rules. Nil means time.Local.
+	Location *time.Location
+
+	// Volumes overrides the policy for specific volumes. The Volumes field
+	// of an override is ignored. An override with a nil Location inherits
+	// the Location of this policy.
+	Volumes map[VolumeGUIDName]*Policy
+}
+
+// Decision is the result of evaluating a retention policy for one shadow copy.
+type Decision struct {
+	ShadowCopy *ShadowCopy
+	Keep       bool
+	Reasons    []string // Rules that selected the shadow copy or the reason for removal
+	Err        error    // Removal error set by Apply
+}
+
+// Removal reasons.
+const (
+	reasonUnselected = "not selected by any rule"
+	reasonMaxCount   = "exceeds max count of %d"
+)
+
+// Validate returns an error if the policy or any of its overrides are invalid.
+// A policy that keeps nothing is invalid.
+func (p *Policy) Validate() error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	for vol, o := range p.Volumes {
+		if o == nil {
+			return fmt.Errorf("vss: nil retention policy for volume %s", vol)
+		}
+		if err := o.validate(); err != nil {
+			return fmt.Errorf("vss: invalid retention policy for volume %s (%w)", vol, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the decision for each shadow copy in the same order as all,
+// using now as the current time. It does not modify any shadow copies.
+func (p *Policy) Evaluate(all []*ShadowCopy, now time.Time) ([]Decision, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	ds := make([]Decision, len(all))
+	byVol := make(map[VolumeGUIDName][]*Decision)
+	var vols []VolumeGUIDName
+	for i, sc := range all {
+		ds[i].ShadowCopy = sc
+		if _, ok := byVol[sc.VolumeName]; !ok {
+			vols = append(vols, sc.VolumeName)
+		}
+		byVol[sc.VolumeName] = append(byVol[sc.VolumeName], &ds[i])
+	}
+	for _, vol := range vols {
+		vp := p
+		if o := p.Volumes[vol]; o != nil {
+			if vp = o; o.Location == nil {
+				c := *o
+				c.Location, vp = p.Location, &c
+			}
+		}
+		vp.evaluate(byVol[vol], now)
+	}
+	return ds, nil
+}
+
+// Apply evaluates the policy for the shadow copies of the specified volume, or
+// all volumes if vol is empty, and removes the ones that are not kept. It
+// returns all decisions and an error joining all removal failures, or just an
+// error if the shadow copies could not be listed.
+func (p *Policy) Apply(ctx context.Context, vol string) ([]Decision, error) {
+	return p.apply(ctx, sys, vol, time.Now())
+}
+
+// apply implements Apply using the specified backend and current time.
+func (p *Policy) apply(ctx context.Context, b backend, vol string, now time.Time) ([]Decision, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	var all []*ShadowCopy
+	err := b.exec(ctx, func(c conn) (err error) {
+		all, err = c.list(vol)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	ds, err := p.Evaluate(all, now)
+	if err != nil {
+		return nil, err
+	}
+	var rs []RemoveResult
+	var idx []int
+	for i := range ds {
+		if !ds[i].Keep {
+			rs = append(rs, RemoveResult{ShadowCopy: ds[i].ShadowCopy})
+			idx = append(idx, i)
+		}
+	}
+	err = removeAll(ctx, b, rs)
+	for i, r := range rs {
+		ds[idx[i]].Err = r.Err
+	}
+	return ds, err
+}
+
+// validate validates p without its overrides.
+func (p *Policy) validate() error {
+	switch {
+	case p.Last < 0 || p.Hourly < 0 || p.Daily < 0 || p.Weekly < 0 || p.Monthly < 0 || p.Yearly < 0:
+		return errors.New("vss: retention policy counts must not be negative")
+	case p.Within < 0:
+		return errors.New("vss: retention policy duration must not be negative")
+	case p.MaxCount < 0 || p.MaxCount > MaxShadowCopies:
+		return fmt.Errorf("vss: retention policy max count must be between 0 and %d", MaxShadowCopies)
+	case p.Last == 0 && p.Hourly == 0 && p.Daily == 0 && p.Weekly == 0 && p.Monthly == 0 &&
+		p.Yearly == 0 && p.Within == 0:
+		return errors.New("vss: retention policy does not keep any shadow copies")
+	}
+	return nil
+}
+
+// evaluate sets the decisions for the shadow copies of one volume.
+func (p *Policy) evaluate(ds []*Decision, now time.Time) {
+	sort.SliceStable(ds, func(i, j int) bool {
+		return ds[i].ShadowCopy.InstallDate.After(ds[j].ShadowCopy.InstallDate)
+	})
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	keep := func(d *Decision, reason string) {
+		d.Keep = true
+		d.Reasons = append(d.Reasons, reason)
+	}
+	for i, d := range ds {
+		if i < p.Last {
+			keep(d, fmt.Sprintf("last %d", i+1))
+		}
+		if p.Within > 0 && now.Sub(d.ShadowCopy.InstallDate) <= p.Within {
+			keep(d, fmt.Sprintf("within %v", p.Within))
+		}
+	}
+	for _, r := range []struct {
+		n      int
+		name   string
+		period func(t time.Time) string
+	}{
+		{p.Hourly, "hourly", func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{p.Daily, "daily", func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, "weekly", func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", y, w)
+		}},
+		{p.Monthly, "monthly", func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, "yearly", func(t time.Time) string { return t.Format("2006") }},
+	} {
+		last, n := "", 0
+		for _, d := range ds {
+			if n == r.n {
+				break
+			}
+			if k := r.period(d.ShadowCopy.InstallDate.In(loc)); k != last {
+				keep(d, r.name+" "+k)
+				last, n = k, n+1
+			}
+		}
+	}
+	limit, n := p.MaxCount, 0
+	if limit == 0 {
+		limit = MaxShadowCopies
+	}
+	for _, d := range ds {
+		switch {
+		case !d.Keep:
+			d.Reasons = []string{reasonUnselected}
+		case n == limit:
+			d.Keep, d.Reasons = false, []string{fmt.Sprintf(reasonMaxCount, limit)}
+		default:
+			n++
+		}
+	}
+}
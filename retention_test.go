@@ -0,0 +1,189 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retentionShadowCopies() []*ShadowCopy {
+	dates := []time.Time{
+		time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 15, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 15, 6, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 14, 23, 30, 0, 0, time.UTC),
+		time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 20, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC),
+	}
+	all := make([]*ShadowCopy, len(dates))
+	for i, t := range dates {
+		all[i] = &ShadowCopy{ID: testShadowID(i), InstallDate: t, VolumeName: volC}
+	}
+	return all
+}
+
+// kept returns the IDs of the shadow copies that are kept.
+func kept(ds []Decision) []ShadowID {
+	var ids []ShadowID
+	for _, d := range ds {
+		if d.Keep {
+			ids = append(ids, d.ShadowCopy.ID)
+		}
+	}
+	return ids
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	all := retentionShadowCopies()
+	now := time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)
+	p := Policy{Last: 1, Daily: 2, Weekly: 2, Monthly: 3, Yearly: 2, Location: time.UTC}
+	ds, err := p.Evaluate(all, now)
+	require.NoError(t, err)
+	require.Len(t, ds, len(all))
+	for i, d := range ds {
+		assert.Same(t, all[i], d.ShadowCopy)
+	}
+	assert.Equal(t, []ShadowID{
+		testShadowID(0), testShadowID(1), testShadowID(3), testShadowID(5),
+		testShadowID(6), testShadowID(7),
+	}, kept(ds))
+	assert.Equal(t, []string{
+		"last 1", "daily 2024-03-15", "weekly 2024-W11", "monthly 2024-03", "yearly 2024",
+	}, ds[1].Reasons)
+	assert.Equal(t, []string{"daily 2024-03-14"}, ds[3].Reasons)
+	assert.Equal(t, []string{"weekly 2024-W10"}, ds[5].Reasons)
+	assert.Equal(t, []string{"yearly 2023"}, ds[7].Reasons)
+	assert.Equal(t, []string{reasonUnselected}, ds[2].Reasons)
+
+	// Period boundaries depend on the time zone
+	p.Location = time.FixedZone("AEST", 10*3600)
+	ds, err = p.Evaluate(all, now)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{
+		testShadowID(0), testShadowID(1), testShadowID(2), testShadowID(5),
+		testShadowID(6),
+	}, kept(ds))
+	assert.Equal(t, []string{"daily 2024-03-15"}, ds[2].Reasons)
+	assert.Equal(t, []string{"monthly 2024-01"}, ds[0].Reasons)
+}
+
+func TestPolicyLimits(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	var all []*ShadowCopy
+	for i := 0; i < 10; i++ {
+		all = append(all, &ShadowCopy{
+			ID:          testShadowID(i),
+			InstallDate: now.Add(-time.Duration(i/2) * time.Hour),
+			VolumeName:  []VolumeGUIDName{volC, volD}[i%2],
+		})
+	}
+	p := Policy{
+		Within:   3 * time.Hour,
+		MaxCount: 3,
+		Volumes:  map[VolumeGUIDName]*Policy{volD: {Last: 1}},
+	}
+	ds, err := p.Evaluate(all, now)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{
+		testShadowID(0), testShadowID(1), testShadowID(2), testShadowID(4),
+	}, kept(ds))
+	assert.Equal(t, []string{"within 3h0m0s"}, ds[4].Reasons)
+	assert.Equal(t, []string{"exceeds max count of 3"}, ds[6].Reasons)
+	assert.Equal(t, []string{reasonUnselected}, ds[8].Reasons)
+	assert.Equal(t, []string{reasonUnselected}, ds[3].Reasons)
+
+	// Max count applies even when all shadow copies are selected
+	var many []*ShadowCopy
+	for i := 0; i < MaxShadowCopies+2; i++ {
+		many = append(many, &ShadowCopy{
+			ID:          testShadowID(i),
+			InstallDate: now.Add(-time.Duration(i) * time.Minute),
+			VolumeName:  volC,
+		})
+	}
+	ds, err = (&Policy{Last: 100}).Evaluate(many, now)
+	require.NoError(t, err)
+	assert.Len(t, kept(ds), MaxShadowCopies)
+	assert.False(t, ds[MaxShadowCopies].Keep)
+}
+
+func TestPolicyOverrideLocation(t *testing.T) {
+	// Both shadow copies of each volume were created on 2024-03-16 in AEST,
+	// but on different days in UTC.
+	now := time.Date(2024, 3, 16, 2, 0, 0, 0, time.UTC)
+	var all []*ShadowCopy
+	for i, vol := range []VolumeGUIDName{volC, volD, volE} {
+		all = append(all, &ShadowCopy{
+			ID:          testShadowID(2 * i),
+			InstallDate: time.Date(2024, 3, 16, 1, 0, 0, 0, time.UTC),
+			VolumeName:  vol,
+		}, &ShadowCopy{
+			ID:          testShadowID(2*i + 1),
+			InstallDate: time.Date(2024, 3, 15, 20, 0, 0, 0, time.UTC),
+			VolumeName:  vol,
+		})
+	}
+	p := Policy{
+		Daily:    2,
+		Location: time.FixedZone("AEST", 10*3600),
+		Volumes: map[VolumeGUIDName]*Policy{
+			volD: {Daily: 2},
+			volE: {Daily: 2, Location: time.UTC},
+		},
+	}
+	ds, err := p.Evaluate(all, now)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{
+		testShadowID(0), testShadowID(2), testShadowID(4), testShadowID(5),
+	}, kept(ds))
+	assert.Equal(t, []string{"daily 2024-03-16"}, ds[2].Reasons)
+	assert.Equal(t, []string{"daily 2024-03-15"}, ds[5].Reasons)
+	assert.Nil(t, p.Volumes[volD].Location)
+}
+
+func TestPolicyValidate(t *testing.T) {
+	assert.NoError(t, (&Policy{Daily: 7}).Validate())
+	for _, p := range []Policy{
+		{},
+		{MaxCount: 10},
+		{Last: -1, Daily: 1},
+		{Within: -time.Hour},
+		{Last: 1, MaxCount: MaxShadowCopies + 1},
+		{Last: 1, Volumes: map[VolumeGUIDName]*Policy{volC: {}}},
+		{Last: 1, Volumes: map[VolumeGUIDName]*Policy{volC: nil}},
+	} {
+		assert.Error(t, p.Validate(), "%+v", p)
+		_, err := p.Evaluate(nil, time.Time{})
+		assert.Error(t, err)
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	now := time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)
+	b := &fakeBackend{all: retentionShadowCopies()}
+	b.fail = map[string]error{testShadowID(4).String(): errors.New("remove")}
+	p := Policy{Daily: 2, Location: time.UTC}
+	ds, err := p.apply(context.Background(), b, volC.String(), now)
+	require.Error(t, err)
+	require.Len(t, ds, 8)
+	assert.Equal(t, []ShadowID{testShadowID(1), testShadowID(3), testShadowID(4)}, b.ids())
+	for _, d := range ds {
+		if d.ShadowCopy.ID == testShadowID(4) {
+			assert.Error(t, d.Err)
+		} else {
+			assert.NoError(t, d.Err)
+		}
+	}
+
+	b = &fakeBackend{err: errors.New("exec")}
+	_, err = p.apply(context.Background(), b, "", now)
+	assert.ErrorIs(t, err, b.err)
+	_, err = (&Policy{}).apply(context.Background(), b, "", now)
+	assert.ErrorContains(t, err, "does not keep")
+}
@@ -0,0 +1,358 @@
+package vss
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Session creates shadow copies and symlinks that are removed when the session
+// is closed, even if the process does not get a chance to close it. Every
+// shadow copy and link is recorded in an on-disk journal before it is created,
+// and OpenSession removes any leftovers recorded by a previous process that
+// crashed or was killed. Shadow copies are created with the native VSS API,
+// which assigns their IDs before they are created, so replay only removes
+// shadow copies created by the session. A journal must only be used by one
+// process at a time. Session methods are safe for concurrent use.
+type Session struct {
+	journal string
+	ops     sessionOps
+
+	mu     sync.Mutex
+	f      *os.File
+	copies []*ShadowCopy
+	failed []ShadowID // Failed creation attempts, which may have left a shadow copy
+	links  []string
+	closed bool
+	err    error
+
+	sig  chan os.Signal
+	done chan struct{}
+}
+
+// sessionOps are the system operations used by a Session. They allow the
+// session to be tested without creating real shadow copies.
+type sessionOps struct {
+	b      backend
+	create func(ctx context.Context, vol string, start func(id ShadowID) error) (*ShadowCopy, error)
+	link   func(sc *ShadowCopy, name string) error // Creates a shadow copy symlink
+	unlink func(name string) error                 // Removes a shadow copy symlink
+	now    func() time.Time
+	exit   func(code int)
+}
+
+// sysSessionOps returns the operations used by OpenSession.
+func sysSessionOps() sessionOps {
+	return sessionOps{
+		b:      sys,
+		create: createJournaled,
+		link:   linkShadow,
+		unlink: unlinkShadow,
+		now:    time.Now,
+		exit:   os.Exit,
+	}
+}
+
+// journalEntry is one line of the session journal.
+type journalEntry struct {
+	Op   string    `json:"op"`             // opShadow, opAbort, or opLink
+	Vol  string    `json:"vol,omitempty"`  // Volume being copied
+	ID   ShadowID  `json:"id"`             // Created or linked shadow copy
+	Path string    `json:"path,omitempty"` // Link path
+	Time time.Time `json:"time"`           // Entry creation time
+}
+
+// Journal operations.
+const (
+	opShadow = "shadow" // Shadow copy is about to be created
+	opAbort  = "abort"  // Symlink creation failed
+	opLink   = "link"   // Symlink is about to be created
+)
+
+// OpenSession removes any shadow copies and links left over in the journal
+// file by a previous session and starts a new session using the same journal.
+// The journal is created if it does not exist and removed when the session is
+// closed successfully. Until then, an interrupt or termination signal closes
+// the session and exits the process with status 1.
+func OpenSession(ctx context.Context, journal string) (*Session, error) {
+	s, err := openSession(ctx, journal, sysSessionOps())
+	if err != nil {
+		return nil, err
+	}
+	s.handleSignals()
+	return s, nil
+}
+
+// ReplayJournal removes the shadow copies and links recorded in the journal of
+// a session that was not closed, and then removes the journal. It does nothing
+// if the journal does not exist. If any leftovers cannot be removed, the
+// journal is kept so that removal can be retried.
+func ReplayJournal(ctx context.Context, journal string) error {
+	return replayJournal(ctx, journal, sysSessionOps())
+}
+
+// openSession implements OpenSession without signal handling.
+func openSession(ctx context.Context, journal string, ops sessionOps) (*Session, error) {
+	if err := replayJournal(ctx, journal, ops); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(journal, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("vss: failed to create session journal (%w)", err)
+	}
+	return &Session{journal: journal, ops: ops, f: f}, nil
+}
+
+// Create creates a new shadow copy of the specified volume, which is removed
+// when the session is closed.
+func (s *Session) Create(ctx context.Context, vol string) (*ShadowCopy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(ctx, vol)
+}
+
+// CreateLink creates a new shadow copy of the specified volume and symlinks it
+// at the specified path. Both are removed when the session is closed. If
+// symlinking fails, the shadow copy remains part of the session.
+func (s *Session) CreateLink(ctx context.Context, link, vol string) (*ShadowCopy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, err := s.create(ctx, vol)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.record(journalEntry{Op: opLink, Path: link, ID: sc.ID}); err != nil {
+		return nil, err
+	}
+	if err = s.ops.link(sc, link); err != nil {
+		err = fmt.Errorf("vss: failed to link shadow copy %s at %#q (%w)", sc.ID, link, err)
+		return nil, errors.Join(err, s.record(journalEntry{Op: opAbort, Path: link, ID: sc.ID}))
+	}
+	s.links = append(s.links, link)
+	return sc, nil
+}
+
+// ShadowCopies returns the shadow copies created by the session.
+func (s *Session) ShadowCopies() []*ShadowCopy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.copies)
+}
+
+// Close removes all links and shadow copies created by the session, and then
+// removes the journal. If anything cannot be removed, the journal is kept and
+// the leftovers are removed by the next OpenSession or ReplayJournal call.
+// Calling Close more than once returns the result of the first call.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.done != nil {
+		signal.Stop(s.sig)
+		close(s.done)
+	}
+	var errs []error
+	for i := len(s.links) - 1; i >= 0; i-- {
+		errs = append(errs, ignoreUnlinked(s.ops.unlink(s.links[i])))
+	}
+	if len(s.copies) > 0 || len(s.failed) > 0 {
+		errs = append(errs, s.ops.b.exec(context.Background(), func(c conn) error {
+			var errs []error
+			for i := len(s.copies) - 1; i >= 0; i-- {
+				errs = append(errs, ignoreNotExist(c.remove(s.copies[i].ID)))
+			}
+			for _, id := range s.failed {
+				errs = append(errs, ignoreNotExist(c.remove(id)))
+			}
+			return errors.Join(errs...)
+		}))
+	}
+	errs = append(errs, s.f.Close())
+	if s.err = errors.Join(errs...); s.err == nil {
+		if err := os.Remove(s.journal); err != nil {
+			s.err = fmt.Errorf("vss: failed to remove session journal (%w)", err)
+		}
+	}
+	return s.err
+}
+
+// handleSignals closes the session and exits the process when an interrupt or
+// termination signal is received.
+func (s *Session) handleSignals() {
+	s.sig, s.done = make(chan os.Signal, 1), make(chan struct{})
+	signal.Notify(s.sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-s.sig:
+			_ = s.Close()
+			s.ops.exit(1)
+		case <-s.done:
+		}
+	}()
+}
+
+// create implements Create. s.mu must be held.
+func (s *Session) create(ctx context.Context, vol string) (*ShadowCopy, error) {
+	if s.closed {
+		return nil, errors.New("vss: session is closed")
+	}
+	var id ShadowID
+	sc, err := s.ops.create(ctx, vol, func(sid ShadowID) error {
+		if err := s.record(journalEntry{Op: opShadow, Vol: vol, ID: sid}); err != nil {
+			return err
+		}
+		id = sid
+		return nil
+	})
+	if err != nil {
+		// The shadow copy may exist if it could not be deleted after a
+		// failure, so it remains journaled and is removed by Close.
+		if !id.IsZero() {
+			s.failed = append(s.failed, id)
+		}
+		return nil, err
+	}
+	s.copies = append(s.copies, sc)
+	return sc, nil
+}
+
+// createJournaled creates a new client-accessible shadow copy of the specified
+// volume using the native VSS API. It calls start with the ID of the shadow
+// copy before creating it and aborts the creation if start fails.
+func createJournaled(ctx context.Context, vol string, start func(id ShadowID) error) (*ShadowCopy, error) {
+	bc, err := newBackupComponents()
+	if err != nil {
+		return nil, err
+	}
+	defer bc.Release()
+	s := &snapshotSet{bc: bc, start: start}
+	all, err := s.create(ctx, []string{vol}, &SetOptions{Context: ContextClientAccessible})
+	if err != nil {
+		return nil, err
+	}
+	return all[0], nil
+}
+
+// record appends e to the journal and flushes it to disk.
+func (s *Session) record(e journalEntry) error {
+	e.Time = s.ops.now().UTC()
+	b, err := json.Marshal(&e)
+	if err == nil {
+		if _, err = s.f.Write(append(b, '\n')); err == nil {
+			err = s.f.Sync()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("vss: failed to write session journal (%w)", err)
+	}
+	return nil
+}
+
+// replayJournal implements ReplayJournal.
+func replayJournal(ctx context.Context, journal string, ops sessionOps) error {
+	b, err := os.ReadFile(journal)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("vss: failed to read session journal (%w)", err)
+	}
+	j, err := parseJournal(b)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := len(j.links) - 1; i >= 0; i-- {
+		errs = append(errs, ignoreUnlinked(ops.unlink(j.links[i])))
+	}
+	if len(j.ids) > 0 {
+		errs = append(errs, ops.b.exec(ctx, func(c conn) error {
+			var errs []error
+			for _, id := range j.ids {
+				errs = append(errs, ignoreNotExist(c.remove(id)))
+			}
+			return errors.Join(errs...)
+		}))
+	}
+	if err = errors.Join(errs...); err != nil {
+		return fmt.Errorf("vss: failed to remove leftovers of a previous session (%w)", err)
+	}
+	if err = os.Remove(journal); err != nil {
+		return fmt.Errorf("vss: failed to remove session journal (%w)", err)
+	}
+	return nil
+}
+
+// sessionJournal is a parsed session journal.
+type sessionJournal struct {
+	ids   []ShadowID // Shadow copies that may have been created
+	links []string   // Links that may have been created
+}
+
+// parseJournal parses the contents of a session journal. A truncated last line,
+// which is left by a crash during a write, is ignored.
+func parseJournal(b []byte) (*sessionJournal, error) {
+	var j sessionJournal
+	if i := bytes.LastIndexByte(b, '\n'); i < len(b)-1 {
+		b = b[:i+1]
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		var e journalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("vss: invalid session journal entry on line %d (%w)", n, err)
+		}
+		switch e.Op {
+		case opShadow:
+			if e.ID.IsZero() {
+				return nil, fmt.Errorf("vss: session journal line %d has no shadow copy ID", n)
+			}
+			j.ids = append(j.ids, e.ID)
+		case opAbort:
+			if i := slices.Index(j.links, e.Path); i >= 0 {
+				j.links = slices.Delete(j.links, i, i+1)
+			}
+		case opLink:
+			j.links = append(j.links, e.Path)
+		default:
+			return nil, fmt.Errorf("vss: invalid session journal operation on line %d: %q", n, e.Op)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("vss: failed to read session journal (%w)", err)
+	}
+	return &j, nil
+}
+
+// errNotShadowLink is returned by unlinkShadow when the path exists but is not a
+// shadow copy symlink.
+var errNotShadowLink = errors.New("not a shadow copy symlink")
+
+// ignoreUnlinked returns nil if err indicates that a link does not exist or
+// was never created because the path is not a shadow copy symlink.
+func ignoreUnlinked(err error) error {
+	if errors.Is(err, errNotShadowLink) {
+		return nil
+	}
+	return ignoreNotExist(err)
+}
+
+// ignoreNotExist returns nil if err indicates that the target does not exist.
+func ignoreNotExist(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,310 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLinks records symlinks created by a session.
+type fakeLinks struct {
+	mu    sync.Mutex
+	links map[string]ShadowID
+	fail  error // Error returned by link
+}
+
+func newFakeSessionOps(b *fakeBackend, l *fakeLinks, now time.Time) sessionOps {
+	l.links = make(map[string]ShadowID)
+	return sessionOps{
+		b:      b,
+		create: fakeCreate(b),
+		link: func(sc *ShadowCopy, name string) error {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.fail != nil {
+				return l.fail
+			}
+			l.links[name] = sc.ID
+			return nil
+		},
+		unlink: func(name string) error {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if _, ok := l.links[name]; !ok {
+				return &os.PathError{Op: "unlink", Path: name, Err: os.ErrNotExist}
+			}
+			delete(l.links, name)
+			return nil
+		},
+		now:  func() time.Time { return now },
+		exit: func(int) { panic("unexpected exit") },
+	}
+}
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	s, err := openSession(ctx, journal, newFakeSessionOps(b, l, time.Now()))
+	require.NoError(t, err)
+
+	c, err := s.Create(ctx, volC.String())
+	require.NoError(t, err)
+	d, err := s.CreateLink(ctx, `C:\snap\d`, volD.String())
+	require.NoError(t, err)
+	assert.Equal(t, []*ShadowCopy{c, d}, s.ShadowCopies())
+	assert.Equal(t, []ShadowID{c.ID, d.ID}, b.ids())
+	assert.Equal(t, map[string]ShadowID{`C:\snap\d`: d.ID}, l.links)
+
+	j := readJournal(t, journal)
+	assert.Equal(t, []ShadowID{c.ID, d.ID}, j.ids)
+	assert.Equal(t, []string{`C:\snap\d`}, j.links)
+
+	require.NoError(t, s.Close())
+	assert.Empty(t, b.ids())
+	assert.Empty(t, l.links)
+	assert.NoFileExists(t, journal)
+	require.NoError(t, s.Close())
+	_, err = s.Create(ctx, volC.String())
+	assert.ErrorContains(t, err, "closed")
+}
+
+func TestSessionErrors(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	ops := newFakeSessionOps(b, l, time.Now())
+	s, err := openSession(ctx, journal, ops)
+	require.NoError(t, err)
+
+	// Failed creation remains journaled
+	b.fail = map[string]error{volC.String(): errors.New("create")}
+	_, err = s.Create(ctx, volC.String())
+	require.Error(t, err)
+	assert.Len(t, readJournal(t, journal).ids, 1)
+	assert.Empty(t, s.ShadowCopies())
+
+	// Failed link leaves the shadow copy in the session
+	l.fail = errors.New("link")
+	_, err = s.CreateLink(ctx, `C:\snap\d`, volD.String())
+	require.ErrorIs(t, err, l.fail)
+	require.Len(t, s.ShadowCopies(), 1)
+	id := s.ShadowCopies()[0].ID
+
+	// Failed removal keeps the journal
+	b.fail = map[string]error{id.String(): errors.New("remove")}
+	err = s.Close()
+	require.Error(t, err)
+	assert.Equal(t, err, s.Close())
+	assert.FileExists(t, journal)
+	assert.Equal(t, []ShadowID{id}, b.ids())
+
+	// Removal is retried by the next session
+	b.fail = nil
+	s, err = openSession(ctx, journal, ops)
+	require.NoError(t, err)
+	assert.Empty(t, b.ids())
+	require.NoError(t, s.Close())
+	assert.NoFileExists(t, journal)
+}
+
+func TestSessionCrash(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	ops := newFakeSessionOps(b, l, time.Now())
+	s, err := openSession(ctx, journal, ops)
+	require.NoError(t, err)
+	_, err = s.Create(ctx, volC.String())
+	require.NoError(t, err)
+	_, err = s.CreateLink(ctx, `C:\snap\d`, volD.String())
+	require.NoError(t, err)
+	require.NoError(t, s.f.Close()) // Process killed
+
+	// Unrelated shadow copies must not be removed
+	other := &ShadowCopy{ID: testShadowID(1), VolumeName: volC}
+	b.all = append(b.all, other)
+
+	s, err = openSession(ctx, journal, ops)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{other.ID}, b.ids())
+	assert.Empty(t, l.links)
+	assert.Empty(t, readJournal(t, journal).ids)
+	require.NoError(t, s.Close())
+	assert.NoFileExists(t, journal)
+}
+
+func TestSessionSignal(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	ops := newFakeSessionOps(b, l, time.Now())
+	exit := make(chan int, 1)
+	ops.exit = func(code int) { exit <- code }
+	s, err := openSession(ctx, journal, ops)
+	require.NoError(t, err)
+	s.handleSignals()
+	_, err = s.Create(ctx, volC.String())
+	require.NoError(t, err)
+
+	s.sig <- syscall.SIGTERM
+	select {
+	case code := <-exit:
+		assert.Equal(t, 1, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not closed")
+	}
+	assert.Empty(t, b.ids())
+	assert.NoFileExists(t, journal)
+}
+
+func TestReplayJournal(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	ops := newFakeSessionOps(b, l, time.Now())
+	require.NoError(t, replayJournal(ctx, journal, ops))
+
+	b.all = []*ShadowCopy{
+		{ID: testShadowID(1), VolumeName: volC, InstallDate: time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{ID: testShadowID(2), VolumeName: volC, InstallDate: time.Date(2024, 1, 31, 12, 0, 1, 0, time.UTC)},
+		{ID: testShadowID(3), VolumeName: volC, InstallDate: time.Date(2024, 1, 31, 12, 20, 0, 0, time.UTC)},
+		{ID: testShadowID(4), VolumeName: volD, InstallDate: time.Date(2024, 1, 31, 12, 0, 1, 0, time.UTC)},
+		{ID: testShadowID(5), VolumeName: volD, InstallDate: time.Date(2024, 1, 31, 12, 0, 2, 0, time.UTC)},
+	}
+	l.links[`C:\snap\d`] = testShadowID(4)
+	b.fail = map[string]error{testShadowID(4).String(): errors.New("remove")}
+	writeJournal(t, journal, "session/journal.jsonl")
+	require.Error(t, replayJournal(ctx, journal, ops))
+	assert.FileExists(t, journal)
+
+	b.fail = nil
+	require.NoError(t, replayJournal(ctx, journal, ops))
+	assert.Equal(t, []ShadowID{testShadowID(1), testShadowID(3), testShadowID(5)}, b.ids())
+	assert.Empty(t, l.links)
+	assert.NoFileExists(t, journal)
+}
+
+func TestReplayJournalForeign(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	ops := newFakeSessionOps(b, l, time.Now())
+
+	// The process was killed after journaling the ID, but before the shadow
+	// copy was created. Another process then created a shadow copy of the
+	// same volume.
+	s, err := openSession(ctx, journal, ops)
+	require.NoError(t, err)
+	var id ShadowID
+	ops.create = func(_ context.Context, vol string, start func(id ShadowID) error) (*ShadowCopy, error) {
+		id = testShadowID(50)
+		require.NoError(t, start(id))
+		require.NoError(t, s.f.Close())
+		return nil, errors.New("killed")
+	}
+	s.ops = ops
+	_, err = s.Create(ctx, volC.String())
+	require.Error(t, err)
+	assert.Equal(t, []ShadowID{id}, readJournal(t, journal).ids)
+	other := &ShadowCopy{ID: testShadowID(1), VolumeName: volC, InstallDate: time.Now()}
+	b.all = append(b.all, other)
+
+	require.NoError(t, replayJournal(ctx, journal, ops))
+	assert.Equal(t, []ShadowID{other.ID}, b.ids())
+	assert.NoFileExists(t, journal)
+}
+
+func TestSessionLinkFailure(t *testing.T) {
+	ctx := context.Background()
+	journal := filepath.Join(t.TempDir(), "session.journal")
+	b, l := new(fakeBackend), new(fakeLinks)
+	ops := newFakeSessionOps(b, l, time.Now())
+	s, err := openSession(ctx, journal, ops)
+	require.NoError(t, err)
+
+	// Link fails because the path is a real directory
+	l.fail = errors.New("directory exists")
+	_, err = s.CreateLink(ctx, `C:\snap\d`, volD.String())
+	require.ErrorIs(t, err, l.fail)
+	assert.Empty(t, readJournal(t, journal).links)
+	require.NoError(t, s.f.Close()) // Process killed
+
+	require.NoError(t, replayJournal(ctx, journal, ops))
+	assert.Empty(t, b.ids())
+	assert.NoFileExists(t, journal)
+
+	// Replay ignores paths that are not shadow copy symlinks, such as links
+	// journaled by older versions without an abort entry.
+	ops.unlink = func(name string) error {
+		return fmt.Errorf("vss: %#q is %w", name, errNotShadowLink)
+	}
+	writeJournal(t, journal, "session/journal.jsonl")
+	require.NoError(t, replayJournal(ctx, journal, ops))
+	assert.NoFileExists(t, journal)
+}
+
+func TestParseJournal(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "session", "journal.jsonl"))
+	require.NoError(t, err)
+	j, err := parseJournal(b)
+	require.NoError(t, err)
+	assert.Equal(t, []ShadowID{testShadowID(4), testShadowID(6), testShadowID(2)}, j.ids)
+	assert.Equal(t, []string{`C:\snap\d`}, j.links)
+
+	for _, in := range []string{
+		"{\"op\":\"shadow\",\"vol\":\"C:\\\\\",\"id\":\"{00000000-0000-0000-0000-000000000001}\",\"time\":\"2024-01-31T12:00:00Z\"}\nx\n",
+		"{\"op\":\"shadow\",\"vol\":\"C:\\\\\",\"id\":\"\",\"time\":\"2024-01-31T12:00:00Z\"}\n",
+		"{\"op\":\"create\",\"vol\":\"C:\\\\\",\"id\":\"\",\"time\":\"2024-01-31T12:00:00Z\"}\n",
+		"{\"op\":\"delete\",\"time\":\"2024-01-31T12:00:00Z\"}\n",
+		"{\"op\":\"link\",\"id\":\"x\",\"time\":\"2024-01-31T12:00:00Z\"}\n",
+	} {
+		_, err = parseJournal([]byte(in))
+		assert.Error(t, err, in)
+	}
+}
+
+// fakeCreate returns a session create operation that creates shadow copies in
+// b, calling start with the ID of each one before it is created.
+func fakeCreate(b *fakeBackend) func(ctx context.Context, vol string, start func(id ShadowID) error) (*ShadowCopy, error) {
+	return func(ctx context.Context, vol string, start func(id ShadowID) error) (sc *ShadowCopy, err error) {
+		b.mu.Lock()
+		id := testShadowID(101 + b.seq)
+		b.mu.Unlock()
+		if err = start(id); err != nil {
+			return nil, err
+		}
+		err = b.exec(ctx, func(c conn) error {
+			sc, err = c.create(vol)
+			return err
+		})
+		return
+	}
+}
+
+// readJournal parses the session journal file.
+func readJournal(t *testing.T, name string) *sessionJournal {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	j, err := parseJournal(b)
+	require.NoError(t, err)
+	return j
+}
+
+// writeJournal copies a journal from testdata.
+func writeJournal(t *testing.T, name, src string) {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", src))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+}
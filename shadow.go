@@ -0,0 +1,302 @@
+package vss
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShadowCopy is an instance of Win32_ShadowCopy class. See:
+//
+// https://learn.microsoft.com/en-us/previous-versions/windows/desktop/legacy/aa394428(v=vs.85)
+type ShadowCopy struct {
+	ID           ShadowID
+	SetID        SetID
+	ProviderID   string
+	InstallDate  time.Time
+	DeviceObject string
+	VolumeName   VolumeGUIDName
+	ExposedName  string // Drive letter, mount point, or share name, if exposed
+	ExposedPath  string // Exposed directory of a shadow copy exposed as a share
+}
+
+// VolumePath returns the drive letter and/or folder where the shadow copy's
+// original volume is mounted. If the volume is mounted at multiple locations,
+// only the first one is returned.
+func (sc *ShadowCopy) VolumePath() (string, error) {
+	return sc.volumePath(sysTopology)
+}
+
+// Index returns the shadow copy device number, which is N in the
+// HarddiskVolumeShadowCopyN DeviceObject. It returns 0 if DeviceObject is not a
+// valid shadow copy device path.
+func (sc *ShadowCopy) Index() uint32 {
+	dev, err := sc.device()
+	if err != nil {
+		return 0
+	}
+	return dev.Index
+}
+
+// volumePath implements VolumePath using topology t.
+func (sc *ShadowCopy) volumePath(t topology) (string, error) {
+	m, err := t.paths(sc.VolumeName)
+	if err != nil || len(m) == 0 {
+		return "", err
+	}
+	return m[0], nil
+}
+
+// shadowJSON is the JSON encoding of ShadowCopy.
+type shadowJSON struct {
+	ID           ShadowID       `json:"id"`
+	SetID        SetID          `json:"setId"`
+	ProviderID   string         `json:"providerId"`
+	InstallDate  cimTime        `json:"installDate"`
+	DeviceObject string         `json:"deviceObject"`
+	VolumeName   VolumeGUIDName `json:"volumeName"`
+	ExposedName  string         `json:"exposedName"`
+	ExposedPath  string         `json:"exposedPath"`
+	Index        uint32         `json:"index,omitempty"`
+	VolumePath   string         `json:"volumePath,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Shadow copies are encoded as objects
+// with the following fields:
+//
+//	{
+//		"id":           "{XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}",
+//		"setId":        "{XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}",
+//		"providerId":   "{XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}",
+//		"installDate":  "2024-01-31T08:45:06.123456-05:00",
+//		"deviceObject": "\\\\?\\GLOBALROOT\\Device\\HarddiskVolumeShadowCopy1",
+//		"volumeName":   "\\\\?\\Volume{xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx}\\",
+//		"exposedName":  "",
+//		"exposedPath":  "",
+//		"index":        1
+//	}
+//
+// All fields except index are always present, using empty strings for
+// unset values. IDs and volume names use their String formats. installDate
+// keeps the microsecond precision and UTC offset of a CIM datetime. It is
+// empty for the zero time.
+//
+// index is computed by Index and omitted when unknown. It is ignored by
+// UnmarshalJSON. MarshalJSON does not query the system, so the volume path is
+// only encoded by ShadowCopyJSON.
+func (sc ShadowCopy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sc.toJSON(""))
+}
+
+// ShadowCopyJSON encodes a shadow copy with a "volumePath" field, which is
+// resolved by the caller, typically once per volume using VolumePath. The
+// field is omitted if VolumePath is empty. A nil ShadowCopy is encoded as
+// null.
+type ShadowCopyJSON struct {
+	ShadowCopy *ShadowCopy
+	VolumePath string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v ShadowCopyJSON) MarshalJSON() ([]byte, error) {
+	if v.ShadowCopy == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(v.ShadowCopy.toJSON(v.VolumePath))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It decodes the format produced by
+// MarshalJSON into a new ShadowCopy, like ShadowCopy.UnmarshalJSON, and sets
+// VolumePath. Null sets both fields to their zero values.
+func (v *ShadowCopyJSON) UnmarshalJSON(b []byte) error {
+	var j *shadowJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if j == nil {
+		*v = ShadowCopyJSON{}
+		return nil
+	}
+	*v = ShadowCopyJSON{ShadowCopy: j.shadowCopy(), VolumePath: j.VolumePath}
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It decodes the format produced by
+// MarshalJSON. InstallDate uses UTC for a zero offset and a fixed zone
+// otherwise, so it may not have the same Location as the encoded time.
+func (sc *ShadowCopy) UnmarshalJSON(b []byte) error {
+	var v shadowJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*sc = *v.shadowCopy()
+	return nil
+}
+
+// shadowCopy returns the decoded shadow copy without the computed fields.
+func (v *shadowJSON) shadowCopy() *ShadowCopy {
+	return &ShadowCopy{
+		ID:           v.ID,
+		SetID:        v.SetID,
+		ProviderID:   v.ProviderID,
+		InstallDate:  time.Time(v.InstallDate),
+		DeviceObject: v.DeviceObject,
+		VolumeName:   v.VolumeName,
+		ExposedName:  v.ExposedName,
+		ExposedPath:  v.ExposedPath,
+	}
+}
+
+// toJSON returns the JSON encoding of the shadow copy with the specified
+// volume path.
+func (sc *ShadowCopy) toJSON(volumePath string) *shadowJSON {
+	return &shadowJSON{
+		ID:           sc.ID,
+		SetID:        sc.SetID,
+		ProviderID:   sc.ProviderID,
+		InstallDate:  cimTime(sc.InstallDate),
+		DeviceObject: sc.DeviceObject,
+		VolumeName:   sc.VolumeName,
+		ExposedName:  sc.ExposedName,
+		ExposedPath:  sc.ExposedPath,
+		Index:        sc.Index(),
+		VolumePath:   volumePath,
+	}
+}
+
+// cimTimeFormat is the RFC 3339 format with the precision of a CIM datetime.
+const cimTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// cimTime is a time.Time that is encoded in cimTimeFormat.
+type cimTime time.Time
+
+// MarshalText implements encoding.TextMarshaler.
+func (t cimTime) MarshalText() ([]byte, error) {
+	if time.Time(t).IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(time.Time(t).Format(cimTimeFormat)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts any RFC 3339
+// time and, like parseDateTime, uses a fixed zone for non-zero offsets.
+func (t *cimTime) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*t = cimTime{}
+		return nil
+	}
+	v, err := time.Parse(time.RFC3339Nano, string(b))
+	if err != nil {
+		return fmt.Errorf("vss: invalid install date: %#q (%w)", b, os.ErrInvalid)
+	}
+	if _, off := v.Zone(); off == 0 {
+		v = v.UTC()
+	} else {
+		v = v.In(time.FixedZone("", off))
+	}
+	*t = cimTime(v)
+	return nil
+}
+
+// CreateError is an error code returned by Win32_ShadowCopy.Create. See:
+//
+// https://learn.microsoft.com/en-us/previous-versions/windows/desktop/vsswmi/create-method-in-class-win32-shadowcopy#return-value
+type CreateError uint32
+
+// createErrorNames are the symbolic names of CreateError codes used by
+// MarshalText.
+var createErrorNames = [...]string{
+	"Success",
+	"AccessDenied",
+	"InvalidArgument",
+	"VolumeNotFound",
+	"VolumeNotSupported",
+	"UnsupportedContext",
+	"InsufficientStorage",
+	"VolumeInUse",
+	"MaxShadowCopiesReached",
+	"OperationInProgress",
+	"ProviderVetoed",
+	"ProviderNotRegistered",
+	"ProviderFailure",
+	"UnknownError",
+}
+
+// Error implements the error interface.
+func (e CreateError) Error() string {
+	switch e {
+	case 0:
+		return "Success"
+	case 1:
+		return "Access denied"
+	case 2:
+		return "Invalid argument"
+	case 3:
+		return "Specified volume not found"
+	case 4:
+		return "Specified volume not supported"
+	case 5:
+		return "Unsupported shadow copy context"
+	case 6:
+		return "Insufficient storage"
+	case 7:
+		return "Volume is in use"
+	case 8:
+		return "Maximum number of shadow copies reached"
+	case 9:
+		return "Another shadow copy operation is already in progress"
+	case 10:
+		return "Shadow copy provider vetoed the operation"
+	case 11:
+		return "Shadow copy provider not registered"
+	case 12:
+		return "Shadow copy provider failure"
+	case 13:
+		return "Unknown error"
+	}
+	return ""
+}
+
+// Unwrap implements errors.Unwrap interface.
+func (e CreateError) Unwrap() error {
+	switch e {
+	case 1:
+		return os.ErrPermission
+	case 2:
+		return os.ErrInvalid
+	case 3:
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler. Known codes are encoded by
+// their symbolic names, such as "MaxShadowCopiesReached" for 8. Other codes are
+// encoded as decimal numbers.
+func (e CreateError) MarshalText() ([]byte, error) {
+	if int(e) < len(createErrorNames) {
+		return []byte(createErrorNames[e]), nil
+	}
+	return strconv.AppendUint(nil, uint64(e), 10), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts symbolic names,
+// ignoring case, and decimal numbers.
+func (e *CreateError) UnmarshalText(b []byte) error {
+	s := string(b)
+	for i, name := range createErrorNames {
+		if strings.EqualFold(s, name) {
+			*e = CreateError(i)
+			return nil
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("vss: invalid create error: %#q (%w)", s, os.ErrInvalid)
+	}
+	*e = CreateError(n)
+	return nil
+}
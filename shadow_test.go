@@ -0,0 +1,169 @@
+package vss
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadowCopyJSON(t *testing.T) {
+	sc := &ShadowCopy{
+		ID:           testShadowID(1),
+		SetID:        testSetID(2),
+		ProviderID:   "{B5946137-7B9F-4925-AF80-51ABD60B20D5}",
+		InstallDate:  time.Date(2024, 1, 31, 8, 45, 6, 123456789, time.FixedZone("", -5*3600)),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy7`,
+		VolumeName:   volC,
+	}
+	vp, err := sc.volumePath(testTopology)
+	require.NoError(t, err)
+	b, err := json.Marshal(ShadowCopyJSON{sc, vp})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id":           "{00000000-0000-0000-0000-000000000001}",
+		"setId":        "{10000000-0000-0000-0000-000000000002}",
+		"providerId":   "{B5946137-7B9F-4925-AF80-51ABD60B20D5}",
+		"installDate":  "2024-01-31T08:45:06.123456-05:00",
+		"deviceObject": "\\\\?\\GLOBALROOT\\Device\\HarddiskVolumeShadowCopy7",
+		"volumeName":   "\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\",
+		"exposedName":  "",
+		"exposedPath":  "",
+		"index":        7,
+		"volumePath":   "C:\\"
+	}`, string(b))
+
+	// Computed fields are ignored and InstallDate is truncated to microseconds
+	var got ShadowCopy
+	require.NoError(t, json.Unmarshal(b, &got))
+	want := *sc
+	want.InstallDate = sc.InstallDate.Truncate(time.Microsecond)
+	assert.Equal(t, want, got)
+
+	// ShadowCopyJSON keeps the volume path
+	var gotJSON ShadowCopyJSON
+	require.NoError(t, json.Unmarshal(b, &gotJSON))
+	assert.Equal(t, ShadowCopyJSON{&want, vp}, gotJSON)
+	b2, err := json.Marshal(gotJSON)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(b), string(b2))
+
+	// Nil shadow copies are encoded as null
+	b2, err = json.Marshal(ShadowCopyJSON{VolumePath: vp})
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(b2))
+	require.NoError(t, json.Unmarshal(b2, &gotJSON))
+	assert.Equal(t, ShadowCopyJSON{}, gotJSON)
+
+	// ShadowCopy does not resolve the volume path
+	b, err = json.Marshal(sc)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "volumePath")
+	assert.Contains(t, string(b), `"index":7`)
+
+	// Unset fields
+	b, err = json.Marshal(ShadowCopy{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id":           "",
+		"setId":        "",
+		"providerId":   "",
+		"installDate":  "",
+		"deviceObject": "",
+		"volumeName":   "",
+		"exposedName":  "",
+		"exposedPath":  ""
+	}`, string(b))
+	got = ShadowCopy{ProviderID: "x"}
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, ShadowCopy{}, got)
+}
+
+func TestShadowCopyJSONRoundTrip(t *testing.T) {
+	all := []*ShadowCopy{
+		{
+			ID:           testShadowID(1),
+			SetID:        testSetID(1),
+			InstallDate:  time.Date(2024, 3, 15, 2, 30, 0, 0, time.UTC),
+			DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`,
+			VolumeName:   testVolume(1),
+			ExposedName:  `X:\`,
+		},
+		{
+			ID:           testShadowID(2),
+			SetID:        testSetID(1),
+			InstallDate:  time.Date(2024, 3, 15, 11, 30, 0, 999000, time.FixedZone("", 9*3600)),
+			DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy2`,
+			VolumeName:   testVolume(2),
+			ExposedName:  "share",
+			ExposedPath:  `C:\Shares\x`,
+		},
+	}
+	b, err := json.Marshal(all)
+	require.NoError(t, err)
+	var got []*ShadowCopy
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, all, got)
+
+	// Decoding is stable
+	b2, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.Equal(t, string(b), string(b2))
+}
+
+func TestShadowCopyJSONInvalid(t *testing.T) {
+	var sc ShadowCopy
+	for _, s := range []string{
+		`{"id": "x"}`,
+		`{"volumeName": "C:\\"}`,
+		`{"installDate": "2024-01-31 13:45:06"}`,
+		`[]`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(s), &sc), "%s", s)
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"installDate": "2024-01-31T13:45:06+00:00"}`), &sc))
+	assert.Equal(t, time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC), sc.InstallDate)
+}
+
+func TestShadowCopyIndex(t *testing.T) {
+	assert.Equal(t, uint32(12), (&ShadowCopy{DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy12`}).Index())
+	assert.Zero(t, (&ShadowCopy{DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolume1`}).Index())
+	assert.Zero(t, (&ShadowCopy{}).Index())
+}
+
+func TestShadowCopyVolumePath(t *testing.T) {
+	p, err := (&ShadowCopy{VolumeName: volE}).volumePath(mapTopology{`D:\data\logs\`: volE})
+	require.NoError(t, err)
+	assert.Equal(t, `D:\data\logs\`, p)
+	p, err = (&ShadowCopy{VolumeName: volF}).volumePath(testTopology)
+	require.NoError(t, err)
+	assert.Empty(t, p)
+}
+
+func TestCreateErrorText(t *testing.T) {
+	for i := range createErrorNames {
+		e := CreateError(i)
+		b, err := e.MarshalText()
+		require.NoError(t, err)
+		var got CreateError
+		require.NoError(t, got.UnmarshalText(b))
+		assert.Equal(t, e, got)
+	}
+	b, err := json.Marshal(map[string]CreateError{"a": 8, "b": 42})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":"MaxShadowCopiesReached","b":"42"}`, string(b))
+
+	var m map[string]CreateError
+	require.NoError(t, json.Unmarshal([]byte(`{"a":"accessdenied","b":"42","c":"3"}`), &m))
+	assert.Equal(t, map[string]CreateError{"a": 1, "b": 42, "c": 3}, m)
+
+	var e CreateError
+	for _, s := range []string{"", "Access denied", "-1", "4294967296"} {
+		err := e.UnmarshalText([]byte(s))
+		assert.True(t, errors.Is(err, os.ErrInvalid), "%q", s)
+	}
+}
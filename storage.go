@@ -0,0 +1,74 @@
+package vss
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UnboundedSpace is the Storage.MaxSpace value that indicates no limit.
+const UnboundedSpace = math.MaxUint64
+
+// Storage is an instance of Win32_ShadowStorage class, which associates a
+// volume with the volume that stores the differential data of its shadow
+// copies. See:
+//
+// https://learn.microsoft.com/en-us/previous-versions/windows/desktop/vsswmi/win32-shadowstorage
+type Storage struct {
+	Volume         VolumeGUIDName // Original volume
+	DiffVolume     VolumeGUIDName // Volume containing the differential data
+	AllocatedSpace uint64         // Bytes allocated for differential data
+	UsedSpace      uint64         // Bytes used by differential data
+	MaxSpace       uint64         // Maximum bytes or UnboundedSpace
+}
+
+// Provider is an instance of Win32_ShadowProvider class. See:
+//
+// https://learn.microsoft.com/en-us/previous-versions/windows/desktop/vsswmi/win32-shadowprovider
+type Provider struct {
+	ID        string
+	CLSID     string
+	Name      string
+	Type      ProviderType
+	Version   string
+	VersionID string
+}
+
+// ProviderType is the type of a shadow copy provider.
+type ProviderType uint32
+
+// Provider types.
+const (
+	ProviderUnknown ProviderType = iota
+	ProviderSystem
+	ProviderSoftware
+	ProviderHardware
+)
+
+// String returns the provider type name as displayed by vssadmin.
+func (t ProviderType) String() string {
+	switch t {
+	case ProviderUnknown:
+		return "Unknown"
+	case ProviderSystem:
+		return "System"
+	case ProviderSoftware:
+		return "Software"
+	case ProviderHardware:
+		return "Hardware"
+	}
+	return "ProviderType(" + strconv.FormatUint(uint64(t), 10) + ")"
+}
+
+// parseVolumeRef parses a WMI reference to a Win32_Volume instance, such as
+// `Win32_Volume.DeviceID="\\\\?\\Volume{GUID}\\"`, and returns the volume name.
+func parseVolumeRef(ref string) (VolumeGUIDName, error) {
+	_, key, ok := strings.Cut(ref, `DeviceID="`)
+	if !ok || !strings.HasSuffix(key, `"`) {
+		return VolumeGUIDName{}, fmt.Errorf("vss: invalid volume reference: %#q (%w)", ref, os.ErrInvalid)
+	}
+	name := strings.ReplaceAll(key[:len(key)-1], `\\`, `\`)
+	return ParseVolumeGUIDName(name)
+}
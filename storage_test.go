@@ -0,0 +1,32 @@
+package vss
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVolumeRef(t *testing.T) {
+	v, err := parseVolumeRef(`Win32_Volume.DeviceID="\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\"`)
+	require.NoError(t, err)
+	assert.Equal(t, volC, v)
+	v, err = parseVolumeRef(`\\HOST\root\cimv2:Win32_Volume.DeviceID="\\\\?\\Volume{22222222-2222-2222-2222-222222222222}\\"`)
+	require.NoError(t, err)
+	assert.Equal(t, volD, v)
+	for _, ref := range []string{
+		``,
+		`\\?\Volume{11111111-1111-1111-1111-111111111111}\`,
+		`Win32_Volume.DeviceID="C:\\"`,
+		`Win32_Volume.DeviceID="\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\`,
+	} {
+		_, err = parseVolumeRef(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestProviderType(t *testing.T) {
+	assert.Equal(t, "System", ProviderSystem.String())
+	assert.Equal(t, "Hardware", ProviderHardware.String())
+	assert.Equal(t, "ProviderType(7)", ProviderType(7).String())
+}
@@ -0,0 +1,265 @@
+package vss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mxk/go-vss/vsspath"
+)
+
+// toolAlias is the diskshadow alias of a new shadow copy. It is not translated,
+// so it identifies the shadow copy ID in localized diskshadow output.
+const toolAlias = "GoVssShadow"
+
+// ToolBackend manages shadow copies by running vssadmin.exe and diskshadow.exe
+// instead of using WMI. It is a fallback for systems where WMI is broken or
+// blocked. Its methods return the same types and errors as the corresponding
+// package functions, and it implements the vssd.Backend interface.
+//
+// Shadow copies are created by diskshadow and listed and removed by vssadmin,
+// so ProviderID is never set and InstallDate has second precision (see
+// ParseVssadminShadows).
+type ToolBackend struct {
+	// Vssadmin and Diskshadow are the paths of the tools. The defaults are
+	// vssadmin.exe and diskshadow.exe in %SystemRoot%\System32.
+	Vssadmin   string
+	Diskshadow string
+
+	// Location is the time zone of the creation times reported by vssadmin.
+	// The default is time.Local.
+	Location *time.Location
+
+	// command returns the command that runs the tool at path. It allows
+	// tests to use stand-in executables.
+	command func(ctx context.Context, path string, args ...string) *exec.Cmd
+
+	// decode converts tool output from the OEM code page. It allows tests to
+	// use output captured on systems with other code pages. The default is
+	// oemText.
+	decode func(b []byte) ([]byte, error)
+}
+
+// Create creates a new client-accessible shadow copy of volume vol, which can
+// be a drive letter, mount point, or volume GUID name.
+func (t *ToolBackend) Create(ctx context.Context, vol string) (*ShadowCopy, error) {
+	if !isAdmin() {
+		return nil, errNotAdmin
+	}
+	if vol == "" || strings.ContainsFunc(vol, func(c rune) bool {
+		return unicode.IsSpace(c) || unicode.IsControl(c) || c == '"'
+	}) {
+		return nil, fmt.Errorf("vss: invalid diskshadow volume: %#q (%w)", vol, os.ErrInvalid)
+	}
+	f, err := os.CreateTemp("", "go-vss.*.dsh")
+	if err != nil {
+		return nil, fmt.Errorf("vss: failed to create diskshadow script (%w)", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	script := strings.Join([]string{
+		"SET CONTEXT CLIENTACCESSIBLE",
+		"SET VERBOSE OFF",
+		"ADD VOLUME " + vol + " ALIAS " + toolAlias,
+		"CREATE",
+		"EXIT",
+		"",
+	}, "\r\n")
+	_, err = f.WriteString(script)
+	if err = errors.Join(err, f.Close()); err != nil {
+		return nil, fmt.Errorf("vss: failed to write diskshadow script (%w)", err)
+	}
+	out, err := t.run(ctx, t.tool(t.Diskshadow, "diskshadow.exe"), "/s", f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("vss: failed to create shadow copy of %#q (%w)", vol, err)
+	}
+	id, err := parseDiskshadowID(out)
+	if err != nil {
+		return nil, fmt.Errorf("vss: a shadow copy of %#q may have been created (%w)", vol, err)
+	}
+	return getNew(id,
+		func(id ShadowID) (*ShadowCopy, error) { return t.get(ctx, id) },
+		func(id ShadowID) error { return t.delete(ctx, id) })
+}
+
+// List returns existing shadow copies. If vol is non-empty, only shadow copies
+// for the specified volume are returned.
+func (t *ToolBackend) List(ctx context.Context, vol string) ([]*ShadowCopy, error) {
+	if !isAdmin() {
+		return nil, errNotAdmin
+	}
+	args := []string{"/for=" + vol}
+	if vol == "" {
+		args = nil
+	}
+	all, err := t.list(ctx, args...)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return all, err
+}
+
+// Get returns a shadow copy by ID or DeviceObject. The returned error contains
+// os.ErrNotExist if there is no such shadow copy.
+func (t *ToolBackend) Get(ctx context.Context, name string) (*ShadowCopy, error) {
+	if !isAdmin() {
+		return nil, errNotAdmin
+	}
+	if id, err := ParseShadowID(name); err == nil {
+		return t.get(ctx, id)
+	}
+	dev, err := vsspath.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("vss: not a shadow copy ID or DeviceObject: %s", name)
+	}
+	all, err := t.list(ctx)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, sc := range all {
+		if sc.Index() == dev.Index {
+			return sc, nil
+		}
+	}
+	return nil, fmt.Errorf("vss: shadow copy not found: %s (%w)", name, os.ErrNotExist)
+}
+
+// Remove removes a shadow copy by ID. The returned error contains
+// os.ErrNotExist if there is no such shadow copy.
+func (t *ToolBackend) Remove(ctx context.Context, id ShadowID) error {
+	if !isAdmin() {
+		return errNotAdmin
+	}
+	if _, err := t.get(ctx, id); err != nil {
+		return fmt.Errorf("vss: failed to remove shadow copy ID %s (%w)", id, err)
+	}
+	return t.delete(ctx, id)
+}
+
+// delete runs "vssadmin delete shadows" for the specified shadow copy ID.
+func (t *ToolBackend) delete(ctx context.Context, id ShadowID) error {
+	_, err := t.run(ctx, t.tool(t.Vssadmin, "vssadmin.exe"), "delete", "shadows", "/shadow="+id.String(), "/quiet")
+	if err != nil {
+		err = fmt.Errorf("vss: failed to remove shadow copy ID %s (%w)", id, err)
+	}
+	return err
+}
+
+// get returns a shadow copy by ID.
+func (t *ToolBackend) get(ctx context.Context, id ShadowID) (*ShadowCopy, error) {
+	all, err := t.list(ctx, "/shadow="+id.String())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, sc := range all {
+		if sc.ID == id {
+			return sc, nil
+		}
+	}
+	return nil, fmt.Errorf("vss: shadow copy not found: %s (%w)", id, os.ErrNotExist)
+}
+
+// list runs "vssadmin list shadows" with additional args. vssadmin exits with a
+// non-zero code when no shadow copies match, reporting it in a localized
+// message, so a failure whose output contains no shadow copies is returned as
+// an error that contains os.ErrNotExist.
+func (t *ToolBackend) list(ctx context.Context, args ...string) ([]*ShadowCopy, error) {
+	out, err := t.run(ctx, t.tool(t.Vssadmin, "vssadmin.exe"), append([]string{"list", "shadows"}, args...)...)
+	var ee *exec.ExitError
+	if err != nil && !errors.As(err, &ee) {
+		return nil, err
+	}
+	all, perr := ParseVssadminShadows(bytes.NewReader(out), t.Location)
+	if err == nil {
+		return all, perr
+	}
+	if perr == nil && len(all) == 0 {
+		return nil, fmt.Errorf("%w (%w)", err, os.ErrNotExist)
+	}
+	return nil, err
+}
+
+// run runs the tool at path and returns its standard output. If the tool
+// exits with a non-zero code, the output is returned along with an error that
+// contains the last line of the output, which is where both tools report
+// errors.
+func (t *ToolBackend) run(ctx context.Context, path string, args ...string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if t.command != nil {
+		cmd = t.command(ctx, path, args...)
+	} else {
+		cmd = exec.CommandContext(ctx, path, args...)
+	}
+	out, err := cmd.Output()
+	out = toolText(out, t.decode)
+	if err == nil {
+		return out, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	name := filepath.Base(path)
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return nil, fmt.Errorf("vss: failed to run %s (%w)", name, err)
+	}
+	if msg := lastLine(out); msg != "" {
+		return out, fmt.Errorf("vss: %s failed: %s (%w)", name, msg, err)
+	}
+	return out, fmt.Errorf("vss: %s failed (%w)", name, err)
+}
+
+// tool returns the path of a tool, which defaults to name in the system
+// directory.
+func (*ToolBackend) tool(path, name string) string {
+	if path != "" {
+		return path
+	}
+	return filepath.Join(os.Getenv("SystemRoot"), "System32", name)
+}
+
+// parseDiskshadowID returns the ID of the shadow copy created with toolAlias
+// from diskshadow output.
+func parseDiskshadowID(out []byte) (ShadowID, error) {
+	for _, ln := range strings.Split(string(out), "\n") {
+		if !strings.Contains(strings.ToLower(ln), strings.ToLower(toolAlias)) {
+			continue
+		}
+		if i := strings.IndexByte(ln, '{'); i >= 0 && len(ln)-i >= 38 {
+			if id, err := ParseShadowID(ln[i : i+38]); err == nil {
+				return id, nil
+			}
+		}
+	}
+	return ShadowID{}, errors.New("vss: diskshadow did not report the new shadow copy ID")
+}
+
+// toolText returns tool output as UTF-8. vssadmin and diskshadow write
+// redirected output in the OEM code page, such as 932 for Japanese, so output
+// that is not valid UTF-8 is converted using decode, or oemText if decode is
+// nil.
+func toolText(out []byte, decode func(b []byte) ([]byte, error)) []byte {
+	if utf8.Valid(out) {
+		return out
+	}
+	if decode == nil {
+		decode = oemText
+	}
+	if t, err := decode(out); err == nil {
+		return t
+	}
+	return out
+}
+
+// lastLine returns the last non-empty line of out.
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,272 @@
+package vss
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standInEnv is the environment variable that contains the stand-in config
+// path of a TestToolStandIn process.
+const standInEnv = "GO_VSS_STANDIN"
+
+// standInConfig configures the output of stand-in tools.
+type standInConfig struct {
+	Log  string                   `json:"log"`  // Command log path
+	Cmds map[string]standInResult `json:"cmds"` // Results by command line
+}
+
+// standInResult is the recorded result of a tool command. vssadmin exits with
+// code 1 when no items are found, as in shadows_empty.txt.
+type standInResult struct {
+	Out  string `json:"out"`  // testdata file containing standard output
+	Exit int    `json:"exit"` // Exit code
+}
+
+// TestToolStandIn is not a real test. It is run by tools started by
+// standInBackend to act as vssadmin.exe or diskshadow.exe. It appends the
+// command line, with the diskshadow script path replaced by the script
+// contents, to the log and writes the recorded output.
+func TestToolStandIn(t *testing.T) {
+	cfgPath := os.Getenv(standInEnv)
+	if cfgPath == "" {
+		t.Skip("not a stand-in tool")
+	}
+	args := os.Args[slices.Index(os.Args, "--")+1:]
+	b, err := os.ReadFile(cfgPath)
+	if err != nil {
+		panic(err)
+	}
+	var cfg standInConfig
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		panic(err)
+	}
+	ln := strings.Join(args, " ")
+	if i := slices.Index(args, "/s"); i >= 0 && i+1 < len(args) {
+		script, err := os.ReadFile(args[i+1])
+		if err != nil {
+			panic(err)
+		}
+		args[i+1] = "<script>"
+		ln = strings.Join(args, " ")
+		ln += "\n" + strings.TrimSpace(strings.ReplaceAll(string(script), "\r\n", "\n"))
+	}
+	log, err := os.OpenFile(cfg.Log, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		panic(err)
+	}
+	_, err = log.WriteString(ln + "\n")
+	if err = errors.Join(err, log.Close()); err != nil {
+		panic(err)
+	}
+	r, ok := cfg.Cmds[strings.SplitN(ln, "\n", 2)[0]]
+	if !ok {
+		_, _ = os.Stderr.WriteString("stand-in: unexpected command: " + ln + "\n")
+		os.Exit(99)
+	}
+	out, err := os.ReadFile(filepath.Join("testdata", r.Out))
+	if err != nil {
+		panic(err)
+	}
+	_, _ = os.Stdout.Write(out)
+	os.Exit(r.Exit)
+}
+
+// standInBackend returns a ToolBackend that runs this test binary as a stand-in
+// for each tool, with results recorded in cmds. The returned function returns
+// the logged commands.
+func standInBackend(t *testing.T, cmds map[string]standInResult) (*ToolBackend, func() []string) {
+	t.Helper()
+	if !isAdmin() {
+		t.Skip("not running as admin")
+	}
+	dir := t.TempDir()
+	cfg := standInConfig{Log: filepath.Join(dir, "log"), Cmds: cmds}
+	b, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	cfgPath := filepath.Join(dir, "cfg.json")
+	require.NoError(t, os.WriteFile(cfgPath, b, 0o600))
+	var decode func(b []byte) ([]byte, error)
+	for _, r := range cmds {
+		if !strings.Contains(r.Out, "_en-") {
+			decode = oemDecoder(r.Out)
+		}
+	}
+	tb := &ToolBackend{
+		Vssadmin:   "vssadmin.exe",
+		Diskshadow: "diskshadow.exe",
+		Location:   time.UTC,
+		command: func(ctx context.Context, path string, args ...string) *exec.Cmd {
+			args = append([]string{"-test.run=^TestToolStandIn$", "--", path}, args...)
+			cmd := exec.CommandContext(ctx, os.Args[0], args...)
+			cmd.Env = append(os.Environ(), standInEnv+"="+cfgPath)
+			return cmd
+		},
+		decode: decode,
+	}
+	return tb, func() []string {
+		b, err := os.ReadFile(cfg.Log)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+}
+
+const (
+	toolShadow1 = "{B1B2C3D4-0000-4000-8000-000000000001}"
+	toolShadow9 = "{B1B2C3D4-0000-4000-8000-000000000009}"
+)
+
+func TestToolBackendList(t *testing.T) {
+	tb, log := standInBackend(t, map[string]standInResult{
+		"vssadmin.exe list shadows":           {Out: "vssadmin/shadows_en-US.txt"},
+		"vssadmin.exe list shadows /for=D:\\": {Out: "vssadmin/shadows_empty.txt", Exit: 1},
+	})
+	all, err := tb.List(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC), all[0].InstallDate)
+	assert.Equal(t, volD, all[2].VolumeName)
+
+	all, err = tb.List(context.Background(), `D:\`)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+	assert.Equal(t, []string{"vssadmin.exe list shadows", `vssadmin.exe list shadows /for=D:\`}, log())
+}
+
+func TestToolBackendCreate(t *testing.T) {
+	for _, locale := range []string{"en-US", "de-DE"} {
+		t.Run(locale, func(t *testing.T) {
+			tb, log := standInBackend(t, map[string]standInResult{
+				"diskshadow.exe /s <script>":                       {Out: "diskshadow/create_" + locale + ".txt"},
+				"vssadmin.exe list shadows /shadow=" + toolShadow1: {Out: "vssadmin/shadows_" + locale + ".txt"},
+			})
+			sc, err := tb.Create(context.Background(), "C:")
+			require.NoError(t, err)
+			assert.Equal(t, toolShadow1, sc.ID.String())
+			assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`, sc.DeviceObject)
+			assert.Equal(t, []string{
+				"diskshadow.exe /s <script>",
+				"SET CONTEXT CLIENTACCESSIBLE",
+				"SET VERBOSE OFF",
+				"ADD VOLUME C: ALIAS GoVssShadow",
+				"CREATE",
+				"EXIT",
+				"vssadmin.exe list shadows /shadow=" + toolShadow1,
+			}, log())
+		})
+	}
+
+	// The new shadow copy is removed if it cannot be queried
+	tb, log := standInBackend(t, map[string]standInResult{
+		"diskshadow.exe /s <script>":                                     {Out: "diskshadow/create_en-US.txt"},
+		"vssadmin.exe list shadows /shadow=" + toolShadow1:               {Out: "vssadmin/error_en-US.txt", Exit: 2},
+		"vssadmin.exe delete shadows /shadow=" + toolShadow1 + " /quiet": {Out: "vssadmin/delete_en-US.txt"},
+	})
+	_, err := tb.Create(context.Background(), "C:")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, []string{
+		"vssadmin.exe list shadows /shadow=" + toolShadow1,
+		"vssadmin.exe delete shadows /shadow=" + toolShadow1 + " /quiet",
+	}, log()[6:])
+
+	tb, log = standInBackend(t, map[string]standInResult{
+		"diskshadow.exe /s <script>": {Out: "vssadmin/delete_en-US.txt"},
+	})
+	_, err = tb.Create(context.Background(), "C:")
+	assert.ErrorContains(t, err, "did not report")
+	assert.ErrorContains(t, err, "may have been created")
+	for _, vol := range []string{"", `C:\Mount Point\`, "C:\r\nDELETE SHADOWS ALL"} {
+		_, err = tb.Create(context.Background(), vol)
+		assert.ErrorIs(t, err, os.ErrInvalid)
+	}
+	assert.Len(t, log(), 6) // Only the first diskshadow script
+}
+
+func TestToolBackendGet(t *testing.T) {
+	tb, log := standInBackend(t, map[string]standInResult{
+		"vssadmin.exe list shadows":                        {Out: "vssadmin/shadows_fr-FR.txt"},
+		"vssadmin.exe list shadows /shadow=" + toolShadow9: {Out: "vssadmin/shadows_empty.txt", Exit: 1},
+	})
+	ctx := context.Background()
+	sc, err := tb.Get(ctx, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy3`)
+	require.NoError(t, err)
+	assert.Equal(t, "{B1B2C3D4-0000-4000-8000-000000000003}", sc.ID.String())
+
+	_, err = tb.Get(ctx, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy4`)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = tb.Get(ctx, toolShadow9)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = tb.Get(ctx, `C:\`)
+	assert.Error(t, err)
+	assert.Len(t, log(), 3)
+}
+
+func TestToolBackendRemove(t *testing.T) {
+	tb, log := standInBackend(t, map[string]standInResult{
+		"vssadmin.exe list shadows /shadow=" + toolShadow1:                         {Out: "vssadmin/shadows_en-US.txt"},
+		"vssadmin.exe delete shadows /shadow=" + toolShadow1 + " /quiet":           {Out: "vssadmin/delete_en-US.txt"},
+		"vssadmin.exe list shadows /shadow=" + toolShadow9:                         {Out: "vssadmin/shadows_empty.txt", Exit: 1},
+		"vssadmin.exe list shadows /shadow={B1B2C3D4-0000-4000-8000-000000000002}": {Out: "vssadmin/shadows_en-US.txt"},
+		"vssadmin.exe delete shadows /shadow={B1B2C3D4-0000-4000-8000-000000000002} /quiet": {
+			Out: "vssadmin/error_en-US.txt", Exit: 2,
+		},
+	})
+	ctx := context.Background()
+	require.NoError(t, tb.Remove(ctx, mustParse(ParseShadowID(toolShadow1))))
+	assert.Equal(t, []string{
+		"vssadmin.exe list shadows /shadow=" + toolShadow1,
+		"vssadmin.exe delete shadows /shadow=" + toolShadow1 + " /quiet",
+	}, log())
+
+	err := tb.Remove(ctx, mustParse(ParseShadowID(toolShadow9)))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Len(t, log(), 3)
+
+	err = tb.Remove(ctx, mustParse(ParseShadowID("{B1B2C3D4-0000-4000-8000-000000000002}")))
+	var ee *exec.ExitError
+	require.ErrorAs(t, err, &ee)
+	assert.Equal(t, 2, ee.ExitCode())
+	assert.ErrorContains(t, err, "vssadmin.exe failed: Error: Invalid option value.")
+}
+
+func TestToolBackendContext(t *testing.T) {
+	tb, _ := standInBackend(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := tb.List(ctx, "")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestParseDiskshadowID(t *testing.T) {
+	for _, locale := range []string{"en-US", "de-DE"} {
+		name := "create_" + locale + ".txt"
+		b, err := os.ReadFile(filepath.Join("testdata", "diskshadow", name))
+		require.NoError(t, err)
+		id, err := parseDiskshadowID(toolText(b, oemDecoder(name)))
+		require.NoError(t, err)
+		assert.Equal(t, toolShadow1, id.String())
+	}
+	_, err := parseDiskshadowID([]byte("-> ADD VOLUME C: ALIAS GoVssShadow\r\n"))
+	assert.Error(t, err)
+}
+
+func TestToolText(t *testing.T) {
+	for _, s := range []string{"", "No items found.\r\n", "2024/01/31 午後 1:45:06"} {
+		assert.Equal(t, s, string(toolText([]byte(s), nil)))
+	}
+	cp850 := []byte("Urspr\x81ngliches Volume")
+	assert.Equal(t, "Ursprüngliches Volume", string(toolText(cp850, oemDecoder("shadows_de-DE.txt"))))
+}
@@ -0,0 +1,229 @@
+package vss
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mxk/go-vss/vsspath"
+)
+
+// topology describes where volumes are mounted. It allows path translation to
+// be tested without access to real volumes.
+type topology interface {
+	// volumeOf returns the mount point and name of the volume containing
+	// the absolute path p. Mount points end with a separator. When mounted
+	// folders are nested, the innermost mount point is returned. If the mount
+	// point is not a volume, such as a SUBST or mapped network drive, it is
+	// returned along with an error.
+	volumeOf(p string) (mount string, vol VolumeGUIDName, err error)
+
+	// paths returns all mount points of volume vol, each ending with a
+	// separator.
+	paths(vol VolumeGUIDName) ([]string, error)
+
+	// volumes returns the names of all volumes.
+	volumes() ([]VolumeGUIDName, error)
+}
+
+// Translate converts the absolute path of a file on the shadow copy's original
+// volume into the path of the same file inside the shadow copy. For example,
+// `D:\data\x.db` becomes `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\data\x.db`.
+// The path may use any of the volume's mount points, including mounted folders,
+// a `\\?\` prefix, or its `\\?\Volume{GUID}\` name. An error is returned if the
+// path is on a different volume, such as one mounted in a folder of the
+// original volume.
+func (sc *ShadowCopy) Translate(livePath string) (string, error) {
+	return sc.translate(sysTopology, livePath)
+}
+
+// Original converts a path inside the shadow copy into the path of the same
+// file on the original volume, reversing Translate. The first mount point of
+// the volume that is not hidden by another volume mounted in one of its folders
+// is used. If the volume is not mounted, the path starts with VolumeName.
+func (sc *ShadowCopy) Original(snapshotPath string) (string, error) {
+	return sc.original(sysTopology, snapshotPath)
+}
+
+// translate implements Translate using topology t.
+func (sc *ShadowCopy) translate(t topology, livePath string) (string, error) {
+	dev, err := sc.device()
+	if err != nil {
+		return "", err
+	}
+	p, err := cleanLivePath(livePath)
+	if err != nil {
+		return "", err
+	}
+	mount, vol, err := mountOf(t, p)
+	if err != nil {
+		return "", err
+	}
+	if vol != sc.VolumeName {
+		return "", fmt.Errorf("vss: %#q is not on the volume of shadow copy %s", livePath, sc.ID)
+	}
+	rel, ok := cutMount(p, mount)
+	if !ok {
+		return "", fmt.Errorf("vss: %#q is not under mount point %#q", livePath, mount)
+	}
+	return dev.Root().Join(rel).String(), nil
+}
+
+// original implements Original using topology t.
+func (sc *ShadowCopy) original(t topology, snapshotPath string) (string, error) {
+	dev, err := sc.device()
+	if err != nil {
+		return "", err
+	}
+	p, err := vsspath.Parse(strings.ReplaceAll(snapshotPath, "/", `\`))
+	if err != nil || p.Index != dev.Index {
+		return "", fmt.Errorf("vss: %#q is not a path in shadow copy %s", snapshotPath, sc.ID)
+	}
+	rel := dev.Root().Join(p.Rest).Rest
+	mounts, err := t.paths(sc.VolumeName)
+	if err != nil {
+		return "", err
+	}
+	if len(mounts) == 0 {
+		return joinMount(sc.VolumeName.String(), rel), nil
+	}
+	for _, m := range mounts {
+		live := joinMount(m, rel)
+		if _, vol, err := t.volumeOf(live); err == nil && vol == sc.VolumeName {
+			return live, nil
+		}
+	}
+	return "", fmt.Errorf("vss: %#q is hidden by another volume mounted at its original location", snapshotPath)
+}
+
+// splitVolume implements SplitVolume using topology t. The volume is the mount
+// point containing name or the root of a network share, and rel is "." for the
+// volume itself. The mount point does not need to have a volume name.
+func splitVolume(t topology, name string) (vol, rel string, err error) {
+	if share, rest, ok := cutShare(name); ok {
+		if rest == "" {
+			rest = "."
+		}
+		return share, rest, nil
+	}
+	p, err := cleanLivePath(name)
+	if err != nil {
+		return "", "", err
+	}
+	mount, _, err := mountOf(t, p)
+	if mount == "" {
+		return "", "", err
+	}
+	rest, ok := cutMount(p, mount)
+	if !ok {
+		return "", "", fmt.Errorf("vss: %#q is not under mount point %#q", name, mount)
+	}
+	if rel = strings.TrimPrefix(rest, `\`); rel == "" {
+		rel = "."
+	}
+	return mount, rel, nil
+}
+
+// volumeName converts a drive letter, mounted folder, or volume GUID name to
+// the canonical `\\?\Volume{GUID}\` format using topology t. The trailing
+// separator of name is optional.
+func volumeName(t topology, name string) (string, error) {
+	p, err := cleanLivePath(strings.TrimSuffix(vsspath.ToSlash(name), "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	mount, vol, err := mountOf(t, p)
+	if err != nil {
+		return "", err
+	}
+	if rest, ok := cutMount(p, mount); !ok || rest != `\` && rest != "" {
+		return "", fmt.Errorf("vss: not a volume mount point: %#q", name)
+	}
+	return vol.String(), nil
+}
+
+// device returns the parsed DeviceObject of the shadow copy.
+func (sc *ShadowCopy) device() (vsspath.Path, error) {
+	dev, err := vsspath.Parse(sc.DeviceObject)
+	if err != nil {
+		return dev, fmt.Errorf("vss: invalid DeviceObject of shadow copy %s: %#q", sc.ID, sc.DeviceObject)
+	}
+	return dev, nil
+}
+
+// cleanLivePath converts an absolute path on a local volume into a clean path
+// starting with a drive letter or a volume GUID name. Both '\' and '/' are
+// accepted as separators and the `\\?\` prefix is removed from drive paths.
+func cleanLivePath(p string) (string, error) {
+	s := strings.ReplaceAll(p, "/", `\`)
+	if vsspath.HasPrefixFold(s, `\\?\`) || vsspath.HasPrefixFold(s, `\\.\`) {
+		if t := s[4:]; len(t) >= 2 && isDriveLetter(t[:2]) {
+			s = t
+		} else {
+			s = `\\?\` + t
+		}
+	}
+	vol := volumeGUIDPrefix(s)
+	if len(s) >= 3 && isDriveLetter(s[:2]) && s[2] == '\\' {
+		vol = strings.ToUpper(s[:1]) + `:\`
+	} else if vol == "" {
+		return "", fmt.Errorf("vss: not an absolute local path: %#q", p)
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+vsspath.ToSlash(s[len(vol):])), "/")
+	return vol + strings.ReplaceAll(rel, "/", `\`), nil
+}
+
+// cutShare splits a UNC path of the form `\\server\share\rest` or
+// `\\?\UNC\server\share\rest` into the share root, which ends with a
+// separator, and the clean rest of the path. Both '\' and '/' are accepted as
+// separators.
+func cutShare(p string) (share, rest string, ok bool) {
+	s := strings.ReplaceAll(p, "/", `\`)
+	var n int // Length of the prefix before the server name
+	switch {
+	case vsspath.HasPrefixFold(s, `\\?\UNC\`):
+		n = len(`\\?\UNC\`)
+	case strings.HasPrefix(s, `\\`) && !strings.HasPrefix(s, `\\?\`) && !strings.HasPrefix(s, `\\.\`):
+		n = len(`\\`)
+	default:
+		return "", "", false
+	}
+	server, t, _ := strings.Cut(s[n:], `\`)
+	name, t, _ := strings.Cut(t, `\`)
+	if server == "" || name == "" || name == "." || name == ".." {
+		return "", "", false
+	}
+	share = s[:n+len(server)+1+len(name)] + `\`
+	rest = strings.TrimPrefix(path.Clean("/"+vsspath.ToSlash(t)), "/")
+	return share, strings.ReplaceAll(rest, "/", `\`), true
+}
+
+// volumeGUIDPrefix returns the `\\?\Volume{GUID}\` prefix of p or an empty
+// string if p does not start with a volume GUID name.
+func volumeGUIDPrefix(p string) string {
+	const volLen = len(`\\?\Volume{xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx}\`)
+	if len(p) >= volLen && vsspath.HasPrefixFold(p, `\\?\Volume{`) &&
+		p[volLen-2] == '}' && p[volLen-1] == '\\' {
+		return p[:volLen]
+	}
+	return ""
+}
+
+// cutMount returns the part of p following mount, which must end with a
+// separator. Comparison is case-insensitive. The mount point itself may be
+// specified without the trailing separator.
+func cutMount(p, mount string) (string, bool) {
+	m := strings.TrimSuffix(mount, `\`)
+	if len(p) < len(m) || !strings.EqualFold(p[:len(m)], m) {
+		return "", false
+	}
+	if rest := p[len(m):]; rest == "" || rest[0] == '\\' {
+		return rest, true
+	}
+	return "", false
+}
+
+// joinMount appends rel, which starts with a separator, to mount.
+func joinMount(mount, rel string) string {
+	return strings.TrimSuffix(mount, `\`) + rel
+}
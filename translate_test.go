@@ -0,0 +1,222 @@
+package vss
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	volC = mustParse(ParseVolumeGUIDName(`\\?\Volume{11111111-1111-1111-1111-111111111111}\`))
+	volD = mustParse(ParseVolumeGUIDName(`\\?\Volume{22222222-2222-2222-2222-222222222222}\`))
+	volE = mustParse(ParseVolumeGUIDName(`\\?\Volume{33333333-3333-3333-3333-333333333333}\`))
+	volF = mustParse(ParseVolumeGUIDName(`\\?\Volume{44444444-4444-4444-4444-444444444444}\`))
+)
+
+// testTopology has D: also mounted at C:\Mnt\Data\, E: mounted inside D: at
+// D:\data\logs\ (and therefore also at C:\Mnt\Data\data\logs\), F: not
+// mounted at all, and S: as a SUBST drive without a volume.
+var testTopology = mapTopology{
+	`C:\`:                    volC,
+	`D:\`:                    volD,
+	`C:\Mnt\Data\`:           volD,
+	`D:\data\logs\`:          volE,
+	`C:\Mnt\Data\data\logs\`: volE,
+	`S:\`:                    {},
+}
+
+func TestTranslate(t *testing.T) {
+	sc := &ShadowCopy{
+		ID:           testShadowID(4),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy7`,
+		VolumeName:   volD,
+	}
+	const dev = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy7`
+	long := strings.Repeat(`very long directory name\`, 20) + "x.db"
+	tests := []struct{ live, snap string }{
+		{`D:\data\x.db`, dev + `\data\x.db`},
+		{`d:/DATA/x.db`, dev + `\DATA\x.db`},
+		{`D:\`, dev + `\`},
+		{`D:\.`, dev + `\`},
+		{`D:\data\.\a\..\x.db`, dev + `\data\x.db`},
+		{`D:\..\..\x.db`, dev + `\x.db`},
+		{`C:\Mnt\Data\data\x.db`, dev + `\data\x.db`},
+		{`c:\mnt\data`, dev + `\`},
+		{`\\?\D:\` + long, dev + `\` + long},
+		{`\\.\D:\data\x.db`, dev + `\data\x.db`},
+		{volD.String() + `data\x.db`, dev + `\data\x.db`},
+		{strings.ToUpper(volD.String()) + `data\x.db`, dev + `\data\x.db`},
+	}
+	for _, tc := range tests {
+		got, err := sc.translate(testTopology, tc.live)
+		require.NoError(t, err, tc.live)
+		assert.Equal(t, tc.snap, got, tc.live)
+	}
+	for _, live := range []string{
+		`data\x.db`,
+		`\data\x.db`,
+		`D:data\x.db`,
+		`\\server\share\x.db`,
+		`C:\Windows`,
+		`C:\Mnt\Database\x.db`,
+		`D:\data\logs`,
+		`D:\data\logs\1.log`,
+		`C:\Mnt\Data\data\logs\1.log`,
+		volC.String() + `x.db`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy7\x.db`,
+		`Z:\x.db`,
+	} {
+		_, err := sc.translate(testTopology, live)
+		assert.Error(t, err, live)
+	}
+	bad := *sc
+	bad.DeviceObject = `D:\`
+	_, err := bad.translate(testTopology, `D:\x.db`)
+	assert.Error(t, err)
+}
+
+func TestSplitVolume(t *testing.T) {
+	tests := []struct{ in, vol, rel string }{
+		{`C:\`, `C:\`, "."},
+		{`c:\Windows\System32`, `C:\`, `Windows\System32`},
+		{`C:/Mnt/Data/x.db`, `C:\Mnt\Data\`, "x.db"},
+		{`C:\Mnt\Data`, `C:\Mnt\Data\`, "."},
+		{`\\?\D:\data\logs\..\x.db`, `D:\`, `data\x.db`},
+		{volC.String() + `x`, volC.String(), "x"},
+		{`\\server\share\dir`, `\\server\share\`, "dir"},
+		{`//server/share`, `\\server\share\`, "."},
+		{`\\?\UNC\server\share\a\..\b\`, `\\?\UNC\server\share\`, "b"},
+		{`S:\dir`, `S:\`, "dir"},
+		{`s:\`, `S:\`, "."},
+	}
+	for _, tc := range tests {
+		vol, rel, err := splitVolume(testTopology, tc.in)
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.vol, vol, tc.in)
+		assert.Equal(t, tc.rel, rel, tc.in)
+	}
+	for _, in := range []string{``, `.`, `C:`, `Windows`, `\\server`, `\\server\\x`, `\\?\UNC\server`, `Z:\x`} {
+		_, _, err := splitVolume(testTopology, in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestVolumeName(t *testing.T) {
+	for in, want := range map[string]VolumeGUIDName{
+		`C:`:                           volC,
+		`c:\`:                          volC,
+		`C:\Mnt\Data`:                  volD,
+		`C:/Mnt/Data/data/logs/`:       volE,
+		strings.ToUpper(volD.String()): volD,
+	} {
+		name, err := volumeName(testTopology, in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want.String(), name, in)
+	}
+	for _, in := range []string{``, `C:\Mnt`, `C:\Mnt\Data\data`, `S:`, `Z:`, volC.String() + `x`} {
+		_, err := volumeName(testTopology, in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestOriginal(t *testing.T) {
+	sc := &ShadowCopy{
+		ID:           testShadowID(4),
+		DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy7`,
+		VolumeName:   volD,
+	}
+	const dev = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy7`
+	tests := []struct{ snap, live, canon string }{
+		{dev + `\data\x.db`, `C:\Mnt\Data\data\x.db`, dev + `\data\x.db`},
+		{dev + `\`, `C:\Mnt\Data\`, dev + `\`},
+		{dev, `C:\Mnt\Data\`, dev + `\`},
+		{`\\.\HarddiskVolumeShadowCopy7\data\..\..\x.db`, `C:\Mnt\Data\x.db`, dev + `\x.db`},
+		{`\\?\globalroot\device\harddiskvolumeshadowcopy7/data/x.db`, `C:\Mnt\Data\data\x.db`, dev + `\data\x.db`},
+	}
+	for _, tc := range tests {
+		got, err := sc.original(testTopology, tc.snap)
+		require.NoError(t, err, tc.snap)
+		assert.Equal(t, tc.live, got, tc.snap)
+
+		// Round trip
+		back, err := sc.translate(testTopology, got)
+		require.NoError(t, err, got)
+		assert.Equal(t, tc.canon, back, got)
+	}
+
+	// Files hidden by E: at C:\Mnt\Data\data\logs\ and D:\data\logs\
+	_, err := sc.original(testTopology, dev+`\data\logs\1.log`)
+	assert.ErrorContains(t, err, "hidden")
+
+	// When the first mount point is hidden, the next one is used
+	topo := mapTopology{`D:\`: volD, `C:\Mnt\Data\`: volD, `C:\Mnt\Data\data\logs\`: volE}
+	got, err := sc.original(topo, dev+`\data\logs\1.log`)
+	require.NoError(t, err)
+	assert.Equal(t, `D:\data\logs\1.log`, got)
+
+	// Unmounted volumes use the volume name
+	sf := &ShadowCopy{ID: testShadowID(6), DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy9`, VolumeName: volF}
+	got, err = sf.original(testTopology, sf.DeviceObject+`\x.db`)
+	require.NoError(t, err)
+	assert.Equal(t, volF.String()+`x.db`, got)
+	snap, err := sf.translate(testTopology, got)
+	require.NoError(t, err)
+	assert.Equal(t, sf.DeviceObject+`\x.db`, snap)
+
+	for _, snap := range []string{
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy8\x.db`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy70\x.db`,
+		`D:\x.db`,
+		``,
+	} {
+		_, err := sc.original(testTopology, snap)
+		assert.Error(t, err, snap)
+	}
+}
+
+// mapTopology is a static topology that maps mount points to volume names.
+type mapTopology map[string]VolumeGUIDName
+
+// volumeOf implements topology.
+func (m mapTopology) volumeOf(p string) (mount string, vol VolumeGUIDName, err error) {
+	for k, v := range m {
+		if _, ok := cutMount(p, k); ok && len(k) > len(mount) {
+			mount, vol = k, v
+		}
+	}
+	if mount == "" {
+		err = os.ErrNotExist
+	} else if vol.IsZero() {
+		err = fmt.Errorf("vss: %#q is not a volume", mount)
+	}
+	return
+}
+
+// paths implements topology.
+func (m mapTopology) paths(vol VolumeGUIDName) ([]string, error) {
+	var all []string
+	for k, v := range m {
+		if v == vol {
+			all = append(all, k)
+		}
+	}
+	slices.Sort(all)
+	return all, nil
+}
+
+// volumes implements topology.
+func (m mapTopology) volumes() ([]VolumeGUIDName, error) {
+	var all []VolumeGUIDName
+	for _, v := range m {
+		if !v.IsZero() && !slices.Contains(all, v) {
+			all = append(all, v)
+		}
+	}
+	slices.SortFunc(all, func(a, b VolumeGUIDName) int { return strings.Compare(a.String(), b.String()) })
+	return all, nil
+}
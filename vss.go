@@ -9,30 +9,29 @@
 package vss
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/go-ole/go-ole"
+	"github.com/mxk/go-vss/vsspath"
 	"golang.org/x/sys/windows"
 )
 
-// errNotAdmin is returned when the current user lacks admin privileges.
-var errNotAdmin = fmt.Errorf("vss: do not have Administrators group privileges (%w)",
-	os.ErrPermission)
-
 // Create creates a new shadow copy of the specified volume and returns its ID.
 // The volume can be specified by its drive letter (e.g. "C:"), mount point, or
 // globally unique identifier (GUID) name (`\\?\Volume{GUID}\`). The returned
 // error will contain os.ErrPermission if the current user does not have
 // Administrators group privileges.
-func Create(vol string) (string, error) {
+func Create(vol string) (ShadowID, error) {
 	if !isAdmin() {
-		return "", errNotAdmin
+		return ShadowID{}, errNotAdmin
 	}
 	var id *ole.GUID
 	err := wmiExec(func(s *sWbemServices) (err error) {
@@ -40,9 +39,9 @@ func Create(vol string) (string, error) {
 		return
 	})
 	if err != nil {
-		return "", err
+		return ShadowID{}, err
 	}
-	return id.String(), nil
+	return ShadowID{fromOLE(id)}, nil
 }
 
 // CreateLink creates a new shadow copy and symlinks it at the specified path.
@@ -54,10 +53,10 @@ func CreateLink(link, vol string) (err error) {
 	}
 	defer func() {
 		if err != nil {
-			_ = Remove(id)
+			_ = (&ShadowCopy{ID: id}).Remove()
 		}
 	}()
-	sc, _, err := get(id)
+	sc, _, err := get(id.String())
 	if err != nil {
 		return err
 	}
@@ -67,17 +66,7 @@ func CreateLink(link, vol string) (err error) {
 // IsShadowCopy returns whether name is a path referring to the contents of a
 // shadow copy.
 func IsShadowCopy(name string) (bool, error) {
-	// https://github.com/golang/go/issues/63703#issuecomment-1872960199
-	if isShadowPath(name) {
-		return true, nil
-	}
-	if target, err := readlink(name); err == nil {
-		if name = target; isShadowPath(target) {
-			return true, nil
-		}
-	}
-	name, err := resolveDevice(name)
-	return isShadowPath(name), err
+	return isShadowCopy(name, readlink, resolveDevice)
 }
 
 // Remove removes a shadow copy by ID, DeviceObject, or symlink path. If a valid
@@ -86,8 +75,8 @@ func Remove(name string) error {
 	if !isAdmin() {
 		return errNotAdmin
 	}
-	if id := ole.NewGUID(name); id != nil {
-		return (&ShadowCopy{ID: id.String()}).Remove()
+	if id, err := ParseShadowID(name); err == nil {
+		return (&ShadowCopy{ID: id}).Remove()
 	}
 	sc, symlink, err := get(name)
 	if err != nil {
@@ -101,33 +90,14 @@ func Remove(name string) error {
 
 // SplitVolume splits an absolute file path into its volume mount point and the
 // path relative to the mount. For example, "C:\Windows\System32" returns "C:\"
-// and "Windows\System32".
+// and "Windows\System32". The path is cleaned first and must be on a local
+// volume or a network share. For UNC paths, such as `\\server\share\dir`, the
+// volume is the share root. The relative path of a volume is ".".
 func SplitVolume(name string) (vol, rel string, err error) {
-	if name = filepath.Clean(name); !filepath.IsAbs(name) {
-		// We don't want GetVolumePathName returning the boot volume for
-		// relative paths.
-		return "", "", fmt.Errorf("vss: non-absolute path: %s", name)
-	}
-	buf := make([]uint16, max(len(name), syscall.MAX_PATH))
-	if err = windows.GetVolumePathName(utf16Ptr(name), &buf[0], uint32(len(buf))); err != nil {
-		return "", "", fmt.Errorf("vss: GetVolumePathName failed for: %s (%w)", name, err)
-	}
-	vol = syscall.UTF16ToString(buf[:])
-	rel, err = filepath.Rel(vol, name)
-	return
+	return splitVolume(sysTopology, name)
 }
 
-// ShadowCopy is an instance of Win32_ShadowCopy class. See:
-//
-// https://learn.microsoft.com/en-us/previous-versions/windows/desktop/legacy/aa394428(v=vs.85)
-type ShadowCopy struct {
-	ID           string
-	InstallDate  time.Time
-	DeviceObject string
-	VolumeName   string
-}
-
-const scSelect = "SELECT ID,InstallDate,DeviceObject,VolumeName FROM Win32_ShadowCopy"
+const scSelect = "SELECT ID,SetID,ProviderID,InstallDate,DeviceObject,VolumeName,ExposedName,ExposedPath FROM Win32_ShadowCopy"
 
 // unpack converts Win32_ShadowCopy object into ShadowCopy.
 func unpack(v *ole.IDispatch) (*ShadowCopy, error) {
@@ -135,9 +105,22 @@ func unpack(v *ole.IDispatch) (*ShadowCopy, error) {
 	if err := getProp(v, "ID", &sc.ID); err != nil {
 		return nil, err
 	}
-	tryGetProp(v, "DeviceObject", &sc.DeviceObject)
-	tryGetProp(v, "InstallDate", &sc.InstallDate)
-	tryGetProp(v, "VolumeName", &sc.VolumeName)
+	for _, p := range []struct {
+		name string
+		v    any
+	}{
+		{"SetID", &sc.SetID},
+		{"ProviderID", &sc.ProviderID},
+		{"DeviceObject", &sc.DeviceObject},
+		{"InstallDate", &sc.InstallDate},
+		{"VolumeName", &sc.VolumeName},
+		{"ExposedName", &sc.ExposedName},
+		{"ExposedPath", &sc.ExposedPath},
+	} {
+		if _, err := tryGetProp(v, p.name, p.v); err != nil {
+			return nil, err
+		}
+	}
 	return sc, nil
 }
 
@@ -154,8 +137,8 @@ func Get(name string) (*ShadowCopy, error) {
 // symlink, then it also returns the cleaned path.
 func get(name string) (sc *ShadowCopy, symlink string, err error) {
 	var wql string
-	if id := ole.NewGUID(name); id != nil {
-		wql = fmt.Sprintf(scSelect+" WHERE ID=%q", id.String())
+	if id, err := ParseShadowID(name); err == nil {
+		wql = fmt.Sprintf(scSelect+" WHERE ID=%q", id)
 	} else {
 		if name = filepath.Clean(name); !isShadowPath(name) {
 			dev, err := readlink(name)
@@ -182,31 +165,60 @@ func List(vol string) ([]*ShadowCopy, error) {
 	if !isAdmin() {
 		return nil, errNotAdmin
 	}
-	var wql = scSelect
-	if vol != "" {
-		vol, err := volumeName(vol)
-		if err != nil {
-			return nil, err
-		}
-		wql = fmt.Sprintf(scSelect+" WHERE VolumeName=%q", vol)
-	}
 	var all []*ShadowCopy
-	err := wmiExec(func(s *sWbemServices) error {
-		return s.execQuery(wql, func(v *ole.IDispatch) error {
-			sc, err := unpack(v)
-			if err == nil {
-				all = append(all, sc)
-			}
-			return err
-		})
+	err := wmiExec(func(s *sWbemServices) (err error) {
+		all, err = s.list(vol)
+		return
 	})
 	return all, err
 }
 
+// ListStorage returns the shadow copy storage associations of all volumes.
+func ListStorage(ctx context.Context) ([]*Storage, error) {
+	if !isAdmin() {
+		return nil, errNotAdmin
+	}
+	type wmiStorage struct {
+		Volume, DiffVolume                  string
+		AllocatedSpace, UsedSpace, MaxSpace uint64
+	}
+	ws, err := Query[wmiStorage](ctx, "SELECT Volume,DiffVolume,AllocatedSpace,UsedSpace,MaxSpace FROM Win32_ShadowStorage")
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*Storage, len(ws))
+	for i, w := range ws {
+		s := &Storage{AllocatedSpace: w.AllocatedSpace, UsedSpace: w.UsedSpace, MaxSpace: w.MaxSpace}
+		if s.Volume, err = parseVolumeRef(w.Volume); err != nil {
+			return nil, err
+		}
+		if s.DiffVolume, err = parseVolumeRef(w.DiffVolume); err != nil {
+			return nil, err
+		}
+		all[i] = s
+	}
+	return all, nil
+}
+
+// ListProviders returns the registered shadow copy providers.
+func ListProviders(ctx context.Context) ([]*Provider, error) {
+	if !isAdmin() {
+		return nil, errNotAdmin
+	}
+	return Query[*Provider](ctx, "SELECT ID,CLSID,Name,Type,Version,VersionID FROM Win32_ShadowProvider")
+}
+
 // Link creates a directory symlink pointing to the contents of the shadow copy.
 func (sc *ShadowCopy) Link(name string) error {
-	return syscall.CreateSymbolicLink(utf16Ptr(name), utf16Ptr(sc.DeviceObject+`\`),
-		syscall.SYMBOLIC_LINK_FLAG_DIRECTORY)
+	link, err := utf16Ptr(name)
+	if err != nil {
+		return err
+	}
+	target, err := utf16Ptr(sc.DeviceObject + `\`)
+	if err != nil {
+		return err
+	}
+	return syscall.CreateSymbolicLink(link, target, syscall.SYMBOLIC_LINK_FLAG_DIRECTORY)
 }
 
 // Remove removes the shadow copy.
@@ -215,25 +227,10 @@ func (sc *ShadowCopy) Remove() error {
 		return errNotAdmin
 	}
 	return wmiExec(func(s *sWbemServices) error {
-		_, err := s.CallMethod("Delete", fmt.Sprintf("Win32_ShadowCopy.ID=%q", sc.ID))
-		if err != nil {
-			err = fmt.Errorf("vss: failed to remove shadow copy ID %s (%w)", sc.ID, err)
-		}
-		return err
+		return s.remove(sc.ID)
 	})
 }
 
-// VolumePath returns the drive letter and/or folder where the shadow copy's
-// original volume is mounted. If the volume is mounted at multiple locations,
-// only the first one is returned.
-func (sc *ShadowCopy) VolumePath() (string, error) {
-	m, err := volumePaths(sc.VolumeName)
-	if err != nil || len(m) == 0 {
-		return "", err
-	}
-	return m[0], nil
-}
-
 // isAdmin returns whether the current thread is a member of the Administrators
 // group.
 var isAdmin = sync.OnceValue(func() bool {
@@ -250,83 +247,40 @@ var isAdmin = sync.OnceValue(func() bool {
 	if err != nil {
 		return false
 	}
-	defer func() {
-		if err := windows.FreeSid(AdministratorsGroup); err != nil {
-			panic(err)
-		}
-	}()
+	defer func() { _ = windows.FreeSid(AdministratorsGroup) }()
 	ok, err := windows.Token(0).IsMember(AdministratorsGroup)
 	return ok && err == nil
 })
 
-// CreateError is an error code returned by Win32_ShadowCopy.Create. See:
-//
-// https://learn.microsoft.com/en-us/previous-versions/windows/desktop/vsswmi/create-method-in-class-win32-shadowcopy#return-value
-type CreateError uint32
-
-// Error implements the error interface.
-func (e CreateError) Error() string {
-	switch e {
-	case 0:
-		return "Success"
-	case 1:
-		return "Access denied"
-	case 2:
-		return "Invalid argument"
-	case 3:
-		return "Specified volume not found"
-	case 4:
-		return "Specified volume not supported"
-	case 5:
-		return "Unsupported shadow copy context"
-	case 6:
-		return "Insufficient storage"
-	case 7:
-		return "Volume is in use"
-	case 8:
-		return "Maximum number of shadow copies reached"
-	case 9:
-		return "Another shadow copy operation is already in progress"
-	case 10:
-		return "Shadow copy provider vetoed the operation"
-	case 11:
-		return "Shadow copy provider not registered"
-	case 12:
-		return "Shadow copy provider failure"
-	case 13:
-		return "Unknown error"
-	}
-	return ""
-}
-
-// Unwrap implements errors.Unwrap interface.
-func (e CreateError) Unwrap() error {
-	switch e {
-	case 1:
-		return os.ErrPermission
-	case 2:
-		return os.ErrInvalid
-	case 3:
-		return os.ErrNotExist
-	}
-	return nil
+// oemText converts b from the OEM code page, which console tools use for
+// redirected output, to UTF-8.
+func oemText(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return b, nil
+	}
+	const cpOEMCP = 1
+	n, err := windows.MultiByteToWideChar(cpOEMCP, 0, &b[0], int32(len(b)), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	u := make([]uint16, n)
+	if n, err = windows.MultiByteToWideChar(cpOEMCP, 0, &b[0], int32(len(b)), &u[0], n); err != nil {
+		return nil, err
+	}
+	return []byte(windows.UTF16ToString(u[:n])), nil
 }
 
 // create creates a new shadow copy of the specified volume and returns its ID.
-func create(s *sWbemServices, vol string) (*ole.GUID, error) {
+func create(s *sWbemServices, vol string) (_ *ole.GUID, err error) {
 	if vol = filepath.FromSlash(vol); vol != "" && vol[len(vol)-1] != '\\' {
 		vol += `\` // Trailing separator is required
 	}
-	sc, err := s.CallMethod("Get", "Win32_ShadowCopy")
-	if err != nil {
-		return nil, fmt.Errorf("vss: failed to get Win32_ShadowCopy (%w)", err)
-	}
-	defer mustClear(sc)
 	var id string
-	rc, err := sc.ToIDispatch().CallMethod("Create", vol, "ClientAccessible", &id)
+	rc, err := s.callMethod("Win32_ShadowCopy", "Create", vol, "ClientAccessible", &id)
 	if err != nil {
-		return nil, fmt.Errorf("vss: Win32_ShadowCopy.Create(%#q) failed (%w)", vol, err)
+		return nil, fmt.Errorf("vss: failed to create shadow copy of %#q (%w)", vol, err)
 	}
+	defer clearVariant(rc, &err)
 	if g := ole.NewGUID(id); rc.Val == 0 && g != nil {
 		return g, nil
 	}
@@ -351,9 +305,34 @@ func readlink(name string) (string, error) {
 	}
 }
 
+// linkShadow creates a directory symlink to the shadow copy.
+func linkShadow(sc *ShadowCopy, name string) error {
+	return sc.Link(name)
+}
+
+// unlinkShadow removes a symlink created by linkShadow. It refuses to remove
+// anything other than a shadow copy symlink.
+func unlinkShadow(name string) error {
+	target, err := readlink(name)
+	if errors.Is(err, windows.ERROR_NOT_A_REPARSE_POINT) {
+		return fmt.Errorf("vss: %#q is %w", name, errNotShadowLink)
+	}
+	if err != nil {
+		return err
+	}
+	if !isShadowPath(target) {
+		return fmt.Errorf("vss: %#q is %w", name, errNotShadowLink)
+	}
+	return rmdir(name)
+}
+
 // rmdir removes the named directory, which may be a symlink.
 func rmdir(name string) error {
-	return syscall.RemoveDirectory(utf16Ptr(name))
+	p, err := utf16Ptr(name)
+	if err != nil {
+		return err
+	}
+	return syscall.RemoveDirectory(p)
 }
 
 // resolveDevice resolves any symbolic links in name and returns the full
@@ -364,7 +343,11 @@ func resolveDevice(name string) (string, error) {
 	const create = syscall.OPEN_EXISTING
 	// See https://docs.microsoft.com/en-us/windows/desktop/FileIO/symbolic-link-effects-on-file-systems-functions#createfile-and-createfiletransacted
 	const flag = syscall.FILE_FLAG_BACKUP_SEMANTICS | syscall.FILE_FLAG_OPEN_REPARSE_POINT
-	h, err := windows.CreateFile(utf16Ptr(name), access, share, nil, create, flag, 0)
+	p, err := utf16Ptr(name)
+	if err != nil {
+		return "", err
+	}
+	h, err := windows.CreateFile(p, access, share, nil, create, flag, 0)
 	if err != nil {
 		return "", err
 	}
@@ -380,20 +363,24 @@ func resolveDevice(name string) (string, error) {
 			return syscall.UTF16ToString(buf[:n]), nil
 		}
 	}
-	panic("vss: should not happen")
+	return "", fmt.Errorf("vss: GetFinalPathNameByHandle buffer size mismatch for: %s", name)
 }
 
-// volumeName converts a drive letter or a mounted folder to `\\?\Volume{GUID}\`
-// format. If vol is already in the GUID format, it is returned unmodified,
-// except for the addition of a trailing slash.
-func volumeName(name string) (string, error) {
+// mountPointVolume converts a drive letter or a mounted folder to
+// `\\?\Volume{GUID}\` format. If vol is already in the GUID format, it is
+// returned unmodified, except for the addition of a trailing slash.
+func mountPointVolume(name string) (string, error) {
 	const volLen = len(`\\?\Volume{xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx}\`)
 	if name = filepath.FromSlash(name); name != "" && name[len(name)-1] != '\\' {
 		name += `\` // Trailing separator is required
 	}
-	if len(name) != volLen || !hasPrefixFold(name, `\\?\Volume{`) {
+	if len(name) != volLen || !vsspath.HasPrefixFold(name, `\\?\Volume{`) {
+		p, err := utf16Ptr(name)
+		if err != nil {
+			return "", err
+		}
 		var buf [volLen + 1]uint16
-		err := windows.GetVolumeNameForVolumeMountPoint(utf16Ptr(name), &buf[0], uint32(len(buf)))
+		err = windows.GetVolumeNameForVolumeMountPoint(p, &buf[0], uint32(len(buf)))
 		if err != nil {
 			return "", fmt.Errorf("vss: failed to get volume name of %#q (%w)", name, err)
 		}
@@ -402,11 +389,76 @@ func volumeName(name string) (string, error) {
 	return name, nil
 }
 
+// winTopology implements topology using the volume management API.
+type winTopology struct{}
+
+// sysTopology is the topology used by path translation.
+var sysTopology topology = winTopology{}
+
+// volumeOf implements topology.
+func (winTopology) volumeOf(p string) (mount string, vol VolumeGUIDName, err error) {
+	q := p
+	if len(q) >= syscall.MAX_PATH && isDriveLetter(q[:2]) {
+		q = `\\?\` + q
+	}
+	u, err := utf16Ptr(q)
+	if err != nil {
+		return "", vol, err
+	}
+	buf := make([]uint16, max(len(q)+1, syscall.MAX_PATH))
+	if err = windows.GetVolumePathName(u, &buf[0], uint32(len(buf))); err != nil {
+		return "", vol, fmt.Errorf("vss: GetVolumePathName failed for: %s (%w)", p, err)
+	}
+	mount = syscall.UTF16ToString(buf)
+	if q != p {
+		mount = strings.TrimPrefix(mount, `\\?\`)
+	}
+	name, err := mountPointVolume(mount)
+	if err != nil {
+		return mount, vol, err
+	}
+	vol, err = ParseVolumeGUIDName(name)
+	return mount, vol, err
+}
+
+// paths implements topology.
+func (winTopology) paths(vol VolumeGUIDName) ([]string, error) {
+	return volumePaths(vol.String())
+}
+
+// volumes implements topology.
+func (winTopology) volumes() ([]VolumeGUIDName, error) {
+	var buf [syscall.MAX_PATH]uint16
+	h, err := windows.FindFirstVolume(&buf[0], uint32(len(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("vss: FindFirstVolume failed (%w)", err)
+	}
+	defer func() { _ = windows.FindVolumeClose(h) }()
+	var all []VolumeGUIDName
+	for {
+		vol, err := ParseVolumeGUIDName(syscall.UTF16ToString(buf[:]))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, vol)
+		if err = windows.FindNextVolume(h, &buf[0], uint32(len(buf))); err != nil {
+			if err == windows.ERROR_NO_MORE_FILES {
+				return all, nil
+			}
+			return nil, fmt.Errorf("vss: FindNextVolume failed (%w)", err)
+		}
+	}
+}
+
 // volumePaths returns all mount points for the specified volume name.
 func volumePaths(vol string) ([]string, error) {
+	p, err := utf16Ptr(vol)
+	if err != nil {
+		return nil, err
+	}
 	var buf [2 * syscall.MAX_PATH]uint16
 	var n uint32
-	err := windows.GetVolumePathNamesForVolumeName(utf16Ptr(vol), &buf[0], uint32(len(buf)), &n)
+	err = windows.GetVolumePathNamesForVolumeName(p, &buf[0], uint32(len(buf)), &n)
 	if err != nil || len(buf) < int(n) {
 		return nil, fmt.Errorf("vss: failed to get volume paths for %#q (%w)", vol, err)
 	}
@@ -422,50 +474,48 @@ func volumePaths(vol string) ([]string, error) {
 	return all, nil
 }
 
-// isShadowPath returns whether s is a shadow copy path.
-func isShadowPath(s string) bool {
-	return trimShadowPath(s) != ""
-}
-
-// normShadowPath ensures that s starts with the canonical shadow copy
-// DeviceObject name. It returns an empty string if s does not refer to a shadow
-// copy.
-func normShadowPath(s string) string {
-	const prefix = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`
-	if hasPrefixFold(s, prefix) {
-		return s
+// copyAttrs are the file attributes preserved by setMetadata.
+const copyAttrs = windows.FILE_ATTRIBUTE_READONLY | windows.FILE_ATTRIBUTE_HIDDEN |
+	windows.FILE_ATTRIBUTE_SYSTEM | windows.FILE_ATTRIBUTE_ARCHIVE |
+	windows.FILE_ATTRIBUTE_NOT_CONTENT_INDEXED
+
+// setMetadata sets the creation, access, and modification times and the
+// copyAttrs of dst to those of the source file described by info. If info does
+// not come from a Windows file system, only the read-only attribute is set
+// from the permission bits.
+func setMetadata(dst string, info fs.FileInfo) error {
+	d, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return os.Chmod(dst, info.Mode().Perm())
+	}
+	p, err := utf16Ptr(dst)
+	if err != nil {
+		return err
 	}
-	if s = trimShadowPath(s); s != "" {
-		return prefix + s
+	h, err := windows.CreateFile(p, windows.FILE_WRITE_ATTRIBUTES,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
 	}
-	return ""
-}
-
-// trimShadowPath removes the shadow copy device prefix just before the volume
-// number. It returns an empty string if s does not refer to a shadow copy.
-func trimShadowPath(s string) string {
-	s, _ = strings.CutPrefix(s, `\\?\`)
-	if hasPrefixFold(s, `GLOBALROOT\`) {
-		s = s[len(`GLOBALROOT`):]
+	ct, at, wt := windows.Filetime(d.CreationTime), windows.Filetime(d.LastAccessTime), windows.Filetime(d.LastWriteTime)
+	err = windows.SetFileTime(h, &ct, &at, &wt)
+	if err = errors.Join(err, windows.CloseHandle(h)); err != nil {
+		return err
 	}
-	const prefix = `\Device\HarddiskVolumeShadowCopy`
-	if hasPrefixFold(s, prefix) {
-		return s[len(prefix):]
+	attrs := d.FileAttributes & copyAttrs
+	if attrs == 0 {
+		attrs = windows.FILE_ATTRIBUTE_NORMAL
 	}
-	return ""
-}
-
-// hasPrefixFold tests whether s begins with an ASCII-only prefix ignoring case.
-func hasPrefixFold(s, prefix string) bool {
-	return len(s) >= len(prefix) && strings.EqualFold(s[0:len(prefix)], prefix)
+	return windows.SetFileAttributes(p, attrs)
 }
 
-// utf16Ptr converts s to UTF-16 format for Windows API calls. It panics if s
-// contains any NUL bytes.
-func utf16Ptr(s string) *uint16 {
+// utf16Ptr converts s to UTF-16 format for Windows API calls. It returns an
+// error if s contains any NUL bytes.
+func utf16Ptr(s string) (*uint16, error) {
 	p, err := syscall.UTF16PtrFromString(s)
 	if err != nil {
-		panic("vss: string with NUL passed to UTF16PtrFromString")
+		return nil, fmt.Errorf("vss: invalid string containing NUL: %q (%w)", s, os.ErrInvalid)
 	}
-	return p
+	return p, nil
 }
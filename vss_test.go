@@ -3,18 +3,17 @@
 package vss
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/windows"
 )
 
 func ExampleCreate() {
@@ -23,10 +22,10 @@ func ExampleCreate() {
 	if err != nil {
 		panic(err)
 	}
-	defer Remove(id)
+	defer Remove(id.String())
 
 	// Get properties
-	sc, err := Get(id)
+	sc, err := Get(id.String())
 	if err != nil {
 		panic(err)
 	}
@@ -53,37 +52,31 @@ func TestMain(m *testing.M) {
 			panic(err)
 		}
 	}
-	s := bufio.NewScanner(bytes.NewReader(out))
-	var sc *ShadowCopy
-	for s.Scan() {
-		ln := strings.TrimSpace(s.Text())
-		if _, ts, ok := strings.Cut(ln, " shadow copies at creation time: "); ok {
-			t, err := time.ParseInLocation("2006-01-02 03:04:05 PM", ts, time.Local)
-			if err != nil {
-				panic(err)
-			}
-			if sc != nil {
-				vssadminList = append(vssadminList, sc)
-			}
-			sc = &ShadowCopy{InstallDate: t}
-		} else if id, ok := strings.CutPrefix(ln, "Shadow Copy ID: "); ok {
-			sc.ID = strings.ToUpper(id)
-		} else if vol, ok := strings.CutPrefix(ln, "Original Volume: "); ok {
-			i := strings.Index(vol, `\\?\Volume{`)
-			sc.VolumeName = vol[i:]
-		} else if dev, ok := strings.CutPrefix(ln, "Shadow Copy Volume: "); ok {
-			sc.DeviceObject = dev
-		}
-	}
-	if err := s.Err(); err != nil {
+	if out, err = oemText(out); err != nil {
 		panic(err)
 	}
-	if sc != nil {
-		vssadminList = append(vssadminList, sc)
+	if vssadminList, err = ParseVssadminShadows(bytes.NewReader(out), nil); err != nil {
+		panic(err)
 	}
 	os.Exit(m.Run())
 }
 
+var procGetOEMCP = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetOEMCP")
+
+func TestOEMText(t *testing.T) {
+	b, err := oemText([]byte("Contents of shadow copy set ID: {X}\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "Contents of shadow copy set ID: {X}\r\n", string(b))
+	b, err = oemText(nil)
+	require.NoError(t, err)
+	assert.Empty(t, b)
+	if cp, _, _ := procGetOEMCP.Call(); cp == 932 {
+		b, err = oemText([]byte{0x8c, 0xdf, 0x8c, 0xe3}) // Shift-JIS
+		require.NoError(t, err)
+		assert.Equal(t, "午後", string(b))
+	}
+}
+
 func TestIsShadowCopy(t *testing.T) {
 	if len(vssadminList) == 0 {
 		t.Skip("no existing shadow copies")
@@ -114,6 +107,7 @@ func TestIsShadowCopy(t *testing.T) {
 		if have.InstallDate.Sub(sc.InstallDate).Abs() < time.Second {
 			have.InstallDate = sc.InstallDate
 		}
+		sc.ProviderID = have.ProviderID
 		assert.Equal(t, sc, have)
 	}
 	if all, err := os.ReadDir(link); assert.NoError(t, err) && len(all) > 0 {
@@ -148,17 +142,20 @@ func TestListGet(t *testing.T) {
 	if !isAdmin() {
 		t.Skip("not running as admin")
 	}
+	_, err := Get(testShadowID(0).String())
+	require.ErrorIs(t, err, os.ErrNotExist)
 	all, err := List("")
 	require.NoError(t, err)
 	if len(all) == 0 {
 		return
 	}
 
-	// vssadmin truncates milliseconds
+	// vssadmin truncates milliseconds and reports provider names, not IDs
 	for _, sc := range all {
 		for _, ref := range vssadminList {
 			if sc.ID == ref.ID && sc.InstallDate.Sub(ref.InstallDate).Abs() < time.Second {
 				ref.InstallDate = sc.InstallDate
+				ref.ProviderID = sc.ProviderID
 				break
 			}
 		}
@@ -166,7 +163,7 @@ func TestListGet(t *testing.T) {
 	assert.Equal(t, vssadminList, all)
 
 	want := all[0]
-	have, err := Get(want.ID)
+	have, err := Get(want.ID.String())
 	require.NoError(t, err)
 	require.Equal(t, want, have)
 	have, err = Get(want.DeviceObject)
@@ -175,21 +172,11 @@ func TestListGet(t *testing.T) {
 }
 
 func TestVolName(t *testing.T) {
-	_, err := volumeName(``)
+	_, err := volumeName(sysTopology, ``)
 	require.Error(t, err)
-	name, err := volumeName(`C:`)
+	name, err := volumeName(sysTopology, `C:`)
 	require.NoError(t, err)
 	paths, err := volumePaths(name)
 	require.NoError(t, err)
 	require.Equal(t, []string{`C:\`}, paths)
 }
-
-func TestShadowPath(t *testing.T) {
-	const want = `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy42`
-	assert.False(t, isShadowPath(``))
-	assert.False(t, isShadowPath(`C:\Windows`))
-	assert.True(t, isShadowPath(`\Device\HarddiskVolumeShadowCopy42`))
-	assert.Equal(t, want, normShadowPath(`\device\harddiskvolumeshadowcopy42`))
-	assert.Equal(t, want, normShadowPath(`globalroot\device\harddiskvolumeshadowcopy42`))
-	assert.Equal(t, want, normShadowPath(want))
-}
@@ -0,0 +1,450 @@
+package vss
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mxk/go-vss/vsspath"
+)
+
+// The vssadmin parsers read the output of vssadmin.exe list commands. Field
+// labels are translated in non-English versions of Windows, so fields are
+// identified by the shape of their values and their position within each
+// record rather than by label. Dates are formatted according to the regional
+// settings of the user that ran vssadmin and are recognized in any common
+// numeric format (see ParseVssadminShadows). The parsers read UTF-8 text, but
+// vssadmin writes redirected output in the OEM code page, which must be
+// converted first. ToolBackend does this automatically.
+
+// ParseVssadminShadows parses the output of "vssadmin list shadows". Creation
+// times are interpreted in location loc, or time.Local if loc is nil. They
+// have second precision. ProviderID is not set because vssadmin reports
+// provider names rather than IDs.
+//
+// Dates may use any order of year, month, and day, separated by any
+// non-digit characters, and may be followed by a 12- or 24-hour time. Year-first
+// dates are unambiguous. Otherwise, a day greater than 12 determines the
+// order, and ambiguous dates are read as month-first if they use '/' with an
+// upper-case AM/PM designator, as in the en-US locale, and as day-first in all
+// other cases, including the lower-case am/pm used by en-AU and en-NZ.
+func ParseVssadminShadows(r io.Reader, loc *time.Location) ([]*ShadowCopy, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	recs, err := scanVssadmin(r)
+	if err != nil {
+		return nil, err
+	}
+	var all []*ShadowCopy
+	for _, rec := range recs {
+		setID, err := ParseSetID(rec.head.value)
+		if err != nil {
+			continue // Not a shadow copy set
+		}
+		if len(rec.fields) == 0 {
+			return nil, fmt.Errorf("vss: missing creation time of vssadmin shadow copy set %s", setID)
+		}
+		t, err := parseVssadminTime(rec.fields[0].value, loc)
+		if err != nil {
+			return nil, err
+		}
+		var sc *ShadowCopy
+		var n int // Index of the field within the shadow copy
+		for _, f := range rec.fields[1:] {
+			if id, err := ParseShadowID(f.value); err == nil {
+				if err = checkVssadminShadow(sc); err != nil {
+					return nil, err
+				}
+				sc = &ShadowCopy{ID: id, SetID: setID, InstallDate: t}
+				all = append(all, sc)
+				n = 0
+				continue
+			}
+			if sc == nil {
+				return nil, fmt.Errorf("vss: unexpected vssadmin field in shadow copy set %s: %s", setID, f.label)
+			}
+			if i := strings.Index(f.value, `\\?\Volume{`); i >= 0 {
+				if sc.VolumeName, err = ParseVolumeGUIDName(f.value[i:]); err != nil {
+					return nil, err
+				}
+			} else if vsspath.Is(f.value) {
+				sc.DeviceObject = f.value
+			} else if _, quoted := unquoteVssadmin(f.value); n == vssadminExposedField && !quoted {
+				sc.ExposedName = f.value
+			}
+			n++
+		}
+		if err = checkVssadminShadow(sc); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// vssadminExposedField is the index of the exposed name of a shadow copy in
+// "vssadmin list shadows" output, counting from the field after the shadow copy
+// ID. It follows the original volume, shadow copy volume, originating machine,
+// and service machine. The exposed name is a drive letter, mount point, or
+// share name. Share names cannot be distinguished from other values by shape,
+// so the field is identified by its position. It is only present for exposed
+// shadow copies, so the quoted provider name is found in its place otherwise.
+const vssadminExposedField = 4
+
+// ParseVssadminStorage parses the output of "vssadmin list shadowstorage".
+// Space values are reported by vssadmin with three significant digits, so the
+// returned values are approximate. A maximum space that is not a number, such
+// as "UNBOUNDED", is returned as UnboundedSpace.
+func ParseVssadminStorage(r io.Reader) ([]*Storage, error) {
+	recs, err := scanVssadmin(r)
+	if err != nil {
+		return nil, err
+	}
+	var all []*Storage
+	for _, rec := range recs {
+		var vols []VolumeGUIDName
+		var space []string
+		for _, f := range rec.fields {
+			if i := strings.Index(f.value, `\\?\Volume{`); i >= 0 {
+				v, err := ParseVolumeGUIDName(f.value[i:])
+				if err != nil {
+					return nil, err
+				}
+				vols = append(vols, v)
+			} else {
+				space = append(space, f.value)
+			}
+		}
+		if len(vols) == 0 && len(space) == 0 {
+			continue
+		}
+		if len(vols) != 2 || len(space) != 3 {
+			return nil, fmt.Errorf("vss: invalid vssadmin shadow storage association: %s", rec.head.label)
+		}
+		s := &Storage{Volume: vols[0], DiffVolume: vols[1]}
+		if s.UsedSpace, err = parseVssadminSpace(space[0]); err != nil {
+			return nil, err
+		}
+		if s.AllocatedSpace, err = parseVssadminSpace(space[1]); err != nil {
+			return nil, err
+		}
+		if s.MaxSpace = UnboundedSpace; startsWithDigit(space[2]) {
+			if s.MaxSpace, err = parseVssadminSpace(space[2]); err != nil {
+				return nil, err
+			}
+		}
+		all = append(all, s)
+	}
+	return all, nil
+}
+
+// ParseVssadminWriters parses the output of "vssadmin list writers". The
+// Failure of each writer is only set when vssadmin describes the last error
+// in English. For other languages, it remains 0, but the State still indicates
+// whether the writer failed.
+func ParseVssadminWriters(r io.Reader) ([]WriterStatus, error) {
+	recs, err := scanVssadmin(r)
+	if err != nil {
+		return nil, err
+	}
+	var all []WriterStatus
+	for _, rec := range recs {
+		name, ok := unquoteVssadmin(rec.head.value)
+		if !ok {
+			continue
+		}
+		if len(rec.fields) < 4 {
+			return nil, fmt.Errorf("vss: incomplete vssadmin writer: %s", name)
+		}
+		w := WriterStatus{Name: name}
+		if w.WriterID, err = formatGUID(rec.fields[0].value, "writer ID"); err != nil {
+			return nil, err
+		}
+		if w.InstanceID, err = formatGUID(rec.fields[1].value, "writer instance ID"); err != nil {
+			return nil, err
+		}
+		if w.State, err = parseVssadminState(rec.fields[2].value); err != nil {
+			return nil, err
+		}
+		w.Failure = vssadminWriterErrors[strings.ToLower(rec.fields[3].value)]
+		all = append(all, w)
+	}
+	return all, nil
+}
+
+// ParseVssadminProviders parses the output of "vssadmin list providers". CLSID
+// and VersionID are not set because vssadmin does not report them.
+func ParseVssadminProviders(r io.Reader) ([]*Provider, error) {
+	recs, err := scanVssadmin(r)
+	if err != nil {
+		return nil, err
+	}
+	var all []*Provider
+	for _, rec := range recs {
+		name, ok := unquoteVssadmin(rec.head.value)
+		if !ok {
+			continue
+		}
+		if len(rec.fields) < 3 {
+			return nil, fmt.Errorf("vss: incomplete vssadmin provider: %s", name)
+		}
+		p := &Provider{
+			Name:    name,
+			Type:    vssadminProviderTypes[strings.ToLower(rec.fields[0].value)],
+			Version: rec.fields[2].value,
+		}
+		if p.ID, err = formatGUID(rec.fields[1].value, "provider ID"); err != nil {
+			return nil, err
+		}
+		all = append(all, p)
+	}
+	return all, nil
+}
+
+// vssadminWriterErrors maps lower-case English descriptions of the last writer
+// error to the corresponding HRESULT.
+var vssadminWriterErrors = map[string]HRESULT{
+	"unexpected error":         0x8000FFFF, // E_UNEXPECTED
+	"inconsistent shadow copy": 0x800423F0, // VSS_E_WRITERERROR_INCONSISTENTSNAPSHOT
+	"out of resources":         0x800423F1, // VSS_E_WRITERERROR_OUTOFRESOURCES
+	"timed out":                0x800423F2, // VSS_E_WRITERERROR_TIMEOUT
+	"retryable error":          0x800423F3, // VSS_E_WRITERERROR_RETRYABLE
+	"non-retryable error":      0x800423F4, // VSS_E_WRITERERROR_NONRETRYABLE
+	"not responding":           0x80042409, // VSS_E_WRITER_STATUS_NOT_AVAILABLE
+}
+
+// vssadminProviderTypes maps lower-case provider type names in English,
+// German, French, and Spanish to ProviderType values.
+var vssadminProviderTypes = map[string]ProviderType{
+	"system":   ProviderSystem,
+	"software": ProviderSoftware,
+	"hardware": ProviderHardware,
+	"système":  ProviderSystem,
+	"logiciel": ProviderSoftware,
+	"matériel": ProviderHardware,
+	"sistema":  ProviderSystem,
+}
+
+// vssadminUnits maps lower-case units of space values to powers of 1024.
+var vssadminUnits = map[string]int{
+	"b": 0, "bytes": 0, "byte": 0, "octets": 0, "octet": 0, "байт": 0,
+	"kb": 1, "ko": 1, "кб": 1,
+	"mb": 2, "mo": 2, "мб": 2,
+	"gb": 3, "go": 3, "гб": 3,
+	"tb": 4, "to": 4, "тб": 4,
+	"pb": 5, "po": 5, "пб": 5,
+	"eb": 6, "eo": 6, "эб": 6,
+}
+
+// vssadminRecord is a top-level line of vssadmin output followed by its
+// indented fields.
+type vssadminRecord struct {
+	head   vssadminField
+	fields []vssadminField
+}
+
+// vssadminField is a "label: value" line of vssadmin output.
+type vssadminField struct {
+	label string
+	value string
+}
+
+// scanVssadmin splits vssadmin output into records. Lines without a value are
+// returned as fields with only a label.
+func scanVssadmin(r io.Reader) ([]*vssadminRecord, error) {
+	var all []*vssadminRecord
+	var rec *vssadminRecord
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		ln := strings.Map(dropInvisible, s.Text())
+		t := strings.TrimLeftFunc(ln, unicode.IsSpace)
+		if t = strings.TrimRightFunc(t, unicode.IsSpace); t == "" {
+			continue
+		}
+		var f vssadminField
+		if i, n := cutVssadminLabel(t); i >= 0 {
+			f = vssadminField{strings.TrimSpace(t[:i]), strings.TrimSpace(t[i+n:])}
+		} else {
+			f.label = t
+		}
+		if len(t) == len(ln) {
+			rec = &vssadminRecord{head: f}
+			all = append(all, rec)
+		} else if rec != nil {
+			rec.fields = append(rec.fields, f)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("vss: failed to read vssadmin output (%w)", err)
+	}
+	return all, nil
+}
+
+// cutVssadminLabel returns the index and length of the separator between the
+// label and value of line t, or -1 if there is no separator. The separator is
+// the first colon that is followed by a space or ends the line. This excludes
+// colons in times, drive letters, and paths. Full-width colons are also
+// accepted.
+func cutVssadminLabel(t string) (i, n int) {
+	for i, c := range t {
+		switch c {
+		case ':':
+			if i+1 == len(t) || t[i+1] == ' ' {
+				return i, 1
+			}
+		case '：':
+			return i, len("：")
+		}
+	}
+	return -1, 0
+}
+
+// dropInvisible is a strings.Map function that removes byte order and
+// directional marks, which may surround localized dates.
+func dropInvisible(r rune) rune {
+	switch r {
+	case '\uFEFF', '\u200E', '\u200F', '\u061C':
+		return -1
+	}
+	return r
+}
+
+// unquoteVssadmin removes single or double quotes around s.
+func unquoteVssadmin(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], true
+	}
+	return s, false
+}
+
+// formatGUID returns GUID s in the canonical upper-case format with braces.
+func formatGUID(s, what string) (string, error) {
+	g, err := parseGUIDText(s, what)
+	return g.format(), err
+}
+
+// parseVssadminState parses a writer state in the "[1] Stable" format.
+func parseVssadminState(s string) (WriterState, error) {
+	if strings.HasPrefix(s, "[") {
+		if i := strings.IndexByte(s, ']'); i > 0 {
+			if n, err := strconv.ParseInt(s[1:i], 10, 32); err == nil {
+				return WriterState(n), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("vss: invalid vssadmin writer state: %#q (%w)", s, os.ErrInvalid)
+}
+
+// parseVssadminSpace parses a space value, such as "1.54 GB (1%)", and returns
+// the number of bytes.
+func parseVssadminSpace(s string) (uint64, error) {
+	v, _, _ := strings.Cut(s, "(")
+	if f := strings.Fields(v); len(f) == 2 {
+		k, ok := vssadminUnits[strings.ToLower(f[1])]
+		n, err := strconv.ParseFloat(strings.Replace(f[0], ",", ".", 1), 64)
+		if ok && err == nil && n >= 0 {
+			return uint64(math.Round(n * math.Pow(1024, float64(k)))), nil
+		}
+	}
+	return 0, fmt.Errorf("vss: invalid vssadmin space value: %#q (%w)", s, os.ErrInvalid)
+}
+
+// parseVssadminTime parses a date and time in location loc. See
+// ParseVssadminShadows for the supported formats.
+func parseVssadminTime(s string, loc *time.Location) (time.Time, error) {
+	var n, w []int
+	var sep rune
+	rest := s
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(c rune) bool { return c < '0' || '9' < c })
+		if i < 0 {
+			i = len(rest)
+		}
+		if i > 0 {
+			v, _ := strconv.Atoi(rest[:i])
+			n, w = append(n, v), append(w, i)
+			rest = rest[i:]
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(rest)
+		if len(n) == 1 && sep == 0 {
+			sep = c
+		}
+		rest = rest[size:]
+	}
+	invalid := fmt.Errorf("vss: invalid vssadmin time: %#q (%w)", s, os.ErrInvalid)
+	if len(n) != 5 && len(n) != 6 {
+		return time.Time{}, invalid
+	}
+	if len(n) == 5 {
+		n = append(n, 0)
+	}
+	pm, h12 := vssadminMeridiem(s)
+	usMeridiem := strings.Contains(s, "AM") || strings.Contains(s, "PM")
+	var y, m, d int
+	switch {
+	case w[0] >= 3:
+		y, m, d = n[0], n[1], n[2]
+	case n[0] > 12 || (n[1] <= 12 && !(usMeridiem && sep == '/')):
+		d, m, y = n[0], n[1], n[2]
+	default:
+		m, d, y = n[0], n[1], n[2]
+	}
+	if y < 100 {
+		y += 2000
+	}
+	hh, mm, ss := n[3], n[4], n[5]
+	if h12 {
+		if hh < 1 || 12 < hh {
+			return time.Time{}, invalid
+		}
+		if hh %= 12; pm {
+			hh += 12
+		}
+	}
+	if m < 1 || 12 < m || d < 1 || 23 < hh || 59 < mm || 59 < ss {
+		return time.Time{}, invalid
+	}
+	t := time.Date(y, time.Month(m), d, hh, mm, ss, 0, loc)
+	if t.Day() != d {
+		return time.Time{}, invalid
+	}
+	return t, nil
+}
+
+// vssadminMeridiem returns whether time s uses a 12-hour clock and whether it
+// is after noon.
+func vssadminMeridiem(s string) (pm, h12 bool) {
+	s = strings.ToLower(s)
+	for _, m := range [...]string{"pm", "p.m.", "午後", "下午", "오후"} {
+		if strings.Contains(s, m) {
+			return true, true
+		}
+	}
+	for _, m := range [...]string{"am", "a.m.", "午前", "上午", "오전"} {
+		if strings.Contains(s, m) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// startsWithDigit returns whether s starts with an ASCII digit.
+func startsWithDigit(s string) bool {
+	return s != "" && '0' <= s[0] && s[0] <= '9'
+}
+
+// checkVssadminShadow returns an error if sc is missing required fields.
+func checkVssadminShadow(sc *ShadowCopy) error {
+	if sc != nil && (sc.VolumeName.IsZero() || sc.DeviceObject == "") {
+		return fmt.Errorf("vss: incomplete vssadmin shadow copy %s", sc.ID)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package vss
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+)
+
+// openVssadmin returns the contents of a vssadmin output file decoded by
+// toolText. The files are stored in the OEM code page of their locale, as
+// written by vssadmin when its output is redirected.
+func openVssadmin(t *testing.T, name string) io.Reader {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", "vssadmin", name))
+	require.NoError(t, err)
+	if !strings.Contains(name, "_en-") && name != "shadows_empty.txt" {
+		require.False(t, utf8.Valid(b), "%s is not in an OEM code page", name)
+	}
+	return bytes.NewReader(toolText(b, oemDecoder(name)))
+}
+
+// oemDecoder returns a function that decodes the OEM code page of the locale
+// in a testdata file name, such as "shadows_ja-JP.txt".
+func oemDecoder(name string) func(b []byte) ([]byte, error) {
+	var enc encoding.Encoding = charmap.CodePage437
+	switch {
+	case strings.Contains(name, "_de-DE"), strings.Contains(name, "_fr-FR"):
+		enc = charmap.CodePage850
+	case strings.Contains(name, "_ja-JP"):
+		enc = japanese.ShiftJIS
+	case strings.Contains(name, "_ko-KR"):
+		enc = korean.EUCKR
+	}
+	return enc.NewDecoder().Bytes
+}
+
+func TestParseVssadminShadows(t *testing.T) {
+	dev := `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`
+	set1 := mustParse(ParseSetID("{A1B2C3D4-0000-4000-8000-000000000001}"))
+	set2 := mustParse(ParseSetID("{A1B2C3D4-0000-4000-8000-000000000002}"))
+	t1 := time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC)
+	t2 := time.Date(2024, 3, 5, 9, 7, 8, 0, time.UTC)
+	want := []*ShadowCopy{{
+		ID:           mustParse(ParseShadowID("{B1B2C3D4-0000-4000-8000-000000000001}")),
+		SetID:        set1,
+		InstallDate:  t1,
+		DeviceObject: dev + "1",
+		VolumeName:   volC,
+	}, {
+		ID:           mustParse(ParseShadowID("{B1B2C3D4-0000-4000-8000-000000000002}")),
+		SetID:        set2,
+		InstallDate:  t2,
+		DeviceObject: dev + "2",
+		VolumeName:   volC,
+	}, {
+		ID:           mustParse(ParseShadowID("{B1B2C3D4-0000-4000-8000-000000000003}")),
+		SetID:        set2,
+		InstallDate:  t2,
+		DeviceObject: dev + "3",
+		VolumeName:   volD,
+	}}
+	for _, locale := range []string{"en-US", "en-GB", "en-AU", "en-CA", "de-DE", "fr-FR", "ja-JP", "ko-KR"} {
+		t.Run(locale, func(t *testing.T) {
+			all, err := ParseVssadminShadows(openVssadmin(t, "shadows_"+locale+".txt"), time.UTC)
+			require.NoError(t, err)
+			switch locale {
+			case "en-US":
+				require.Len(t, all, 3)
+				assert.Equal(t, `X:\`, all[0].ExposedName)
+				all[0].ExposedName = ""
+			case "de-DE":
+				require.Len(t, all, 3)
+				assert.Equal(t, "Snap1", all[0].ExposedName)
+				all[0].ExposedName = ""
+			}
+			assert.Equal(t, want, all)
+		})
+	}
+
+	all, err := ParseVssadminShadows(openVssadmin(t, "shadows_empty.txt"), nil)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	loc := time.FixedZone("", -5*3600)
+	all, err = ParseVssadminShadows(openVssadmin(t, "shadows_en-GB.txt"), loc)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 31, 13, 45, 6, 0, loc), all[0].InstallDate)
+}
+
+func TestParseVssadminShadowsInvalid(t *testing.T) {
+	set := "Contents of shadow copy set ID: {a1b2c3d4-0000-4000-8000-000000000001}\n"
+	for _, s := range []string{
+		set,
+		set + "   Contained 1 shadow copies at creation time: yesterday\n",
+		set + "   Contained 1 shadow copies at creation time: 2/30/2024 1:45:06 PM\n",
+		set + "   Contained 1 shadow copies at creation time: 1/31/2024 1:45:06 PM\n" +
+			"         Original Volume: (C:)\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\\n",
+		set + "   Contained 1 shadow copies at creation time: 1/31/2024 1:45:06 PM\n" +
+			"      Shadow Copy ID: {b1b2c3d4-0000-4000-8000-000000000001}\n" +
+			"         Original Volume: (C:)\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\\n",
+	} {
+		_, err := ParseVssadminShadows(strings.NewReader(s), time.UTC)
+		assert.Error(t, err, "%s", s)
+	}
+}
+
+func TestParseVssadminTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"1/31/2024 1:45:06 PM", time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC)},
+		{"3/5/2024 12:07:08 AM", time.Date(2024, 3, 5, 0, 7, 8, 0, time.UTC)},
+		{"3/5/2024 12:07:08 PM", time.Date(2024, 3, 5, 12, 7, 8, 0, time.UTC)},
+		{"05/03/2024 09:07:08", time.Date(2024, 3, 5, 9, 7, 8, 0, time.UTC)},
+		{"05.03.24 09:07", time.Date(2024, 3, 5, 9, 7, 0, 0, time.UTC)},
+		{"2024-03-05 09:07:08", time.Date(2024, 3, 5, 9, 7, 8, 0, time.UTC)},
+		{"2024-03-05 03:07:08 PM", time.Date(2024, 3, 5, 15, 7, 8, 0, time.UTC)},
+		{"2024/3/5 下午 03:07:08", time.Date(2024, 3, 5, 15, 7, 8, 0, time.UTC)},
+		{"5. 3. 2024 9:07:08", time.Date(2024, 3, 5, 9, 7, 8, 0, time.UTC)},
+		{"\u200F05/03/2024 \u200F09:07:08", time.Date(2024, 3, 5, 9, 7, 8, 0, time.UTC)},
+		{"12/13/2024 10:00:00", time.Date(2024, 12, 13, 10, 0, 0, 0, time.UTC)},
+		{"05/01/2024 8:45:06 am", time.Date(2024, 1, 5, 8, 45, 6, 0, time.UTC)},
+		{"5/01/2024 8:45:06 pm", time.Date(2024, 1, 5, 20, 45, 6, 0, time.UTC)},
+		{"1/31/2024 8:45:06 pm", time.Date(2024, 1, 31, 20, 45, 6, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		got, err := parseVssadminTime(strings.Map(dropInvisible, tc.in), time.UTC)
+		if assert.NoError(t, err, "%s", tc.in) {
+			assert.Equal(t, tc.want, got, "%s", tc.in)
+		}
+	}
+	for _, s := range []string{"", "1/31/2024", "13/13/2024 1:00:00", "1/31/2024 0:00:00 PM", "2024-02-30 00:00:00", "1/1/2024 24:00:00"} {
+		_, err := parseVssadminTime(s, time.UTC)
+		assert.ErrorIs(t, err, os.ErrInvalid, "%s", s)
+	}
+}
+
+func TestParseVssadminStorage(t *testing.T) {
+	volE := mustParse(ParseVolumeGUIDName(`\\?\Volume{33333333-3333-3333-3333-333333333333}\`))
+	want := []*Storage{{
+		Volume:         volC,
+		DiffVolume:     volC,
+		UsedSpace:      1653562409, // 1.54 GiB
+		AllocatedSpace: 2201170739,
+		MaxSpace:       25555055411,
+	}, {
+		Volume:     volD,
+		DiffVolume: volE,
+		MaxSpace:   UnboundedSpace,
+	}}
+	for _, locale := range []string{"en-US", "de-DE", "fr-FR"} {
+		t.Run(locale, func(t *testing.T) {
+			all, err := ParseVssadminStorage(openVssadmin(t, "storage_"+locale+".txt"))
+			require.NoError(t, err)
+			assert.Equal(t, want, all)
+		})
+	}
+
+	head := "Shadow Copy Storage association\n   For volume: (C:)\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\\n" +
+		"   Shadow Copy Storage volume: (C:)\\\\?\\Volume{11111111-1111-1111-1111-111111111111}\\\n"
+	for _, s := range []string{
+		head,
+		head + "   Used: 1 GB (1%)\n   Allocated: 2 GB (1%)\n",
+		head + "   Used: 1 XB (1%)\n   Allocated: 2 GB (1%)\n   Maximum: UNBOUNDED (100%)\n",
+		head + "   Used: UNBOUNDED\n   Allocated: 2 GB (1%)\n   Maximum: UNBOUNDED (100%)\n",
+	} {
+		_, err := ParseVssadminStorage(strings.NewReader(s))
+		assert.Error(t, err, "%s", s)
+	}
+}
+
+func TestParseVssadminWriters(t *testing.T) {
+	all, err := ParseVssadminWriters(openVssadmin(t, "writers_en-US.txt"))
+	require.NoError(t, err)
+	want := append([]WriterStatus(nil), testWriters...)
+	want[2].Failure = 0x800423F2 // VSS_E_WRITERERROR_TIMEOUT
+	assert.Equal(t, want, all)
+
+	all, err = ParseVssadminWriters(openVssadmin(t, "writers_de-DE.txt"))
+	require.NoError(t, err)
+	want = append([]WriterStatus(nil), testWriters...)
+	want[1].Failure = 0
+	assert.Equal(t, want, all)
+
+	_, err = ParseVssadminWriters(strings.NewReader("Writer name: 'x'\n   Writer Id: {e8132975-6f93-4464-a53e-1050253ae220}\n"))
+	assert.Error(t, err)
+	_, err = ParseVssadminWriters(strings.NewReader("Writer name: 'x'\n" +
+		"   Writer Id: {e8132975-6f93-4464-a53e-1050253ae220}\n" +
+		"   Writer Instance Id: {9e1cf4db-3f5d-4c4c-9c2a-6b47b0a7e7a1}\n" +
+		"   State: Stable\n   Last error: No error\n"))
+	assert.ErrorIs(t, err, os.ErrInvalid)
+}
+
+func TestParseVssadminProviders(t *testing.T) {
+	want := []*Provider{{
+		ID:      "{B5946137-7B9F-4925-AF80-51ABD60B20D5}",
+		Name:    "Microsoft Software Shadow Copy provider 1.0",
+		Type:    ProviderSystem,
+		Version: "1.0.0.7",
+	}, {
+		ID:      "{0C1E3F4A-5B6C-4D7E-8F90-A1B2C3D4E5F6}",
+		Name:    "Contoso Backup Provider",
+		Type:    ProviderSoftware,
+		Version: "2.3.1.0",
+	}}
+	for _, locale := range []string{"en-US", "fr-FR"} {
+		t.Run(locale, func(t *testing.T) {
+			all, err := ParseVssadminProviders(openVssadmin(t, "providers_"+locale+".txt"))
+			require.NoError(t, err)
+			assert.Equal(t, want, all)
+		})
+	}
+	_, err := ParseVssadminProviders(strings.NewReader("Provider name: 'x'\n   Provider type: System\n   Provider Id: x\n   Version: 1\n"))
+	assert.ErrorIs(t, err, os.ErrInvalid)
+}
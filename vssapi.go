@@ -0,0 +1,713 @@
+//go:build windows
+
+package vss
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	vssapi                        = windows.NewLazySystemDLL("vssapi.dll")
+	procCreateVssBackupComponents = vssapi.NewProc("CreateVssBackupComponentsInternal")
+)
+
+// asyncPollInterval is the interval at which the status of asynchronous VSS
+// operations is checked.
+const asyncPollInterval = 50 * time.Millisecond
+
+// newBackupComponents initializes the COM library and creates a new
+// IVssBackupComponents instance. The returned interface must be used from the
+// calling goroutine.
+func newBackupComponents() (_ backupComponents, err error) {
+	if !isAdmin() {
+		return nil, errNotAdmin
+	}
+	if runtime.GOARCH == "386" {
+		// https://learn.microsoft.com/en-us/windows/win32/vss/requirements-for-vss-applications
+		return nil, errors.New("vss: native VSS API is not supported by 32-bit processes")
+	}
+	if err = procCreateVssBackupComponents.Find(); err != nil {
+		return nil, fmt.Errorf("vss: failed to load CreateVssBackupComponents (%w)", err)
+	}
+	if err = initCOM(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			uninitCOM()
+		}
+	}()
+	var bc *iVssBackupComponents
+	hr, _, _ := syscall.SyscallN(procCreateVssBackupComponents.Addr(), uintptr(unsafe.Pointer(&bc)))
+	if hr := HRESULT(hr); hr.Failed() {
+		return nil, fmt.Errorf("vss: CreateVssBackupComponents failed (%w)", hr)
+	}
+	return bc, nil
+}
+
+// iVssBackupComponents is an instance of IVssBackupComponents interface.
+type iVssBackupComponents struct{ ole.IUnknown }
+
+// iVssBackupComponentsVtbl is the IVssBackupComponents method table. See
+// vsbackup.h in Windows SDK.
+type iVssBackupComponentsVtbl struct {
+	ole.IUnknownVtbl
+	GetWriterComponentsCount      uintptr
+	GetWriterComponents           uintptr
+	InitializeForBackup           uintptr
+	SetBackupState                uintptr
+	InitializeForRestore          uintptr
+	SetRestoreState               uintptr
+	GatherWriterMetadata          uintptr
+	GetWriterMetadataCount        uintptr
+	GetWriterMetadata             uintptr
+	FreeWriterMetadata            uintptr
+	AddComponent                  uintptr
+	PrepareForBackup              uintptr
+	AbortBackup                   uintptr
+	GatherWriterStatus            uintptr
+	GetWriterStatusCount          uintptr
+	FreeWriterStatus              uintptr
+	GetWriterStatus               uintptr
+	SetBackupSucceeded            uintptr
+	SetBackupOptions              uintptr
+	SetSelectedForRestore         uintptr
+	SetRestoreOptions             uintptr
+	SetAdditionalRestores         uintptr
+	SetPreviousBackupStamp        uintptr
+	SaveAsXML                     uintptr
+	BackupComplete                uintptr
+	AddAlternativeLocationMapping uintptr
+	AddRestoreSubcomponent        uintptr
+	SetFileRestoreStatus          uintptr
+	AddNewTarget                  uintptr
+	SetRangesFilePath             uintptr
+	PreRestore                    uintptr
+	PostRestore                   uintptr
+	SetContext                    uintptr
+	StartSnapshotSet              uintptr
+	AddToSnapshotSet              uintptr
+	DoSnapshotSet                 uintptr
+	DeleteSnapshots               uintptr
+	ImportSnapshots               uintptr
+	BreakSnapshotSet              uintptr
+	GetSnapshotProperties         uintptr
+	Query                         uintptr
+	IsVolumeSupported             uintptr
+	DisableWriterClasses          uintptr
+	EnableWriterClasses           uintptr
+	DisableWriterInstances        uintptr
+	ExposeSnapshot                uintptr
+	RevertToSnapshot              uintptr
+	QueryRevertStatus             uintptr
+}
+
+func (bc *iVssBackupComponents) vtbl() *iVssBackupComponentsVtbl {
+	return (*iVssBackupComponentsVtbl)(unsafe.Pointer(bc.RawVTable))
+}
+
+var iidIVssBackupComponentsEx2 = ole.NewGUID("{ACFE2B3A-22C9-4EF8-BD03-2F9CA230084E}")
+
+// iVssBackupComponentsEx2 is an instance of IVssBackupComponentsEx2 interface.
+type iVssBackupComponentsEx2 struct{ ole.IUnknown }
+
+// iVssBackupComponentsEx2Vtbl is the IVssBackupComponentsEx2 method table,
+// which extends IVssBackupComponents and IVssBackupComponentsEx.
+type iVssBackupComponentsEx2Vtbl struct {
+	iVssBackupComponentsVtbl
+	GetWriterMetadataEx     uintptr
+	SetSelectedForRestoreEx uintptr
+	UnexposeSnapshot        uintptr
+	SetAuthoritativeRestore uintptr
+	SetRollForward          uintptr
+	SetRestoreName          uintptr
+	BreakSnapshotSetEx      uintptr
+	PreFastRecovery         uintptr
+	FastRecovery            uintptr
+}
+
+func (bc *iVssBackupComponentsEx2) vtbl() *iVssBackupComponentsEx2Vtbl {
+	return (*iVssBackupComponentsEx2Vtbl)(unsafe.Pointer(bc.RawVTable))
+}
+
+// Release implements backupComponents.
+func (bc *iVssBackupComponents) Release() {
+	bc.IUnknown.Release()
+	uninitCOM()
+}
+
+// InitializeForBackup implements backupComponents.
+func (bc *iVssBackupComponents) InitializeForBackup() error {
+	hr, _, _ := syscall.SyscallN(bc.vtbl().InitializeForBackup, uintptr(unsafe.Pointer(bc)), 0)
+	return vssResult("InitializeForBackup", hr)
+}
+
+// SetContext implements backupComponents.
+func (bc *iVssBackupComponents) SetContext(attr int32) error {
+	hr, _, _ := syscall.SyscallN(bc.vtbl().SetContext, uintptr(unsafe.Pointer(bc)), uintptr(attr))
+	return vssResult("SetContext", hr)
+}
+
+// SetBackupState implements backupComponents.
+func (bc *iVssBackupComponents) SetBackupState(selectComponents bool, backupType int32) error {
+	const bootableSystemState, partialFileSupport = 0, 0
+	var sel uintptr
+	if selectComponents {
+		sel = 1
+	}
+	hr, _, _ := syscall.SyscallN(bc.vtbl().SetBackupState, uintptr(unsafe.Pointer(bc)),
+		sel, bootableSystemState, uintptr(backupType), partialFileSupport)
+	return vssResult("SetBackupState", hr)
+}
+
+// GatherWriterMetadata implements backupComponents.
+func (bc *iVssBackupComponents) GatherWriterMetadata(ctx context.Context) error {
+	return bc.async(ctx, "GatherWriterMetadata", bc.vtbl().GatherWriterMetadata)
+}
+
+// GetWriterMetadata implements backupComponents.
+func (bc *iVssBackupComponents) GetWriterMetadata() (_ []string, err error) {
+	defer func() {
+		hr, _, _ := syscall.SyscallN(bc.vtbl().FreeWriterMetadata, uintptr(unsafe.Pointer(bc)))
+		if err == nil {
+			err = vssResult("FreeWriterMetadata", hr)
+		}
+	}()
+	var n uint32
+	hr, _, _ := syscall.SyscallN(bc.vtbl().GetWriterMetadataCount, uintptr(unsafe.Pointer(bc)),
+		uintptr(unsafe.Pointer(&n)))
+	if err = vssResult("GetWriterMetadataCount", hr); err != nil {
+		return nil, err
+	}
+	all := make([]string, 0, n)
+	for i := uint32(0); i < n; i++ {
+		var instanceID ole.GUID
+		var wm *iVssExamineWriterMetadata
+		hr, _, _ := syscall.SyscallN(bc.vtbl().GetWriterMetadata, uintptr(unsafe.Pointer(bc)),
+			uintptr(i), uintptr(unsafe.Pointer(&instanceID)), uintptr(unsafe.Pointer(&wm)))
+		if err = vssResult("GetWriterMetadata", hr); err != nil {
+			return nil, err
+		}
+		doc, err := wm.saveAsXML()
+		wm.Release()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, doc)
+	}
+	return all, nil
+}
+
+// AddComponent implements backupComponents.
+func (bc *iVssBackupComponents) AddComponent(instanceID, writerID string, typ ComponentType, logicalPath, name string) error {
+	in, err := parseGUIDText(instanceID, "writer instance ID")
+	if err != nil {
+		return err
+	}
+	w, err := parseGUIDText(writerID, "writer ID")
+	if err != nil {
+		return err
+	}
+	gi, gw := in.ole(), w.ole()
+	var lp *uint16 // NULL if the component has no logical path
+	if logicalPath != "" {
+		if lp, err = utf16Ptr(logicalPath); err != nil {
+			return err
+		}
+	}
+	n, err := utf16Ptr(name)
+	if err != nil {
+		return err
+	}
+	ct := vssComponentType(typ)
+	var hr uintptr
+	if i, w := (*[2]uintptr)(unsafe.Pointer(gi)), (*[2]uintptr)(unsafe.Pointer(gw)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().AddComponent, uintptr(unsafe.Pointer(bc)),
+			i[0], i[1], w[0], w[1], ct, uintptr(unsafe.Pointer(lp)), uintptr(unsafe.Pointer(n)))
+	} else {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().AddComponent, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(gi)), uintptr(unsafe.Pointer(gw)), ct, uintptr(unsafe.Pointer(lp)),
+			uintptr(unsafe.Pointer(n)))
+	}
+	return vssResult("AddComponent", hr)
+}
+
+// GatherWriterStatus implements backupComponents.
+func (bc *iVssBackupComponents) GatherWriterStatus(ctx context.Context) (_ []WriterStatus, err error) {
+	if err = bc.async(ctx, "GatherWriterStatus", bc.vtbl().GatherWriterStatus); err != nil {
+		return nil, err
+	}
+	defer func() {
+		hr, _, _ := syscall.SyscallN(bc.vtbl().FreeWriterStatus, uintptr(unsafe.Pointer(bc)))
+		if err == nil {
+			err = vssResult("FreeWriterStatus", hr)
+		}
+	}()
+	var n uint32
+	hr, _, _ := syscall.SyscallN(bc.vtbl().GetWriterStatusCount, uintptr(unsafe.Pointer(bc)),
+		uintptr(unsafe.Pointer(&n)))
+	if err = vssResult("GetWriterStatusCount", hr); err != nil {
+		return nil, err
+	}
+	all := make([]WriterStatus, 0, n)
+	for i := uint32(0); i < n; i++ {
+		var instanceID, writerID ole.GUID
+		var name *uint16
+		var state WriterState
+		var failure HRESULT
+		hr, _, _ := syscall.SyscallN(bc.vtbl().GetWriterStatus, uintptr(unsafe.Pointer(bc)),
+			uintptr(i), uintptr(unsafe.Pointer(&instanceID)), uintptr(unsafe.Pointer(&writerID)),
+			uintptr(unsafe.Pointer(&name)), uintptr(unsafe.Pointer(&state)),
+			uintptr(unsafe.Pointer(&failure)))
+		if err = vssResult("GetWriterStatus", hr); err != nil {
+			return nil, err
+		}
+		all = append(all, WriterStatus{
+			Name:       takeBSTR(name),
+			WriterID:   writerID.String(),
+			InstanceID: instanceID.String(),
+			State:      state,
+			Failure:    failure,
+		})
+	}
+	return all, nil
+}
+
+// StartSnapshotSet implements backupComponents.
+func (bc *iVssBackupComponents) StartSnapshotSet() (SetID, error) {
+	var id ole.GUID
+	hr, _, _ := syscall.SyscallN(bc.vtbl().StartSnapshotSet, uintptr(unsafe.Pointer(bc)),
+		uintptr(unsafe.Pointer(&id)))
+	if err := vssResult("StartSnapshotSet", hr); err != nil {
+		return SetID{}, err
+	}
+	return SetID{fromOLE(&id)}, nil
+}
+
+// AddToSnapshotSet implements backupComponents.
+func (bc *iVssBackupComponents) AddToSnapshotSet(vol string) (ShadowID, error) {
+	vol, err := volumeName(sysTopology, vol)
+	if err != nil {
+		return ShadowID{}, err
+	}
+	p, err := utf16Ptr(vol)
+	if err != nil {
+		return ShadowID{}, err
+	}
+	var provider, id ole.GUID // GUID_NULL provider lets VSS choose
+	var hr uintptr
+	if g := (*[2]uintptr)(unsafe.Pointer(&provider)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().AddToSnapshotSet, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(p)), g[0], g[1], uintptr(unsafe.Pointer(&id)))
+	} else {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().AddToSnapshotSet, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&provider)), uintptr(unsafe.Pointer(&id)))
+	}
+	if err = vssResult("AddToSnapshotSet", hr); err != nil {
+		return ShadowID{}, err
+	}
+	return ShadowID{fromOLE(&id)}, nil
+}
+
+// PrepareForBackup implements backupComponents.
+func (bc *iVssBackupComponents) PrepareForBackup(ctx context.Context) error {
+	return bc.async(ctx, "PrepareForBackup", bc.vtbl().PrepareForBackup)
+}
+
+// DoSnapshotSet implements backupComponents.
+func (bc *iVssBackupComponents) DoSnapshotSet(ctx context.Context) error {
+	return bc.async(ctx, "DoSnapshotSet", bc.vtbl().DoSnapshotSet)
+}
+
+// GetSnapshotProperties implements backupComponents.
+func (bc *iVssBackupComponents) GetSnapshotProperties(id ShadowID) (*ShadowCopy, error) {
+	g := id.g.ole()
+	var prop vssSnapshotProp
+	var hr uintptr
+	if w := (*[2]uintptr)(unsafe.Pointer(g)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().GetSnapshotProperties, uintptr(unsafe.Pointer(bc)),
+			w[0], w[1], uintptr(unsafe.Pointer(&prop)))
+	} else {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().GetSnapshotProperties, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(g)), uintptr(unsafe.Pointer(&prop)))
+	}
+	if err := vssResult("GetSnapshotProperties", hr); err != nil {
+		return nil, err
+	}
+	defer prop.free()
+	return prop.shadowCopy()
+}
+
+// BackupComplete implements backupComponents.
+func (bc *iVssBackupComponents) BackupComplete(ctx context.Context) error {
+	return bc.async(ctx, "BackupComplete", bc.vtbl().BackupComplete)
+}
+
+// AbortBackup implements backupComponents.
+func (bc *iVssBackupComponents) AbortBackup() error {
+	hr, _, _ := syscall.SyscallN(bc.vtbl().AbortBackup, uintptr(unsafe.Pointer(bc)))
+	return vssResult("AbortBackup", hr)
+}
+
+// DeleteSnapshotSet implements backupComponents.
+func (bc *iVssBackupComponents) DeleteSnapshotSet(setID SetID) error {
+	const vssObjectSnapshotSet = 2 // VSS_OBJECT_SNAPSHOT_SET
+	const forceDelete = 1
+	g := setID.g.ole()
+	var deleted int32
+	var failed ole.GUID
+	var hr uintptr
+	if w := (*[2]uintptr)(unsafe.Pointer(g)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().DeleteSnapshots, uintptr(unsafe.Pointer(bc)),
+			w[0], w[1], vssObjectSnapshotSet, forceDelete,
+			uintptr(unsafe.Pointer(&deleted)), uintptr(unsafe.Pointer(&failed)))
+	} else {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().DeleteSnapshots, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(g)), vssObjectSnapshotSet, forceDelete,
+			uintptr(unsafe.Pointer(&deleted)), uintptr(unsafe.Pointer(&failed)))
+	}
+	if err := vssResult("DeleteSnapshots", hr); err != nil {
+		return fmt.Errorf("vss: failed to remove shadow copy set ID %s (%w)", setID, err)
+	}
+	return nil
+}
+
+// ExposeSnapshot implements backupComponents.
+func (bc *iVssBackupComponents) ExposeSnapshot(id ShadowID, path string, attr int32, expose string) (_ string, err error) {
+	g := id.g.ole()
+	var p, e *uint16 // NULL if empty
+	if path != "" {
+		if p, err = utf16Ptr(path); err != nil {
+			return "", err
+		}
+	}
+	if expose != "" {
+		if e, err = utf16Ptr(expose); err != nil {
+			return "", err
+		}
+	}
+	var exposed *uint16
+	var hr uintptr
+	if w := (*[2]uintptr)(unsafe.Pointer(g)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().ExposeSnapshot, uintptr(unsafe.Pointer(bc)),
+			w[0], w[1], uintptr(unsafe.Pointer(p)), uintptr(attr), uintptr(unsafe.Pointer(e)),
+			uintptr(unsafe.Pointer(&exposed)))
+	} else {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().ExposeSnapshot, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(g)), uintptr(unsafe.Pointer(p)), uintptr(attr),
+			uintptr(unsafe.Pointer(e)), uintptr(unsafe.Pointer(&exposed)))
+	}
+	if err = vssResult("ExposeSnapshot", hr); err != nil {
+		return "", err
+	}
+	if exposed == nil {
+		return expose, nil
+	}
+	defer ole.CoTaskMemFree(uintptr(unsafe.Pointer(exposed)))
+	return windows.UTF16PtrToString(exposed), nil
+}
+
+// UnexposeSnapshot implements backupComponents.
+func (bc *iVssBackupComponents) UnexposeSnapshot(id ShadowID) error {
+	g := id.g.ole()
+	var ex2 *iVssBackupComponentsEx2
+	hr, _, _ := syscall.SyscallN(bc.vtbl().QueryInterface, uintptr(unsafe.Pointer(bc)),
+		uintptr(unsafe.Pointer(iidIVssBackupComponentsEx2)), uintptr(unsafe.Pointer(&ex2)))
+	if err := vssResult("QueryInterface(IVssBackupComponentsEx2)", hr); err != nil {
+		return err
+	}
+	defer ex2.Release()
+	if w := (*[2]uintptr)(unsafe.Pointer(g)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(ex2.vtbl().UnexposeSnapshot, uintptr(unsafe.Pointer(ex2)),
+			w[0], w[1])
+	} else {
+		hr, _, _ = syscall.SyscallN(ex2.vtbl().UnexposeSnapshot, uintptr(unsafe.Pointer(ex2)),
+			uintptr(unsafe.Pointer(g)))
+	}
+	return vssResult("UnexposeSnapshot", hr)
+}
+
+// SaveAsXML implements backupComponents.
+func (bc *iVssBackupComponents) SaveAsXML() (string, error) {
+	var bstr *uint16
+	hr, _, _ := syscall.SyscallN(bc.vtbl().SaveAsXML, uintptr(unsafe.Pointer(bc)),
+		uintptr(unsafe.Pointer(&bstr)))
+	if err := vssResult("SaveAsXML", hr); err != nil {
+		return "", err
+	}
+	return takeBSTR(bstr), nil
+}
+
+// InitializeForRestore implements backupComponents.
+func (bc *iVssBackupComponents) InitializeForRestore(doc string) error {
+	if strings.IndexByte(doc, 0) >= 0 {
+		return fmt.Errorf("vss: invalid backup components document (%w)", syscall.EINVAL)
+	}
+	bstr := ole.SysAllocString(doc)
+	if bstr == nil {
+		return fmt.Errorf("vss: failed to allocate backup components document (%w)", HRESULT(ole.E_OUTOFMEMORY))
+	}
+	defer func() { _ = ole.SysFreeString(bstr) }()
+	hr, _, _ := syscall.SyscallN(bc.vtbl().InitializeForRestore, uintptr(unsafe.Pointer(bc)),
+		uintptr(unsafe.Pointer(bstr)))
+	return vssResult("InitializeForRestore", hr)
+}
+
+// SetSelectedForRestore implements backupComponents.
+func (bc *iVssBackupComponents) SetSelectedForRestore(writerID string, typ ComponentType, logicalPath, name string) error {
+	const selected = 1
+	ct := vssComponentType(typ)
+	w, err := parseGUIDText(writerID, "writer ID")
+	if err != nil {
+		return err
+	}
+	g := w.ole()
+	var lp *uint16 // NULL if the component has no logical path
+	if logicalPath != "" {
+		if lp, err = utf16Ptr(logicalPath); err != nil {
+			return err
+		}
+	}
+	n, err := utf16Ptr(name)
+	if err != nil {
+		return err
+	}
+	var hr uintptr
+	if w := (*[2]uintptr)(unsafe.Pointer(g)); runtime.GOARCH == "arm64" {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().SetSelectedForRestore, uintptr(unsafe.Pointer(bc)),
+			w[0], w[1], ct, uintptr(unsafe.Pointer(lp)), uintptr(unsafe.Pointer(n)), selected)
+	} else {
+		hr, _, _ = syscall.SyscallN(bc.vtbl().SetSelectedForRestore, uintptr(unsafe.Pointer(bc)),
+			uintptr(unsafe.Pointer(g)), ct, uintptr(unsafe.Pointer(lp)), uintptr(unsafe.Pointer(n)), selected)
+	}
+	if err = vssResult("SetSelectedForRestore", hr); err != nil {
+		return fmt.Errorf("vss: failed to select component %s for restore (%w)", fullPath(logicalPath, name), err)
+	}
+	return nil
+}
+
+// vssComponentType returns the VSS_COMPONENT_TYPE value of typ.
+func vssComponentType(typ ComponentType) uintptr {
+	const vssCtDatabase, vssCtFilegroup = 1, 2
+	if typ == ComponentFileGroup {
+		return vssCtFilegroup
+	}
+	return vssCtDatabase
+}
+
+// PreRestore implements backupComponents.
+func (bc *iVssBackupComponents) PreRestore(ctx context.Context) error {
+	return bc.async(ctx, "PreRestore", bc.vtbl().PreRestore)
+}
+
+// PostRestore implements backupComponents.
+func (bc *iVssBackupComponents) PostRestore(ctx context.Context) error {
+	return bc.async(ctx, "PostRestore", bc.vtbl().PostRestore)
+}
+
+// async calls an IVssBackupComponents method that returns IVssAsync and waits
+// for the operation to finish.
+func (bc *iVssBackupComponents) async(ctx context.Context, name string, method uintptr) error {
+	var a *iVssAsync
+	hr, _, _ := syscall.SyscallN(method, uintptr(unsafe.Pointer(bc)), uintptr(unsafe.Pointer(&a)))
+	if err := vssResult(name, hr); err != nil {
+		return err
+	}
+	defer a.Release()
+	if err := a.wait(ctx); err != nil {
+		return fmt.Errorf("vss: IVssBackupComponents.%s failed (%w)", name, err)
+	}
+	return nil
+}
+
+// iVssExamineWriterMetadata is an instance of IVssExamineWriterMetadata
+// interface.
+type iVssExamineWriterMetadata struct{ ole.IUnknown }
+
+// iVssExamineWriterMetadataVtbl is the IVssExamineWriterMetadata method table.
+type iVssExamineWriterMetadataVtbl struct {
+	ole.IUnknownVtbl
+	GetIdentity                 uintptr
+	GetFileCounts               uintptr
+	GetIncludeFile              uintptr
+	GetExcludeFile              uintptr
+	GetComponent                uintptr
+	GetRestoreMethod            uintptr
+	GetAlternateLocationMapping uintptr
+	GetBackupSchema             uintptr
+	GetDocument                 uintptr
+	SaveAsXML                   uintptr
+	LoadFromXML                 uintptr
+}
+
+func (wm *iVssExamineWriterMetadata) vtbl() *iVssExamineWriterMetadataVtbl {
+	return (*iVssExamineWriterMetadataVtbl)(unsafe.Pointer(wm.RawVTable))
+}
+
+// saveAsXML returns the Writer Metadata Document in XML format.
+func (wm *iVssExamineWriterMetadata) saveAsXML() (string, error) {
+	var bstr *uint16
+	hr, _, _ := syscall.SyscallN(wm.vtbl().SaveAsXML, uintptr(unsafe.Pointer(wm)),
+		uintptr(unsafe.Pointer(&bstr)))
+	if hr := HRESULT(hr); hr.Failed() {
+		return "", fmt.Errorf("vss: IVssExamineWriterMetadata.SaveAsXML failed (%w)", hr)
+	}
+	return takeBSTR(bstr), nil
+}
+
+// iVssAsync is an instance of IVssAsync interface.
+type iVssAsync struct{ ole.IUnknown }
+
+// iVssAsyncVtbl is the IVssAsync method table.
+type iVssAsyncVtbl struct {
+	ole.IUnknownVtbl
+	Cancel      uintptr
+	Wait        uintptr
+	QueryStatus uintptr
+}
+
+func (a *iVssAsync) vtbl() *iVssAsyncVtbl {
+	return (*iVssAsyncVtbl)(unsafe.Pointer(a.RawVTable))
+}
+
+// wait waits for the asynchronous operation to finish. If ctx is done, the
+// operation is cancelled and ctx.Err() is returned once the cancellation is
+// complete.
+func (a *iVssAsync) wait(ctx context.Context) error {
+	var cancelled bool
+	for {
+		var status HRESULT
+		hr, _, _ := syscall.SyscallN(a.vtbl().QueryStatus, uintptr(unsafe.Pointer(a)),
+			uintptr(unsafe.Pointer(&status)), 0)
+		if hr := HRESULT(hr); hr.Failed() {
+			return hr
+		}
+		switch status {
+		case vssAsyncPending:
+		case vssAsyncFinished:
+			return nil
+		case vssAsyncCancelled:
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return status
+		default:
+			if status.Failed() {
+				return status
+			}
+			return nil
+		}
+		if !cancelled && ctx.Err() != nil {
+			cancelled = true
+			_, _, _ = syscall.SyscallN(a.vtbl().Cancel, uintptr(unsafe.Pointer(a)))
+		}
+		time.Sleep(asyncPollInterval)
+	}
+}
+
+// vssSnapshotProp is the VSS_SNAPSHOT_PROP structure.
+type vssSnapshotProp struct {
+	SnapshotID           ole.GUID
+	SnapshotSetID        ole.GUID
+	SnapshotsCount       int32
+	SnapshotDeviceObject *uint16
+	OriginalVolumeName   *uint16
+	OriginatingMachine   *uint16
+	ServiceMachine       *uint16
+	ExposedName          *uint16
+	ExposedPath          *uint16
+	ProviderID           ole.GUID
+	SnapshotAttributes   int32
+	CreationTimestamp    int64
+	Status               int32
+}
+
+// shadowCopy converts p into a ShadowCopy.
+func (p *vssSnapshotProp) shadowCopy() (*ShadowCopy, error) {
+	ft := syscall.Filetime{
+		LowDateTime:  uint32(p.CreationTimestamp),
+		HighDateTime: uint32(p.CreationTimestamp >> 32),
+	}
+	vol, err := ParseVolumeGUIDName(windows.UTF16PtrToString(p.OriginalVolumeName))
+	if err != nil {
+		return nil, err
+	}
+	return &ShadowCopy{
+		ID:           ShadowID{fromOLE(&p.SnapshotID)},
+		SetID:        SetID{fromOLE(&p.SnapshotSetID)},
+		ProviderID:   p.ProviderID.String(),
+		InstallDate:  time.Unix(0, ft.Nanoseconds()),
+		DeviceObject: windows.UTF16PtrToString(p.SnapshotDeviceObject),
+		VolumeName:   vol,
+		ExposedName:  windows.UTF16PtrToString(p.ExposedName),
+		ExposedPath:  windows.UTF16PtrToString(p.ExposedPath),
+	}, nil
+}
+
+// free releases the strings allocated by VSS. This is equivalent to
+// VssFreeSnapshotProperties.
+func (p *vssSnapshotProp) free() {
+	for _, s := range []**uint16{
+		&p.SnapshotDeviceObject,
+		&p.OriginalVolumeName,
+		&p.OriginatingMachine,
+		&p.ServiceMachine,
+		&p.ExposedName,
+		&p.ExposedPath,
+	} {
+		if *s != nil {
+			ole.CoTaskMemFree(uintptr(unsafe.Pointer(*s)))
+			*s = nil
+		}
+	}
+}
+
+// vssResult converts the HRESULT returned by an IVssBackupComponents method
+// into an error.
+func vssResult(method string, hr uintptr) error {
+	if hr := HRESULT(hr); hr.Failed() {
+		return fmt.Errorf("vss: IVssBackupComponents.%s failed (%w)", method, hr)
+	}
+	return nil
+}
+
+// takeBSTR converts a BSTR returned by a COM method into a string and frees
+// it.
+func takeBSTR(bstr *uint16) string {
+	if bstr == nil {
+		return ""
+	}
+	s := ole.BstrToString(bstr)
+	_ = ole.SysFreeString((*int16)(unsafe.Pointer(bstr)))
+	return s
+}
+
+// ole converts g into the COM GUID structure.
+func (g guid) ole() *ole.GUID {
+	return &ole.GUID{
+		Data1: binary.BigEndian.Uint32(g[0:4]),
+		Data2: binary.BigEndian.Uint16(g[4:6]),
+		Data3: binary.BigEndian.Uint16(g[6:8]),
+		Data4: [8]byte(g[8:16]),
+	}
+}
+
+// fromOLE converts a COM GUID structure into a guid.
+func fromOLE(g *ole.GUID) (b guid) {
+	binary.BigEndian.PutUint32(b[0:4], g.Data1)
+	binary.BigEndian.PutUint16(b[4:6], g.Data2)
+	binary.BigEndian.PutUint16(b[6:8], g.Data3)
+	copy(b[8:], g.Data4[:])
+	return
+}
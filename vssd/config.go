@@ -0,0 +1,270 @@
+package vssd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-vss"
+)
+
+// Config is the declarative daemon configuration, normally loaded from a JSON
+// file by LoadConfig. See testdata/config.json for an example.
+type Config struct {
+	// TimeZone is the IANA name of the time zone used to interpret schedules,
+	// maintenance windows, and retention periods. Empty means local time.
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Status is the path of a JSON file that is updated with the status of
+	// all volumes after every run. It also records the shadow copies created
+	// by the daemon, so that retention continues to apply to them after a
+	// restart. Empty disables the status file.
+	Status string `json:"status,omitempty"`
+
+	// Volumes are the volumes to snapshot.
+	Volumes []*VolumeConfig `json:"volumes"`
+
+	loc *time.Location
+}
+
+// VolumeConfig is the configuration of one volume.
+type VolumeConfig struct {
+	// Volume is the volume to snapshot, such as `C:\`.
+	Volume string `json:"volume"`
+
+	// Schedule is a cron expression that determines when shadow copies are
+	// created. See Schedule.
+	Schedule string `json:"schedule"`
+
+	// Jitter delays each run by a random duration in the range [0, Jitter) to
+	// avoid creating shadow copies of many volumes or hosts at the same time.
+	// Runs delayed past the end of their maintenance window are skipped.
+	Jitter Duration `json:"jitter,omitempty"`
+
+	// Windows are maintenance windows. If any are specified, scheduled runs
+	// outside of all windows are skipped.
+	Windows []*Window `json:"windows,omitempty"`
+
+	// Retention is the policy applied after each run. If nil, no shadow
+	// copies are removed. Otherwise, it only applies to shadow copies created
+	// by the daemon unless Retention.Foreign is set.
+	Retention *Retention `json:"retention,omitempty"`
+
+	// Hooks are commands that run before and after each shadow copy is
+	// created.
+	Hooks Hooks `json:"hooks"`
+
+	sched *Schedule
+}
+
+// Window is a daily maintenance window. If End is not after Start, the window
+// ends on the following day.
+type Window struct {
+	Days  string `json:"days,omitempty"` // Days of week in cron syntax, such as "mon-fri"; empty means all
+	Start string `json:"start"`          // Start time as "HH:MM"
+	End   string `json:"end"`            // End time as "HH:MM"
+
+	days       uint64
+	start, end int // Minutes since midnight
+}
+
+// Retention is the configuration of a vss.Policy.
+type Retention struct {
+	Last     int      `json:"last,omitempty"`
+	Hourly   int      `json:"hourly,omitempty"`
+	Daily    int      `json:"daily,omitempty"`
+	Weekly   int      `json:"weekly,omitempty"`
+	Monthly  int      `json:"monthly,omitempty"`
+	Yearly   int      `json:"yearly,omitempty"`
+	Within   Duration `json:"within,omitempty"`
+	MaxCount int      `json:"maxCount,omitempty"`
+
+	// Foreign applies the policy to all shadow copies of the volume,
+	// including System Restore points and shadow copies created by other
+	// programs, which are removed if the policy does not keep them.
+	Foreign bool `json:"foreign,omitempty"`
+}
+
+// Hooks are commands that run around shadow copy creation. Each command is a
+// program name followed by its arguments. Pre commands run before creation and
+// a failure of any of them cancels the run. Post commands run after successful
+// creation with the VSS_VOLUME, VSS_SHADOW_ID, and VSS_DEVICE_OBJECT
+// environment variables describing the new shadow copy.
+type Hooks struct {
+	Pre  [][]string `json:"pre,omitempty"`
+	Post [][]string `json:"post,omitempty"`
+}
+
+// Duration is a time.Duration encoded as a string, such as "1h30m".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return fmt.Errorf("vssd: invalid duration %q", b)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig reads and validates a JSON configuration file. Unknown fields are
+// rejected.
+func LoadConfig(name string) (*Config, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("vssd: failed to read config (%w)", err)
+	}
+	return ParseConfig(b)
+}
+
+// ParseConfig parses and validates a JSON configuration.
+func ParseConfig(b []byte) (*Config, error) {
+	var c Config
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("vssd: invalid config (%w)", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks the entire configuration and returns an error describing
+// every problem found. It must be called before a Config that was not returned
+// by LoadConfig or ParseConfig is used.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field string, err error) {
+		errs = append(errs, fmt.Errorf("%s: %w", field, err))
+	}
+	var err error
+	if c.loc = time.Local; c.TimeZone != "" {
+		if c.loc, err = time.LoadLocation(c.TimeZone); err != nil {
+			fail("timeZone", err)
+		}
+	}
+	if len(c.Volumes) == 0 {
+		fail("volumes", errors.New("no volumes configured"))
+	}
+	seen := make(map[string]int, len(c.Volumes))
+	for i, v := range c.Volumes {
+		field := "volumes[" + strconv.Itoa(i) + "]"
+		if v == nil {
+			fail(field, errors.New("null volume"))
+			continue
+		}
+		if v.Volume == "" {
+			fail(field+".volume", errors.New("empty volume"))
+		} else if j, dup := seen[strings.ToUpper(v.Volume)]; dup {
+			fail(field+".volume", fmt.Errorf("%#q is also configured in volumes[%d]", v.Volume, j))
+		} else {
+			seen[strings.ToUpper(v.Volume)] = i
+		}
+		if v.sched, err = ParseSchedule(v.Schedule); err != nil {
+			fail(field+".schedule", err)
+		}
+		if v.Jitter < 0 {
+			fail(field+".jitter", errors.New("negative jitter"))
+		}
+		for j, w := range v.Windows {
+			if err = w.parse(); err != nil {
+				fail(field+".windows["+strconv.Itoa(j)+"]", err)
+			}
+		}
+		if v.Retention != nil {
+			if err = v.Retention.policy(c.loc).Validate(); err != nil {
+				fail(field+".retention", err)
+			}
+		}
+		for _, h := range []struct {
+			name string
+			cmds [][]string
+		}{{"pre", v.Hooks.Pre}, {"post", v.Hooks.Post}} {
+			for j, cmd := range h.cmds {
+				if len(cmd) == 0 || cmd[0] == "" {
+					fail(fmt.Sprintf("%s.hooks.%s[%d]", field, h.name, j), errors.New("empty command"))
+				}
+			}
+		}
+	}
+	if err = errors.Join(errs...); err != nil {
+		return fmt.Errorf("vssd: invalid config (%w)", err)
+	}
+	return nil
+}
+
+// Location returns the time zone of the configuration.
+func (c *Config) Location() *time.Location {
+	if c.loc == nil {
+		return time.Local
+	}
+	return c.loc
+}
+
+// contains returns whether t is inside the window. The window must be parsed.
+func (w *Window) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	today := w.days&(1<<uint(t.Weekday())) != 0
+	if w.start < w.end {
+		return today && w.start <= m && m < w.end
+	}
+	yesterday := w.days&(1<<uint((t.Weekday()+6)%7)) != 0
+	return (today && w.start <= m) || (yesterday && m < w.end)
+}
+
+// parse validates the window and sets its unexported fields.
+func (w *Window) parse() (err error) {
+	if w == nil {
+		return errors.New("null window")
+	}
+	if w.days = 1<<7 - 1; w.Days != "" {
+		if w.days, err = cronDOW.parse(w.Days); err != nil {
+			return err
+		}
+		if w.days&(1<<7) != 0 {
+			w.days |= 1
+		}
+	}
+	if w.start, err = parseClock(w.Start); err == nil {
+		w.end, err = parseClock(w.End)
+	}
+	return
+}
+
+// parseClock parses a time of day in the "HH:MM" format and returns the number
+// of minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// policy returns the equivalent vss.Policy.
+func (r *Retention) policy(loc *time.Location) *vss.Policy {
+	return &vss.Policy{
+		Last:     r.Last,
+		Hourly:   r.Hourly,
+		Daily:    r.Daily,
+		Weekly:   r.Weekly,
+		Monthly:  r.Monthly,
+		Yearly:   r.Yearly,
+		Within:   time.Duration(r.Within),
+		MaxCount: r.MaxCount,
+		Location: loc,
+	}
+}
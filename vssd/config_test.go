@@ -0,0 +1,99 @@
+package vssd
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig(filepath.Join("testdata", "config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "America/New_York", c.Location().String())
+	require.Len(t, c.Volumes, 2)
+	v := c.Volumes[0]
+	assert.Equal(t, `C:\`, v.Volume)
+	assert.Equal(t, Duration(5*time.Minute), v.Jitter)
+	assert.Equal(t, &Retention{Last: 3, Daily: 7, Weekly: 4, Monthly: 6, MaxCount: 60}, v.Retention)
+	assert.Equal(t, [][]string{{`C:\Scripts\backup.cmd`, "--quiet"}}, v.Hooks.Post)
+	assert.NotNil(t, v.sched)
+	v = c.Volumes[1]
+	assert.Equal(t, Duration(72*time.Hour), v.Retention.Within)
+	require.Len(t, v.Windows, 1)
+	assert.Equal(t, 22*60, v.Windows[0].start)
+
+	_, err = LoadConfig(filepath.Join("testdata", "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	c, err := ParseConfig([]byte(`{"volumes": [{"volume": "C:\\", "schedule": "@daily"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Local, c.Location())
+
+	_, err = ParseConfig([]byte(`{"volumes": [], "extra": 1}`))
+	assert.ErrorContains(t, err, "extra")
+	_, err = ParseConfig([]byte(`{"volumes": [{"volume": "C:\\", "jitter": "soon"}]}`))
+	assert.ErrorContains(t, err, "soon")
+
+	// All problems are reported at once
+	_, err = ParseConfig([]byte(`{
+		"timeZone": "Nowhere/Special",
+		"volumes": [
+			{"volume": "C:\\", "schedule": "@daily"},
+			{"volume": "c:\\", "schedule": "61 * * * *", "jitter": "-1m"},
+			{"volume": "", "schedule": "@daily", "retention": {}},
+			{"volume": "E:\\", "schedule": "@daily", "windows": [{"start": "25:00", "end": "01:00"}]},
+			{"volume": "F:\\", "schedule": "@daily", "hooks": {"pre": [[]], "post": [[""]]}},
+			null
+		]
+	}`))
+	require.Error(t, err)
+	for _, want := range []string{
+		"timeZone:",
+		"volumes[1].volume:",
+		"volumes[1].schedule:",
+		"volumes[1].jitter:",
+		"volumes[2].volume:",
+		"volumes[2].retention:",
+		"volumes[3].windows[0]:",
+		"volumes[4].hooks.pre[0]:",
+		"volumes[4].hooks.post[0]:",
+		"volumes[5]:",
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+	_, err = ParseConfig([]byte(`{}`))
+	assert.ErrorContains(t, err, "no volumes")
+}
+
+func TestWindow(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 1, day, hour, min, 0, 0, time.UTC) // Jan 1 is Monday
+	}
+	w := &Window{Days: "mon-fri", Start: "22:00", End: "06:00"}
+	require.NoError(t, w.parse())
+	assert.True(t, w.contains(at(1, 22, 0)))
+	assert.True(t, w.contains(at(2, 5, 59)))
+	assert.False(t, w.contains(at(2, 6, 0)))
+	assert.False(t, w.contains(at(1, 21, 59)))
+	assert.True(t, w.contains(at(6, 5, 0)))   // Saturday morning after Friday
+	assert.False(t, w.contains(at(6, 22, 0))) // Saturday night
+	assert.False(t, w.contains(at(1, 5, 0)))  // Monday morning after Sunday
+
+	w = &Window{Start: "09:00", End: "17:30"}
+	require.NoError(t, w.parse())
+	assert.True(t, w.contains(at(7, 17, 29)))
+	assert.False(t, w.contains(at(7, 17, 30)))
+
+	for _, w := range []*Window{
+		{Start: "24:00", End: "17:00"},
+		{Start: "09:00"},
+		{Days: "weekdays", Start: "09:00", End: "17:00"},
+	} {
+		assert.Error(t, w.parse())
+	}
+}
@@ -0,0 +1,187 @@
+package vssd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCronYears limits how far into the future Schedule.Next searches before
+// concluding that a schedule never fires, such as "0 0 30 2 *".
+const maxCronYears = 5
+
+// Schedule is a parsed cron expression with five fields: minute, hour, day of
+// month, month, and day of week. Each field is "*", a number or name, a range
+// "a-b", or a comma-separated list of those, and each item can have a "/step"
+// suffix. Month and weekday names are the first three letters of the English
+// name. Sunday is 0 or 7. If both day fields are restricted, a day matches if
+// either one does. The macros @yearly, @annually, @monthly, @weekly, @daily,
+// @midnight, and @hourly are also accepted.
+type Schedule struct {
+	min, hour, dom, month, dow uint64
+	domStar, dowStar           bool
+	expr                       string
+}
+
+// cronField describes the range of values of a cron field.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // Names of values starting at min
+}
+
+var (
+	cronMinute = cronField{"minute", 0, 59, nil}
+	cronHour   = cronField{"hour", 0, 23, nil}
+	cronDOM    = cronField{"day of month", 1, 31, nil}
+	cronMonth  = cronField{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may",
+		"jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	cronDOW = cronField{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu",
+		"fri", "sat"}}
+)
+
+// cronMacros maps macros to equivalent expressions.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a cron expression.
+func ParseSchedule(expr string) (*Schedule, error) {
+	s := &Schedule{expr: expr}
+	e := strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(e)]; ok {
+		e = m
+	}
+	f := strings.Fields(e)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("vssd: cron expression %q must have 5 fields", expr)
+	}
+	var err error
+	for i, p := range []struct {
+		set  *uint64
+		star *bool
+		fld  *cronField
+	}{
+		{&s.min, nil, &cronMinute},
+		{&s.hour, nil, &cronHour},
+		{&s.dom, &s.domStar, &cronDOM},
+		{&s.month, nil, &cronMonth},
+		{&s.dow, &s.dowStar, &cronDOW},
+	} {
+		if *p.set, err = p.fld.parse(f[i]); err != nil {
+			return nil, fmt.Errorf("vssd: invalid cron expression %q (%w)", expr, err)
+		}
+		if p.star != nil {
+			*p.star = f[i] == "*" || strings.HasPrefix(f[i], "*/")
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// String returns the original expression.
+func (s *Schedule) String() string { return s.expr }
+
+// Next returns the first time after t that matches the schedule, in the
+// location of t. It returns the zero time if there is no such time within
+// maxCronYears.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(maxCronYears, 0, 0)
+	for t.Before(end) {
+		y, mo, d := t.Date()
+		switch {
+		case s.month&(1<<uint(mo)) == 0:
+			t = advance(t, time.Date(y, mo+1, 1, 0, 0, 0, 0, loc))
+		case !s.dayMatches(t):
+			t = advance(t, time.Date(y, mo, d+1, 0, 0, 0, 0, loc))
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = advance(t, time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc))
+		case s.min&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// advance returns next if it is after t. Otherwise, next is a local time that
+// was skipped by a daylight saving time transition and normalized backwards, so
+// the start of the hour following t is returned instead.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// dayMatches returns whether the date of t matches the day fields.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parse returns the set of values selected by field expression e.
+func (f *cronField) parse(e string) (set uint64, err error) {
+	for _, item := range strings.Split(e, ",") {
+		r, step, hasStep := strings.Cut(item, "/")
+		lo, hi := f.min, f.max
+		switch {
+		case r == "*":
+		case strings.Contains(r, "-"):
+			a, b, _ := strings.Cut(r, "-")
+			if lo, err = f.value(a); err == nil {
+				hi, err = f.value(b)
+			}
+			if err == nil && hi < lo {
+				err = fmt.Errorf("invalid %s range %q", f.name, r)
+			}
+		default:
+			if lo, err = f.value(r); err == nil && !hasStep {
+				hi = lo
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		n := 1
+		if hasStep {
+			if n, err = strconv.Atoi(step); err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, step)
+			}
+		}
+		for v := lo; v <= hi; v += n {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// value parses a single field value.
+func (f *cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || f.max < v {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
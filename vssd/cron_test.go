@@ -0,0 +1,86 @@
+package vssd
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2024, 1, 31, 13, 45, 30, 0, time.UTC) // Wednesday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 13, 46, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2024, 1, 31, 14, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 14, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, 1, 31, 14, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 31, 14, 5, 0, 0, time.UTC)},
+		{"45 13 * * *", time.Date(2024, 2, 1, 13, 45, 0, 0, time.UTC)},
+		{"0 0 * * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 2, 4, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 1,15 * *", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 29 feb *", time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{"0 9 31 * *", time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12-14/2 * * *", time.Date(2024, 1, 31, 14, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tc := range tests {
+		s, err := ParseSchedule(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.want, s.Next(from), tc.expr)
+		assert.Equal(t, tc.expr, s.String())
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	s, err := ParseSchedule("30 2 * * *")
+	require.NoError(t, err)
+
+	// 2:30 does not exist on the day DST starts
+	got := s.Next(time.Date(2024, 3, 9, 12, 0, 0, 0, ny))
+	assert.Equal(t, time.Date(2024, 3, 11, 2, 30, 0, 0, ny), got)
+	s, err = ParseSchedule("* * * * *")
+	require.NoError(t, err)
+	got = s.Next(time.Date(2024, 3, 10, 1, 59, 0, 0, ny))
+	assert.Equal(t, time.Date(2024, 3, 10, 3, 0, 0, 0, ny), got)
+
+	// Half-hour offsets
+	ist := time.FixedZone("IST", 5*3600+1800)
+	s, err = ParseSchedule("0 * * * *")
+	require.NoError(t, err)
+	got = s.Next(time.Date(2024, 1, 31, 10, 15, 0, 0, ist))
+	assert.Equal(t, time.Date(2024, 1, 31, 11, 0, 0, 0, ist), got)
+	assert.Equal(t, "2024-01-31T05:30:00Z", got.UTC().Format(time.RFC3339))
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@reboot",
+	} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
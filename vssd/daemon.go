@@ -0,0 +1,399 @@
+// Package vssd implements a daemon that creates shadow copies on a schedule
+// and removes old ones according to a retention policy.
+package vssd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-vss"
+)
+
+// Backend is the shadow copy service used by the daemon.
+type Backend interface {
+	Create(ctx context.Context, vol string) (*vss.ShadowCopy, error)
+	List(ctx context.Context, vol string) ([]*vss.ShadowCopy, error)
+	Remove(ctx context.Context, id vss.ShadowID) error
+}
+
+// Clock is the source of time used by the daemon.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// sysClock is the Clock backed by package time.
+type sysClock struct{}
+
+func (sysClock) Now() time.Time                         { return time.Now() }
+func (sysClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Status is the status of one configured volume.
+type Status struct {
+	Volume      string       `json:"volume"`
+	NextRun     time.Time    `json:"nextRun"`     // Zero if the schedule never fires
+	LastRun     time.Time    `json:"lastRun"`     // Start of the last run
+	LastSuccess time.Time    `json:"lastSuccess"` // Start of the last successful run
+	LastShadow  vss.ShadowID `json:"lastShadowId"`
+	LastError   string       `json:"lastError,omitempty"`
+	Runs        int          `json:"runs"`
+	Failures    int          `json:"failures"`
+	Removed     int          `json:"removed"` // Shadow copies removed by retention
+
+	// Shadows are the IDs of shadow copies created by the daemon that have
+	// not been removed. Retention only applies to these unless
+	// Retention.Foreign is set. They are restored from the status file when
+	// the daemon is created.
+	Shadows []vss.ShadowID `json:"shadowIds,omitempty"`
+}
+
+// Daemon creates shadow copies of the configured volumes on their schedules.
+type Daemon struct {
+	cfg    *Config
+	b      Backend
+	clock  Clock
+	jitter func(n time.Duration) time.Duration
+	hook   func(ctx context.Context, cmd, env []string) error
+	logf   func(format string, v ...any)
+
+	mu   sync.Mutex
+	jobs []*job
+}
+
+// job is the state of one configured volume.
+type job struct {
+	cfg    *VolumeConfig
+	policy *vss.Policy
+	sched  time.Time // Next scheduled time
+	due    time.Time // Next scheduled time with jitter
+	status Status
+}
+
+// New returns a daemon that uses backend b to implement configuration cfg.
+// The configuration is validated first. Use System for the real backend.
+func New(cfg *Config, b Backend) (*Daemon, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	d := &Daemon{
+		cfg:   cfg,
+		b:     b,
+		clock: sysClock{},
+		jitter: func(n time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(n)))
+		},
+		hook: runHook,
+		logf: log.Printf,
+		jobs: make([]*job, len(cfg.Volumes)),
+	}
+	for i, v := range cfg.Volumes {
+		j := &job{cfg: v, status: Status{Volume: v.Volume}}
+		if v.Retention != nil {
+			j.policy = v.Retention.policy(cfg.Location())
+		}
+		d.jobs[i] = j
+	}
+	if err := d.loadStatus(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// maxLate is how much later than its due time a run may start after waiting
+// for it. Later runs are considered missed, for example because the system was
+// suspended.
+const maxLate = time.Minute
+
+// Run creates shadow copies on schedule until ctx is canceled. Runs that were
+// missed because the system was suspended and runs that would start outside of
+// all maintenance windows, such as when delayed by jitter, are skipped. Each
+// run executes the pre hooks, creates a shadow copy, executes the post hooks,
+// applies the retention policy, and updates the status file. Run failures are
+// reported via the status and the standard logger and do not stop the daemon.
+func (d *Daemon) Run(ctx context.Context) error {
+	now := d.clock.Now()
+	d.mu.Lock()
+	for _, j := range d.jobs {
+		d.schedule(j, now)
+	}
+	d.mu.Unlock()
+	d.writeStatus()
+	for {
+		j := d.next()
+		if j == nil {
+			return errors.New("vssd: no runs are scheduled")
+		}
+		now, waited := d.clock.Now(), false
+		if wait := j.due.Sub(now); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-d.clock.After(wait):
+			}
+			now, waited = d.clock.Now(), true
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if late := now.Sub(j.due); waited && late > maxLate {
+			d.logf("vssd: skipped run for %#q scheduled at %v (%v late)", j.cfg.Volume, j.due, late)
+		} else if !j.cfg.inWindows(now.In(d.cfg.Location())) {
+			d.logf("vssd: skipped run for %#q scheduled at %v (outside of maintenance windows)", j.cfg.Volume, j.due)
+		} else {
+			d.run(ctx, j)
+		}
+		d.mu.Lock()
+		d.schedule(j, d.clock.Now())
+		d.mu.Unlock()
+		d.writeStatus()
+	}
+}
+
+// Status returns the status of all configured volumes in configuration order.
+func (d *Daemon) Status() []Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	all := make([]Status, len(d.jobs))
+	for i, j := range d.jobs {
+		all[i] = j.status
+		all[i].Shadows = slices.Clone(j.status.Shadows)
+	}
+	return all
+}
+
+// next returns the job that is due first or nil if no jobs are scheduled.
+func (d *Daemon) next() *job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var next *job
+	for _, j := range d.jobs {
+		if !j.due.IsZero() && (next == nil || j.due.Before(next.due)) {
+			next = j
+		}
+	}
+	return next
+}
+
+// schedule sets the next run time of j after t. d.mu must be held.
+func (d *Daemon) schedule(j *job, t time.Time) {
+	j.sched = nextRun(j.cfg, t.In(d.cfg.Location()))
+	j.due = j.sched
+	if !j.sched.IsZero() && j.cfg.Jitter > 0 {
+		j.due = j.sched.Add(d.jitter(time.Duration(j.cfg.Jitter)))
+	}
+	j.status.NextRun = j.due
+}
+
+// nextRun returns the first scheduled time of v after t that is inside one of
+// its maintenance windows, or the zero time if there isn't one.
+func nextRun(v *VolumeConfig, t time.Time) time.Time {
+	end := t.AddDate(maxCronYears, 0, 0)
+	for t = v.sched.Next(t); !t.IsZero() && t.Before(end); t = v.sched.Next(t) {
+		if v.inWindows(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// inWindows returns whether t is inside any of the maintenance windows of v or
+// v has no windows.
+func (v *VolumeConfig) inWindows(t time.Time) bool {
+	if len(v.Windows) == 0 {
+		return true
+	}
+	for _, w := range v.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// run performs one run of job j and updates its status.
+func (d *Daemon) run(ctx context.Context, j *job) {
+	start := d.clock.Now()
+	sc, removed, err := d.snapshot(ctx, j, start)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := &j.status
+	s.Runs++
+	s.LastRun = start
+	s.Removed += removed
+	if sc != nil {
+		s.LastShadow = sc.ID
+	}
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		d.logf("vssd: run for %#q failed: %v", s.Volume, err)
+		return
+	}
+	s.LastSuccess = start
+	s.LastError = ""
+	d.logf("vssd: created shadow copy %s of %#q (removed %d)", sc.ID, s.Volume, removed)
+}
+
+// snapshot creates a shadow copy for job j and applies its retention policy.
+func (d *Daemon) snapshot(ctx context.Context, j *job, now time.Time) (sc *vss.ShadowCopy, removed int, err error) {
+	vol := j.cfg.Volume
+	env := []string{"VSS_VOLUME=" + vol}
+	for _, cmd := range j.cfg.Hooks.Pre {
+		if err = d.hook(ctx, cmd, env); err != nil {
+			return nil, 0, fmt.Errorf("vssd: pre hook %q failed (%w)", cmd[0], err)
+		}
+	}
+	if sc, err = d.b.Create(ctx, vol); err != nil {
+		return nil, 0, err
+	}
+	d.mu.Lock()
+	j.status.Shadows = append(j.status.Shadows, sc.ID)
+	d.mu.Unlock()
+	env = append(env, "VSS_SHADOW_ID="+sc.ID.String(), "VSS_DEVICE_OBJECT="+sc.DeviceObject)
+	var errs []error
+	for _, cmd := range j.cfg.Hooks.Post {
+		if err = d.hook(ctx, cmd, env); err != nil {
+			errs = append(errs, fmt.Errorf("vssd: post hook %q failed (%w)", cmd[0], err))
+		}
+	}
+	if j.policy != nil {
+		removed, err = d.retain(ctx, j, now)
+		errs = append(errs, err)
+	}
+	return sc, removed, errors.Join(errs...)
+}
+
+// retain applies the retention policy of job j to the shadow copies of its
+// volume and returns the number of removed shadow copies. Unless the policy
+// applies to foreign shadow copies, only the ones created by the daemon are
+// considered.
+func (d *Daemon) retain(ctx context.Context, j *job, now time.Time) (int, error) {
+	all, err := d.b.List(ctx, j.cfg.Volume)
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	owned := slices.DeleteFunc(slices.Clone(j.status.Shadows), func(id vss.ShadowID) bool {
+		return !slices.ContainsFunc(all, func(sc *vss.ShadowCopy) bool { return sc.ID == id })
+	})
+	j.status.Shadows = owned
+	d.mu.Unlock()
+	if !j.cfg.Retention.Foreign {
+		all = slices.DeleteFunc(all, func(sc *vss.ShadowCopy) bool { return !slices.Contains(owned, sc.ID) })
+	}
+	ds, err := j.policy.Evaluate(all, now)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var errs []error
+	for _, dec := range ds {
+		if dec.Keep {
+			continue
+		}
+		if err = d.b.Remove(ctx, dec.ShadowCopy.ID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+		d.mu.Lock()
+		j.status.Shadows = slices.DeleteFunc(j.status.Shadows, func(id vss.ShadowID) bool {
+			return id == dec.ShadowCopy.ID
+		})
+		d.mu.Unlock()
+	}
+	return n, errors.Join(errs...)
+}
+
+// statusFile is the contents of the status file.
+type statusFile struct {
+	Updated time.Time `json:"updated"`
+	Volumes []Status  `json:"volumes"`
+}
+
+// loadStatus restores the IDs of the shadow copies created by the daemon from
+// the status file, if one exists.
+func (d *Daemon) loadStatus() error {
+	if d.cfg.Status == "" {
+		return nil
+	}
+	b, err := os.ReadFile(d.cfg.Status)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("vssd: failed to read status (%w)", err)
+	}
+	var sf statusFile
+	if err = json.Unmarshal(b, &sf); err != nil {
+		return fmt.Errorf("vssd: invalid status file %#q (%w)", d.cfg.Status, err)
+	}
+	for _, st := range sf.Volumes {
+		for _, j := range d.jobs {
+			if j.status.Volume == st.Volume {
+				j.status.Shadows = st.Shadows
+			}
+		}
+	}
+	return nil
+}
+
+// writeStatus atomically replaces the status file, if one is configured.
+func (d *Daemon) writeStatus() {
+	if d.cfg.Status == "" {
+		return
+	}
+	if err := writeStatus(d.cfg.Status, &statusFile{d.clock.Now(), d.Status()}); err != nil {
+		d.logf("%v", err)
+	}
+}
+
+// writeStatus writes s to the named file via a temporary file.
+func writeStatus(name string, s *statusFile) (err error) {
+	b, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return fmt.Errorf("vssd: failed to encode status (%w)", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("vssd: failed to write status (%w)", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+			err = fmt.Errorf("vssd: failed to write status (%w)", err)
+		}
+	}()
+	if _, err = f.Write(append(b, '\n')); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	return
+}
+
+// runHook runs a hook command with additional environment variables.
+func runHook(ctx context.Context, cmd, env []string) error {
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Env = append(os.Environ(), env...)
+	out, err := c.CombinedOutput()
+	if out = bytes.TrimSpace(out); err != nil && len(out) > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.ReplaceAll(string(out), "\n", " "))
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+package vssd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-vss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock that advances instantly whenever the daemon waits.
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	jump time.Duration // Added to the next wait, as if the system was suspended
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d + c.jump)
+	c.jump = 0
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// ToolBackend can be used when WMI is unavailable.
+var _ Backend = (*vss.ToolBackend)(nil)
+
+// fakeBackend is an in-memory Backend that records created shadow copies.
+type fakeBackend struct {
+	clock    *fakeClock
+	all      []fakeShadow
+	created  []string    // "vol@time" of each creation
+	fail     error       // Error returned by Create
+	onCreate func(n int) // Called after the n-th creation
+}
+
+// fakeShadow is a shadow copy of a volume.
+type fakeShadow struct {
+	vol string
+	sc  *vss.ShadowCopy
+}
+
+func (b *fakeBackend) Create(_ context.Context, vol string) (*vss.ShadowCopy, error) {
+	if b.fail != nil {
+		return nil, b.fail
+	}
+	now := b.clock.Now()
+	b.created = append(b.created, vol+"@"+now.Format("15:04"))
+	n := len(b.created)
+	id, err := vss.ParseShadowID(fmt.Sprintf("{00000000-0000-0000-0000-%012d}", n))
+	if err != nil {
+		return nil, err
+	}
+	sc := &vss.ShadowCopy{
+		ID:           id,
+		InstallDate:  now,
+		DeviceObject: fmt.Sprintf(`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy%d`, n),
+	}
+	b.all = append(b.all, fakeShadow{vol, sc})
+	if b.onCreate != nil {
+		b.onCreate(n)
+	}
+	return sc, nil
+}
+
+func (b *fakeBackend) List(_ context.Context, vol string) ([]*vss.ShadowCopy, error) {
+	var all []*vss.ShadowCopy
+	for _, s := range b.all {
+		if s.vol == vol {
+			all = append(all, s.sc)
+		}
+	}
+	return all, nil
+}
+
+func (b *fakeBackend) Remove(_ context.Context, id vss.ShadowID) error {
+	i := slices.IndexFunc(b.all, func(s fakeShadow) bool { return s.sc.ID == id })
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	b.all = slices.Delete(b.all, i, i+1)
+	return nil
+}
+
+// newTestDaemon returns a daemon for the JSON config starting at the specified
+// time. The returned context is canceled after the n-th shadow copy is created.
+func newTestDaemon(t *testing.T, config string, start time.Time, n int) (*Daemon, *fakeBackend, context.Context) {
+	t.Helper()
+	cfg, err := ParseConfig([]byte(config))
+	require.NoError(t, err)
+	clock := &fakeClock{now: start}
+	b := &fakeBackend{clock: clock}
+	d, err := New(cfg, b)
+	require.NoError(t, err)
+	d.clock = clock
+	d.jitter = func(n time.Duration) time.Duration { return n / 2 }
+	d.hook = func(context.Context, []string, []string) error { return nil }
+	d.logf = t.Logf
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	b.onCreate = func(i int) {
+		if i == n {
+			cancel()
+		}
+	}
+	return d, b, ctx
+}
+
+func TestDaemonRun(t *testing.T) {
+	d, b, ctx := newTestDaemon(t, `{
+		"timeZone": "UTC",
+		"volumes": [
+			{"volume": "C:\\", "schedule": "0 * * * *", "retention": {"last": 2}},
+			{"volume": "D:\\", "schedule": "30 2 * * *"}
+		]
+	}`, time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC), 4)
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	assert.Equal(t, []string{`C:\@01:00`, `C:\@02:00`, `D:\@02:30`, `C:\@03:00`}, b.created)
+
+	st := d.Status()
+	require.Len(t, st, 2)
+	assert.Equal(t, 3, st[0].Runs)
+	assert.Equal(t, 1, st[0].Removed)
+	assert.Equal(t, time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC), st[0].LastSuccess)
+	assert.Equal(t, time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC), st[0].NextRun)
+	assert.Equal(t, b.all[len(b.all)-1].sc.ID, st[0].LastShadow)
+	assert.Equal(t, 1, st[1].Runs)
+	assert.Equal(t, time.Date(2024, 1, 2, 2, 30, 0, 0, time.UTC), st[1].NextRun)
+	c, _ := b.List(ctx, `C:\`)
+	assert.Len(t, c, 2)
+}
+
+func TestDaemonRetentionForeign(t *testing.T) {
+	const config = `{
+		"timeZone": "UTC",
+		"volumes": [{"volume": "C:\\", "schedule": "0 * * * *", "retention": {"last": 1%s}}]
+	}`
+	start := time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC)
+	restore := fakeShadow{`C:\`, &vss.ShadowCopy{
+		ID:          mustParseID(t, "{10000000-0000-0000-0000-000000000001}"),
+		InstallDate: start.Add(-time.Hour),
+	}}
+
+	// Shadow copies created by other programs are kept
+	d, b, ctx := newTestDaemon(t, fmt.Sprintf(config, ""), start, 3)
+	b.all = append(b.all, restore)
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	c, _ := b.List(ctx, `C:\`)
+	assert.Equal(t, []*vss.ShadowCopy{restore.sc, b.all[1].sc}, c)
+	assert.Equal(t, []vss.ShadowID{b.all[1].sc.ID}, d.Status()[0].Shadows)
+	assert.Equal(t, 2, d.Status()[0].Removed)
+
+	// Unless the policy explicitly applies to them
+	d, b, ctx = newTestDaemon(t, fmt.Sprintf(config, `, "foreign": true`), start, 3)
+	b.all = append(b.all, restore)
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	c, _ = b.List(ctx, `C:\`)
+	require.Len(t, c, 1)
+	assert.NotEqual(t, restore.sc.ID, c[0].ID)
+}
+
+func TestDaemonJitter(t *testing.T) {
+	d, b, ctx := newTestDaemon(t, `{
+		"timeZone": "UTC",
+		"volumes": [{"volume": "C:\\", "schedule": "0 * * * *", "jitter": "10m"}]
+	}`, time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC), 2)
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	assert.Equal(t, []string{`C:\@01:05`, `C:\@02:05`}, b.created)
+}
+
+func TestDaemonWindows(t *testing.T) {
+	d, b, ctx := newTestDaemon(t, `{
+		"timeZone": "America/New_York",
+		"volumes": [{
+			"volume": "C:\\",
+			"schedule": "0 * * * *",
+			"windows": [{"days": "mon-fri", "start": "22:00", "end": "02:00"}]
+		}]
+	}`, time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC), 6) // Friday 7:00 EST
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	// Friday night, then Monday night; clock times are in UTC
+	assert.Equal(t, []string{
+		`C:\@03:00`, `C:\@04:00`, `C:\@05:00`, `C:\@06:00`, `C:\@03:00`, `C:\@04:00`,
+	}, b.created)
+	assert.Equal(t, time.Date(2024, 1, 9, 5, 0, 0, 0, time.UTC), d.Status()[0].NextRun.UTC())
+}
+
+func TestDaemonSuspend(t *testing.T) {
+	d, b, ctx := newTestDaemon(t, `{
+		"timeZone": "UTC",
+		"volumes": [{"volume": "C:\\", "schedule": "0 * * * *"}]
+	}`, time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC), 2)
+	d.clock.(*fakeClock).jump = 90 * time.Minute
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	// The 01:00 run is skipped after waking up at 02:30
+	assert.Equal(t, []string{`C:\@03:00`, `C:\@04:00`}, b.created)
+	assert.Equal(t, 2, d.Status()[0].Runs)
+
+	// Runs are not skipped when delayed by other runs
+	d, b, ctx = newTestDaemon(t, `{
+		"timeZone": "UTC",
+		"volumes": [
+			{"volume": "C:\\", "schedule": "0 1 * * *"},
+			{"volume": "D:\\", "schedule": "0 1 * * *"}
+		]
+	}`, time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC), 2)
+	cancel := b.onCreate
+	b.onCreate = func(n int) {
+		b.clock.mu.Lock()
+		b.clock.now = b.clock.now.Add(30 * time.Minute)
+		b.clock.mu.Unlock()
+		cancel(n)
+	}
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	assert.Equal(t, []string{`C:\@01:00`, `D:\@01:30`}, b.created)
+}
+
+func TestDaemonJitterWindow(t *testing.T) {
+	d, b, ctx := newTestDaemon(t, `{
+		"timeZone": "UTC",
+		"volumes": [{
+			"volume": "C:\\",
+			"schedule": "0,50 0 * * *",
+			"jitter": "20m",
+			"windows": [{"start": "00:00", "end": "01:00"}]
+		}]
+	}`, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 2)
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	// The 00:50 run is delayed to 01:00 and skipped
+	assert.Equal(t, []string{`C:\@00:10`, `C:\@00:10`}, b.created)
+	assert.Equal(t, 2, d.Status()[0].Runs)
+}
+
+func TestDaemonNoRuns(t *testing.T) {
+	d, _, ctx := newTestDaemon(t, `{
+		"volumes": [{"volume": "C:\\", "schedule": "0 0 30 2 *"}]
+	}`, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 1)
+	assert.ErrorContains(t, d.Run(ctx), "no runs")
+	assert.True(t, d.Status()[0].NextRun.IsZero())
+}
+
+func TestDaemonHooks(t *testing.T) {
+	d, b, ctx := newTestDaemon(t, `{
+		"timeZone": "UTC",
+		"volumes": [{
+			"volume": "C:\\",
+			"schedule": "0 * * * *",
+			"hooks": {"pre": [["pre"]], "post": [["post", "arg"]]}
+		}]
+	}`, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 2)
+	var calls []string
+	preErr := errors.New("exit status 1")
+	d.hook = func(_ context.Context, cmd, env []string) error {
+		calls = append(calls, strings.Join(cmd, " ")+": "+strings.Join(env, " "))
+		if cmd[0] == "pre" && len(calls) == 1 {
+			return preErr
+		}
+		return nil
+	}
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	assert.Equal(t, []string{
+		`pre: VSS_VOLUME=C:\`,
+		`pre: VSS_VOLUME=C:\`,
+		`post arg: VSS_VOLUME=C:\ VSS_SHADOW_ID={00000000-0000-0000-0000-000000000001} ` +
+			`VSS_DEVICE_OBJECT=\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`,
+		`pre: VSS_VOLUME=C:\`,
+		`post arg: VSS_VOLUME=C:\ VSS_SHADOW_ID={00000000-0000-0000-0000-000000000002} ` +
+			`VSS_DEVICE_OBJECT=\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy2`,
+	}, calls)
+	assert.Equal(t, []string{`C:\@02:00`, `C:\@03:00`}, b.created)
+	st := d.Status()[0]
+	assert.Equal(t, 3, st.Runs)
+	assert.Equal(t, 1, st.Failures)
+	assert.Empty(t, st.LastError)
+}
+
+func TestDaemonStatusShadows(t *testing.T) {
+	status := filepath.Join(t.TempDir(), "status.json")
+	cfg, err := json.Marshal(map[string]any{
+		"timeZone": "UTC",
+		"status":   status,
+		"volumes": []any{map[string]any{
+			"volume":    `C:\`,
+			"schedule":  "@hourly",
+			"retention": map[string]any{"last": 1},
+		}},
+	})
+	require.NoError(t, err)
+
+	// Shadow copies created by a previous daemon are restored
+	old := mustParseID(t, "{20000000-0000-0000-0000-000000000001}")
+	other := mustParseID(t, "{20000000-0000-0000-0000-000000000002}")
+	require.NoError(t, writeStatus(status, &statusFile{Volumes: []Status{
+		{Volume: `C:\`, Shadows: []vss.ShadowID{old}},
+		{Volume: `D:\`, Shadows: []vss.ShadowID{other}},
+	}}))
+	d, b, ctx := newTestDaemon(t, string(cfg), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 1)
+	assert.Equal(t, []vss.ShadowID{old}, d.Status()[0].Shadows)
+	b.all = []fakeShadow{
+		{`C:\`, &vss.ShadowCopy{ID: old}},
+		{`C:\`, &vss.ShadowCopy{ID: other}},
+	}
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+	c, _ := b.List(ctx, `C:\`)
+	require.Len(t, c, 2)
+	assert.Equal(t, other, c[0].ID)
+
+	var got statusFile
+	buf, err := os.ReadFile(status)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &got))
+	assert.Equal(t, []vss.ShadowID{c[1].ID}, got.Volumes[0].Shadows)
+
+	// Invalid status files are reported
+	require.NoError(t, os.WriteFile(status, []byte("{"), 0o600))
+	c2, err := ParseConfig(cfg)
+	require.NoError(t, err)
+	_, err = New(c2, b)
+	assert.ErrorContains(t, err, "invalid status file")
+}
+
+// mustParseID parses a shadow copy ID.
+func mustParseID(t *testing.T, s string) vss.ShadowID {
+	t.Helper()
+	id, err := vss.ParseShadowID(s)
+	require.NoError(t, err)
+	return id
+}
+
+func TestDaemonStatus(t *testing.T) {
+	dir := t.TempDir()
+	status := filepath.Join(dir, "status.json")
+	cfg, err := json.Marshal(map[string]any{
+		"timeZone": "UTC",
+		"status":   status,
+		"volumes":  []any{map[string]any{"volume": `C:\`, "schedule": "@hourly"}},
+	})
+	require.NoError(t, err)
+	d, b, ctx := newTestDaemon(t, string(cfg), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 1)
+	b.fail = errors.New("create failed")
+	failures := 0
+	d.logf = func(format string, v ...any) {
+		if failures++; failures == 2 {
+			b.fail = nil
+		}
+		t.Logf(format, v...)
+	}
+	require.ErrorIs(t, d.Run(ctx), context.Canceled)
+
+	var got statusFile
+	buf, err := os.ReadFile(status)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &got))
+	require.Len(t, got.Volumes, 1)
+	st := got.Volumes[0]
+	assert.Equal(t, 3, st.Runs)
+	assert.Equal(t, 2, st.Failures)
+	assert.Empty(t, st.LastError)
+	assert.Equal(t, time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC), st.NextRun)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,41 @@
+//go:build windows
+
+package vssd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mxk/go-vss"
+)
+
+// sysBackend is the Backend implemented by package vss functions.
+type sysBackend struct{}
+
+// System returns the Backend that uses the Windows shadow copy service.
+func System() Backend { return sysBackend{} }
+
+// Create implements Backend. The new shadow copy is removed if its properties
+// cannot be read, because it would never be added to the status and retention
+// would not remove it.
+func (sysBackend) Create(_ context.Context, vol string) (*vss.ShadowCopy, error) {
+	id, err := vss.Create(vol)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := vss.Get(id.String())
+	if err != nil {
+		return nil, errors.Join(err, vss.Remove(id.String()))
+	}
+	return sc, nil
+}
+
+// List implements Backend.
+func (sysBackend) List(_ context.Context, vol string) ([]*vss.ShadowCopy, error) {
+	return vss.List(vol)
+}
+
+// Remove implements Backend.
+func (sysBackend) Remove(_ context.Context, id vss.ShadowID) error {
+	return vss.Remove(id.String())
+}
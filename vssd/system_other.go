@@ -0,0 +1,37 @@
+//go:build !windows
+
+package vssd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mxk/go-vss"
+)
+
+// errUnsupported is returned by the System backend on platforms other than
+// Windows.
+var errUnsupported = fmt.Errorf("vssd: shadow copies are not supported on this platform (%w)",
+	errors.ErrUnsupported)
+
+// sysBackend is the Backend for platforms other than Windows.
+type sysBackend struct{}
+
+// System returns the Backend that uses the Windows shadow copy service.
+func System() Backend { return sysBackend{} }
+
+// Create implements Backend.
+func (sysBackend) Create(context.Context, string) (*vss.ShadowCopy, error) {
+	return nil, errUnsupported
+}
+
+// List implements Backend.
+func (sysBackend) List(context.Context, string) ([]*vss.ShadowCopy, error) {
+	return nil, errUnsupported
+}
+
+// Remove implements Backend.
+func (sysBackend) Remove(context.Context, vss.ShadowID) error {
+	return errUnsupported
+}
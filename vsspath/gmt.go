@@ -0,0 +1,62 @@
+package vsspath
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// gmtLayout is the time layout of @GMT tokens used by SMB clients to access
+// previous versions of files. See [MS-SMB2] 2.2.13.2.7.
+const gmtLayout = "@GMT-2006.01.02-15.04.05"
+
+// errInvalidGMT is returned by ParseGMT for invalid tokens.
+var errInvalidGMT = errors.New("vsspath: invalid @GMT token")
+
+// FormatGMT returns the @GMT token of t in UTC with second precision, such as
+// "@GMT-2024.01.31-13.45.00".
+func FormatGMT(t time.Time) string {
+	return t.UTC().Format(gmtLayout)
+}
+
+// ParseGMT parses an @GMT token and returns the time in UTC. The token must be
+// in the exact format returned by FormatGMT.
+func ParseGMT(tok string) (time.Time, error) {
+	if len(tok) != len(gmtLayout) {
+		return time.Time{}, errInvalidGMT
+	}
+	t, err := time.Parse(gmtLayout, tok)
+	if err != nil || FormatGMT(t) != tok {
+		return time.Time{}, errInvalidGMT
+	}
+	return t, nil
+}
+
+// IsGMT returns whether s is a valid @GMT token.
+func IsGMT(s string) bool {
+	_, err := ParseGMT(s)
+	return err == nil
+}
+
+// CutGMT finds the first component of path p that is a valid @GMT token and
+// returns the path before and after the token along with the token time. Both
+// '\' and '/' are accepted as separators. The separator preceding the token is
+// kept in before and the one following it is kept in after. If p does not
+// contain a token, ok is false.
+func CutGMT(p string) (before string, t time.Time, after string, ok bool) {
+	for i := 0; i < len(p); {
+		j := strings.IndexAny(p[i:], `\/`)
+		if j < 0 {
+			j = len(p)
+		} else {
+			j += i
+		}
+		if j-i == len(gmtLayout) {
+			if t, err := ParseGMT(p[i:j]); err == nil {
+				return p[:i], t, p[j:], true
+			}
+		}
+		i = j + 1
+	}
+	return p, time.Time{}, "", false
+}
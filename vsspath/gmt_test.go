@@ -0,0 +1,71 @@
+package vsspath
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGMT(t *testing.T) {
+	want := time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC)
+	local := want.Add(999 * time.Millisecond).In(time.FixedZone("EST", -5*3600))
+	assert.Equal(t, "@GMT-2024.01.31-13.45.06", FormatGMT(want))
+	assert.Equal(t, "@GMT-2024.01.31-13.45.06", FormatGMT(local))
+
+	got, err := ParseGMT("@GMT-2024.01.31-13.45.06")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, time.UTC, got.Location())
+	assert.True(t, IsGMT("@GMT-1999.12.31-23.59.59"))
+
+	for _, s := range []string{
+		"",
+		"@GMT-",
+		"@GMT-2024.01.31",
+		"@GMT-2024.01.31-13.45.06Z",
+		"@gmt-2024.01.31-13.45.06",
+		"@GMT 2024.01.31-13.45.06",
+		"@GMT-2024.1.31-13.45.006",
+		"@GMT-2024.13.31-13.45.06",
+		"@GMT-2023.02.29-13.45.06",
+		"@GMT-2024.01.31-24.00.00",
+		"@GMT-2024.01.31-13.45.60",
+		"@GMT-2024-01-31-13-45-06",
+		"@GMT-+024.01.31-13.45.06",
+	} {
+		_, err := ParseGMT(s)
+		assert.Error(t, err, s)
+		assert.False(t, IsGMT(s), s)
+	}
+}
+
+func TestCutGMT(t *testing.T) {
+	ts := time.Date(2024, 1, 31, 13, 45, 6, 0, time.UTC)
+	tests := []struct {
+		in            string
+		before, after string
+		ok            bool
+	}{
+		{`@GMT-2024.01.31-13.45.06`, ``, ``, true},
+		{`\@GMT-2024.01.31-13.45.06\`, `\`, `\`, true},
+		{`Data\@GMT-2024.01.31-13.45.06\a\b.txt`, `Data\`, `\a\b.txt`, true},
+		{`/share/@GMT-2024.01.31-13.45.06/a/b`, `/share/`, `/a/b`, true},
+		{`x\@GMT-2024.01.31-13.45.060\@GMT-2024.01.31-13.45.06`, `x\@GMT-2024.01.31-13.45.060\`, ``, true},
+		{`a\@GMT-2024.01.31-13.45.06x\b`, `a\@GMT-2024.01.31-13.45.06x\b`, ``, false},
+		{`a\x@GMT-2024.01.31-13.45.06\b`, `a\x@GMT-2024.01.31-13.45.06\b`, ``, false},
+		{``, ``, ``, false},
+	}
+	for _, tc := range tests {
+		before, got, after, ok := CutGMT(tc.in)
+		assert.Equal(t, tc.ok, ok, tc.in)
+		assert.Equal(t, tc.before, before, tc.in)
+		assert.Equal(t, tc.after, after, tc.in)
+		if ok {
+			assert.Equal(t, ts, got, tc.in)
+		} else {
+			assert.True(t, got.IsZero(), tc.in)
+		}
+	}
+}
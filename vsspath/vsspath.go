@@ -0,0 +1,169 @@
+// Package vsspath parses and formats shadow copy device paths, such as
+// `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Windows`. It does not access
+// the file system and works on all platforms.
+package vsspath
+
+import (
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNotShadowPath is returned by Parse when a path does not refer to a shadow
+// copy device.
+var ErrNotShadowPath = errors.New("vsspath: not a shadow copy path")
+
+// Form is the syntax of a shadow copy device path.
+type Form int
+
+const (
+	// GlobalRoot is the Win32 form of the NT device path, which is used by
+	// Win32_ShadowCopy.DeviceObject: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopyN`.
+	GlobalRoot Form = iota
+
+	// NT is the NT object manager path: `\Device\HarddiskVolumeShadowCopyN`.
+	NT
+
+	// Device is the Win32 device namespace path: `\\.\HarddiskVolumeShadowCopyN`.
+	Device
+)
+
+// device is the name of a shadow copy device without the index.
+const device = `HarddiskVolumeShadowCopy`
+
+// prefixes are the recognized path prefixes preceding the shadow copy index.
+var prefixes = [...]string{
+	`\\?\GLOBALROOT\Device\` + device,
+	`\\.\GLOBALROOT\Device\` + device,
+	`GLOBALROOT\Device\` + device,
+	`\Device\` + device,
+	`\\?\` + device,
+	`\\.\` + device,
+}
+
+// Path is a parsed shadow copy path.
+type Path struct {
+	// Index is the shadow copy device number, which is N in
+	// HarddiskVolumeShadowCopyN. It is always greater than zero.
+	Index uint32
+
+	// Rest is the path relative to the device starting with a separator,
+	// such as `\` for the root directory or `\Windows\System32`. It is empty
+	// if the path refers to the device itself.
+	Rest string
+}
+
+// Parse parses a shadow copy path in any of the supported forms. Prefixes are
+// matched case-insensitively and only '\' is accepted as a separator. Look-alike
+// device names, such as `HarddiskVolumeShadowCopyX` or
+// `HarddiskVolumeShadowCopy01`, are rejected. The part following the device
+// name is returned verbatim in Rest.
+func Parse(s string) (Path, error) {
+	for _, prefix := range prefixes {
+		if HasPrefixFold(s, prefix) {
+			return parseIndex(s[len(prefix):])
+		}
+	}
+	return Path{}, ErrNotShadowPath
+}
+
+// Is returns whether s is a valid shadow copy path.
+func Is(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+// parseIndex parses the device index followed by an optional path.
+func parseIndex(s string) (Path, error) {
+	n := 0
+	for n < len(s) && '0' <= s[n] && s[n] <= '9' {
+		n++
+	}
+	if n == 0 || s[0] == '0' || (n < len(s) && s[n] != '\\') {
+		return Path{}, ErrNotShadowPath
+	}
+	i, err := strconv.ParseUint(s[:n], 10, 32)
+	if err != nil {
+		return Path{}, ErrNotShadowPath
+	}
+	return Path{Index: uint32(i), Rest: s[n:]}, nil
+}
+
+// String returns p in the GlobalRoot form.
+func (p Path) String() string {
+	return p.Format(GlobalRoot)
+}
+
+// Format returns p in the specified form. It returns an empty string if p has
+// a zero Index or f is invalid.
+func (p Path) Format(f Form) string {
+	var prefix string
+	switch f {
+	case GlobalRoot:
+		prefix = `\\?\GLOBALROOT\Device\`
+	case NT:
+		prefix = `\Device\`
+	case Device:
+		prefix = `\\.\`
+	}
+	if p.Index == 0 || prefix == "" {
+		return ""
+	}
+	return prefix + device + strconv.FormatUint(uint64(p.Index), 10) + p.Rest
+}
+
+// Root returns the path of the root directory of the shadow copy.
+func (p Path) Root() Path {
+	return Path{Index: p.Index, Rest: `\`}
+}
+
+// Device returns the path of the shadow copy device.
+func (p Path) Device() Path {
+	return Path{Index: p.Index}
+}
+
+// Join appends the path elements to p and cleans the result. Both '\' and '/'
+// are accepted as separators in elem and the result uses '\'. The result never
+// refers to a location outside of the shadow copy, so ".." elements at the root
+// are dropped. If elem is empty, p is returned unchanged.
+func (p Path) Join(elem ...string) Path {
+	if len(elem) == 0 {
+		return p
+	}
+	all := make([]string, 0, 2+len(elem))
+	all = append(all, "/", ToSlash(p.Rest))
+	for _, e := range elem {
+		all = append(all, ToSlash(e))
+	}
+	p.Rest = strings.ReplaceAll(path.Join(all...), "/", `\`)
+	return p
+}
+
+// ToSlash converts '\' separators to '/'. Unlike filepath.ToSlash, it does so
+// on all platforms.
+func ToSlash(s string) string {
+	return strings.ReplaceAll(s, `\`, "/")
+}
+
+// HasPrefixFold tests whether s begins with an ASCII prefix ignoring ASCII
+// case. Unlike strings.EqualFold, non-ASCII characters in s never match.
+func HasPrefixFold(s, prefix string) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		if lower(s[i]) != lower(prefix[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// lower converts an ASCII upper-case letter to lower case.
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
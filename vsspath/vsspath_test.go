@@ -0,0 +1,154 @@
+package vsspath
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Path
+	}{
+		{`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`, Path{1, ``}},
+		{`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy42\`, Path{42, `\`}},
+		{`\\?\globalroot\device\harddiskvolumeshadowcopy42\Windows\System32`, Path{42, `\Windows\System32`}},
+		{`\\.\GLOBALROOT\Device\HarddiskVolumeShadowCopy7\x`, Path{7, `\x`}},
+		{`GLOBALROOT\Device\HarddiskVolumeShadowCopy7`, Path{7, ``}},
+		{`\Device\HarddiskVolumeShadowCopy3\`, Path{3, `\`}},
+		{`\\?\HarddiskVolumeShadowCopy9\a\\b`, Path{9, `\a\\b`}},
+		{`\\.\HARDDISKVOLUMESHADOWCOPY9`, Path{9, ``}},
+		{`\\.\HarddiskVolumeShadowCopy4294967295`, Path{4294967295, ``}},
+		{"\\Device\\HarddiskVolumeShadowCopy3\\\x00", Path{3, "\\\x00"}},
+	}
+	for _, tc := range tests {
+		p, err := Parse(tc.in)
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.want, p, tc.in)
+		assert.True(t, Is(tc.in), tc.in)
+	}
+}
+
+func TestParseLookAlikes(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`C:\Windows`,
+		`HarddiskVolumeShadowCopy1`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy\`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopyX`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1X`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1 `,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1/Windows`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy0`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy01`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy+1`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy-1`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy4294967296`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy99999999999999999999`,
+		"\\\\?\\GLOBALROOT\\Device\\HarddiskVolumeShadowCopy\uff11", // Fullwidth digit one
+		"\\Device\\Harddis\u212aVolumeShadowCopy1",                  // Kelvin sign
+		"\\Device\\HarddiskVolume\u017fhadowCopy1",                  // Long s
+		`\\?\GLOBALROOT\Device\HarddiskVolume1`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopies1`,
+		`\\?\GLOBALROOT\\Device\HarddiskVolumeShadowCopy1`,
+		`\\?\Device\HarddiskVolumeShadowCopy1`,
+		`\\?\GLOBALROOT\HarddiskVolumeShadowCopy1`,
+		`\\server\Device\HarddiskVolumeShadowCopy1`,
+		`/Device/HarddiskVolumeShadowCopy1`,
+		`\Device\HarddiskVolumeShadowCopy1X\`,
+	} {
+		_, err := Parse(s)
+		assert.ErrorIs(t, err, ErrNotShadowPath, s)
+		assert.False(t, Is(s), s)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	p := Path{Index: 12, Rest: `\Windows`}
+	assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy12\Windows`, p.String())
+	assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy12\Windows`, p.Format(GlobalRoot))
+	assert.Equal(t, `\Device\HarddiskVolumeShadowCopy12\Windows`, p.Format(NT))
+	assert.Equal(t, `\\.\HarddiskVolumeShadowCopy12\Windows`, p.Format(Device))
+	assert.Equal(t, "", p.Format(Device+1))
+	assert.Equal(t, "", p.Format(-1))
+	assert.Equal(t, "", Path{Rest: `\`}.String())
+	assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy12\`, p.Root().String())
+	assert.Equal(t, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy12`, p.Device().String())
+}
+
+func TestJoin(t *testing.T) {
+	p := Path{Index: 1}
+	tests := []struct {
+		p    Path
+		elem []string
+		want string
+	}{
+		{p, nil, ``},
+		{p, []string{""}, `\`},
+		{p, []string{"Windows"}, `\Windows`},
+		{p, []string{`\Windows\`, "System32/"}, `\Windows\System32`},
+		{p, []string{`Windows\..\..\..\Users`}, `\Users`},
+		{p, []string{"..", "x"}, `\x`},
+		{p, []string{`a\.\b//c`}, `\a\b\c`},
+		{Path{1, `\Users\x`}, []string{`..\y`}, `\Users\y`},
+		{Path{1, `\Users\x`}, nil, `\Users\x`},
+		{Path{1, `\Users\\x\`}, []string{"."}, `\Users\x`},
+	}
+	for _, tc := range tests {
+		got := tc.p.Join(tc.elem...)
+		assert.Equal(t, tc.p.Index, got.Index)
+		assert.Equal(t, tc.want, got.Rest, "%+v %q", tc.p, tc.elem)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{
+		``,
+		`C:\Windows`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy`,
+		`\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Windows`,
+		`\\?\globalroot\device\harddiskvolumeshadowcopy42`,
+		`GLOBALROOT\Device\HarddiskVolumeShadowCopy7`,
+		`\Device\HarddiskVolumeShadowCopy3\`,
+		`\\.\HarddiskVolumeShadowCopy4294967295\..`,
+		`\\?\HarddiskVolumeShadowCopy01`,
+		"\\Device\\HarddiskVolumeShadowCopy3\x00",
+		"\\\\?\\GLOBALROOT\xff",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := Parse(s)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrNotShadowPath)
+			assert.False(t, Is(s))
+			return
+		}
+		assert.True(t, Is(s))
+		assert.NotZero(t, p.Index)
+		assert.True(t, p.Rest == "" || p.Rest[0] == '\\', p.Rest)
+		assert.True(t, strings.HasSuffix(s, p.Rest))
+		for _, form := range []Form{GlobalRoot, NT, Device} {
+			q, err := Parse(p.Format(form))
+			require.NoError(t, err, form)
+			assert.Equal(t, p, q, form)
+		}
+		j := p.Join(s)
+		assert.Equal(t, p.Index, j.Index)
+		assert.True(t, strings.HasPrefix(j.Rest, `\`), j.Rest)
+		assert.NotContains(t, `\`+ToSlash(j.Rest)+`/`, "/../")
+		assert.Equal(t, j, j.Join("."))
+	})
+}
+
+func TestHasPrefixFold(t *testing.T) {
+	assert.True(t, HasPrefixFold(`\\?\VOLUME{x}`, `\\?\Volume{`))
+	assert.True(t, HasPrefixFold("abc", ""))
+	assert.False(t, HasPrefixFold("ab", "abc"))
+	assert.False(t, HasPrefixFold("\u212Aey", "key")) // Kelvin sign
+	assert.Equal(t, "C:/Windows/", ToSlash(`C:\Windows\`))
+}
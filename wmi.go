@@ -3,11 +3,11 @@
 package vss
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"runtime"
-	"strconv"
-	"time"
 	"unsafe"
 
 	"github.com/go-ole/go-ole"
@@ -32,6 +32,65 @@ func wmiExec(fn func(s *sWbemServices) error) error {
 	return fn(s)
 }
 
+// wmiBackend implements backend using WMI.
+type wmiBackend struct{}
+
+// sys is the backend used by package functions.
+var sys backend = wmiBackend{}
+
+// exec implements backend.
+func (wmiBackend) exec(ctx context.Context, fn func(c conn) error) error {
+	if !isAdmin() {
+		return errNotAdmin
+	}
+	return wmiExecContext(ctx, func(s *sWbemServices) error { return fn(s) })
+}
+
+// list implements conn.
+func (s *sWbemServices) list(vol string) ([]*ShadowCopy, error) {
+	var wql = scSelect
+	if vol != "" {
+		vol, err := volumeName(sysTopology, vol)
+		if err != nil {
+			return nil, err
+		}
+		wql = fmt.Sprintf(scSelect+" WHERE VolumeName=%q", vol)
+	}
+	var all []*ShadowCopy
+	err := s.execQuery(wql, func(v *ole.IDispatch) error {
+		sc, err := unpack(v)
+		if err == nil {
+			all = append(all, sc)
+		}
+		return err
+	})
+	return all, err
+}
+
+// remove implements conn.
+func (s *sWbemServices) remove(id ShadowID) error {
+	_, err := s.CallMethod("Delete", fmt.Sprintf("Win32_ShadowCopy.ID=%q", id))
+	if err != nil {
+		err = removeError(id, err)
+	}
+	return err
+}
+
+// create implements conn.
+func (s *sWbemServices) create(vol string) (*ShadowCopy, error) {
+	g, err := create(s, vol)
+	if err != nil {
+		return nil, err
+	}
+	id, err := ParseShadowID(g.String())
+	if err != nil {
+		return nil, err
+	}
+	return getNew(id, func(id ShadowID) (*ShadowCopy, error) {
+		return queryOne(s, fmt.Sprintf(scSelect+" WHERE ID=%q", id.String()), unpack)
+	}, s.remove)
+}
+
 // initCOM initializes the COM library.
 func initCOM() (err error) {
 	runtime.LockOSThread()
@@ -78,7 +137,7 @@ func connectServer() (*sWbemServices, error) {
 }
 
 // execQuery executes a WQL query and calls fn for each returned object.
-func (s *sWbemServices) execQuery(wql string, fn func(*ole.IDispatch) error) error {
+func (s *sWbemServices) execQuery(wql string, fn func(*ole.IDispatch) error) (err error) {
 	// https://learn.microsoft.com/en-us/windows/win32/api/wbemdisp/ne-wbemdisp-wbemflagenum
 	const (
 		wbemFlagForwardOnly       = 0x20
@@ -90,15 +149,16 @@ func (s *sWbemServices) execQuery(wql string, fn func(*ole.IDispatch) error) err
 	if err != nil {
 		return fmt.Errorf("vss: SWbemServices.ExecQuery failed (%w)", err)
 	}
-	defer mustClear(v)
-	return oleutil.ForEach(v.ToIDispatch(), func(v *ole.VARIANT) error {
-		defer mustClear(v)
+	defer clearVariant(v, &err)
+	return oleutil.ForEach(v.ToIDispatch(), func(v *ole.VARIANT) (err error) {
+		defer clearVariant(v, &err)
 		return fn(v.ToIDispatch())
 	})
 }
 
 // queryOne executes a query expecting to get exactly one object and returns the
-// result of calling fn on it.
+// result of calling fn on it. The error contains os.ErrNotExist if there is no
+// such object.
 func queryOne[T any](s *sWbemServices, wql string, fn func(v *ole.IDispatch) (T, error)) (T, error) {
 	var out T
 	var ok bool
@@ -111,103 +171,77 @@ func queryOne[T any](s *sWbemServices, wql string, fn func(v *ole.IDispatch) (T,
 		return
 	})
 	if err == nil && !ok {
-		err = fmt.Errorf("vss: not found: %s", wql)
+		err = fmt.Errorf("vss: not found: %s (%w)", wql, os.ErrNotExist)
 	}
 	return out, err
 }
 
 // getProp stores the value of the named property into v, which must be a
 // correctly typed pointer.
-func getProp(d *ole.IDispatch, name string, v any) error {
+func getProp(d *ole.IDispatch, name string, v any) (err error) {
 	vp, err := d.GetProperty(name)
 	if err != nil {
 		return err
 	}
-	defer mustClear(vp)
-	switch v := v.(type) {
-	case *string:
-		*v = vp.ToString()
-	case *time.Time:
-		*v, err = parseDateTime(vp.ToString())
-	default:
-		panic(fmt.Sprintf("vss: unsupported property type: %T", v))
-	}
-	return err
+	defer clearVariant(vp, &err)
+	return storeProp(vp.ToString(), v)
 }
 
 // tryGetProp tries to store the value of a possibly non-existent named property
 // into v, which must be a correctly typed pointer. It returns whether the
-// property exists and panics on any other error.
-func tryGetProp(d *ole.IDispatch, name string, v any) bool {
+// property exists. Errors other than a missing property are returned as-is.
+func tryGetProp(d *ole.IDispatch, name string, v any) (bool, error) {
 	if err := getProp(d, name, v); err != nil {
 		var e *ole.OleError
 		if errors.As(err, &e) && e.Code() == 0x80020006 { // DISP_E_UNKNOWNNAME
-			return false
+			return false, nil
 		}
-		panic(err)
+		return false, fmt.Errorf("vss: failed to get property %s (%w)", name, err)
 	}
-	return true
+	return true, nil
 }
 
 // getProps returns all properties of v in a map.
-func getProps(v *ole.IDispatch) (map[string]any, error) {
+func getProps(v *ole.IDispatch) (all map[string]any, err error) {
 	vps, err := v.GetProperty("Properties_")
 	if err != nil {
 		return nil, fmt.Errorf("vss: failed to get Properties_ (%w)", err)
 	}
-	defer mustClear(vps)
-	all := make(map[string]any)
-	err = oleutil.ForEach(vps.ToIDispatch(), func(vp *ole.VARIANT) error {
-		defer mustClear(vp)
+	defer clearVariant(vps, &err)
+	all = make(map[string]any)
+	err = oleutil.ForEach(vps.ToIDispatch(), func(vp *ole.VARIANT) (err error) {
+		defer clearVariant(vp, &err)
 		p := vp.ToIDispatch()
 		vname, err := p.GetProperty("Name")
 		if err != nil {
 			return fmt.Errorf("vss: failed to get Name property (%w)", err)
 		}
-		defer mustClear(vname)
+		defer clearVariant(vname, &err)
 		vval, err := p.GetProperty("Value")
 		if err != nil {
 			return fmt.Errorf("vss: failed to get Value property (%w)", err)
 		}
-		defer mustClear(vval)
+		defer clearVariant(vval, &err)
 		switch name := vname.ToString(); vval.VT {
 		case ole.VT_UNKNOWN, ole.VT_DISPATCH:
 			all[name] = vval.VT.String() // Objects will be invalid
 		default:
-			all[name] = vval.Value()
+			if vval.VT&ole.VT_ARRAY != 0 {
+				all[name] = vval.ToArray().ToValueArray()
+			} else {
+				all[name] = vval.Value()
+			}
 		}
 		return nil
 	})
 	return all, err
 }
 
-// parseDateTime converts a WMI datetime string (yyyymmddHHMMSS.mmmmmmsUUU) to
-// time.Time.
-func parseDateTime(dt string) (time.Time, error) {
-	// This logic is the same as creating an SWbemDateTime object, setting its
-	// Value property, and calling GetFileTime method, but much faster.
-	const sign = 21
-	if len(dt) != sign+4 || (dt[sign] != '-' && dt[sign] != '+') {
-		return time.Time{}, fmt.Errorf("vss: invalid datetime: %s", dt)
-	}
-	// https://learn.microsoft.com/en-us/windows/win32/wmisdk/swbemdatetime-utc
-	off, err := strconv.Atoi(dt[sign:])
-	if err != nil || off < -720 || 720 < off {
-		return time.Time{}, fmt.Errorf("vss: invalid datetime UTC offset: %s", dt)
-	}
-	// https://learn.microsoft.com/en-us/windows/win32/wmisdk/cim-datetime
-	tz := time.FixedZone("", off*60)
-	t, err := time.ParseInLocation("20060102150405.000000", dt[:sign], tz)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("vss: failed to parse datetime: %s (%w)", dt, err)
-	}
-	return t.Local(), nil
-}
-
-// mustClear panics if VariantClear returns an error. If v is a VT_UNKNOWN or
-// VT_DISPATCH, then this also releases the object.
-func mustClear(v *ole.VARIANT) {
-	if err := v.Clear(); err != nil {
-		panic(err)
+// clearVariant clears v and stores any VariantClear error in *err unless it
+// already contains an error. If v is a VT_UNKNOWN or VT_DISPATCH, then this
+// also releases the object.
+func clearVariant(v *ole.VARIANT, err *error) {
+	if e := v.Clear(); e != nil && *err == nil {
+		*err = fmt.Errorf("vss: VariantClear failed (%w)", e)
 	}
 }
@@ -37,9 +37,17 @@ func TestGetProp(t *testing.T) {
 		require.NoError(t, err)
 
 		var have time.Time
-		require.True(t, tryGetProp(sWbemDateTime, "Value", &have))
+		ok, err := tryGetProp(sWbemDateTime, "Value", &have)
+		require.NoError(t, err)
+		require.True(t, ok)
 		require.Equal(t, want, have.In(zone))
-		require.False(t, tryGetProp(sWbemDateTime, "Value1", &have))
+		ok, err = tryGetProp(sWbemDateTime, "Value1", &have)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		var unsupported int
+		_, err = tryGetProp(sWbemDateTime, "Value", &unsupported)
+		require.Error(t, err)
 		return nil
 	})
 	require.NoError(t, err)
@@ -54,16 +62,9 @@ func TestGetProps(t *testing.T) {
 		require.NoError(t, err)
 		delete(props, "Name")
 		require.Equal(t, map[string]any{"DNSHostName": want}, props)
+		_, err = queryOne(s, wql+` WHERE DNSHostName=""`, getProps)
+		require.ErrorIs(t, err, os.ErrNotExist)
 		return nil
 	})
 	require.NoError(t, err)
 }
-
-func TestParseDateTime(t *testing.T) {
-	zone := time.FixedZone("", -300*60)
-	want := time.Date(2023, 12, 13, 01, 22, 50, 108_124_000, zone)
-	v, err := parseDateTime("20231213012250.108124-300")
-	require.NoError(t, err)
-	require.Equal(t, want, v.In(zone))
-	require.Equal(t, want.Local(), v)
-}
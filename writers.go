@@ -0,0 +1,209 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// WriterState is the state of a VSS writer. See:
+//
+// https://learn.microsoft.com/en-us/windows/win32/api/vss/ne-vss-vss_writer_state
+type WriterState int32
+
+const (
+	WriterUnknown                  WriterState = 0  // VSS_WS_UNKNOWN
+	WriterStable                   WriterState = 1  // VSS_WS_STABLE
+	WriterWaitingForFreeze         WriterState = 2  // VSS_WS_WAITING_FOR_FREEZE
+	WriterWaitingForThaw           WriterState = 3  // VSS_WS_WAITING_FOR_THAW
+	WriterWaitingForPostSnapshot   WriterState = 4  // VSS_WS_WAITING_FOR_POST_SNAPSHOT
+	WriterWaitingForBackupComplete WriterState = 5  // VSS_WS_WAITING_FOR_BACKUP_COMPLETE
+	WriterFailedAtIdentify         WriterState = 6  // VSS_WS_FAILED_AT_IDENTIFY
+	WriterFailedAtPrepareBackup    WriterState = 7  // VSS_WS_FAILED_AT_PREPARE_BACKUP
+	WriterFailedAtPrepareSnapshot  WriterState = 8  // VSS_WS_FAILED_AT_PREPARE_SNAPSHOT
+	WriterFailedAtFreeze           WriterState = 9  // VSS_WS_FAILED_AT_FREEZE
+	WriterFailedAtThaw             WriterState = 10 // VSS_WS_FAILED_AT_THAW
+	WriterFailedAtPostSnapshot     WriterState = 11 // VSS_WS_FAILED_AT_POST_SNAPSHOT
+	WriterFailedAtBackupComplete   WriterState = 12 // VSS_WS_FAILED_AT_BACKUP_COMPLETE
+	WriterFailedAtPreRestore       WriterState = 13 // VSS_WS_FAILED_AT_PRE_RESTORE
+	WriterFailedAtPostRestore      WriterState = 14 // VSS_WS_FAILED_AT_POST_RESTORE
+	WriterFailedAtBackupShutdown   WriterState = 15 // VSS_WS_FAILED_AT_BACKUPSHUTDOWN
+)
+
+// String returns the state description used by vssadmin.
+func (s WriterState) String() string {
+	switch s {
+	case WriterUnknown:
+		return "Unknown"
+	case WriterStable:
+		return "Stable"
+	case WriterWaitingForFreeze:
+		return "Waiting for freeze"
+	case WriterWaitingForThaw:
+		return "Waiting for thaw"
+	case WriterWaitingForPostSnapshot:
+		return "Waiting for post snapshot"
+	case WriterWaitingForBackupComplete:
+		return "Waiting for backup complete"
+	case WriterFailedAtIdentify:
+		return "Failed at identify"
+	case WriterFailedAtPrepareBackup:
+		return "Failed at prepare backup"
+	case WriterFailedAtPrepareSnapshot:
+		return "Failed at prepare snapshot"
+	case WriterFailedAtFreeze:
+		return "Failed at freeze"
+	case WriterFailedAtThaw:
+		return "Failed at thaw"
+	case WriterFailedAtPostSnapshot:
+		return "Failed at post snapshot"
+	case WriterFailedAtBackupComplete:
+		return "Failed at backup complete"
+	case WriterFailedAtPreRestore:
+		return "Failed at pre restore"
+	case WriterFailedAtPostRestore:
+		return "Failed at post restore"
+	case WriterFailedAtBackupShutdown:
+		return "Failed at backup shutdown"
+	}
+	return fmt.Sprintf("WriterState(%d)", int32(s))
+}
+
+// Failed returns whether s is one of the failed states.
+func (s WriterState) Failed() bool {
+	return WriterFailedAtIdentify <= s && s <= WriterFailedAtBackupShutdown
+}
+
+// WriterStatus is the status of a VSS writer.
+type WriterStatus struct {
+	Name       string
+	WriterID   string
+	InstanceID string
+	State      WriterState
+	Failure    HRESULT // Last failure reported by the writer, or 0
+}
+
+// Failed returns whether the writer is in a failed state or reported a
+// failure.
+func (w *WriterStatus) Failed() bool {
+	return w.State.Failed() || w.Failure.Failed()
+}
+
+// Err returns the writer's failure as an error or nil if the writer did not
+// fail.
+func (w *WriterStatus) Err() error {
+	if !w.Failed() {
+		return nil
+	}
+	if w.Failure.Failed() {
+		return fmt.Errorf("vss: writer %s: %v (%w)", w.Name, w.State, w.Failure)
+	}
+	return fmt.Errorf("vss: writer %s: %v", w.Name, w.State)
+}
+
+// matches returns whether the writer is identified by name or ID sel.
+func (w *WriterStatus) matches(sel string) bool {
+	return strings.EqualFold(w.Name, sel) || guidEqual(w.WriterID, sel) ||
+		guidEqual(w.InstanceID, sel)
+}
+
+// WriterError is returned when one or more writers fail during shadow copy
+// creation.
+type WriterError struct {
+	Writers []WriterStatus // Failed writers
+}
+
+// Error implements the error interface.
+func (e *WriterError) Error() string {
+	var b strings.Builder
+	b.WriteString("vss: writer failure: ")
+	for i := range e.Writers {
+		w := &e.Writers[i]
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(w.Name)
+		b.WriteString(" (")
+		b.WriteString(w.State.String())
+		if w.Failure.Failed() {
+			b.WriteString(": ")
+			b.WriteString(w.Failure.Error())
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// Unwrap returns the failures reported by the writers.
+func (e *WriterError) Unwrap() []error {
+	var all []error
+	for _, w := range e.Writers {
+		if w.Failure.Failed() {
+			all = append(all, w.Failure)
+		}
+	}
+	return all
+}
+
+// Writers returns the status of all writers on the system using the native VSS
+// API.
+func Writers(ctx context.Context) ([]WriterStatus, error) {
+	bc, err := newBackupComponents()
+	if err != nil {
+		return nil, err
+	}
+	defer bc.Release()
+	return writers(ctx, bc)
+}
+
+// writers implements Writers.
+func writers(ctx context.Context, bc backupComponents) ([]WriterStatus, error) {
+	bt, _ := BackupCopy.vss()
+	if _, err := initBackup(ctx, bc, vssCtxBackup, bt, false); err != nil {
+		return nil, err
+	}
+	return bc.GatherWriterStatus(ctx)
+}
+
+// checkWriters returns a WriterError if any writer selected by sel is in a
+// failed state. If sel is empty, all writers are selected. Writers are
+// selected by name or writer/instance ID. It returns an error containing
+// os.ErrNotExist if any selector does not match a writer.
+func checkWriters(all []WriterStatus, sel []string) error {
+	var unmatched []string
+	for _, s := range sel {
+		if !slices.ContainsFunc(all, func(w WriterStatus) bool { return w.matches(s) }) {
+			unmatched = append(unmatched, fmt.Sprintf("%#q", s))
+		}
+	}
+	if len(unmatched) > 0 {
+		return fmt.Errorf("vss: writers not found: %s (%w)", strings.Join(unmatched, ", "), os.ErrNotExist)
+	}
+	var failed []WriterStatus
+	for _, w := range all {
+		if !w.Failed() {
+			continue
+		}
+		if len(sel) == 0 {
+			failed = append(failed, w)
+			continue
+		}
+		for _, s := range sel {
+			if w.matches(s) {
+				failed = append(failed, w)
+				break
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &WriterError{Writers: failed}
+}
+
+// errNoWriters is returned when writer failures are checked for a shadow copy
+// context that does not involve writers.
+var errNoWriters = errors.New("vss: shadow copy context does not involve writers")
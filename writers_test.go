@@ -0,0 +1,144 @@
+package vss
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterState(t *testing.T) {
+	assert.Equal(t, "Stable", WriterStable.String())
+	assert.Equal(t, "Failed at freeze", WriterFailedAtFreeze.String())
+	assert.Equal(t, "WriterState(16)", WriterState(16).String())
+	for s := WriterUnknown; s <= WriterWaitingForBackupComplete; s++ {
+		assert.False(t, s.Failed(), s)
+	}
+	for s := WriterFailedAtIdentify; s <= WriterFailedAtBackupShutdown; s++ {
+		assert.True(t, s.Failed(), s)
+	}
+	assert.False(t, WriterState(16).Failed())
+	assert.False(t, WriterState(-1).Failed())
+}
+
+var testWriters = []WriterStatus{{
+	Name:       "System Writer",
+	WriterID:   "{E8132975-6F93-4464-A53E-1050253AE220}",
+	InstanceID: "{9E1CF4DB-3F5D-4C4C-9C2A-6B47B0A7E7A1}",
+	State:      WriterStable,
+}, {
+	Name:       "SqlServerWriter",
+	WriterID:   "{A65FAA63-5EA8-4EBC-9DBD-A0C4DB26912A}",
+	InstanceID: "{AA8AD2D0-2C2B-4CC0-AB0E-FB0F0D1E8B0D}",
+	State:      WriterFailedAtFreeze,
+	Failure:    0x800423F4, // VSS_E_WRITERERROR_NONRETRYABLE
+}, {
+	Name:       "Registry Writer",
+	WriterID:   "{AFBAB4A2-367D-4D15-A586-71DBB18F8485}",
+	InstanceID: "{1C4E3B4A-2F27-4F0A-8A42-3B6F2D1C9E55}",
+	State:      WriterFailedAtPrepareSnapshot,
+}}
+
+func TestCheckWriters(t *testing.T) {
+	assert.NoError(t, checkWriters(testWriters[:1], nil))
+	assert.NoError(t, checkWriters(testWriters, []string{"System Writer"}))
+
+	err := checkWriters(testWriters, nil)
+	var we *WriterError
+	require.ErrorAs(t, err, &we)
+	require.Len(t, we.Writers, 2)
+	assert.Equal(t, "vss: writer failure: SqlServerWriter (Failed at freeze: "+
+		HRESULT(0x800423F4).Error()+"), Registry Writer (Failed at prepare snapshot)", err.Error())
+	assert.ErrorIs(t, err, HRESULT(0x800423F4))
+
+	for _, sel := range []string{
+		"sqlserverwriter",
+		"a65faa63-5ea8-4ebc-9dbd-a0c4db26912a",
+		"{AA8AD2D0-2C2B-4CC0-AB0E-FB0F0D1E8B0D}",
+	} {
+		err = checkWriters(testWriters, []string{"System Writer", sel})
+		require.ErrorAs(t, err, &we, sel)
+		require.Len(t, we.Writers, 1)
+		assert.Equal(t, "SqlServerWriter", we.Writers[0].Name)
+	}
+
+	err = checkWriters(testWriters, []string{"Missing", "sqlserverwriter", "{}", ""})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.EqualError(t, err, "vss: writers not found: `Missing`, `{}`, `` (file does not exist)")
+	assert.False(t, errors.As(err, &we))
+}
+
+func TestWriterStatusErr(t *testing.T) {
+	assert.NoError(t, testWriters[0].Err())
+	err := testWriters[1].Err()
+	assert.ErrorIs(t, err, HRESULT(0x800423F4))
+	assert.ErrorContains(t, err, "SqlServerWriter: Failed at freeze")
+	assert.EqualError(t, testWriters[2].Err(), "vss: writer Registry Writer: Failed at prepare snapshot")
+
+	w := WriterStatus{Name: "X", State: WriterStable, Failure: 0x80042302}
+	assert.True(t, w.Failed())
+	assert.Error(t, w.Err())
+}
+
+func TestWriters(t *testing.T) {
+	f := &fakeComponents{ws: testWriters}
+	all, err := writers(context.Background(), f)
+	require.NoError(t, err)
+	assert.Equal(t, testWriters, all)
+	assert.Equal(t, []string{
+		"InitializeForBackup",
+		"SetContext",
+		"SetBackupState",
+		"GatherWriterMetadata",
+		"GatherWriterStatus",
+	}, f.calls)
+	assert.Equal(t, int32(vssCtxBackup), f.attr)
+
+	f = &fakeComponents{fail: []string{"GatherWriterStatus"}}
+	_, err = writers(context.Background(), f)
+	assert.ErrorIs(t, err, HRESULT(0x80042302))
+}
+
+func TestSnapshotSetWriterFailure(t *testing.T) {
+	// Writer status is not checked by default
+	f := &fakeComponents{ws: testWriters}
+	_, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, nil)
+	require.NoError(t, err)
+	assert.NotContains(t, f.calls, "GatherWriterStatus")
+
+	// Failed writers delete the set
+	f = &fakeComponents{ws: testWriters}
+	opts := &SetOptions{FailOnWriterError: true}
+	all, err := (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	var we *WriterError
+	require.ErrorAs(t, err, &we)
+	assert.Nil(t, all)
+	assert.Len(t, we.Writers, 2)
+	assert.Equal(t, []string{"DoSnapshotSet", "GatherWriterStatus", "DeleteSnapshotSet"},
+		f.calls[len(f.calls)-3:])
+
+	// Only selected writers are checked
+	f = &fakeComponents{ws: testWriters}
+	opts.Writers = []string{"System Writer"}
+	all, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+	assert.Contains(t, f.calls, "GatherWriterStatus")
+	assert.Equal(t, "BackupComplete", f.calls[len(f.calls)-1])
+
+	// Status gathering failure
+	f = &fakeComponents{fail: []string{"GatherWriterStatus"}}
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"}, opts)
+	require.ErrorIs(t, err, HRESULT(0x80042302))
+	assert.Equal(t, "DeleteSnapshotSet", f.calls[len(f.calls)-1])
+
+	// Contexts without writers are rejected
+	f = new(fakeComponents)
+	_, err = (&snapshotSet{bc: f}).create(context.Background(), []string{"C:"},
+		&SetOptions{Context: ContextClientAccessible, FailOnWriterError: true})
+	require.True(t, errors.Is(err, errNoWriters))
+	assert.Empty(t, f.calls)
+}